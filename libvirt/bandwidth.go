@@ -0,0 +1,253 @@
+package libvirt
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	libvirt "github.com/libvirt/libvirt-go"
+	"github.com/libvirt/libvirt-go-xml"
+)
+
+// bandwidthSchema returns the schema of the QoS limits of the traffic of a
+// network or a network interface. Only the inbound traffic of interfaces
+// can have a guaranteed floor.
+func bandwidthSchema(floor bool) *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"inbound":  bandwidthParamsSchema(floor),
+				"outbound": bandwidthParamsSchema(false),
+			},
+		},
+	}
+}
+
+// bandwidthParamsSchema returns the schema of the limits of the traffic in
+// one direction: rates are in KiB/s and bursts in KiB
+func bandwidthParamsSchema(floor bool) *schema.Schema {
+	params := map[string]*schema.Schema{
+		"average": {
+			Type:         schema.TypeInt,
+			Optional:     true,
+			ValidateFunc: validateBandwidthValue,
+		},
+		"peak": {
+			Type:         schema.TypeInt,
+			Optional:     true,
+			ValidateFunc: validateBandwidthValue,
+		},
+		"burst": {
+			Type:         schema.TypeInt,
+			Optional:     true,
+			ValidateFunc: validateBandwidthValue,
+		},
+	}
+	if floor {
+		params["floor"] = &schema.Schema{
+			Type:         schema.TypeInt,
+			Optional:     true,
+			ValidateFunc: validateBandwidthValue,
+		}
+	}
+
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: params,
+		},
+	}
+}
+
+func validateBandwidthValue(v interface{}, k string) ([]string, []error) {
+	if value := v.(int); value < 0 {
+		return nil, []error{fmt.Errorf("%q can't be negative, got %d", k, value)}
+	}
+	return nil, nil
+}
+
+// getBandwidthValueFromResource returns a limit of the traffic, or nil
+// when it is not set
+func getBandwidthValueFromResource(d *schema.ResourceData, key string) *int {
+	if value, ok := d.GetOk(key); ok {
+		v := value.(int)
+		return &v
+	}
+	return nil
+}
+
+// uintBandwidthValue converts an optional limit of the traffic of an
+// interface to one of a network
+func uintBandwidthValue(value *int) *uint {
+	if value == nil {
+		return nil
+	}
+	v := uint(*value)
+	return &v
+}
+
+// intBandwidthValue converts an optional limit of the traffic of a network
+// to one of an interface
+func intBandwidthValue(value *uint) *int {
+	if value == nil {
+		return nil
+	}
+	v := int(*value)
+	return &v
+}
+
+// getDomainInterfaceBandwidthParamsFromResource returns the limits of the
+// traffic in one direction, if any
+func getDomainInterfaceBandwidthParamsFromResource(d *schema.ResourceData, prefix string) *libvirtxml.DomainInterfaceBandwidthParams {
+	if d.Get(prefix+".#").(int) == 0 {
+		return nil
+	}
+	return &libvirtxml.DomainInterfaceBandwidthParams{
+		Average: getBandwidthValueFromResource(d, prefix+".0.average"),
+		Peak:    getBandwidthValueFromResource(d, prefix+".0.peak"),
+		Burst:   getBandwidthValueFromResource(d, prefix+".0.burst"),
+		Floor:   getBandwidthValueFromResource(d, prefix+".0.floor"),
+	}
+}
+
+// getDomainInterfaceBandwidthFromResource returns the QoS limits of a
+// network interface, if any
+func getDomainInterfaceBandwidthFromResource(d *schema.ResourceData, prefix string) *libvirtxml.DomainInterfaceBandwidth {
+	if d.Get(prefix+".bandwidth.#").(int) == 0 {
+		return nil
+	}
+	return &libvirtxml.DomainInterfaceBandwidth{
+		Inbound:  getDomainInterfaceBandwidthParamsFromResource(d, prefix+".bandwidth.0.inbound"),
+		Outbound: getDomainInterfaceBandwidthParamsFromResource(d, prefix+".bandwidth.0.outbound"),
+	}
+}
+
+// getNetworkBandwidthParamsFromResource returns the limits of the traffic of
+// a network in one direction, if any
+func getNetworkBandwidthParamsFromResource(d *schema.ResourceData, prefix string) *libvirtxml.NetworkBandwidthParams {
+	if d.Get(prefix+".#").(int) == 0 {
+		return nil
+	}
+	return &libvirtxml.NetworkBandwidthParams{
+		Average: uintBandwidthValue(getBandwidthValueFromResource(d, prefix+".0.average")),
+		Peak:    uintBandwidthValue(getBandwidthValueFromResource(d, prefix+".0.peak")),
+		Burst:   uintBandwidthValue(getBandwidthValueFromResource(d, prefix+".0.burst")),
+	}
+}
+
+// getNetworkBandwidthFromResource returns the QoS limits of a network, if any
+func getNetworkBandwidthFromResource(d *schema.ResourceData) *libvirtxml.NetworkBandwidth {
+	if d.Get("bandwidth.#").(int) == 0 {
+		return nil
+	}
+	return &libvirtxml.NetworkBandwidth{
+		Inbound:  getNetworkBandwidthParamsFromResource(d, "bandwidth.0.inbound"),
+		Outbound: getNetworkBandwidthParamsFromResource(d, "bandwidth.0.outbound"),
+	}
+}
+
+// flattenBandwidthParams returns the block with the limits of the traffic
+// in one direction
+func flattenBandwidthParams(average, peak, burst, floor *int, withFloor bool) []map[string]interface{} {
+	value := func(v *int) int {
+		if v == nil {
+			return 0
+		}
+		return *v
+	}
+	params := map[string]interface{}{
+		"average": value(average),
+		"peak":    value(peak),
+		"burst":   value(burst),
+	}
+	if withFloor {
+		params["floor"] = value(floor)
+	}
+	return []map[string]interface{}{params}
+}
+
+// flattenDomainInterfaceBandwidth returns the bandwidth block of a network
+// interface
+func flattenDomainInterfaceBandwidth(bandwidth *libvirtxml.DomainInterfaceBandwidth) []map[string]interface{} {
+	if bandwidth == nil || (bandwidth.Inbound == nil && bandwidth.Outbound == nil) {
+		return []map[string]interface{}{}
+	}
+	result := map[string]interface{}{
+		"inbound":  []map[string]interface{}{},
+		"outbound": []map[string]interface{}{},
+	}
+	if in := bandwidth.Inbound; in != nil {
+		result["inbound"] = flattenBandwidthParams(in.Average, in.Peak, in.Burst, in.Floor, true)
+	}
+	if out := bandwidth.Outbound; out != nil {
+		result["outbound"] = flattenBandwidthParams(out.Average, out.Peak, out.Burst, nil, false)
+	}
+	return []map[string]interface{}{result}
+}
+
+// flattenNetworkBandwidth returns the bandwidth block of a network
+func flattenNetworkBandwidth(bandwidth *libvirtxml.NetworkBandwidth) []map[string]interface{} {
+	if bandwidth == nil || (bandwidth.Inbound == nil && bandwidth.Outbound == nil) {
+		return []map[string]interface{}{}
+	}
+	result := map[string]interface{}{
+		"inbound":  []map[string]interface{}{},
+		"outbound": []map[string]interface{}{},
+	}
+	if in := bandwidth.Inbound; in != nil {
+		result["inbound"] = flattenBandwidthParams(intBandwidthValue(in.Average), intBandwidthValue(in.Peak), intBandwidthValue(in.Burst), nil, false)
+	}
+	if out := bandwidth.Outbound; out != nil {
+		result["outbound"] = flattenBandwidthParams(intBandwidthValue(out.Average), intBandwidthValue(out.Peak), intBandwidthValue(out.Burst), nil, false)
+	}
+	return []map[string]interface{}{result}
+}
+
+// newDomainInterfaceParameters returns the parameters changing the QoS
+// limits of a network interface from the current ones to the new ones.
+// libvirt removes the limits set to zero. The floor is only given when it
+// is, or was, set, as libvirt refuses it for interfaces not connected to a
+// network.
+func newDomainInterfaceParameters(current, bandwidth *libvirtxml.DomainInterfaceBandwidth) *libvirt.DomainInterfaceParameters {
+	value := func(v *int) uint {
+		if v == nil {
+			return 0
+		}
+		return uint(*v)
+	}
+
+	var in, out libvirtxml.DomainInterfaceBandwidthParams
+	if bandwidth != nil && bandwidth.Inbound != nil {
+		in = *bandwidth.Inbound
+	}
+	if bandwidth != nil && bandwidth.Outbound != nil {
+		out = *bandwidth.Outbound
+	}
+
+	params := &libvirt.DomainInterfaceParameters{
+		BandwidthInAverageSet:  true,
+		BandwidthInAverage:     value(in.Average),
+		BandwidthInPeakSet:     true,
+		BandwidthInPeak:        value(in.Peak),
+		BandwidthInBurstSet:    true,
+		BandwidthInBurst:       value(in.Burst),
+		BandwidthOutAverageSet: true,
+		BandwidthOutAverage:    value(out.Average),
+		BandwidthOutPeakSet:    true,
+		BandwidthOutPeak:       value(out.Peak),
+		BandwidthOutBurstSet:   true,
+		BandwidthOutBurst:      value(out.Burst),
+	}
+
+	hadFloor := current != nil && current.Inbound != nil && value(current.Inbound.Floor) > 0
+	if hadFloor || value(in.Floor) > 0 {
+		params.BandwidthInFloorSet = true
+		params.BandwidthInFloor = value(in.Floor)
+	}
+
+	return params
+}
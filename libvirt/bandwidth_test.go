@@ -0,0 +1,157 @@
+package libvirt
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	libvirt "github.com/libvirt/libvirt-go"
+	"github.com/libvirt/libvirt-go-xml"
+)
+
+func TestGetDomainInterfaceBandwidthFromResource(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibvirtDomain().Schema, map[string]interface{}{
+		"name": "throttled",
+		"network_interface": []interface{}{
+			map[string]interface{}{
+				"network_name": "default",
+			},
+			map[string]interface{}{
+				"network_name": "default",
+				"bandwidth": []interface{}{
+					map[string]interface{}{
+						"inbound": []interface{}{
+							map[string]interface{}{
+								"average": 1000,
+								"peak":    5000,
+								"burst":   1024,
+								"floor":   200,
+							},
+						},
+						"outbound": []interface{}{
+							map[string]interface{}{
+								"average": 128,
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	if bandwidth := getDomainInterfaceBandwidthFromResource(d, "network_interface.0"); bandwidth != nil {
+		t.Errorf("Expected no bandwidth, got %+v", bandwidth)
+	}
+
+	bandwidth := getDomainInterfaceBandwidthFromResource(d, "network_interface.1")
+	if bandwidth == nil || bandwidth.Inbound == nil || bandwidth.Outbound == nil {
+		t.Fatalf("Expected inbound and outbound bandwidth, got %+v", bandwidth)
+	}
+	if *bandwidth.Inbound.Average != 1000 || *bandwidth.Inbound.Peak != 5000 ||
+		*bandwidth.Inbound.Burst != 1024 || *bandwidth.Inbound.Floor != 200 {
+		t.Errorf("Unexpected inbound bandwidth: %+v", bandwidth.Inbound)
+	}
+	if *bandwidth.Outbound.Average != 128 || bandwidth.Outbound.Peak != nil ||
+		bandwidth.Outbound.Burst != nil || bandwidth.Outbound.Floor != nil {
+		t.Errorf("Unexpected outbound bandwidth: %+v", bandwidth.Outbound)
+	}
+
+	expected := []map[string]interface{}{
+		{
+			"inbound": []map[string]interface{}{
+				{"average": 1000, "peak": 5000, "burst": 1024, "floor": 200},
+			},
+			"outbound": []map[string]interface{}{
+				{"average": 128, "peak": 0, "burst": 0},
+			},
+		},
+	}
+	if flattened := flattenDomainInterfaceBandwidth(bandwidth); !reflect.DeepEqual(flattened, expected) {
+		t.Errorf("Expected %v, got %v", expected, flattened)
+	}
+}
+
+func TestGetNetworkBandwidthFromResource(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibvirtNetwork().Schema, map[string]interface{}{
+		"name": "throttled",
+		"bandwidth": []interface{}{
+			map[string]interface{}{
+				"outbound": []interface{}{
+					map[string]interface{}{
+						"average": 2048,
+						"burst":   4096,
+					},
+				},
+			},
+		},
+	})
+
+	bandwidth := getNetworkBandwidthFromResource(d)
+	if bandwidth == nil || bandwidth.Inbound != nil || bandwidth.Outbound == nil {
+		t.Fatalf("Expected only outbound bandwidth, got %+v", bandwidth)
+	}
+	if *bandwidth.Outbound.Average != 2048 || bandwidth.Outbound.Peak != nil || *bandwidth.Outbound.Burst != 4096 {
+		t.Errorf("Unexpected outbound bandwidth: %+v", bandwidth.Outbound)
+	}
+
+	data, err := xmlMarshallIndented(libvirtxml.Network{Name: "throttled", Bandwidth: bandwidth})
+	if err != nil {
+		t.Fatal(err)
+	}
+	networkDef, err := newDefNetworkFromXML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []map[string]interface{}{
+		{
+			"inbound": []map[string]interface{}{},
+			"outbound": []map[string]interface{}{
+				{"average": 2048, "peak": 0, "burst": 4096},
+			},
+		},
+	}
+	if flattened := flattenNetworkBandwidth(networkDef.Bandwidth); !reflect.DeepEqual(flattened, expected) {
+		t.Errorf("Expected %v, got %v", expected, flattened)
+	}
+	if flattened := flattenNetworkBandwidth(nil); len(flattened) != 0 {
+		t.Errorf("Expected no bandwidth, got %v", flattened)
+	}
+}
+
+func TestNewDomainInterfaceParameters(t *testing.T) {
+	average := 1000
+	floor := 200
+	withFloor := &libvirtxml.DomainInterfaceBandwidth{
+		Inbound: &libvirtxml.DomainInterfaceBandwidthParams{Average: &average, Floor: &floor},
+	}
+	withoutFloor := &libvirtxml.DomainInterfaceBandwidth{
+		Outbound: &libvirtxml.DomainInterfaceBandwidthParams{Average: &average},
+	}
+
+	// removing all the limits
+	params := newDomainInterfaceParameters(withoutFloor, nil)
+	expected := &libvirt.DomainInterfaceParameters{
+		BandwidthInAverageSet:  true,
+		BandwidthInPeakSet:     true,
+		BandwidthInBurstSet:    true,
+		BandwidthOutAverageSet: true,
+		BandwidthOutPeakSet:    true,
+		BandwidthOutBurstSet:   true,
+	}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, params)
+	}
+
+	// setting a floor
+	params = newDomainInterfaceParameters(withoutFloor, withFloor)
+	if !params.BandwidthInFloorSet || params.BandwidthInFloor != 200 || params.BandwidthInAverage != 1000 || params.BandwidthOutAverage != 0 {
+		t.Errorf("Unexpected parameters: %+v", params)
+	}
+
+	// removing the floor
+	params = newDomainInterfaceParameters(withFloor, withoutFloor)
+	if !params.BandwidthInFloorSet || params.BandwidthInFloor != 0 || params.BandwidthOutAverage != 1000 {
+		t.Errorf("Unexpected parameters: %+v", params)
+	}
+}
@@ -1,13 +1,13 @@
 package libvirt
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -16,20 +16,40 @@ import (
 	"github.com/mitchellh/packer/common/uuid"
 )
 
+// cloud-init datasources the disk can be laid out for
+const (
+	cloudInitDataSourceNoCloud     = "nocloud"
+	cloudInitDataSourceConfigDrive = "configdrive"
+)
+
+// NoCloud layout, see
+// http://cloudinit.readthedocs.io/en/latest/topics/datasources/nocloud.html
+const noCloudVolumeID string = "cidata"
 const userDataFileName string = "user-data"
 const metaDataFileName string = "meta-data"
 const networkConfigFileName string = "network-config"
+const vendorDataFileName string = "vendor-data"
+
+// OpenStack config drive layout, see
+// http://cloudinit.readthedocs.io/en/latest/topics/datasources/configdrive.html
+const configDriveVolumeID string = "config-2"
+const configDriveUserDataFileName string = "openstack/latest/user_data"
+const configDriveMetaDataFileName string = "openstack/latest/meta_data.json"
+const configDriveNetworkDataFileName string = "openstack/latest/network_data.json"
+const configDriveVendorDataFileName string = "openstack/latest/vendor_data.json"
 
 type defCloudInit struct {
 	Name          string
 	PoolName      string
+	DataSource    string `yaml:"datasource"`
 	MetaData      string `yaml:"meta_data"`
 	UserData      string `yaml:"user_data"`
 	NetworkConfig string `yaml:"network_config"`
+	VendorData    string `yaml:"vendor_data"`
 }
 
 func newCloudInitDef() defCloudInit {
-	return defCloudInit{}
+	return defCloudInit{DataSource: cloudInitDataSourceNoCloud}
 }
 
 // Create a ISO file based on the contents of the CloudInit instance and
@@ -134,59 +154,83 @@ func getCloudInitVolumeKeyFromTerraformID(id string) (string, error) {
 // Returns a string with the full path to the ISO file
 func (ci *defCloudInit) createISO() (string, error) {
 	log.Print("Creating new ISO")
-	tmpDir, err := ci.createFiles()
+	volumeID, files, err := ci.isoFiles()
 	if err != nil {
 		return "", err
 	}
 
-	isoDestination := filepath.Join(tmpDir, ci.Name)
-	cmd := exec.Command(
-		"mkisofs",
-		"-output",
-		isoDestination,
-		"-volid",
-		"cidata",
-		"-joliet",
-		"-rock",
-		filepath.Join(tmpDir, userDataFileName),
-		filepath.Join(tmpDir, metaDataFileName),
-		filepath.Join(tmpDir, networkConfigFileName))
-
-	log.Printf("About to execute cmd: %+v", cmd)
-	if err = cmd.Run(); err != nil {
-		return "", fmt.Errorf("Error while starting the creation of CloudInit's ISO image: %s", err)
-	}
-	log.Printf("ISO created at %s", isoDestination)
-
-	return isoDestination, nil
-}
-
-// write user-data,  meta-data network-config in tmp files and dedicated directory
-// Returns a string containing the name of the temporary directory and an error
-// object
-func (ci *defCloudInit) createFiles() (string, error) {
-	log.Print("Creating ISO contents")
 	tmpDir, err := ioutil.TempDir("", "cloudinit")
 	if err != nil {
 		return "", fmt.Errorf("Cannot create tmp directory for cloudinit ISO generation: %s",
 			err)
 	}
-	// user-data
-	if err = ioutil.WriteFile(filepath.Join(tmpDir, userDataFileName), []byte(ci.UserData), os.ModePerm); err != nil {
-		return "", fmt.Errorf("Error while writing user-data to file: %s", err)
-	}
-	// meta-data
-	if err = ioutil.WriteFile(filepath.Join(tmpDir, metaDataFileName), []byte(ci.MetaData), os.ModePerm); err != nil {
-		return "", fmt.Errorf("Error while writing meta-data to file: %s", err)
+
+	isoDestination := filepath.Join(tmpDir, ci.Name)
+	iso, err := os.Create(isoDestination)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return "", fmt.Errorf("Cannot create CloudInit's ISO image: %s", err)
 	}
-	// network-config
-	if err = ioutil.WriteFile(filepath.Join(tmpDir, networkConfigFileName), []byte(ci.NetworkConfig), os.ModePerm); err != nil {
-		return "", fmt.Errorf("Error while writing network-config to file: %s", err)
+	defer iso.Close()
+
+	err = writeISO9660(iso, volumeID, files)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return "", fmt.Errorf("Error while writing CloudInit's ISO image: %s", err)
 	}
+	log.Printf("ISO created at %s", isoDestination)
 
-	log.Print("ISO contents created")
+	return isoDestination, nil
+}
+
+// isoFiles returns the volume id and the files of the ISO image for the
+// datasource of the disk
+func (ci *defCloudInit) isoFiles() (string, []isoFile, error) {
+	switch ci.DataSource {
+	case cloudInitDataSourceNoCloud:
+		files := []isoFile{
+			{Name: userDataFileName, Data: []byte(ci.UserData)},
+			{Name: metaDataFileName, Data: []byte(ci.MetaData)},
+			{Name: networkConfigFileName, Data: []byte(ci.NetworkConfig)},
+		}
+		if ci.VendorData != "" {
+			files = append(files, isoFile{Name: vendorDataFileName, Data: []byte(ci.VendorData)})
+		}
+		return noCloudVolumeID, files, nil
 
-	return tmpDir, nil
+	case cloudInitDataSourceConfigDrive:
+		// cloud-init takes the instance id from the mandatory uuid key
+		var metaData map[string]interface{}
+		if err := json.Unmarshal([]byte(ci.MetaData), &metaData); err != nil {
+			return "", nil, fmt.Errorf("meta_data of a '%s' cloud-init disk must be a JSON object: %s", ci.DataSource, err)
+		}
+		if _, ok := metaData["uuid"]; !ok {
+			return "", nil, fmt.Errorf("meta_data of a '%s' cloud-init disk must have a 'uuid' key", ci.DataSource)
+		}
+		files := []isoFile{
+			{Name: configDriveUserDataFileName, Data: []byte(ci.UserData)},
+			{Name: configDriveMetaDataFileName, Data: []byte(ci.MetaData)},
+		}
+		if ci.NetworkConfig != "" {
+			var networkData map[string]interface{}
+			if err := json.Unmarshal([]byte(ci.NetworkConfig), &networkData); err != nil {
+				return "", nil, fmt.Errorf("network_config of a '%s' cloud-init disk must be an OpenStack network_data JSON object: %s", ci.DataSource, err)
+			}
+			files = append(files, isoFile{Name: configDriveNetworkDataFileName, Data: []byte(ci.NetworkConfig)})
+		}
+		if ci.VendorData != "" {
+			// cloud-init only honours the "cloud-init" key of vendor_data.json
+			vendorData, err := json.Marshal(map[string]string{"cloud-init": ci.VendorData})
+			if err != nil {
+				return "", nil, fmt.Errorf("Error serializing vendor_data: %s", err)
+			}
+			files = append(files, isoFile{Name: configDriveVendorDataFileName, Data: vendorData})
+		}
+		return configDriveVolumeID, files, nil
+	}
+
+	return "", nil, fmt.Errorf("Unsupported cloud-init datasource '%s': it can be '%s' or '%s'",
+		ci.DataSource, cloudInitDataSourceNoCloud, cloudInitDataSourceConfigDrive)
 }
 
 // Creates a new defCloudInit object starting from a ISO volume handled by
@@ -231,13 +275,15 @@ func newCloudInitDefFromRemoteISO(virConn *libvirt.Connect, id string) (defCloud
 	return ci, nil
 }
 
-// setCloudInitDataFromExistingCloudInitDisk read and set UserData, MetaData, and NetworkConfig from existing CloudInitDisk
+// setCloudInitDataFromExistingCloudInitDisk read and set the DataSource,
+// UserData, MetaData, NetworkConfig and VendorData from existing CloudInitDisk
 func (ci *defCloudInit) setCloudInitDataFromExistingCloudInitDisk(virConn *libvirt.Connect, volume *libvirt.StorageVol, isoFile *os.File) error {
 	isoReader, err := iso9660.NewReader(isoFile)
 	if err != nil {
 		return fmt.Errorf("Error initializing ISO reader: %s", err)
 	}
 
+	ci.DataSource = cloudInitDataSourceNoCloud
 	for {
 		file, err := isoReader.Next()
 		if err == io.EOF {
@@ -247,26 +293,69 @@ func (ci *defCloudInit) setCloudInitDataFromExistingCloudInitDisk(virConn *libvi
 		if err != nil {
 			return err
 		}
+		if file.IsDir() {
+			continue
+		}
 		dataBytes, err := readIso9660File(file)
 		if err != nil {
 			return err
 		}
-		// the following filenames need to be like this because in the ios9660 reader
-		// joliet is not supported. https://github.com/hooklift/iso9660/blob/master/README.md#not-supported
-		if file.Name() == "/user_dat." {
+		switch file.Name() {
+		case isoReaderName(userDataFileName):
 			ci.UserData = fmt.Sprintf("%s", dataBytes)
-		}
-		if file.Name() == "/meta_dat." {
+		case isoReaderName(metaDataFileName):
 			ci.MetaData = fmt.Sprintf("%s", dataBytes)
-		}
-		if file.Name() == "/network_." {
+		case isoReaderName(networkConfigFileName):
 			ci.NetworkConfig = fmt.Sprintf("%s", dataBytes)
+		case isoReaderName(vendorDataFileName):
+			ci.VendorData = fmt.Sprintf("%s", dataBytes)
+		case isoReaderName(configDriveUserDataFileName):
+			ci.DataSource = cloudInitDataSourceConfigDrive
+			ci.UserData = fmt.Sprintf("%s", dataBytes)
+		case isoReaderName(configDriveMetaDataFileName):
+			ci.DataSource = cloudInitDataSourceConfigDrive
+			ci.MetaData = fmt.Sprintf("%s", dataBytes)
+		case isoReaderName(configDriveNetworkDataFileName):
+			ci.DataSource = cloudInitDataSourceConfigDrive
+			ci.NetworkConfig = fmt.Sprintf("%s", dataBytes)
+		case isoReaderName(configDriveVendorDataFileName):
+			ci.DataSource = cloudInitDataSourceConfigDrive
+			ci.VendorData = configDriveVendorData(dataBytes)
 		}
 	}
 	log.Printf("[DEBUG]: Read cloud-init from file: %+v", ci)
 	return nil
 }
 
+// configDriveVendorData returns the cloud-init vendor data held in a config
+// drive vendor_data.json, or the whole file when it doesn't follow the format
+// written by isoFiles
+func configDriveVendorData(data []byte) string {
+	var vendorData map[string]interface{}
+	if err := json.Unmarshal(data, &vendorData); err == nil {
+		if cloudInit, ok := vendorData["cloud-init"].(string); ok {
+			return cloudInit
+		}
+	}
+	return string(data)
+}
+
+// isoReaderName returns the name the iso9660 reader gives to a file written
+// by writeISO9660 (eg. "/user_dat." for "user-data"): joliet and rock ridge
+// are not supported by the reader, so it returns the lowercased primary names.
+// https://github.com/hooklift/iso9660/blob/master/README.md#not-supported
+func isoReaderName(name string) string {
+	components := strings.Split(name, "/")
+	for i, component := range components {
+		if i == len(components)-1 {
+			components[i] = strings.Split(isoPrimaryName(component), ";")[0]
+		} else {
+			components[i] = isoPrimaryDirName(component)
+		}
+	}
+	return "/" + strings.ToLower(strings.Join(components, "/"))
+}
+
 // setCloudInitPoolNameFromExistingVol retrieve poolname from an existing CloudInitDisk
 func (ci *defCloudInit) setCloudInitPoolNameFromExistingVol(volume *libvirt.StorageVol) error {
 	volPool, err := volume.LookupPoolByVolume()
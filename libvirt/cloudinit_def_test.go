@@ -2,7 +2,6 @@ package libvirt
 
 import (
 	"os"
-	"path/filepath"
 	"testing"
 )
 
@@ -22,47 +21,112 @@ func TestCloudInitTerraformKeyOps(t *testing.T) {
 	}
 }
 
-func TestCloudInitCreateFiles(t *testing.T) {
+func TestCloudInitCreateISONoExternalTool(t *testing.T) {
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+
+	os.Setenv("PATH", "/")
+
 	ci := newCloudInitDef()
+	ci.Name = "test.iso"
+	ci.UserData = "#cloud-config\nhostname: test\n"
+	ci.MetaData = "instance-id: test\n"
+	ci.NetworkConfig = "version: 2\n"
+	ci.VendorData = "#cloud-config\npackages: [vim]\n"
+
+	testCloudInitISORoundTrip(t, ci)
+}
 
-	dir, err := ci.createFiles()
+func TestCloudInitCreateConfigDriveISO(t *testing.T) {
+	ci := newCloudInitDef()
+	ci.Name = "test.iso"
+	ci.DataSource = cloudInitDataSourceConfigDrive
+	ci.UserData = "#cloud-config\nhostname: test\n"
+	ci.MetaData = `{"uuid": "test", "hostname": "test"}`
+	ci.NetworkConfig = `{"links": [], "networks": [], "services": []}`
+	ci.VendorData = "#cloud-config\npackages: [vim]\n"
+
+	testCloudInitISORoundTrip(t, ci)
+
+	volumeID, files, err := ci.isoFiles()
 	if err != nil {
-		t.Errorf("Unexpected error %v", err)
+		t.Fatal(err)
+	}
+	if volumeID != "config-2" {
+		t.Errorf("Expected volume id config-2, got %s", volumeID)
 	}
-	defer os.RemoveAll(dir)
-	for _, file := range []string{"user-data", "meta-data", "network-config"} {
-		check, err := exists(filepath.Join(dir, file))
-		if !check {
-			t.Errorf("%s not found: %v", file, err)
+	for _, file := range files {
+		if file.Name == configDriveVendorDataFileName {
+			expected := `{"cloud-init":"#cloud-config\npackages: [vim]\n"}`
+			if string(file.Data) != expected {
+				t.Errorf("Expected vendor_data.json %s, got %s", expected, file.Data)
+			}
 		}
 	}
 }
 
-func TestCloudInitCreateISONoExternalTool(t *testing.T) {
-	path := os.Getenv("PATH")
-	defer os.Setenv("PATH", path)
-
-	os.Setenv("PATH", "/")
+func TestCloudInitConfigDriveInvalidData(t *testing.T) {
+	testCases := []struct {
+		metaData      string
+		networkConfig string
+	}{
+		{"", ""},
+		{"instance-id: test", ""},
+		{`{"hostname": "test"}`, ""},
+		{`{"uuid": "test"}`, "version: 2"},
+	}
+	for _, tc := range testCases {
+		ci := newCloudInitDef()
+		ci.DataSource = cloudInitDataSourceConfigDrive
+		ci.MetaData = tc.metaData
+		ci.NetworkConfig = tc.networkConfig
+		if _, _, err := ci.isoFiles(); err == nil {
+			t.Errorf("Expected an error for meta_data '%s' and network_config '%s'", tc.metaData, tc.networkConfig)
+		}
+	}
 
 	ci := newCloudInitDef()
+	ci.DataSource = "ec2"
+	if _, _, err := ci.isoFiles(); err == nil {
+		t.Errorf("Expected an error for an unsupported datasource")
+	}
+}
 
+func TestIsoReaderName(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{userDataFileName, "/user_dat."},
+		{networkConfigFileName, "/network_."},
+		{configDriveMetaDataFileName, "/openstac/latest/meta_dat.jso"},
+	}
+	for _, tc := range testCases {
+		if r := isoReaderName(tc.name); r != tc.expected {
+			t.Errorf("%s: got=%s expected=%s", tc.name, r, tc.expected)
+		}
+	}
+}
+
+func testCloudInitISORoundTrip(t *testing.T, ci defCloudInit) {
 	iso, err := ci.createISO()
-	if err == nil {
-		t.Errorf("Expected error")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
 	}
+	defer removeTmpIsoDirectory(iso)
 
-	if iso != "" {
-		t.Errorf("Expected iso to be empty")
+	isoFile, err := os.Open(iso)
+	if err != nil {
+		t.Fatal(err)
 	}
-}
+	defer isoFile.Close()
 
-func exists(path string) (bool, error) {
-	_, err := os.Stat(path)
-	if err == nil {
-		return true, nil
+	read := newCloudInitDef()
+	read.Name = ci.Name
+	if err := read.setCloudInitDataFromExistingCloudInitDisk(nil, nil, isoFile); err != nil {
+		t.Fatalf("Unexpected error reading the ISO: %v", err)
 	}
-	if os.IsNotExist(err) {
-		return false, nil
+	if read != ci {
+		t.Errorf("Expected %+v, got %+v", ci, read)
 	}
-	return true, err
 }
@@ -1,14 +1,37 @@
 package libvirt
 
 import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
 	"github.com/hashicorp/terraform/helper/mutexkv"
 	libvirt "github.com/libvirt/libvirt-go"
-	"log"
+)
+
+// host key verification modes for SSH connections
+const (
+	knownHostsVerifyNormal = "normal"
+	knownHostsVerifyIgnore = "ignore"
 )
 
 // Config struct for the libvirt-provider
 type Config struct {
 	URI string
+
+	// used to build the URI when it is not given
+	Host             string
+	User             string
+	Port             int
+	KeyFile          string
+	KnownHostsVerify string
+	Socket           string
+
+	// how long to wait for the connection, zero means forever
+	Timeout time.Duration
 }
 
 // Client libvirt
@@ -17,11 +40,116 @@ type Client struct {
 	poolMutexKV *mutexkv.MutexKV
 }
 
+// Validate checks the provider configuration, so errors are reported before
+// trying to connect to libvirt
+func (c *Config) Validate() error {
+	if c.URI != "" {
+		if c.Host != "" || c.User != "" || c.Port != 0 || c.KeyFile != "" || c.KnownHostsVerify != "" || c.Socket != "" {
+			return fmt.Errorf("'host', 'user', 'port', 'keyfile', 'known_hosts_verify' and 'socket' can't be used together with 'uri': " +
+				"either set the full connection URI or let the provider build it from these arguments")
+		}
+		if _, err := url.Parse(c.URI); err != nil {
+			return fmt.Errorf("'uri' is not a valid libvirt connection URI: %s", err)
+		}
+		return nil
+	}
+
+	if c.Host == "" {
+		return fmt.Errorf("No libvirt host to connect to: set either 'uri' (or the LIBVIRT_DEFAULT_URI environment variable) or 'host'")
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("'port' must be between 1 and 65535, got %d", c.Port)
+	}
+	if c.KeyFile != "" {
+		f, err := os.Open(c.KeyFile)
+		if err != nil {
+			return fmt.Errorf("'keyfile' can't be read: %s", err)
+		}
+		f.Close()
+	}
+	switch c.KnownHostsVerify {
+	case "", knownHostsVerifyNormal, knownHostsVerifyIgnore:
+	default:
+		return fmt.Errorf("'known_hosts_verify' can be '%s' (the host key must be in the known_hosts file) or '%s', got '%s'",
+			knownHostsVerifyNormal, knownHostsVerifyIgnore, c.KnownHostsVerify)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("'timeout' can't be negative")
+	}
+
+	return nil
+}
+
+// ConnectionURI returns the libvirt URI to connect to, building a qemu+ssh
+// one from the SSH arguments when no URI was given
+func (c *Config) ConnectionURI() string {
+	if c.URI != "" {
+		return c.URI
+	}
+
+	host := c.Host
+	if c.Port != 0 {
+		host = host + ":" + strconv.Itoa(c.Port)
+	}
+
+	uri := url.URL{
+		Scheme: "qemu+ssh",
+		Host:   host,
+		Path:   "/system",
+	}
+	if c.User != "" {
+		uri.User = url.User(c.User)
+	}
+
+	query := url.Values{}
+	if c.KeyFile != "" {
+		query.Set("keyfile", c.KeyFile)
+	}
+	if c.KnownHostsVerify == knownHostsVerifyIgnore {
+		query.Set("no_verify", "1")
+	}
+	if c.Socket != "" {
+		query.Set("socket", c.Socket)
+	}
+	uri.RawQuery = query.Encode()
+
+	return uri.String()
+}
+
 // Client libvirt, generate libvirt client given URI
 func (c *Config) Client() (*Client, error) {
-	libvirtClient, err := libvirt.NewConnect(c.URI)
-	if err != nil {
-		return nil, err
+	uri := c.ConnectionURI()
+
+	type connectResult struct {
+		conn *libvirt.Connect
+		err  error
+	}
+	result := make(chan connectResult, 1)
+	go func() {
+		conn, err := libvirt.NewConnect(uri)
+		result <- connectResult{conn, err}
+	}()
+
+	var timeout <-chan time.Time
+	if c.Timeout > 0 {
+		timeout = time.After(c.Timeout)
+	}
+
+	var libvirtClient *libvirt.Connect
+	select {
+	case r := <-result:
+		if r.err != nil {
+			return nil, r.err
+		}
+		libvirtClient = r.conn
+	case <-timeout:
+		// don't leak the connection if it is established after giving up
+		go func() {
+			if r := <-result; r.err == nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("Timeout after %s connecting to libvirt at '%s'", c.Timeout, uri)
 	}
 	log.Println("[INFO] Created libvirt client")
 
@@ -0,0 +1,68 @@
+package libvirt
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestConfigConnectionURI(t *testing.T) {
+	testCases := []struct {
+		config   Config
+		expected string
+	}{
+		{Config{URI: "qemu:///system"}, "qemu:///system"},
+		{Config{Host: "kvm.example.com"}, "qemu+ssh://kvm.example.com/system"},
+		{Config{Host: "kvm.example.com", User: "root", Port: 2222}, "qemu+ssh://root@kvm.example.com:2222/system"},
+		{
+			Config{
+				Host:             "kvm.example.com",
+				KeyFile:          "/home/ci/.ssh/id_rsa",
+				KnownHostsVerify: knownHostsVerifyIgnore,
+				Socket:           "/var/run/libvirt/libvirt-sock",
+			},
+			"qemu+ssh://kvm.example.com/system?keyfile=%2Fhome%2Fci%2F.ssh%2Fid_rsa&no_verify=1&socket=%2Fvar%2Frun%2Flibvirt%2Flibvirt-sock",
+		},
+		{Config{Host: "kvm.example.com", KnownHostsVerify: knownHostsVerifyNormal}, "qemu+ssh://kvm.example.com/system"},
+	}
+	for _, tc := range testCases {
+		if uri := tc.config.ConnectionURI(); uri != tc.expected {
+			t.Errorf("got=%s expected=%s", uri, tc.expected)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	keyFile, err := ioutil.TempFile("", "terraform-provider-libvirt-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile.Close()
+	defer os.Remove(keyFile.Name())
+
+	valid := []Config{
+		{URI: "qemu:///system"},
+		{Host: "kvm.example.com"},
+		{Host: "kvm.example.com", User: "root", Port: 22, KeyFile: keyFile.Name(), KnownHostsVerify: knownHostsVerifyIgnore},
+	}
+	for _, config := range valid {
+		if err := config.Validate(); err != nil {
+			t.Errorf("unexpected error for %+v: %s", config, err)
+		}
+	}
+
+	invalid := []Config{
+		{},
+		{URI: "qemu:///system", Host: "kvm.example.com"},
+		{URI: "qemu:///system", KeyFile: keyFile.Name()},
+		{Host: "kvm.example.com", Port: 70000},
+		{Host: "kvm.example.com", KeyFile: "/does/not/exist"},
+		{Host: "kvm.example.com", KnownHostsVerify: "sometimes"},
+		{Host: "kvm.example.com", Timeout: -1},
+	}
+	for _, config := range invalid {
+		if err := config.Validate(); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
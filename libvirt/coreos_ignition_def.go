@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -14,16 +13,48 @@ import (
 	"github.com/mitchellh/packer/common/uuid"
 )
 
+// ways to deliver the Ignition config to a domain
+const (
+	// file given to qemu's firmware configuration device, x86 only
+	ignitionDeliveryFwCfg = "fw_cfg"
+	// OpenStack config drive, a "config-2" ISO holding the config as user_data
+	ignitionDeliveryConfigDrive = "configdrive"
+	// raw virtio disk with the "ignition" serial, for s390x, ppc64 and aarch64
+	ignitionDeliveryVirtio = "virtio"
+	// fw_cfg or virtio, chosen by each domain from its architecture
+	ignitionDeliveryAuto = ""
+)
+
+// the serial of the virtio disk holding the Ignition config, Ignition looks
+// for /dev/disk/by-id/virtio-ignition
+const ignitionDiskSerial = "ignition"
+
 type defIgnition struct {
 	Name     string
 	PoolName string
 	Content  string
+	Delivery string
+	// when set, older configs are translated to this spec version
+	SpecVersion string
+}
+
+// ignitionDeliveryForArch returns the way of delivering the Ignition config
+// to domains of the architecture `arch` when it isn't given: fw_cfg is only
+// reliable on x86
+func ignitionDeliveryForArch(arch string) string {
+	switch arch {
+	case "x86_64", "i686":
+		return ignitionDeliveryFwCfg
+	}
+	return ignitionDeliveryVirtio
 }
 
 // Creates a new cloudinit with the defaults
 // the provider uses
 func newIgnitionDef() defIgnition {
-	ign := defIgnition{}
+	ign := defIgnition{
+		Delivery: ignitionDeliveryAuto,
+	}
 
 	return ign
 }
@@ -103,23 +134,48 @@ func (ign *defIgnition) CreateAndUpload(client *Client) (string, error) {
 
 // create a unique ID for terraform use
 // The ID is made by the volume ID (the internal one used by libvirt)
-// joined by the ";" with a UUID
+// joined by the ";" with a UUID and the delivery mode, so domains know how to
+// attach the volume
 func (ign *defIgnition) buildTerraformKey(volumeKey string) string {
-	return fmt.Sprintf("%s;%s", volumeKey, uuid.TimeOrderedUUID())
+	return fmt.Sprintf("%s;%s;%s", volumeKey, uuid.TimeOrderedUUID(), ign.Delivery)
 }
 
 func getIgnitionVolumeKeyFromTerraformID(id string) (string, error) {
-	s := strings.SplitN(id, ";", 2)
-	if len(s) != 2 {
+	s := strings.SplitN(id, ";", 3)
+	if len(s) < 2 {
 		return "", fmt.Errorf("%s is not a valid key", id)
 	}
 	return s[0], nil
 }
 
+// getIgnitionDeliveryFromTerraformID returns the delivery mode recorded in
+// the ID, IDs created before delivery modes were supported are always fw_cfg
+func getIgnitionDeliveryFromTerraformID(id string) string {
+	s := strings.SplitN(id, ";", 3)
+	if len(s) < 3 {
+		return ignitionDeliveryFwCfg
+	}
+	return s[2]
+}
+
 // Dumps the Ignition object - either generated by Terraform or supplied as a file -
-// to a temporary ignition file
+// to a temporary file, wrapped in a config drive ISO image when needed
 func (ign *defIgnition) createFile() (string, error) {
 	log.Print("Creating Ignition temporary file")
+	content, err := ign.readContent()
+	if err != nil {
+		return "", err
+	}
+	if _, errs := validateIgnitionConfig(content); len(errs) > 0 {
+		return "", fmt.Errorf("Invalid Ignition config: %s", errs[0])
+	}
+	if ign.SpecVersion != "" {
+		content, err = translateIgnitionConfig(content, ign.SpecVersion)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	tempFile, err := ioutil.TempFile("", ign.Name)
 	if err != nil {
 		return "", fmt.Errorf("Cannot create tmp file for Ignition: %s",
@@ -127,39 +183,49 @@ func (ign *defIgnition) createFile() (string, error) {
 	}
 	defer tempFile.Close()
 
-	var file bool
-	file = true
+	switch ign.Delivery {
+	case ignitionDeliveryAuto, ignitionDeliveryFwCfg, ignitionDeliveryVirtio:
+		_, err = tempFile.Write(content)
+	case ignitionDeliveryConfigDrive:
+		err = writeISO9660(tempFile, configDriveVolumeID, []isoFile{
+			{Name: configDriveUserDataFileName, Data: content},
+		})
+	default:
+		err = fmt.Errorf("Unsupported Ignition delivery '%s': it can be '%s', '%s' or '%s'",
+			ign.Delivery, ignitionDeliveryFwCfg, ignitionDeliveryConfigDrive, ignitionDeliveryVirtio)
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return "", fmt.Errorf("Cannot write Ignition object to temporary "+
+			"ignition file: %s", err)
+	}
+	return tempFile.Name(), nil
+}
+
+// readContent returns the Ignition config, read from the file named by
+// Content or Content itself
+func (ign *defIgnition) readContent() ([]byte, error) {
 	if _, err := os.Stat(ign.Content); err != nil {
 		var js map[string]interface{}
 		if errConf := json.Unmarshal([]byte(ign.Content), &js); errConf != nil {
-			return "", fmt.Errorf("coreos_ignition 'content' is neither a file "+
+			return nil, fmt.Errorf("coreos_ignition 'content' is neither a file "+
 				"nor a valid json object %s", ign.Content)
 		}
-		file = false
+		return []byte(ign.Content), nil
 	}
 
-	if !file {
-		if _, err := tempFile.WriteString(ign.Content); err != nil {
-			return "", fmt.Errorf("Cannot write Ignition object to temporary " +
-				"ignition file")
-		}
-	} else if file {
-		ignFile, err := os.Open(ign.Content)
-		if err != nil {
-			return "", fmt.Errorf("Error opening supplied Ignition file %s", ign.Content)
-		}
-		defer ignFile.Close()
-		_, err = io.Copy(tempFile, ignFile)
-		if err != nil {
-			return "", fmt.Errorf("Error copying supplied Igition file to temporary file: %s", ign.Content)
-		}
+	content, err := ioutil.ReadFile(ign.Content)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading supplied Ignition file %s: %s", ign.Content, err)
 	}
-	return tempFile.Name(), nil
+	return content, nil
 }
 
 // Creates a new defIgnition object from provided id
 func newIgnitionDefFromRemoteVol(virConn *libvirt.Connect, id string) (defIgnition, error) {
-	ign := defIgnition{}
+	ign := defIgnition{
+		Delivery: getIgnitionDeliveryFromTerraformID(id),
+	}
 
 	key, err := getIgnitionVolumeKeyFromTerraformID(id)
 	if err != nil {
@@ -0,0 +1,137 @@
+package libvirt
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/hooklift/iso9660"
+)
+
+func TestIgnitionTerraformKeyOps(t *testing.T) {
+	ign := newIgnitionDef()
+	ign.Delivery = ignitionDeliveryConfigDrive
+
+	terraformID := ign.buildTerraformKey("volume-key")
+
+	key, err := getIgnitionVolumeKeyFromTerraformID(terraformID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "volume-key" {
+		t.Errorf("wrong key returned: %s", key)
+	}
+	if delivery := getIgnitionDeliveryFromTerraformID(terraformID); delivery != ignitionDeliveryConfigDrive {
+		t.Errorf("wrong delivery returned: %s", delivery)
+	}
+
+	// IDs created before delivery modes were supported
+	if delivery := getIgnitionDeliveryFromTerraformID("volume-key;uuid"); delivery != ignitionDeliveryFwCfg {
+		t.Errorf("Expected %s for an old ID, got %s", ignitionDeliveryFwCfg, delivery)
+	}
+}
+
+func TestIgnitionDeliveryForArch(t *testing.T) {
+	testCases := []struct {
+		arch     string
+		expected string
+	}{
+		{"x86_64", ignitionDeliveryFwCfg},
+		{"i686", ignitionDeliveryFwCfg},
+		{"aarch64", ignitionDeliveryVirtio},
+		{"s390x", ignitionDeliveryVirtio},
+		{"ppc64le", ignitionDeliveryVirtio},
+	}
+	for _, tc := range testCases {
+		if r := ignitionDeliveryForArch(tc.arch); r != tc.expected {
+			t.Errorf("%s: got=%s expected=%s", tc.arch, r, tc.expected)
+		}
+	}
+}
+
+func TestIgnitionCreateFile(t *testing.T) {
+	content := `{"ignition": {"version": "2.2.0"}}`
+
+	ign := newIgnitionDef()
+	ign.Name = "test.ign"
+	ign.Content = content
+	ign.Delivery = ignitionDeliveryVirtio
+
+	file, err := ign.createFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file)
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Errorf("Expected %s, got %s", content, data)
+	}
+
+	// without a delivery, the config is written as is for fw_cfg or virtio
+	ign.Delivery = ignitionDeliveryAuto
+	file, err = ign.createFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file)
+
+	ign.Delivery = "floppy"
+	if _, err := ign.createFile(); err == nil {
+		t.Errorf("Expected an error for an unsupported delivery")
+	}
+}
+
+func TestIgnitionCreateConfigDrive(t *testing.T) {
+	content := `{"ignition": {"version": "2.2.0"}}`
+
+	ign := newIgnitionDef()
+	ign.Name = "test.ign"
+	ign.Content = content
+	ign.Delivery = ignitionDeliveryConfigDrive
+
+	file, err := ign.createFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file)
+
+	iso, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iso.Close()
+
+	reader, err := iso9660.NewReader(iso)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for {
+		f, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Name() != isoReaderName(configDriveUserDataFileName) {
+			continue
+		}
+		data, err := ioutil.ReadAll(f.Sys().(io.Reader))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("Expected %s, got %s", content, data)
+		}
+		found = true
+	}
+	if !found {
+		t.Errorf("The config drive doesn't hold %s", configDriveUserDataFileName)
+	}
+}
@@ -0,0 +1,253 @@
+package libvirt
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	libvirt "github.com/libvirt/libvirt-go"
+)
+
+// a libvirt domain datasource
+//
+// Datasource example:
+//
+//	data "libvirt_domain" "dns_server" {
+//	   name = "dns-server"
+//	}
+//
+//	output "dns_server_ips" {
+//	   value = "${flatten(data.libvirt_domain.dns_server.network_interface.*.addresses)}"
+//	}
+func datasourceLibvirtDomain() *schema.Resource {
+	return &schema.Resource{
+		Read: datasourceLibvirtDomainRead,
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"uuid": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"qemu_agent": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"vcpu": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"memory": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"running": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+			"autostart": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+			"arch": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"machine": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"disk": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"device": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"target": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"source": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+			"network_interface": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"mac": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"network_name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"bridge": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"addresses": {
+							Type:     schema.TypeList,
+							Computed: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// lookupDomainByNameOrUUID finds the domain referenced by the "name" or
+// "uuid" attributes of a datasource
+//
+// You have to call domain.Free() on the returned domain
+func lookupDomainByNameOrUUID(virConn *libvirt.Connect, d *schema.ResourceData) (*libvirt.Domain, error) {
+	if uuid, ok := d.GetOk("uuid"); ok {
+		domain, err := virConn.LookupDomainByUUIDString(uuid.(string))
+		if err != nil {
+			return nil, fmt.Errorf("Error retrieving libvirt domain '%s': %s", uuid.(string), err)
+		}
+		return domain, nil
+	}
+	if name, ok := d.GetOk("name"); ok {
+		domain, err := virConn.LookupDomainByName(name.(string))
+		if err != nil {
+			return nil, fmt.Errorf("Error retrieving libvirt domain '%s': %s", name.(string), err)
+		}
+		return domain, nil
+	}
+	return nil, fmt.Errorf("One of 'name' or 'uuid' must be provided")
+}
+
+func datasourceLibvirtDomainRead(d *schema.ResourceData, meta interface{}) error {
+	log.Printf("[DEBUG] Read data source libvirt_domain")
+
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	domain, err := lookupDomainByNameOrUUID(virConn, d)
+	if err != nil {
+		return err
+	}
+	defer domain.Free()
+
+	domainDef, err := getXMLDomainDefFromLibvirt(domain)
+	if err != nil {
+		return err
+	}
+
+	uuid, err := domain.GetUUIDString()
+	if err != nil {
+		return fmt.Errorf("Error retrieving libvirt domain id: %s", err)
+	}
+	d.SetId(uuid)
+	d.Set("uuid", uuid)
+	d.Set("name", domainDef.Name)
+
+	vcpu := domainDef.VCPU.Value
+	if domainDef.VCPU.Current != "" {
+		if vcpu, err = strconv.Atoi(domainDef.VCPU.Current); err != nil {
+			return fmt.Errorf("Error parsing current vcpus '%s': %s", domainDef.VCPU.Current, err)
+		}
+	}
+	d.Set("vcpu", vcpu)
+
+	memory := domainMemoryToMiB(domainDef.Memory.Value, domainDef.Memory.Unit)
+	if domainDef.CurrentMemory != nil {
+		memory = domainMemoryToMiB(domainDef.CurrentMemory.Value, domainDef.CurrentMemory.Unit)
+	}
+	d.Set("memory", memory)
+
+	if domainDef.OS != nil && domainDef.OS.Type != nil {
+		d.Set("arch", domainDef.OS.Type.Arch)
+		d.Set("machine", domainDef.OS.Type.Machine)
+	}
+
+	running, err := domainIsRunning(*domain)
+	if err != nil {
+		return err
+	}
+	d.Set("running", running)
+
+	autostart, err := domain.GetAutostart()
+	if err != nil {
+		return fmt.Errorf("Error reading domain autostart setting: %s", err)
+	}
+	d.Set("autostart", autostart)
+
+	if domainDef.Devices == nil {
+		return nil
+	}
+
+	var disks []map[string]interface{}
+	for _, diskDef := range domainDef.Devices.Disks {
+		disk := map[string]interface{}{
+			"device": diskDef.Device,
+			"source": domainDiskSourcePath(diskDef),
+		}
+		if diskDef.Target != nil {
+			disk["target"] = diskDef.Target.Dev
+		}
+		disks = append(disks, disk)
+	}
+	d.Set("disk", disks)
+
+	ifacesWithAddr, err := domainGetIfacesInfo(*domain, d)
+	if err != nil {
+		return fmt.Errorf("Error retrieving interface addresses: %s", err)
+	}
+
+	var netIfaces []map[string]interface{}
+	for _, networkInterfaceDef := range domainDef.Devices.Interfaces {
+		netIface := map[string]interface{}{}
+
+		mac := ""
+		if networkInterfaceDef.MAC != nil {
+			mac = strings.ToUpper(networkInterfaceDef.MAC.Address)
+		}
+		netIface["mac"] = mac
+
+		if networkInterfaceDef.Source != nil {
+			if networkInterfaceDef.Source.Network != nil {
+				netIface["network_name"] = networkInterfaceDef.Source.Network.Network
+			} else if networkInterfaceDef.Source.Bridge != nil {
+				netIface["bridge"] = networkInterfaceDef.Source.Bridge.Bridge
+			}
+		}
+
+		var addrs []string
+		for _, ifaceWithAddr := range ifacesWithAddr {
+			if strings.ToUpper(ifaceWithAddr.Hwaddr) == mac {
+				for _, addr := range ifaceWithAddr.Addrs {
+					addrs = append(addrs, addr.Addr)
+				}
+			}
+		}
+		netIface["addresses"] = addrs
+
+		netIfaces = append(netIfaces, netIface)
+	}
+	d.Set("network_interface", netIfaces)
+
+	return nil
+}
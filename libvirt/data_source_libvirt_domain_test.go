@@ -0,0 +1,48 @@
+package libvirt
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/acctest"
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestAccLibvirtDomainDataSource_Basic(t *testing.T) {
+	randomDomainName := acctest.RandString(10)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtDomainDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_domain" "%[1]s" {
+					name   = "%[1]s"
+					memory = 384
+					vcpu   = 2
+				}
+
+				data "libvirt_domain" "by_name" {
+					name = "${libvirt_domain.%[1]s.name}"
+				}
+
+				data "libvirt_domain" "by_uuid" {
+					uuid = "${libvirt_domain.%[1]s.id}"
+				}`, randomDomainName),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrPair(
+						"data.libvirt_domain.by_name", "id", "libvirt_domain."+randomDomainName, "id"),
+					resource.TestCheckResourceAttr(
+						"data.libvirt_domain.by_name", "memory", "384"),
+					resource.TestCheckResourceAttr(
+						"data.libvirt_domain.by_name", "vcpu", "2"),
+					resource.TestCheckResourceAttr(
+						"data.libvirt_domain.by_name", "running", "true"),
+					resource.TestCheckResourceAttr(
+						"data.libvirt_domain.by_uuid", "name", randomDomainName),
+				),
+			},
+		},
+	})
+}
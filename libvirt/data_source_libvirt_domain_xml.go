@@ -0,0 +1,60 @@
+package libvirt
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/hashicorp/terraform/helper/hashcode"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/libvirt/libvirt-go-xml"
+)
+
+// a datasource rendering the XML definition of a domain without defining it
+//
+// Datasource example:
+//
+//	data "libvirt_domain_xml" "preview" {
+//	   name   = "preview"
+//	   memory = 1024
+//	   network_interface {
+//	     network_name = "default"
+//	   }
+//	}
+//
+//	output "xml" {
+//	   value = "${data.libvirt_domain_xml.preview.rendered_xml}"
+//	}
+func datasourceLibvirtDomainXML() *schema.Resource {
+	// the arguments are the ones of the domain resource, so that its
+	// configuration can be copied as is
+	return &schema.Resource{
+		Read:   datasourceLibvirtDomainXMLRead,
+		Schema: resourceLibvirtDomain().Schema,
+	}
+}
+
+func datasourceLibvirtDomainXMLRead(d *schema.ResourceData, meta interface{}) error {
+	log.Printf("[DEBUG] Read data source libvirt_domain_xml")
+
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	// the DHCP hosts of the networks are left untouched
+	var waitForLeases []*libvirtxml.DomainInterface
+	domainDef, err := newDomainDefFromResource(d, virConn, nil, &waitForLeases)
+	if err != nil {
+		return err
+	}
+
+	data, err := renderDomainXML(d, domainDef)
+	if err != nil {
+		return err
+	}
+
+	d.Set("rendered_xml", data)
+	d.SetId(strconv.Itoa(hashcode.String(data)))
+	return nil
+}
@@ -0,0 +1,63 @@
+package libvirt
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/acctest"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestAccLibvirtDomainXMLDataSource_Basic(t *testing.T) {
+	randomDomainName := acctest.RandString(10)
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				data "libvirt_domain_xml" "%[1]s" {
+					name   = "%[1]s"
+					memory = 384
+					network_interface {
+						network_name = "default"
+						mac          = "52:54:00:B2:2F:86"
+					}
+					xml {
+						patch {
+							action = "set"
+							path   = "/domain/devices/interface/model/@type"
+							value  = "e1000"
+						}
+					}
+				}`, randomDomainName),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr(
+						"data.libvirt_domain_xml."+randomDomainName, "rendered_xml", regexp.MustCompile("<name>"+randomDomainName+"</name>")),
+					resource.TestMatchResourceAttr(
+						"data.libvirt_domain_xml."+randomDomainName, "rendered_xml", regexp.MustCompile(`<memory unit="MiB">384</memory>`)),
+					resource.TestMatchResourceAttr(
+						"data.libvirt_domain_xml."+randomDomainName, "rendered_xml", regexp.MustCompile(`<mac address="52:54:00:B2:2F:86"/>`)),
+					resource.TestMatchResourceAttr(
+						"data.libvirt_domain_xml."+randomDomainName, "rendered_xml", regexp.MustCompile(`<model type="e1000"/>`)),
+					testAccCheckLibvirtDomainNotDefined(randomDomainName),
+				),
+			},
+		},
+	})
+}
+
+// testAccCheckLibvirtDomainNotDefined checks that rendering a domain didn't
+// define it
+func testAccCheckLibvirtDomainNotDefined(name string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		virConn := testAccProvider.Meta().(*Client).libvirt
+		if domain, err := virConn.LookupDomainByName(name); err == nil {
+			domain.Free()
+			return fmt.Errorf("Domain '%s' was defined", name)
+		}
+		return nil
+	}
+}
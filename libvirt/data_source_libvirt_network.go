@@ -2,11 +2,13 @@ package libvirt
 
 import (
 	"fmt"
+	"log"
 	"net"
 	"strconv"
 
 	"github.com/hashicorp/terraform/helper/hashcode"
 	"github.com/hashicorp/terraform/helper/schema"
+	libvirt "github.com/libvirt/libvirt-go"
 )
 
 // a libvirt network DNS host template datasource
@@ -156,3 +158,139 @@ func resourceLibvirtNetworkDNSSRVRead(d *schema.ResourceData, meta interface{})
 
 	return nil
 }
+
+// a libvirt network datasource
+//
+// Datasource example:
+//
+// data "libvirt_network" "default" {
+//   name = "default"
+// }
+//
+// resource "libvirt_domain" "my_machine" {
+//   ...
+//   network_interface {
+//     network_id = "${data.libvirt_network.default.id}"
+//   }
+// }
+//
+func datasourceLibvirtNetwork() *schema.Resource {
+	return &schema.Resource{
+		Read: datasourceLibvirtNetworkRead,
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"uuid": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"mode": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"bridge": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"domain": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"addresses": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"active": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+			"autostart": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func datasourceLibvirtNetworkRead(d *schema.ResourceData, meta interface{}) error {
+	log.Printf("[DEBUG] Read data source libvirt_network")
+
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	var network *libvirt.Network
+	var err error
+	if uuid, ok := d.GetOk("uuid"); ok {
+		network, err = virConn.LookupNetworkByUUIDString(uuid.(string))
+		if err != nil {
+			return fmt.Errorf("Error retrieving libvirt network '%s': %s", uuid.(string), err)
+		}
+	} else if name, ok := d.GetOk("name"); ok {
+		network, err = virConn.LookupNetworkByName(name.(string))
+		if err != nil {
+			return fmt.Errorf("Error retrieving libvirt network '%s': %s", name.(string), err)
+		}
+	} else {
+		return fmt.Errorf("One of 'name' or 'uuid' must be provided")
+	}
+	defer network.Free()
+
+	uuid, err := network.GetUUIDString()
+	if err != nil {
+		return fmt.Errorf("Error retrieving libvirt network id: %s", err)
+	}
+	d.SetId(uuid)
+	d.Set("uuid", uuid)
+
+	networkDef, err := getXMLNetworkDefFromLibvirt(network)
+	if err != nil {
+		return err
+	}
+
+	d.Set("name", networkDef.Name)
+	if networkDef.Bridge != nil {
+		d.Set("bridge", networkDef.Bridge.Name)
+	}
+	// isolated networks have no forward element
+	mode := netModeIsolated
+	if networkDef.Forward != nil {
+		mode = networkDef.Forward.Mode
+	}
+	d.Set("mode", mode)
+	if networkDef.Domain != nil {
+		d.Set("domain", networkDef.Domain.Name)
+	}
+
+	var addresses []string
+	for _, address := range networkDef.IPs {
+		cidr, err := getNetworkIPCIDR(address)
+		if err != nil {
+			return err
+		}
+		addresses = append(addresses, cidr)
+	}
+	d.Set("addresses", addresses)
+
+	active, err := network.IsActive()
+	if err != nil {
+		return fmt.Errorf("Couldn't determine if network is active: %s", err)
+	}
+	d.Set("active", active)
+
+	autostart, err := network.GetAutostart()
+	if err != nil {
+		return fmt.Errorf("Error reading network autostart setting: %s", err)
+	}
+	d.Set("autostart", autostart)
+
+	return nil
+}
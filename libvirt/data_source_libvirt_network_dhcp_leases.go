@@ -0,0 +1,177 @@
+package libvirt
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	libvirt "github.com/libvirt/libvirt-go"
+)
+
+// a datasource for the DHCP leases handed out by a libvirt network
+//
+// Datasource example:
+//
+//	data "libvirt_network_dhcp_leases" "worker" {
+//	   network_id = "${libvirt_network.k8snet.id}"
+//	   mac        = "${libvirt_domain.worker.network_interface.0.mac}"
+//	}
+//
+//	output "worker_ip" {
+//	   value = "${data.libvirt_network_dhcp_leases.worker.leases.0.ip}"
+//	}
+func datasourceLibvirtNetworkDHCPLeases() *schema.Resource {
+	return &schema.Resource{
+		Read: datasourceLibvirtNetworkDHCPLeasesRead,
+		Schema: map[string]*schema.Schema{
+			"network_id": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"network_name": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"mac": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"hostname": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"leases": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"mac": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"ip": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"prefix": {
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"type": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"hostname": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"client_id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"iaid": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"expiry_time": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"interface": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// flattenNetworkDHCPLeases returns the leases with the given MAC and
+// hostname (when not empty) in the format of the datasource
+func flattenNetworkDHCPLeases(leases []libvirt.NetworkDHCPLease, mac string, hostname string) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	for _, lease := range leases {
+		if mac != "" && !strings.EqualFold(lease.Mac, mac) {
+			continue
+		}
+		if hostname != "" && lease.Hostname != hostname {
+			continue
+		}
+
+		leaseType := "ipv4"
+		if lease.Type == libvirt.IP_ADDR_TYPE_IPV6 {
+			leaseType = "ipv6"
+		}
+
+		expiryTime := ""
+		if !lease.ExpiryTime.IsZero() && lease.ExpiryTime.Unix() != 0 {
+			expiryTime = lease.ExpiryTime.UTC().Format(time.RFC3339)
+		}
+
+		result = append(result, map[string]interface{}{
+			"mac":         lease.Mac,
+			"ip":          lease.IPaddr,
+			"prefix":      int(lease.Prefix),
+			"type":        leaseType,
+			"hostname":    lease.Hostname,
+			"client_id":   lease.Clientid,
+			"iaid":        lease.Iaid,
+			"expiry_time": expiryTime,
+			"interface":   lease.Iface,
+		})
+	}
+	return result
+}
+
+func datasourceLibvirtNetworkDHCPLeasesRead(d *schema.ResourceData, meta interface{}) error {
+	log.Printf("[DEBUG] Read data source libvirt_network_dhcp_leases")
+
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	var network *libvirt.Network
+	var err error
+	if uuid, ok := d.GetOk("network_id"); ok {
+		network, err = virConn.LookupNetworkByUUIDString(uuid.(string))
+		if err != nil {
+			return fmt.Errorf("Error retrieving libvirt network '%s': %s", uuid.(string), err)
+		}
+	} else if name, ok := d.GetOk("network_name"); ok {
+		network, err = virConn.LookupNetworkByName(name.(string))
+		if err != nil {
+			return fmt.Errorf("Error retrieving libvirt network '%s': %s", name.(string), err)
+		}
+	} else {
+		return fmt.Errorf("One of 'network_id' or 'network_name' must be provided")
+	}
+	defer network.Free()
+
+	uuid, err := network.GetUUIDString()
+	if err != nil {
+		return fmt.Errorf("Error retrieving libvirt network id: %s", err)
+	}
+	name, err := network.GetName()
+	if err != nil {
+		return fmt.Errorf("Error retrieving libvirt network name: %s", err)
+	}
+	d.SetId(uuid)
+	d.Set("network_id", uuid)
+	d.Set("network_name", name)
+
+	leases, err := network.GetDHCPLeases()
+	if err != nil {
+		return fmt.Errorf("Error retrieving DHCP leases of network '%s': %s", name, err)
+	}
+
+	d.Set("leases", flattenNetworkDHCPLeases(leases, d.Get("mac").(string), d.Get("hostname").(string)))
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package libvirt
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/acctest"
+	"github.com/hashicorp/terraform/helper/resource"
+	libvirt "github.com/libvirt/libvirt-go"
+)
+
+func TestFlattenNetworkDHCPLeases(t *testing.T) {
+	leases := []libvirt.NetworkDHCPLease{
+		{
+			Iface:      "virbr1",
+			ExpiryTime: time.Date(2019, 5, 10, 12, 0, 0, 0, time.UTC),
+			Type:       libvirt.IP_ADDR_TYPE_IPV4,
+			Mac:        "52:54:00:6c:3c:01",
+			IPaddr:     "10.17.3.10",
+			Prefix:     24,
+			Hostname:   "worker",
+			Clientid:   "01:52:54:00:6c:3c:01",
+		},
+		{
+			Iface:    "virbr1",
+			Type:     libvirt.IP_ADDR_TYPE_IPV6,
+			Mac:      "52:54:00:6c:3c:01",
+			Iaid:     "7073025",
+			IPaddr:   "2001:db8:ca2:2::10",
+			Prefix:   64,
+			Hostname: "worker",
+		},
+		{
+			Iface:    "virbr1",
+			Type:     libvirt.IP_ADDR_TYPE_IPV4,
+			Mac:      "52:54:00:6c:3c:02",
+			IPaddr:   "10.17.3.11",
+			Prefix:   24,
+			Hostname: "master",
+		},
+	}
+
+	if r := flattenNetworkDHCPLeases(leases, "", ""); len(r) != 3 {
+		t.Errorf("expected all the leases without filters, got %v", r)
+	}
+	if r := flattenNetworkDHCPLeases(leases, "", "master"); len(r) != 1 || r[0]["ip"] != "10.17.3.11" {
+		t.Errorf("expected the lease of master, got %v", r)
+	}
+	if r := flattenNetworkDHCPLeases(leases, "52:54:00:6C:3C:01", "nothing"); len(r) != 0 {
+		t.Errorf("expected no leases, got %v", r)
+	}
+
+	r := flattenNetworkDHCPLeases(leases, "52:54:00:6C:3C:01", "")
+	expected := []map[string]interface{}{
+		{
+			"mac":         "52:54:00:6c:3c:01",
+			"ip":          "10.17.3.10",
+			"prefix":      24,
+			"type":        "ipv4",
+			"hostname":    "worker",
+			"client_id":   "01:52:54:00:6c:3c:01",
+			"iaid":        "",
+			"expiry_time": "2019-05-10T12:00:00Z",
+			"interface":   "virbr1",
+		},
+		{
+			"mac":         "52:54:00:6c:3c:01",
+			"ip":          "2001:db8:ca2:2::10",
+			"prefix":      64,
+			"type":        "ipv6",
+			"hostname":    "worker",
+			"client_id":   "",
+			"iaid":        "7073025",
+			"expiry_time": "",
+			"interface":   "virbr1",
+		},
+	}
+	if !reflect.DeepEqual(r, expected) {
+		t.Errorf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestAccLibvirtNetworkDHCPLeasesDataSource_Basic(t *testing.T) {
+	randomNetworkName := acctest.RandString(10)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtNetworkDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_network" "%[1]s" {
+					name      = "%[1]s"
+					mode      = "nat"
+					addresses = ["10.17.3.0/24"]
+				}
+
+				data "libvirt_network_dhcp_leases" "%[1]s" {
+					network_id = "${libvirt_network.%[1]s.id}"
+					mac        = "52:54:00:6c:3c:01"
+				}`, randomNetworkName),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(
+						"data.libvirt_network_dhcp_leases."+randomNetworkName, "network_name", randomNetworkName),
+					resource.TestCheckResourceAttr(
+						"data.libvirt_network_dhcp_leases."+randomNetworkName, "leases.#", "0"),
+				),
+			},
+		},
+	})
+}
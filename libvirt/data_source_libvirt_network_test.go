@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/hashicorp/terraform/helper/acctest"
 	"github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/terraform"
 )
@@ -74,3 +75,37 @@ func TestAccLibvirtNetworkDataSource_DNSSRVTemplate(t *testing.T) {
 		},
 	})
 }
+
+func TestAccLibvirtNetworkDataSource_Lookup(t *testing.T) {
+	randomNetworkName := acctest.RandString(10)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtNetworkDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_network" "%[1]s" {
+					name      = "%[1]s"
+					mode      = "nat"
+					domain    = "k8s.local"
+					addresses = ["10.17.3.0/24"]
+				}
+
+				data "libvirt_network" "by_name" {
+					name = "${libvirt_network.%[1]s.name}"
+				}`, randomNetworkName),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrPair(
+						"data.libvirt_network.by_name", "id", "libvirt_network."+randomNetworkName, "id"),
+					resource.TestCheckResourceAttr(
+						"data.libvirt_network.by_name", "mode", "nat"),
+					resource.TestCheckResourceAttr(
+						"data.libvirt_network.by_name", "domain", "k8s.local"),
+					resource.TestCheckResourceAttr(
+						"data.libvirt_network.by_name", "addresses.0", "10.17.3.0/24"),
+				),
+			},
+		},
+	})
+}
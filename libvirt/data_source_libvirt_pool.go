@@ -0,0 +1,132 @@
+package libvirt
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	libvirt "github.com/libvirt/libvirt-go"
+)
+
+// a libvirt storage pool datasource
+//
+// Datasource example:
+//
+//	data "libvirt_pool" "images" {
+//	   name = "images"
+//	}
+//
+//	resource "libvirt_volume" "disk" {
+//	   name = "disk.qcow2"
+//	   pool = "${data.libvirt_pool.images.name}"
+//	}
+func datasourceLibvirtPool() *schema.Resource {
+	return &schema.Resource{
+		Read: datasourceLibvirtPoolRead,
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"uuid": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"type": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"path": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"active": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+			"autostart": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+			"capacity": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"allocation": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"available": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func datasourceLibvirtPoolRead(d *schema.ResourceData, meta interface{}) error {
+	log.Printf("[DEBUG] Read data source libvirt_pool")
+
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	var pool *libvirt.StoragePool
+	var err error
+	if uuid, ok := d.GetOk("uuid"); ok {
+		pool, err = virConn.LookupStoragePoolByUUIDString(uuid.(string))
+		if err != nil {
+			return fmt.Errorf("Error retrieving libvirt storage pool '%s': %s", uuid.(string), err)
+		}
+	} else if name, ok := d.GetOk("name"); ok {
+		pool, err = virConn.LookupStoragePoolByName(name.(string))
+		if err != nil {
+			return fmt.Errorf("Error retrieving libvirt storage pool '%s': %s", name.(string), err)
+		}
+	} else {
+		return fmt.Errorf("One of 'name' or 'uuid' must be provided")
+	}
+	defer pool.Free()
+
+	uuid, err := pool.GetUUIDString()
+	if err != nil {
+		return fmt.Errorf("Error retrieving libvirt storage pool id: %s", err)
+	}
+	d.SetId(uuid)
+	d.Set("uuid", uuid)
+
+	poolDef, err := newDefPoolFromLibvirt(pool)
+	if err != nil {
+		return err
+	}
+	d.Set("name", poolDef.Name)
+	d.Set("type", poolDef.Type)
+	if poolDef.Target != nil {
+		d.Set("path", poolDef.Target.Path)
+	}
+
+	active, err := pool.IsActive()
+	if err != nil {
+		return fmt.Errorf("Couldn't determine if storage pool is active: %s", err)
+	}
+	d.Set("active", active)
+
+	autostart, err := pool.GetAutostart()
+	if err != nil {
+		return fmt.Errorf("Error reading storage pool autostart setting: %s", err)
+	}
+	d.Set("autostart", autostart)
+
+	info, err := pool.GetInfo()
+	if err != nil {
+		return fmt.Errorf("Error retrieving storage pool info: %s", err)
+	}
+	d.Set("capacity", info.Capacity)
+	d.Set("allocation", info.Allocation)
+	d.Set("available", info.Available)
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package libvirt
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/acctest"
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestAccLibvirtPoolDataSource_Basic(t *testing.T) {
+	randomPoolName := acctest.RandString(10)
+	poolPath := filepath.Join(os.TempDir(), "terraform-provider-libvirt-pool-"+randomPoolName)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtPoolDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_pool" "%[1]s" {
+					name = "%[1]s"
+					type = "dir"
+					path = "%[2]s"
+				}
+
+				data "libvirt_pool" "by_name" {
+					name = "${libvirt_pool.%[1]s.name}"
+				}`, randomPoolName, poolPath),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrPair(
+						"data.libvirt_pool.by_name", "id", "libvirt_pool."+randomPoolName, "id"),
+					resource.TestCheckResourceAttr(
+						"data.libvirt_pool.by_name", "type", "dir"),
+					resource.TestCheckResourceAttr(
+						"data.libvirt_pool.by_name", "path", poolPath),
+					resource.TestCheckResourceAttr(
+						"data.libvirt_pool.by_name", "active", "true"),
+				),
+			},
+		},
+	})
+}
@@ -0,0 +1,142 @@
+package libvirt
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	libvirt "github.com/libvirt/libvirt-go"
+)
+
+// a libvirt volume datasource
+//
+// Datasource example:
+//
+//	data "libvirt_volume" "base_image" {
+//	   name = "opensuse_leap.qcow2"
+//	   pool = "images"
+//	}
+//
+//	resource "libvirt_volume" "worker" {
+//	   name           = "worker.qcow2"
+//	   base_volume_id = "${data.libvirt_volume.base_image.id}"
+//	}
+func datasourceLibvirtVolume() *schema.Resource {
+	return &schema.Resource{
+		Read: datasourceLibvirtVolumeRead,
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"pool": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  "default",
+			},
+			"key": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"path": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"format": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"size": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"allocation": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"base_volume_path": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func datasourceLibvirtVolumeRead(d *schema.ResourceData, meta interface{}) error {
+	log.Printf("[DEBUG] Read data source libvirt_volume")
+
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	var volume *libvirt.StorageVol
+	if key, ok := d.GetOk("key"); ok {
+		var err error
+		volume, err = virConn.LookupStorageVolByKey(key.(string))
+		if err != nil {
+			return fmt.Errorf("Can't retrieve volume %s: %v", key.(string), err)
+		}
+	} else if name, ok := d.GetOk("name"); ok {
+		poolName := d.Get("pool").(string)
+		pool, err := virConn.LookupStoragePoolByName(poolName)
+		if err != nil {
+			return fmt.Errorf("can't find storage pool '%s'", poolName)
+		}
+		defer pool.Free()
+
+		volume, err = pool.LookupStorageVolByName(name.(string))
+		if err != nil {
+			return fmt.Errorf("Can't retrieve volume %s: %v", name.(string), err)
+		}
+	} else {
+		return fmt.Errorf("One of 'name' or 'key' must be provided")
+	}
+	defer volume.Free()
+
+	key, err := volume.GetKey()
+	if err != nil {
+		return fmt.Errorf("Error retrieving volume key: %s", err)
+	}
+	d.SetId(key)
+	d.Set("key", key)
+
+	volPool, err := volume.LookupPoolByVolume()
+	if err != nil {
+		return fmt.Errorf("error retrieving pool for volume: %s", err)
+	}
+	defer volPool.Free()
+
+	volPoolName, err := volPool.GetName()
+	if err != nil {
+		return fmt.Errorf("error retrieving pool name: %s", err)
+	}
+	d.Set("pool", volPoolName)
+
+	volumeDef, err := newDefVolumeFromLibvirt(volume)
+	if err != nil {
+		return err
+	}
+	d.Set("name", volumeDef.Name)
+
+	if volumeDef.Target != nil {
+		d.Set("path", volumeDef.Target.Path)
+		if volumeDef.Target.Format != nil {
+			d.Set("format", volumeDef.Target.Format.Type)
+		}
+	}
+	if volumeDef.BackingStore != nil {
+		d.Set("base_volume_path", volumeDef.BackingStore.Path)
+	}
+
+	info, err := volume.GetInfo()
+	if err != nil {
+		return fmt.Errorf("error retrieving volume info: %s", err)
+	}
+	d.Set("size", info.Capacity)
+	d.Set("allocation", info.Allocation)
+
+	return nil
+}
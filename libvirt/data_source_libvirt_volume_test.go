@@ -0,0 +1,50 @@
+package libvirt
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/acctest"
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestAccLibvirtVolumeDataSource_Basic(t *testing.T) {
+	randomVolumeName := acctest.RandString(10)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtVolumeDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_volume" "%[1]s" {
+					name   = "%[1]s"
+					format = "qcow2"
+					size   = 1073741824
+				}
+
+				data "libvirt_volume" "by_name" {
+					name = "${libvirt_volume.%[1]s.name}"
+				}
+
+				data "libvirt_volume" "by_key" {
+					key = "${libvirt_volume.%[1]s.id}"
+				}`, randomVolumeName),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrPair(
+						"data.libvirt_volume.by_name", "id", "libvirt_volume."+randomVolumeName, "id"),
+					resource.TestCheckResourceAttr(
+						"data.libvirt_volume.by_name", "format", "qcow2"),
+					resource.TestCheckResourceAttr(
+						"data.libvirt_volume.by_name", "size", "1073741824"),
+					resource.TestCheckResourceAttrSet(
+						"data.libvirt_volume.by_name", "path"),
+					resource.TestCheckResourceAttr(
+						"data.libvirt_volume.by_key", "name", randomVolumeName),
+					resource.TestCheckResourceAttr(
+						"data.libvirt_volume.by_key", "pool", "default"),
+				),
+			},
+		},
+	})
+}
@@ -1,11 +1,13 @@
 package libvirt
 
 import (
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/url"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -27,6 +29,16 @@ const useQemuAgentEnvVar = "TF_USE_QEMU_AGENT"
 const domWaitLeaseStillWaiting = "waiting-addresses"
 const domWaitLeaseDone = "all-addresses-obtained"
 
+// graceful shutdown methods
+const (
+	domainShutdownACPI  = "acpi"
+	domainShutdownAgent = "agent"
+)
+
+// defaultDomainShutdownTimeout is how long the guest is given to shut down
+// before the domain is destroyed, unless the shutdown block sets it
+const defaultDomainShutdownTimeout = time.Minute
+
 var errDomainInvalidState = errors.New("invalid state for domain")
 
 func domainWaitForLeases(domain *libvirt.Domain, waitForLeases []*libvirtxml.DomainInterface,
@@ -229,13 +241,28 @@ func newDiskForCloudInit(virConn *libvirt.Connect, volumeKey string) (libvirtxml
 	return disk, nil
 }
 
-func setCoreOSIgnition(d *schema.ResourceData, domainDef *libvirtxml.Domain) error {
+// setCoreOSIgnition gives the Ignition config to the domain, whose
+// architecture and machine type decide how when the config doesn't
+func setCoreOSIgnition(d *schema.ResourceData, domainDef *libvirtxml.Domain, virConn *libvirt.Connect, arch string, machine string) error {
 	if ignition, ok := d.GetOk("coreos_ignition"); ok {
 		ignitionKey, err := getIgnitionVolumeKeyFromTerraformID(ignition.(string))
 		if err != nil {
 			return err
 		}
 
+		delivery := getIgnitionDeliveryFromTerraformID(ignition.(string))
+		if delivery == ignitionDeliveryAuto {
+			delivery = ignitionDeliveryForArch(arch)
+		}
+		if delivery != ignitionDeliveryFwCfg {
+			disk, err := newDiskForIgnition(virConn, ignitionKey, delivery, arch, machine)
+			if err != nil {
+				return err
+			}
+			domainDef.Devices.Disks = append(domainDef.Devices.Disks, disk)
+			return nil
+		}
+
 		domainDef.QEMUCommandline = &libvirtxml.DomainQEMUCommandline{
 			Args: []libvirtxml.DomainQEMUCommandlineArg{
 				{
@@ -251,6 +278,87 @@ func setCoreOSIgnition(d *schema.ResourceData, domainDef *libvirtxml.Domain) err
 	return nil
 }
 
+// newConfigDriveDiskTarget returns where a config drive is attached: there
+// are IDE controllers only on x86 machines other than q35, which has SATA
+func newConfigDriveDiskTarget(arch string, machine string) *libvirtxml.DomainDiskTarget {
+	if arch != "x86_64" && arch != "i686" {
+		return &libvirtxml.DomainDiskTarget{
+			Dev: "sdz",
+			Bus: "scsi",
+		}
+	}
+	if strings.Contains(machine, "q35") {
+		return &libvirtxml.DomainDiskTarget{
+			Dev: "sdz",
+			Bus: "sata",
+		}
+	}
+	return &libvirtxml.DomainDiskTarget{
+		Dev: "hdd",
+		Bus: "ide",
+	}
+}
+
+// domainHasIgnitionFwCfg returns whether the Ignition config with the key
+// is given to the domain by fw_cfg
+func domainHasIgnitionFwCfg(domainDef libvirtxml.Domain, key string) bool {
+	if domainDef.QEMUCommandline == nil {
+		return false
+	}
+	for _, arg := range domainDef.QEMUCommandline.Args {
+		if arg.Value == fmt.Sprintf("name=opt/com.coreos/config,file=%s", key) {
+			return true
+		}
+	}
+	return false
+}
+
+// newDiskForIgnition returns the disk holding the Ignition config: a cdrom
+// for config drives, a virtio disk Ignition finds by its serial otherwise
+func newDiskForIgnition(virConn *libvirt.Connect, volumeKey string, delivery string, arch string, machine string) (libvirtxml.DomainDisk, error) {
+	disk := libvirtxml.DomainDisk{
+		Driver: &libvirtxml.DomainDiskDriver{
+			Name: "qemu",
+			Type: "raw",
+		},
+		ReadOnly: &libvirtxml.DomainDiskReadOnly{},
+	}
+
+	switch delivery {
+	case ignitionDeliveryConfigDrive:
+		disk.Device = "cdrom"
+		disk.Target = newConfigDriveDiskTarget(arch, machine)
+	case ignitionDeliveryVirtio:
+		disk.Device = "disk"
+		disk.Serial = ignitionDiskSerial
+		disk.Target = &libvirtxml.DomainDiskTarget{
+			Dev: "vdz",
+			Bus: "virtio",
+		}
+	default:
+		return disk, fmt.Errorf("Unsupported Ignition delivery '%s'", delivery)
+	}
+
+	diskVolume, err := virConn.LookupStorageVolByKey(volumeKey)
+	if err != nil {
+		return disk, fmt.Errorf("Can't retrieve volume %s: %v", volumeKey, err)
+	}
+	defer diskVolume.Free()
+
+	diskVolumeFile, err := diskVolume.GetPath()
+	if err != nil {
+		return disk, fmt.Errorf("Error retrieving volume file: %s", err)
+	}
+
+	disk.Source = &libvirtxml.DomainDiskSource{
+		File: &libvirtxml.DomainDiskSourceFile{
+			File: diskVolumeFile,
+		},
+	}
+
+	return disk, nil
+}
+
 func setVideo(d *schema.ResourceData, domainDef *libvirtxml.Domain) error {
 	prefix := "video.0"
 	if _, ok := d.GetOk(prefix); ok {
@@ -264,8 +372,26 @@ func setVideo(d *schema.ResourceData, domainDef *libvirtxml.Domain) error {
 	return nil
 }
 
+// flattenDomainVideo returns the video block of the domain
+func flattenDomainVideo(videos []libvirtxml.DomainVideo) []map[string]interface{} {
+	if len(videos) == 0 {
+		return []map[string]interface{}{}
+	}
+	return []map[string]interface{}{
+		{
+			"type": videos[0].Model.Type,
+		},
+	}
+}
+
+// domainArchSupportsGraphics returns whether domains of the architecture
+// can have graphics devices
+func domainArchSupportsGraphics(arch string) bool {
+	return arch != "s390x" && arch != "ppc64"
+}
+
 func setGraphics(d *schema.ResourceData, domainDef *libvirtxml.Domain, arch string) error {
-	if arch == "s390x" || arch == "ppc64" {
+	if !domainArchSupportsGraphics(arch) {
 		domainDef.Devices.Graphics = nil
 		return nil
 	}
@@ -321,6 +447,51 @@ func setGraphics(d *schema.ResourceData, domainDef *libvirtxml.Domain, arch stri
 	return nil
 }
 
+// flattenDomainGraphics returns the graphics block of the domain. The
+// listen address of the resource is kept when the graphics don't listen on
+// an address.
+func flattenDomainGraphics(d *schema.ResourceData, graphics []libvirtxml.DomainGraphic) []map[string]interface{} {
+	for _, graphic := range graphics {
+		var graphicsType, autoport string
+		var listeners []libvirtxml.DomainGraphicListener
+		switch {
+		case graphic.Spice != nil:
+			graphicsType, autoport, listeners = "spice", graphic.Spice.AutoPort, graphic.Spice.Listeners
+		case graphic.VNC != nil:
+			graphicsType, autoport, listeners = "vnc", graphic.VNC.AutoPort, graphic.VNC.Listeners
+		default:
+			continue
+		}
+
+		listenType := "none"
+		listenAddress := d.Get("graphics.0.listen_address").(string)
+		if listenAddress == "" {
+			listenAddress = "127.0.0.1"
+		}
+		if len(listeners) > 0 {
+			switch {
+			case listeners[0].Address != nil:
+				listenType = "address"
+				listenAddress = listeners[0].Address.Address
+			case listeners[0].Network != nil:
+				listenType = "network"
+			case listeners[0].Socket != nil:
+				listenType = "socket"
+			}
+		}
+
+		return []map[string]interface{}{
+			{
+				"type":           graphicsType,
+				"autoport":       autoport == "yes",
+				"listen_type":    listenType,
+				"listen_address": listenAddress,
+			},
+		}
+	}
+	return []map[string]interface{}{}
+}
+
 func setCmdlineArgs(d *schema.ResourceData, domainDef *libvirtxml.Domain) {
 	var cmdlineArgs []string
 	for i := 0; i < d.Get("cmdline.#").(int); i++ {
@@ -365,6 +536,19 @@ func setFirmware(d *schema.ResourceData, domainDef *libvirtxml.Domain) error {
 	return nil
 }
 
+// flattenDomainNVRam returns the nvram block of the domain
+func flattenDomainNVRam(nvram *libvirtxml.DomainNVRam) []map[string]interface{} {
+	if nvram == nil {
+		return []map[string]interface{}{}
+	}
+	return []map[string]interface{}{
+		{
+			"file":     nvram.NVRam,
+			"template": nvram.Template,
+		},
+	}
+}
+
 func setBootDevices(d *schema.ResourceData, domainDef *libvirtxml.Domain) {
 	for i := 0; i < d.Get("boot_device.#").(int); i++ {
 		if bootMap, ok := d.GetOk(fmt.Sprintf("boot_device.%d.dev", i)); ok {
@@ -378,6 +562,39 @@ func setBootDevices(d *schema.ResourceData, domainDef *libvirtxml.Domain) {
 	}
 }
 
+// flattenDomainBootDevices returns the boot_device blocks of the domain.
+// setBootDevices joins the devices of all the blocks, so the blocks of the
+// resource are kept when they list the same devices.
+func flattenDomainBootDevices(d *schema.ResourceData, bootDevices []libvirtxml.DomainBootDevice) []map[string]interface{} {
+	var devs []interface{}
+	for _, bootDevice := range bootDevices {
+		devs = append(devs, bootDevice.Dev)
+	}
+
+	var stateDevs []interface{}
+	var stateBlocks []map[string]interface{}
+	for i := 0; i < d.Get("boot_device.#").(int); i++ {
+		blockDevs := d.Get(fmt.Sprintf("boot_device.%d.dev", i)).([]interface{})
+		stateDevs = append(stateDevs, blockDevs...)
+		stateBlocks = append(stateBlocks, map[string]interface{}{"dev": blockDevs})
+	}
+
+	if reflect.DeepEqual(devs, stateDevs) {
+		if stateBlocks == nil {
+			return []map[string]interface{}{}
+		}
+		return stateBlocks
+	}
+	if len(devs) == 0 {
+		return []map[string]interface{}{}
+	}
+	return []map[string]interface{}{
+		{
+			"dev": devs,
+		},
+	}
+}
+
 func setConsoles(d *schema.ResourceData, domainDef *libvirtxml.Domain) {
 	for i := 0; i < d.Get("console.#").(int); i++ {
 		console := libvirtxml.DomainConsole{}
@@ -406,6 +623,89 @@ func setConsoles(d *schema.ResourceData, domainDef *libvirtxml.Domain) {
 	}
 }
 
+// consoleSourceType returns the type of the source setConsoles gives to a
+// console: a device when a source path is given, a pty otherwise
+func consoleSourceType(sourcePath string) string {
+	if sourcePath != "" {
+		return "dev"
+	}
+	return "pty"
+}
+
+// domainChardevSource returns the type and the path of the source of a
+// character device
+func domainChardevSource(source *libvirtxml.DomainChardevSource) (string, string) {
+	switch {
+	case source == nil:
+		return "pty", ""
+	case source.Pty != nil:
+		return "pty", source.Pty.Path
+	case source.Dev != nil:
+		return "dev", source.Dev.Path
+	case source.File != nil:
+		return "file", source.File.Path
+	case source.Pipe != nil:
+		return "pipe", source.Pipe.Path
+	case source.UNIX != nil:
+		return "unix", source.UNIX.Path
+	case source.Null != nil:
+		return "null", ""
+	case source.VC != nil:
+		return "vc", ""
+	case source.StdIO != nil:
+		return "stdio", ""
+	case source.UDP != nil:
+		return "udp", ""
+	case source.TCP != nil:
+		return "tcp", ""
+	case source.SpiceVMC != nil:
+		return "spicevmc", ""
+	case source.SpicePort != nil:
+		return "spiceport", ""
+	case source.NMDM != nil:
+		return "nmdm", ""
+	}
+	return "", ""
+}
+
+// flattenDomainConsoles returns the console blocks of the domain. The type
+// of a console in the resource is kept when setConsoles turns it into the
+// same type of source, and so is the source path of pty consoles, as
+// libvirt allocates the pty when the domain starts.
+func flattenDomainConsoles(d *schema.ResourceData, consoles []libvirtxml.DomainConsole) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(consoles))
+	for i, console := range consoles {
+		prefix := fmt.Sprintf("console.%d", i)
+		stateType := d.Get(prefix + ".type").(string)
+		statePath := d.Get(prefix + ".source_path").(string)
+
+		sourceType, sourcePath := domainChardevSource(console.Source)
+		consoleType := sourceType
+		if stateType != "" && consoleSourceType(statePath) == sourceType {
+			consoleType = stateType
+		}
+		if sourceType == "pty" {
+			sourcePath = statePath
+		}
+
+		targetPort, targetType := "", ""
+		if console.Target != nil {
+			if console.Target.Port != nil {
+				targetPort = strconv.Itoa(int(*console.Target.Port))
+			}
+			targetType = console.Target.Type
+		}
+
+		result = append(result, map[string]interface{}{
+			"type":        consoleType,
+			"source_path": sourcePath,
+			"target_port": targetPort,
+			"target_type": targetType,
+		})
+	}
+	return result
+}
+
 func setDisks(d *schema.ResourceData, domainDef *libvirtxml.Domain, virConn *libvirt.Connect) error {
 	var scsiDisk = false
 	for i := 0; i < d.Get("disk.#").(int); i++ {
@@ -537,6 +837,119 @@ func setDisks(d *schema.ResourceData, domainDef *libvirtxml.Domain, virConn *lib
 	return nil
 }
 
+// domainDiskSourceURL returns the URL of the source of a network disk
+func domainDiskSourceURL(network *libvirtxml.DomainDiskSourceNetwork) string {
+	u := url.URL{
+		Scheme: network.Protocol,
+		Path:   network.Name,
+	}
+	if len(network.Hosts) > 0 {
+		u.Host = network.Hosts[0].Name
+		if port := network.Hosts[0].Port; port != "" {
+			u.Host = net.JoinHostPort(u.Host, port)
+		}
+	}
+	return u.String()
+}
+
+// domainDiskVolumeKey returns the key of the volume of a disk. The volume
+// of the resource is looked up first, starting its pool when needed.
+func domainDiskVolumeKey(client *Client, source *libvirtxml.DomainDiskSourceVolume, stateKey string) (string, error) {
+	virConn := client.libvirt
+	if stateKey != "" {
+		volume, err := lookupVolumeReallyHard(client, source.Pool, stateKey)
+		if err != nil {
+			return "", err
+		}
+		if volume != nil {
+			defer volume.Free()
+			name, err := volume.GetName()
+			if err != nil {
+				return "", fmt.Errorf("Error retrieving name of volume %s: %s", stateKey, err)
+			}
+			if name == source.Volume {
+				return stateKey, nil
+			}
+		}
+	}
+
+	pool, err := virConn.LookupStoragePoolByName(source.Pool)
+	if err != nil {
+		return "", fmt.Errorf("Error retrieving pool for disk: %s", err)
+	}
+	defer pool.Free()
+
+	volume, err := pool.LookupStorageVolByName(source.Volume)
+	if err != nil {
+		return "", fmt.Errorf("Error retrieving volume for disk: %s", err)
+	}
+	defer volume.Free()
+
+	key, err := volume.GetKey()
+	if err != nil {
+		return "", fmt.Errorf("Error retrieving volume key for disk: %s", err)
+	}
+	return key, nil
+}
+
+// flattenDomainDisk returns the disk block of a disk of the domain, given
+// the disk block of the resource at the same position, if any
+func flattenDomainDisk(client *Client, diskDef libvirtxml.DomainDisk, stateDisk map[string]interface{}) (map[string]interface{}, error) {
+	disk := map[string]interface{}{
+		"volume_id": "",
+		"url":       "",
+		"file":      "",
+		"scsi":      false,
+		"wwn":       "",
+	}
+	if diskDef.Target != nil && diskDef.Target.Bus == "scsi" {
+		disk["scsi"] = true
+		disk["wwn"] = diskDef.WWN
+	}
+	if diskDef.Source == nil {
+		return disk, nil
+	}
+
+	switch {
+	case diskDef.Source.Network != nil:
+		disk["url"] = domainDiskSourceURL(diskDef.Source.Network)
+	case diskDef.Source.Volume != nil:
+		stateKey, _ := stateDisk["volume_id"].(string)
+		key, err := domainDiskVolumeKey(client, diskDef.Source.Volume, stateKey)
+		if err != nil {
+			return nil, err
+		}
+		disk["volume_id"] = key
+	case diskDef.Source.File != nil:
+		path := diskDef.Source.File.File
+		if stateFile, _ := stateDisk["file"].(string); diskDef.Device == "cdrom" || stateFile == path {
+			disk["file"] = path
+			break
+		}
+		// LEGACY way of handling volumes using "file", which we replaced
+		// by the diskdef.Source.Volume once we realized it existed.
+		volume, err := client.libvirt.LookupStorageVolByPath(path)
+		if err != nil {
+			if virErr, ok := err.(libvirt.Error); ok && virErr.Code == libvirt.ERR_NO_STORAGE_VOL {
+				disk["file"] = path
+				break
+			}
+			return nil, fmt.Errorf("Error retrieving volume for disk: %s", err)
+		}
+		defer volume.Free()
+
+		key, err := volume.GetKey()
+		if err != nil {
+			return nil, fmt.Errorf("Error retrieving volume key for disk: %s", err)
+		}
+		disk["volume_id"] = key
+	case diskDef.Source.Block != nil:
+		disk["file"] = diskDef.Source.Block.Dev
+	}
+
+	return disk, nil
+}
+
 func setFilesystems(d *schema.ResourceData, domainDef *libvirtxml.Domain) error {
 	for i := 0; i < d.Get("filesystem.#").(int); i++ {
 		fs := newFilesystemDef()
@@ -573,6 +986,30 @@ func setFilesystems(d *schema.ResourceData, domainDef *libvirtxml.Domain) error
 	return nil
 }
 
+// flattenDomainFilesystems returns the filesystem blocks of the domain
+func flattenDomainFilesystems(filesystems []libvirtxml.DomainFilesystem) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(filesystems))
+	for _, fsDef := range filesystems {
+		fs := map[string]interface{}{
+			"accessmode": fsDef.AccessMode,
+			"source":     "",
+			"target":     "",
+			"readonly":   fsDef.ReadOnly != nil,
+		}
+		if fsDef.AccessMode == "" {
+			fs["accessmode"] = "passthrough"
+		}
+		if fsDef.Source != nil && fsDef.Source.Mount != nil {
+			fs["source"] = fsDef.Source.Mount.Dir
+		}
+		if fsDef.Target != nil {
+			fs["target"] = fsDef.Target.Dir
+		}
+		result = append(result, fs)
+	}
+	return result
+}
+
 func setCloudinit(d *schema.ResourceData, domainDef *libvirtxml.Domain, virConn *libvirt.Connect) error {
 	if cloudinit, ok := d.GetOk("cloudinit"); ok {
 		cloudinitID, err := getCloudInitVolumeKeyFromTerraformID(cloudinit.(string))
@@ -589,6 +1026,46 @@ func setCloudinit(d *schema.ResourceData, domainDef *libvirtxml.Domain, virConn
 	return nil
 }
 
+// getDomainInterfaceFilterRefFromResource returns the network filter
+// applied to a network interface, if any
+func getDomainInterfaceFilterRefFromResource(d *schema.ResourceData, prefix string) *libvirtxml.DomainInterfaceFilterRef {
+	if d.Get(prefix+".filterref.#").(int) == 0 {
+		return nil
+	}
+	filterRef := &libvirtxml.DomainInterfaceFilterRef{
+		Filter: d.Get(prefix + ".filterref.0.filter").(string),
+	}
+	for _, param := range expandFilterParameters(d.Get(prefix + ".filterref.0.parameters").(map[string]interface{})) {
+		filterRef.Parameters = append(filterRef.Parameters, libvirtxml.DomainInterfaceFilterParam{
+			Name:  param.Name,
+			Value: param.Value,
+		})
+	}
+	return filterRef
+}
+
+// flattenDomainInterfaceFilterRef returns the filterref block of a network
+// interface
+func flattenDomainInterfaceFilterRef(filterRef *libvirtxml.DomainInterfaceFilterRef) []map[string]interface{} {
+	if filterRef == nil {
+		return []map[string]interface{}{}
+	}
+	var params []libvirtxml.NWFilterParameter
+	for _, param := range filterRef.Parameters {
+		params = append(params, libvirtxml.NWFilterParameter{Name: param.Name, Value: param.Value})
+	}
+	return []map[string]interface{}{
+		{
+			"filter":     filterRef.Filter,
+			"parameters": flattenFilterParameters(params),
+		},
+	}
+}
+
+// setNetworkInterfaces adds the network interfaces of the resource to the
+// domain. Unless partialNetIfaces is nil, the addresses of the interfaces
+// are added to the DHCP hosts of their networks, or recorded in
+// partialNetIfaces when they have to be waited for.
 func setNetworkInterfaces(d *schema.ResourceData, domainDef *libvirtxml.Domain,
 	virConn *libvirt.Connect, partialNetIfaces map[string]*pendingMapping,
 	waitForLeases *[]*libvirtxml.DomainInterface) error {
@@ -597,8 +1074,10 @@ func setNetworkInterfaces(d *schema.ResourceData, domainDef *libvirtxml.Domain,
 
 		netIface := libvirtxml.DomainInterface{
 			Model: &libvirtxml.DomainInterfaceModel{
-				Type: "virtio",
+				Type: d.Get(prefix + ".model").(string),
 			},
+			Driver: getDomainInterfaceDriverFromResource(d, prefix),
+			MTU:    getDomainInterfaceMTUFromResource(d, prefix),
 		}
 
 		// calculate the MAC address
@@ -616,6 +1095,9 @@ func setNetworkInterfaces(d *schema.ResourceData, domainDef *libvirtxml.Domain,
 			Address: mac,
 		}
 
+		netIface.FilterRef = getDomainInterfaceFilterRefFromResource(d, prefix)
+		netIface.Bandwidth = getDomainInterfaceBandwidthFromResource(d, prefix)
+
 		// this is not passed to libvirt, but used by waitForAddress
 		if waitForLease, ok := d.GetOk(prefix + ".wait_for_lease"); ok {
 			if waitForLease.(bool) {
@@ -648,46 +1130,17 @@ func setNetworkInterfaces(d *schema.ResourceData, domainDef *libvirtxml.Domain,
 			networkDef, err := getXMLNetworkDefFromLibvirt(network)
 
 			// only for DHCP, we update the host table of the network
-			if HasDHCP(networkDef) {
-				hostname := domainDef.Name
-				if hostnameI, ok := d.GetOk(prefix + ".hostname"); ok {
-					hostname = hostnameI.(string)
-				}
-				if addresses, ok := d.GetOk(prefix + ".addresses"); ok {
-					// some IP(s) provided
-					for _, addressI := range addresses.([]interface{}) {
-						address := addressI.(string)
-						ip := net.ParseIP(address)
-						if ip == nil {
-							return fmt.Errorf("Could not parse addresses '%s'", address)
-						}
-
-						log.Printf("[INFO] Adding IP/MAC/host=%s/%s/%s to %s", ip.String(), mac, hostname, networkName)
-						if err := updateOrAddHost(network, ip.String(), mac, hostname); err != nil {
-							return err
-						}
-					}
-				} else {
-					// no IPs provided: if the hostname has been provided, wait until we get an IP
-					wait := false
-					for _, iface := range *waitForLeases {
-						if iface == &netIface {
-							wait = true
-							break
-						}
-					}
-					if wait {
-						// the resource specifies a hostname but not an IP, so we must wait until we
-						// have a valid lease and then read the IP we have been assigned, so we can
-						// do the mapping
-						log.Printf("[DEBUG] Do not have an IP for '%s' yet: will wait until DHCP provides one...", hostname)
-						partialNetIfaces[strings.ToUpper(mac)] = &pendingMapping{
-							mac:      strings.ToUpper(mac),
-							hostname: hostname,
-							network:  network,
-						}
+			if partialNetIfaces != nil && HasDHCP(networkDef) {
+				wait := false
+				for _, iface := range *waitForLeases {
+					if iface == &netIface {
+						wait = true
+						break
 					}
 				}
+				if err := setDomainInterfaceHosts(d, prefix, mac, wait, network, networkName, partialNetIfaces); err != nil {
+					return err
+				}
 			}
 
 			netIface.Source = &libvirtxml.DomainInterfaceSource{
@@ -722,6 +1175,12 @@ func setNetworkInterfaces(d *schema.ResourceData, domainDef *libvirtxml.Domain,
 					Mode: "passthrough",
 				},
 			}
+		} else if _, ok := d.GetOk(prefix + ".user"); ok {
+			// the backend and the port forwards are added by
+			// getDomainInterfaceUserPatches
+			netIface.Source = &libvirtxml.DomainInterfaceSource{
+				User: &libvirtxml.DomainInterfaceSourceUser{},
+			}
 		} else {
 			// no network has been specified: we are on our own
 		}
@@ -732,28 +1191,915 @@ func setNetworkInterfaces(d *schema.ResourceData, domainDef *libvirtxml.Domain,
 	return nil
 }
 
-func destroyDomainByUserRequest(d *schema.ResourceData, domain *libvirt.Domain) error {
-	if d.Get("running").(bool) {
+// domainInterfaceHostname returns the name of the static DHCP hosts added for
+// a network interface: its hostname, or the name of the domain
+func domainInterfaceHostname(d *schema.ResourceData, prefix string) string {
+	if hostname := d.Get(prefix + ".hostname").(string); hostname != "" {
+		return hostname
+	}
+	return d.Get("name").(string)
+}
+
+// setDomainInterfaceHosts adds the addresses of a network interface to the
+// static DHCP hosts of its network. An interface without addresses waiting
+// for a lease is recorded in partialNetIfaces, so its host is added once the
+// lease is obtained.
+func setDomainInterfaceHosts(d *schema.ResourceData, prefix string, mac string, wait bool,
+	network *libvirt.Network, networkName string, partialNetIfaces map[string]*pendingMapping) error {
+	hostname := domainInterfaceHostname(d, prefix)
+	if addresses, ok := d.GetOk(prefix + ".addresses"); ok {
+		// some IP(s) provided
+		for _, addressI := range addresses.([]interface{}) {
+			address := addressI.(string)
+			ip := net.ParseIP(address)
+			if ip == nil {
+				return fmt.Errorf("Could not parse addresses '%s'", address)
+			}
+
+			log.Printf("[INFO] Adding IP/MAC/host=%s/%s/%s to %s", ip.String(), mac, hostname, networkName)
+			if err := updateOrAddHost(network, ip.String(), mac, hostname); err != nil {
+				return err
+			}
+		}
+	} else if wait {
+		// the resource specifies a hostname but not an IP, so we must wait until we
+		// have a valid lease and then read the IP we have been assigned, so we can
+		// do the mapping
+		log.Printf("[DEBUG] Do not have an IP for '%s' yet: will wait until DHCP provides one...", hostname)
+		partialNetIfaces[strings.ToUpper(mac)] = &pendingMapping{
+			mac:      strings.ToUpper(mac),
+			hostname: hostname,
+			network:  network,
+		}
+	}
+	return nil
+}
+
+// removeDomainNetworkHosts removes from the networks the static DHCP hosts
+// added for the network interfaces of the domain. The hosts with other names
+// are left alone, as they may belong to libvirt_network_dhcp_host resources.
+// Failures are only logged: they must not prevent deleting the domain.
+func removeDomainNetworkHosts(d *schema.ResourceData, virConn *libvirt.Connect) {
+	for i := 0; i < d.Get("network_interface.#").(int); i++ {
+		prefix := fmt.Sprintf("network_interface.%d", i)
+		removeDomainInterfaceHosts(virConn, d.Get(prefix).(map[string]interface{}), domainInterfaceHostname(d, prefix))
+	}
+}
+
+// removeDomainInterfaceHosts removes the static DHCP hosts added with the
+// given hostname for a network interface, as stored in the state. Failures
+// are only logged.
+func removeDomainInterfaceHosts(virConn *libvirt.Connect, iface map[string]interface{}, hostname string) {
+	networkUUID, _ := iface["network_id"].(string)
+	mac, _ := iface["mac"].(string)
+	addresses, _ := iface["addresses"].([]interface{})
+	if networkUUID == "" || mac == "" || len(addresses) == 0 {
+		return
+	}
+
+	network, err := virConn.LookupNetworkByUUIDString(networkUUID)
+	if err != nil {
+		log.Printf("[WARN] Can't retrieve network ID %s for removing the hosts of %s: %s", networkUUID, mac, err)
+		return
+	}
+	defer network.Free()
+
+	hosts, err := getNetworkDHCPHosts(network)
+	if err != nil {
+		log.Printf("[WARN] Can't read the hosts of network ID %s: %s", networkUUID, err)
+		return
+	}
+
+	for _, host := range hosts {
+		if !strings.EqualFold(host.MAC, mac) || host.Name != hostname {
+			continue
+		}
+		for _, address := range addresses {
+			if !net.ParseIP(host.IP).Equal(net.ParseIP(address.(string))) {
+				continue
+			}
+			log.Printf("[INFO] Removing IP/MAC/host=%s/%s/%s from network ID %s", host.IP, host.MAC, host.Name, networkUUID)
+			if err := removeHost(network, host.IP, host.MAC, host.Name); err != nil {
+				log.Printf("[WARN] Could not remove IP/MAC/host=%s/%s/%s: %s", host.IP, host.MAC, host.Name, err)
+			}
+		}
+	}
+}
+
+// setVCPUs sets the amount of virtual CPUs of the domain, and the maximum
+// it can be grown to without restarting it when "maxvcpu" is provided
+func setVCPUs(d *schema.ResourceData, domainDef *libvirtxml.Domain) error {
+	vcpu := d.Get("vcpu").(int)
+	domainDef.VCPU = &libvirtxml.DomainVCPU{
+		Value: vcpu,
+	}
+
+	if maxVCPU, ok := d.GetOk("maxvcpu"); ok {
+		if maxVCPU.(int) < vcpu {
+			return fmt.Errorf("'maxvcpu' (%d) can't be lower than 'vcpu' (%d)", maxVCPU.(int), vcpu)
+		}
+		domainDef.VCPU.Value = maxVCPU.(int)
+		domainDef.VCPU.Current = strconv.Itoa(vcpu)
+	}
+
+	return nil
+}
+
+// setMemory sets the memory of the domain, and the maximum it can be
+// ballooned to without restarting it when "maxmemory" is provided
+func setMemory(d *schema.ResourceData, domainDef *libvirtxml.Domain) error {
+	memory := d.Get("memory").(int)
+	domainDef.Memory = &libvirtxml.DomainMemory{
+		Value: uint(memory),
+		Unit:  "MiB",
+	}
+
+	if maxMemory, ok := d.GetOk("maxmemory"); ok {
+		if maxMemory.(int) < memory {
+			return fmt.Errorf("'maxmemory' (%d) can't be lower than 'memory' (%d)", maxMemory.(int), memory)
+		}
+		domainDef.Memory.Value = uint(maxMemory.(int))
+		domainDef.CurrentMemory = &libvirtxml.DomainCurrentMemory{
+			Value: uint(memory),
+			Unit:  "MiB",
+		}
+	}
+
+	return nil
+}
+
+// domainApplyLiveOrConfig applies a change to a running domain and to its
+// persistent configuration. When the change can't be applied live, only the
+// persistent configuration is changed and true is returned, meaning the
+// domain has to be restarted for the change to take effect.
+func domainApplyLiveOrConfig(domain *libvirt.Domain, what string, apply func(live bool) error) (bool, error) {
+	running, err := domainIsRunning(*domain)
+	if err != nil {
+		return false, err
+	}
+
+	if running {
+		err := apply(true)
+		if err == nil {
+			return false, nil
+		}
+		log.Printf("[WARN] Couldn't change %s of the running domain, changing the persistent configuration instead: %s", what, err)
+	}
+
+	if err := apply(false); err != nil {
+		return false, fmt.Errorf("Error changing %s of the domain: %s", what, err)
+	}
+
+	return running, nil
+}
+
+// getMaximumFromResource returns the old and new values of a resource maximum
+// (ie, "maxvcpu"), which default to the current value (ie, "vcpu") when not set
+func getMaximumFromResource(d *schema.ResourceData, key string, maxKey string) (int, int) {
+	oldValueI, newValueI := d.GetChange(key)
+	oldMaxI, newMaxI := d.GetChange(maxKey)
+
+	oldMax, newMax := oldMaxI.(int), newMaxI.(int)
+	if oldMax == 0 {
+		oldMax = oldValueI.(int)
+	}
+	if newMax == 0 {
+		newMax = newValueI.(int)
+	}
+	return oldMax, newMax
+}
+
+// updateDomainVCPUs changes the amount of virtual CPUs of the domain, live
+// when possible. Returns true when the domain needs to be restarted.
+func updateDomainVCPUs(d *schema.ResourceData, domain *libvirt.Domain) (bool, error) {
+	vcpu := d.Get("vcpu").(int)
+	oldMax, newMax := getMaximumFromResource(d, "vcpu", "maxvcpu")
+	if newMax < vcpu {
+		return false, fmt.Errorf("'maxvcpu' (%d) can't be lower than 'vcpu' (%d)", newMax, vcpu)
+	}
+
+	setMaximum := func() error {
+		log.Printf("[DEBUG] Setting maximum vcpus of domain %s to %d", d.Id(), newMax)
+		if err := domain.SetVcpusFlags(uint(newMax), libvirt.DOMAIN_VCPU_MAXIMUM|libvirt.DOMAIN_VCPU_CONFIG); err != nil {
+			return fmt.Errorf("Error changing maximum vcpus of the domain: %s", err)
+		}
 		return nil
 	}
 
-	domainID, err := domain.GetUUIDString()
+	// the maximum must always be larger than the current amount, so the
+	// order of the changes depends on whether we grow or shrink it
+	if newMax > oldMax {
+		if err := setMaximum(); err != nil {
+			return false, err
+		}
+	}
+
+	restart := false
+	if d.HasChange("vcpu") {
+		var err error
+		restart, err = domainApplyLiveOrConfig(domain, "vcpus", func(live bool) error {
+			flags := libvirt.DOMAIN_VCPU_CONFIG
+			if live {
+				flags |= libvirt.DOMAIN_VCPU_LIVE
+			}
+			return domain.SetVcpusFlags(uint(vcpu), flags)
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if newMax < oldMax {
+		if err := setMaximum(); err != nil {
+			return false, err
+		}
+	}
+
+	if newMax != oldMax {
+		// the maximum can only be changed in the persistent configuration
+		running, err := domainIsRunning(*domain)
+		if err != nil {
+			return false, err
+		}
+		restart = restart || running
+	}
+
+	return restart, nil
+}
+
+// updateDomainMemory changes the memory of the domain, live when possible.
+// Returns true when the domain needs to be restarted.
+func updateDomainMemory(d *schema.ResourceData, domain *libvirt.Domain) (bool, error) {
+	memory := d.Get("memory").(int)
+	oldMax, newMax := getMaximumFromResource(d, "memory", "maxmemory")
+	if newMax < memory {
+		return false, fmt.Errorf("'maxmemory' (%d) can't be lower than 'memory' (%d)", newMax, memory)
+	}
+
+	// libvirt expects the memory in KiB
+	setMaximum := func() error {
+		log.Printf("[DEBUG] Setting maximum memory of domain %s to %d MiB", d.Id(), newMax)
+		if err := domain.SetMemoryFlags(uint64(newMax)*1024, libvirt.DOMAIN_MEM_MAXIMUM|libvirt.DOMAIN_MEM_CONFIG); err != nil {
+			return fmt.Errorf("Error changing maximum memory of the domain: %s", err)
+		}
+		return nil
+	}
+
+	if newMax > oldMax {
+		if err := setMaximum(); err != nil {
+			return false, err
+		}
+	}
+
+	restart := false
+	if d.HasChange("memory") {
+		var err error
+		restart, err = domainApplyLiveOrConfig(domain, "memory", func(live bool) error {
+			flags := libvirt.DOMAIN_MEM_CONFIG
+			if live {
+				flags |= libvirt.DOMAIN_MEM_LIVE
+			}
+			return domain.SetMemoryFlags(uint64(memory)*1024, flags)
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if newMax < oldMax {
+		if err := setMaximum(); err != nil {
+			return false, err
+		}
+	}
+
+	if newMax != oldMax {
+		running, err := domainIsRunning(*domain)
+		if err != nil {
+			return false, err
+		}
+		restart = restart || running
+	}
+
+	return restart, nil
+}
+
+// updateDomainGraphicsAndVideo replaces the graphics and video devices in the
+// persistent configuration of the domain, as they can't be changed in a
+// running domain. Returns true when the domain needs to be restarted.
+func updateDomainGraphicsAndVideo(d *schema.ResourceData, domain *libvirt.Domain, virConn *libvirt.Connect) (bool, error) {
+	xmlDesc, err := domain.GetXMLDesc(libvirt.DOMAIN_XML_INACTIVE | libvirt.DOMAIN_XML_SECURE)
+	if err != nil {
+		return false, fmt.Errorf("Error retrieving libvirt domain XML description: %s", err)
+	}
+	var domainDef libvirtxml.Domain
+	if err := xml.Unmarshal([]byte(xmlDesc), &domainDef); err != nil {
+		return false, fmt.Errorf("Error reading libvirt domain XML description: %s", err)
+	}
+	if domainDef.Devices == nil {
+		domainDef.Devices = &libvirtxml.DomainDeviceList{}
+	}
+
+	arch := ""
+	if domainDef.OS != nil && domainDef.OS.Type != nil {
+		arch = domainDef.OS.Type.Arch
+	}
+	if d.HasChange("graphics") {
+		domainDef.Devices.Graphics = nil
+		if err := setGraphics(d, &domainDef, arch); err != nil {
+			return false, err
+		}
+	}
+	if d.HasChange("video") {
+		domainDef.Devices.Videos = nil
+		setVideo(d, &domainDef)
+	}
+
+	data, err := xmlMarshallIndented(domainDef)
+	if err != nil {
+		return false, fmt.Errorf("Error serializing libvirt domain: %s", err)
+	}
+	log.Printf("[DEBUG] Redefining domain %s with new graphics and video devices", d.Id())
+	newDomain, err := virConn.DomainDefineXML(data)
+	if err != nil {
+		return false, fmt.Errorf("Error changing the graphics and video devices of the domain: %s", err)
+	}
+	defer newDomain.Free()
+
+	return domainIsRunning(*domain)
+}
+
+// findDomainDisk returns the disk of the domain definition with the source of
+// a disk of the resource, or nil when there is none
+func findDomainDisk(virConn *libvirt.Connect, domainDef libvirtxml.Domain, disk map[string]interface{}) (*libvirtxml.DomainDisk, error) {
+	var matches func(libvirtxml.DomainDiskSource) bool
+	if volumeKey, _ := disk["volume_id"].(string); volumeKey != "" {
+		volume, err := virConn.LookupStorageVolByKey(volumeKey)
+		if err != nil {
+			return nil, fmt.Errorf("Can't retrieve volume %s: %v", volumeKey, err)
+		}
+		defer volume.Free()
+		volumeName, err := volume.GetName()
+		if err != nil {
+			return nil, fmt.Errorf("Can't retrieve name for volume %s", volumeKey)
+		}
+		pool, err := volume.LookupPoolByVolume()
+		if err != nil {
+			return nil, fmt.Errorf("Can't retrieve pool for volume %s", volumeKey)
+		}
+		defer pool.Free()
+		poolName, err := pool.GetName()
+		if err != nil {
+			return nil, fmt.Errorf("Can't retrieve name for pool of volume %s", volumeKey)
+		}
+		matches = func(source libvirtxml.DomainDiskSource) bool {
+			return (source.Volume != nil && source.Volume.Pool == poolName && source.Volume.Volume == volumeName) ||
+				(source.File != nil && source.File.File == volumeKey)
+		}
+	} else if rawURL, _ := disk["url"].(string); rawURL != "" {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		matches = func(source libvirtxml.DomainDiskSource) bool {
+			return source.Network != nil && source.Network.Name == u.Path &&
+				len(source.Network.Hosts) > 0 && source.Network.Hosts[0].Name == u.Hostname()
+		}
+	} else if file, _ := disk["file"].(string); file != "" {
+		matches = func(source libvirtxml.DomainDiskSource) bool {
+			return source.File != nil && source.File.File == file
+		}
+	} else {
+		return nil, nil
+	}
+
+	for i, diskDef := range domainDef.Devices.Disks {
+		if diskDef.Source != nil && matches(*diskDef.Source) {
+			return &domainDef.Devices.Disks[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// freeDiskTargetDev returns the target device of a disk to be attached: the
+// one given by setDisks, unless another disk of the domain uses it
+func freeDiskTargetDev(dev string, used map[string]bool) string {
+	if !used[dev] || len(dev) < 3 {
+		return dev
+	}
+	for i := 0; ; i++ {
+		if free := dev[:2] + diskLetterForIndex(i); !used[free] {
+			return free
+		}
+	}
+}
+
+// attachDomainDevice hot-plugs a device in the domain, or adds it to its
+// persistent configuration when that is not possible
+func attachDomainDevice(domain *libvirt.Domain, what string, device interface{}) (bool, error) {
+	data, err := xml.Marshal(device)
+	if err != nil {
+		return false, fmt.Errorf("Error serializing %s: %s", what, err)
+	}
+	return attachDomainDeviceXML(domain, what, string(data))
+}
+
+// attachDomainDeviceXML hot-plugs the device with the given XML definition,
+// see attachDomainDevice
+func attachDomainDeviceXML(domain *libvirt.Domain, what string, data string) (bool, error) {
+	log.Printf("[DEBUG] Attaching %s to domain:\n%s", what, data)
+	return domainApplyLiveOrConfig(domain, "devices", func(live bool) error {
+		flags := libvirt.DOMAIN_DEVICE_MODIFY_CONFIG
+		if live {
+			flags |= libvirt.DOMAIN_DEVICE_MODIFY_LIVE
+		}
+		return domain.AttachDeviceFlags(data, flags)
+	})
+}
+
+// detachDomainDevice hot-unplugs a device from the domain, or removes it from
+// its persistent configuration when that is not possible
+func detachDomainDevice(domain *libvirt.Domain, what string, device interface{}) (bool, error) {
+	data, err := xml.Marshal(device)
+	if err != nil {
+		return false, fmt.Errorf("Error serializing %s: %s", what, err)
+	}
+
+	log.Printf("[DEBUG] Detaching %s from domain:\n%s", what, data)
+	return domainApplyLiveOrConfig(domain, "devices", func(live bool) error {
+		flags := libvirt.DOMAIN_DEVICE_MODIFY_CONFIG
+		if live {
+			flags |= libvirt.DOMAIN_DEVICE_MODIFY_LIVE
+		}
+		return domain.DetachDeviceFlags(string(data), flags)
+	})
+}
+
+// updateDomainDisks hot-plugs and unplugs the disks that changed in the
+// resource. The disks are matched by their source, so the ones that are kept
+// are left alone even when their position in the list changes. Returns true
+// when the domain needs to be restarted.
+func updateDomainDisks(d *schema.ResourceData, domain *libvirt.Domain, virConn *libvirt.Connect) (bool, error) {
+	oldDisksI, newDisksI := d.GetChange("disk")
+	oldDisks := oldDisksI.([]interface{})
+	newDisks := newDisksI.([]interface{})
+
+	// build the new disks the same way we do when creating the domain
+	newDef := libvirtxml.Domain{Devices: &libvirtxml.DomainDeviceList{}}
+	if err := setDisks(d, &newDef, virConn); err != nil {
+		return false, err
+	}
+
+	currentDef, err := getXMLDomainDefFromLibvirt(domain)
+	if err != nil {
+		return false, err
+	}
+
+	// the disks present in both lists are kept
+	kept := make([]bool, len(newDisks))
+	var removed []map[string]interface{}
+	for _, oldDiskI := range oldDisks {
+		oldDisk := oldDiskI.(map[string]interface{})
+		found := false
+		for j, newDisk := range newDisks {
+			if !kept[j] && reflect.DeepEqual(oldDisk, newDisk) {
+				kept[j] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			removed = append(removed, oldDisk)
+		}
+	}
+
+	used := make(map[string]bool)
+	for _, diskDef := range currentDef.Devices.Disks {
+		if diskDef.Target != nil {
+			used[diskDef.Target.Dev] = true
+		}
+	}
+
+	restart := false
+	for _, oldDisk := range removed {
+		diskDef, err := findDomainDisk(virConn, currentDef, oldDisk)
+		if err != nil {
+			return false, err
+		}
+		if diskDef == nil || diskDef.Target == nil {
+			log.Printf("[DEBUG] Disk %v is not in the domain anymore", oldDisk)
+			continue
+		}
+		detachRestart, err := detachDomainDevice(domain, "disk "+diskDef.Target.Dev, diskDef)
+		if err != nil {
+			return false, err
+		}
+		restart = restart || detachRestart
+		delete(used, diskDef.Target.Dev)
+	}
+
+	for j := range newDisks {
+		if kept[j] {
+			continue
+		}
+		diskDef := newDef.Devices.Disks[j]
+		diskDef.Target.Dev = freeDiskTargetDev(diskDef.Target.Dev, used)
+		used[diskDef.Target.Dev] = true
+
+		attachRestart, err := attachDomainDevice(domain, "disk "+diskDef.Target.Dev, diskDef)
+		if err != nil {
+			return false, err
+		}
+		restart = restart || attachRestart
+	}
+
+	return restart, nil
+}
+
+// attributes of a network_interface that define the device itself: changing
+// any of them means replacing the device in the domain
+var networkInterfaceDeviceKeys = []string{
+	"network_id",
+	"network_name",
+	"bridge",
+	"vepa",
+	"macvtap",
+	"passthrough",
+	"user",
+	"port_forward",
+	"mac",
+	"filterref",
+	"model",
+	"driver",
+	"mtu",
+}
+
+// networkInterfaceDeviceChanged returns whether the device defined by a
+// network_interface changed
+func networkInterfaceDeviceChanged(oldIface, newIface map[string]interface{}) bool {
+	if oldIface == nil || newIface == nil {
+		return oldIface != nil || newIface != nil
+	}
+	for _, key := range networkInterfaceDeviceKeys {
+		if !reflect.DeepEqual(oldIface[key], newIface[key]) {
+			return true
+		}
+	}
+	return false
+}
+
+// updateDomainNetworkInterfaces hot-plugs and unplugs the network interfaces
+// that changed in the resource, updating their static DHCP hosts. The new
+// interfaces whose leases have to be waited for are added to waitForLeases,
+// and to partialNetIfaces when their hosts can only be added after that.
+// Returns true when the domain needs to be restarted.
+func updateDomainNetworkInterfaces(d *schema.ResourceData, domain *libvirt.Domain, virConn *libvirt.Connect,
+	partialNetIfaces map[string]*pendingMapping, waitForLeases *[]*libvirtxml.DomainInterface) (bool, error) {
+	oldIfacesI, newIfacesI := d.GetChange("network_interface")
+	oldIfaces := oldIfacesI.([]interface{})
+	newIfaces := newIfacesI.([]interface{})
+
+	currentDef, err := getXMLDomainDefFromLibvirt(domain)
+	if err != nil {
+		return false, err
+	}
+
+	// build the new interfaces the same way we do when creating the domain
+	newDef := libvirtxml.Domain{
+		Type: currentDef.Type,
+		Name: currentDef.Name,
+		OS:   currentDef.OS,
+		Devices: &libvirtxml.DomainDeviceList{
+			Emulator: currentDef.Devices.Emulator,
+		},
+	}
+	// the DHCP hosts are only updated for the interfaces that changed
+	var newIfacesWaiting []*libvirtxml.DomainInterface
+	if err := setNetworkInterfaces(d, &newDef, virConn, nil, &newIfacesWaiting); err != nil {
+		return false, err
+	}
+	if err := checkDomainInterfacesCapabilities(virConn, &newDef); err != nil {
+		return false, err
+	}
+
+	restart := false
+	for i := 0; i < len(oldIfaces) || i < len(newIfaces); i++ {
+		var oldIface, newIface map[string]interface{}
+		if i < len(oldIfaces) {
+			oldIface = oldIfaces[i].(map[string]interface{})
+		}
+		if i < len(newIfaces) {
+			newIface = newIfaces[i].(map[string]interface{})
+		}
+		if !networkInterfaceDeviceChanged(oldIface, newIface) {
+			// the QoS limits can be changed without replacing the device
+			if !reflect.DeepEqual(oldIface["bandwidth"], newIface["bandwidth"]) {
+				bandwidthRestart, err := updateDomainInterfaceBandwidth(domain, currentDef, newDef.Devices.Interfaces[i])
+				if err != nil {
+					return false, err
+				}
+				restart = restart || bandwidthRestart
+			}
+			continue
+		}
+
+		if oldIface != nil {
+			mac := strings.ToUpper(oldIface["mac"].(string))
+			for _, ifaceDef := range currentDef.Devices.Interfaces {
+				if ifaceDef.MAC == nil || strings.ToUpper(ifaceDef.MAC.Address) != mac {
+					continue
+				}
+				detachRestart, err := detachDomainDevice(domain, "network interface "+mac, ifaceDef)
+				if err != nil {
+					return false, err
+				}
+				restart = restart || detachRestart
+				break
+			}
+
+			hostname, _ := oldIface["hostname"].(string)
+			if hostname == "" {
+				hostname = d.Get("name").(string)
+			}
+			removeDomainInterfaceHosts(virConn, oldIface, hostname)
+		}
+
+		if newIface != nil {
+			netIface := newDef.Devices.Interfaces[i]
+			userPatches, err := getDomainInterfaceUserPatches(d, fmt.Sprintf("network_interface.%d", i), "/interface")
+			if err != nil {
+				return false, err
+			}
+			data, err := xml.Marshal(netIface)
+			if err != nil {
+				return false, fmt.Errorf("Error serializing network interface %s: %s", netIface.MAC.Address, err)
+			}
+			ifaceXML, err := patchXML(string(data), userPatches)
+			if err != nil {
+				return false, fmt.Errorf("Error adding the user mode network interface %s: %s", netIface.MAC.Address, err)
+			}
+			attachRestart, err := attachDomainDeviceXML(domain, "network interface "+netIface.MAC.Address, ifaceXML)
+			if err != nil {
+				return false, err
+			}
+			restart = restart || attachRestart
+
+			if err := updateDomainInterfaceHosts(d, i, virConn, &newDef.Devices.Interfaces[i],
+				newIfacesWaiting, partialNetIfaces, waitForLeases); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	return restart, nil
+}
+
+// updateDomainInterfaceHosts adds the static DHCP hosts of a network
+// interface attached to the domain, see updateDomainNetworkInterfaces
+func updateDomainInterfaceHosts(d *schema.ResourceData, i int, virConn *libvirt.Connect,
+	netIface *libvirtxml.DomainInterface, ifacesWaiting []*libvirtxml.DomainInterface,
+	partialNetIfaces map[string]*pendingMapping, waitForLeases *[]*libvirtxml.DomainInterface) error {
+	prefix := fmt.Sprintf("network_interface.%d", i)
+
+	wait := false
+	for _, iface := range ifacesWaiting {
+		if iface.MAC.Address == netIface.MAC.Address {
+			wait = true
+			*waitForLeases = append(*waitForLeases, netIface)
+			break
+		}
+	}
+
+	networkUUID, ok := d.GetOk(prefix + ".network_id")
+	if !ok {
+		return nil
+	}
+	network, err := virConn.LookupNetworkByUUIDString(networkUUID.(string))
+	if err != nil {
+		return fmt.Errorf("Can't retrieve network ID %s", networkUUID)
+	}
+	networkName, err := network.GetName()
+	if err != nil {
+		network.Free()
+		return fmt.Errorf("Error retrieving network name: %s", err)
+	}
+	networkDef, err := getXMLNetworkDefFromLibvirt(network)
+	if err != nil {
+		network.Free()
+		return err
+	}
+	if !HasDHCP(networkDef) {
+		network.Free()
+		return nil
+	}
+
+	if err := setDomainInterfaceHosts(d, prefix, netIface.MAC.Address, wait, network, networkName, partialNetIfaces); err != nil {
+		network.Free()
+		return err
+	}
+	// a pending host is added with the network once the lease is obtained
+	if _, ok := partialNetIfaces[strings.ToUpper(netIface.MAC.Address)]; !ok {
+		network.Free()
+	}
+	return nil
+}
+
+// addDomainPendingHosts adds the static DHCP hosts of the network interfaces
+// that were waiting for their leases, with the addresses they got
+func addDomainPendingHosts(d *schema.ResourceData, domain *libvirt.Domain, partialNetIfaces map[string]*pendingMapping) error {
+	if len(partialNetIfaces) == 0 {
+		return nil
+	}
+
+	ifacesWithAddr, err := domainGetIfacesInfo(*domain, d)
+	if err != nil {
+		return fmt.Errorf("Error retrieving interface addresses: %s", err)
+	}
+	for mac, pending := range partialNetIfaces {
+		found := false
+		for _, iface := range ifacesWithAddr {
+			if strings.ToUpper(iface.Hwaddr) != mac {
+				continue
+			}
+			for _, addr := range iface.Addrs {
+				found = true
+				log.Printf("[INFO] Finally adding IP/MAC/host=%s/%s/%s", addr.Addr, mac, pending.hostname)
+				if err := updateOrAddHost(pending.network, addr.Addr, mac, pending.hostname); err != nil {
+					return fmt.Errorf("Could not add IP/MAC/host=%s/%s/%s: %s", addr.Addr, mac, pending.hostname, err)
+				}
+			}
+		}
+		pending.network.Free()
+		if !found {
+			return fmt.Errorf("Did not obtain the IP address for MAC=%s", mac)
+		}
+	}
+	return nil
+}
+
+// updateDomainInterfaceBandwidth changes the QoS limits of a network
+// interface, live when possible. Returns true when the domain needs to be
+// restarted.
+func updateDomainInterfaceBandwidth(domain *libvirt.Domain, currentDef libvirtxml.Domain, netIface libvirtxml.DomainInterface) (bool, error) {
+	mac := netIface.MAC.Address
+
+	var current *libvirtxml.DomainInterfaceBandwidth
+	for _, ifaceDef := range currentDef.Devices.Interfaces {
+		if ifaceDef.MAC != nil && strings.ToUpper(ifaceDef.MAC.Address) == mac {
+			current = ifaceDef.Bandwidth
+			break
+		}
+	}
+
+	params := newDomainInterfaceParameters(current, netIface.Bandwidth)
+	log.Printf("[DEBUG] Setting bandwidth of network interface %s: %+v", mac, params)
+	return domainApplyLiveOrConfig(domain, "bandwidth of network interface "+mac, func(live bool) error {
+		flags := libvirt.DOMAIN_AFFECT_CONFIG
+		if live {
+			flags |= libvirt.DOMAIN_AFFECT_LIVE
+		}
+		// libvirt finds the interface by its MAC address too
+		return domain.SetInterfaceParameters(mac, params, flags)
+	})
+}
 
+// domainRestart shuts down the domain and starts it again, so changes done
+// to its persistent configuration take effect
+func domainRestart(d *schema.ResourceData, domain *libvirt.Domain, timeout time.Duration) error {
+	methods := getShutdownMethodsFromResource(d)
+	timeout, err := getShutdownTimeoutFromResource(d, timeout)
+	if err != nil {
+		return err
+	}
+
+	if err := domainShutdown(domain, methods, timeout); err != nil {
+		return err
+	}
+
+	if err := domain.Create(); err != nil {
+		return fmt.Errorf("Error starting libvirt domain: %s", err)
+	}
+	return nil
+}
+
+// waitForDomainState returns the state of the domain, as a string
+func waitForDomainState(domain *libvirt.Domain) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		state, err := domainGetState(*domain)
+		if err != nil {
+			return nil, "", err
+		}
+		return domain, state, nil
+	}
+}
+
+// getShutdownMethodsFromResource returns the graceful shutdown methods to try,
+// in order, before destroying the domain. Terraform doesn't tell an empty
+// list apart from a missing one, so both mean the default methods.
+func getShutdownMethodsFromResource(d *schema.ResourceData) []string {
+	var methods []string
+	if d.Get("shutdown.#").(int) > 0 {
+		for _, methodI := range d.Get("shutdown.0.methods").([]interface{}) {
+			methods = append(methods, methodI.(string))
+		}
+	}
+	if len(methods) == 0 {
+		return []string{domainShutdownACPI, domainShutdownAgent}
+	}
+	return methods
+}
+
+// getShutdownTimeoutFromResource returns how long the guest is given to shut
+// down, which can't be longer than the timeout of the operation
+func getShutdownTimeoutFromResource(d *schema.ResourceData, operationTimeout time.Duration) (time.Duration, error) {
+	timeout := defaultDomainShutdownTimeout
+	if d.Get("shutdown.#").(int) > 0 {
+		var err error
+		if timeout, err = time.ParseDuration(d.Get("shutdown.0.timeout").(string)); err != nil {
+			return 0, fmt.Errorf("invalid shutdown timeout: %s", err)
+		}
+	}
+	if timeout > operationTimeout {
+		return operationTimeout, nil
+	}
+	return timeout, nil
+}
+
+func validateDomainShutdownTimeout(v interface{}, k string) ([]string, []error) {
+	if timeout, err := time.ParseDuration(v.(string)); err != nil || timeout < 0 {
+		return nil, []error{fmt.Errorf("%q must be a duration, like \"30s\" or \"2m\", got %q", k, v.(string))}
+	}
+	return nil, nil
+}
+
+// domainShutdown stops a domain trying the graceful shutdown methods in
+// order, giving each one an equal share of the timeout. When none of them
+// succeeds, or the timeout is zero, the domain is destroyed.
+func domainShutdown(domain *libvirt.Domain, methods []string, timeout time.Duration) error {
+	domainID, err := domain.GetUUIDString()
 	if err != nil {
 		return fmt.Errorf("Error retrieving libvirt domain id: %s", err)
 	}
 
-	log.Printf("Destroying libvirt domain %s", domainID)
 	state, _, err := domain.GetState()
 	if err != nil {
 		return fmt.Errorf("Couldn't get info about domain: %s", err)
 	}
+	if state != libvirt.DOMAIN_RUNNING && state != libvirt.DOMAIN_PAUSED {
+		return nil
+	}
+
+	// a paused guest can't react to any graceful shutdown request
+	if state == libvirt.DOMAIN_RUNNING && timeout > 0 {
+		for _, method := range methods {
+			flags := libvirt.DOMAIN_SHUTDOWN_ACPI_POWER_BTN
+			if method == domainShutdownAgent {
+				flags = libvirt.DOMAIN_SHUTDOWN_GUEST_AGENT
+			}
+
+			log.Printf("[DEBUG] Shutting down domain %s using the '%s' method", domainID, method)
+			if err := domain.ShutdownFlags(flags); err != nil {
+				log.Printf("[DEBUG] Couldn't shutdown domain %s using the '%s' method: %s", domainID, method, err)
+				continue
+			}
 
-	if state == libvirt.DOMAIN_RUNNING || state == libvirt.DOMAIN_PAUSED {
-		if err := domain.Destroy(); err != nil {
-			return fmt.Errorf("Couldn't destroy libvirt domain: %s", err)
+			stateConf := &resource.StateChangeConf{
+				Pending:    []string{"running", "blocked", "paused", "shutdown"},
+				Target:     []string{"shutoff"},
+				Refresh:    waitForDomainState(domain),
+				Timeout:    timeout / time.Duration(len(methods)),
+				Delay:      2 * time.Second,
+				MinTimeout: 2 * time.Second,
+			}
+			if _, err := stateConf.WaitForState(); err != nil {
+				log.Printf("[DEBUG] Domain %s did not shutdown using the '%s' method: %s", domainID, method, err)
+				continue
+			}
+
+			log.Printf("[DEBUG] Domain %s was stopped using the '%s' method", domainID, method)
+			return nil
 		}
 	}
 
+	if err := domain.Destroy(); err != nil {
+		return fmt.Errorf("Couldn't destroy libvirt domain: %s", err)
+	}
+	log.Printf("[DEBUG] Domain %s was stopped using the 'destroy' method", domainID)
+
 	return nil
 }
+
+// destroyDomainByUserRequest stops the domain when the user asked
+// for it not to be running
+func destroyDomainByUserRequest(d *schema.ResourceData, domain *libvirt.Domain, timeout time.Duration) error {
+	if d.Get("running").(bool) {
+		return nil
+	}
+
+	methods := getShutdownMethodsFromResource(d)
+	timeout, err := getShutdownTimeoutFromResource(d, timeout)
+	if err != nil {
+		return err
+	}
+
+	return domainShutdown(domain, methods, timeout)
+}
@@ -0,0 +1,405 @@
+package libvirt
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/dmacvicar/terraform-provider-libvirt/libvirt/internal/xslt"
+	"github.com/hashicorp/terraform/helper/schema"
+	libvirt "github.com/libvirt/libvirt-go"
+	"github.com/libvirt/libvirt-go-xml"
+)
+
+// the model of the network interfaces when none is given
+const defaultDomainInterfaceModel = "virtio"
+
+// the characters libvirt accepts in the model of a network interface
+const domainInterfaceModelChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-"
+
+// the backends of the virtio network interfaces
+var domainInterfaceDriverNames = []string{"qemu", "vhost"}
+
+// domainInterfaceDriverSchema returns the schema of the backend driver of a
+// virtio network interface
+func domainInterfaceDriverSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"name": {
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: validateStringInSlice(domainInterfaceDriverNames),
+				},
+				"queues": {
+					Type:         schema.TypeInt,
+					Optional:     true,
+					ValidateFunc: validateDomainInterfaceQueues,
+				},
+				"rx_queue_size": {
+					Type:         schema.TypeInt,
+					Optional:     true,
+					ValidateFunc: validateDomainInterfaceQueueSize,
+				},
+				"tx_queue_size": {
+					Type:         schema.TypeInt,
+					Optional:     true,
+					ValidateFunc: validateDomainInterfaceQueueSize,
+				},
+			},
+		},
+	}
+}
+
+func validateDomainInterfaceModel(v interface{}, k string) ([]string, []error) {
+	model := v.(string)
+	if model == "" || strings.Trim(model, domainInterfaceModelChars) != "" {
+		return nil, []error{fmt.Errorf("%q must only contain letters, digits, '_' and '-', got '%s'", k, model)}
+	}
+	return nil, nil
+}
+
+// suppressDomainInterfaceModelDiff keeps the model of an existing network
+// interface when the domain has an XSLT, which may have changed it
+func suppressDomainInterfaceModelDiff(k, old, new string, d *schema.ResourceData) bool {
+	return old != "" && d.Get("xml.0.xslt").(string) != ""
+}
+
+func validateDomainInterfaceQueues(v interface{}, k string) ([]string, []error) {
+	if queues := v.(int); queues < 1 {
+		return nil, []error{fmt.Errorf("%q must be at least 1, got %d", k, queues)}
+	}
+	return nil, nil
+}
+
+// validateDomainInterfaceQueueSize checks the size of a virtqueue is a power
+// of two QEMU supports
+func validateDomainInterfaceQueueSize(v interface{}, k string) ([]string, []error) {
+	size := v.(int)
+	if size < 256 || size > 1024 || size&(size-1) != 0 {
+		return nil, []error{fmt.Errorf("%q must be 256, 512 or 1024, got %d", k, size)}
+	}
+	return nil, nil
+}
+
+func validateDomainInterfaceMTU(v interface{}, k string) ([]string, []error) {
+	if mtu := v.(int); mtu < 68 || mtu > 65535 {
+		return nil, []error{fmt.Errorf("%q must be between 68 and 65535, got %d", k, mtu)}
+	}
+	return nil, nil
+}
+
+// getDomainInterfaceDriverFromResource returns the backend driver of a
+// network interface, if any
+func getDomainInterfaceDriverFromResource(d *schema.ResourceData, prefix string) *libvirtxml.DomainInterfaceDriver {
+	if d.Get(prefix+".driver.#").(int) == 0 {
+		return nil
+	}
+	return &libvirtxml.DomainInterfaceDriver{
+		Name:        d.Get(prefix + ".driver.0.name").(string),
+		Queues:      uint(d.Get(prefix + ".driver.0.queues").(int)),
+		RXQueueSize: uint(d.Get(prefix + ".driver.0.rx_queue_size").(int)),
+		TXQueueSize: uint(d.Get(prefix + ".driver.0.tx_queue_size").(int)),
+	}
+}
+
+// getDomainInterfaceMTUFromResource returns the MTU of a network interface,
+// if any
+func getDomainInterfaceMTUFromResource(d *schema.ResourceData, prefix string) *libvirtxml.DomainInterfaceMTU {
+	if mtu, ok := d.GetOk(prefix + ".mtu"); ok {
+		return &libvirtxml.DomainInterfaceMTU{
+			Size: uint(mtu.(int)),
+		}
+	}
+	return nil
+}
+
+// flattenDomainInterfaceDriver returns the driver block of a network
+// interface
+func flattenDomainInterfaceDriver(driver *libvirtxml.DomainInterfaceDriver) []map[string]interface{} {
+	if driver == nil || (driver.Name == "" && driver.Queues == 0 && driver.RXQueueSize == 0 && driver.TXQueueSize == 0) {
+		return []map[string]interface{}{}
+	}
+	return []map[string]interface{}{
+		{
+			"name":          driver.Name,
+			"queues":        int(driver.Queues),
+			"rx_queue_size": int(driver.RXQueueSize),
+			"tx_queue_size": int(driver.TXQueueSize),
+		},
+	}
+}
+
+// flattenDomainInterfaceModel returns the model of a network interface
+func flattenDomainInterfaceModel(model *libvirtxml.DomainInterfaceModel) string {
+	if model == nil {
+		return ""
+	}
+	return model.Type
+}
+
+// flattenDomainInterfaceMTU returns the MTU of a network interface, 0 when
+// it is not set
+func flattenDomainInterfaceMTU(mtu *libvirtxml.DomainInterfaceMTU) int {
+	if mtu == nil {
+		return 0
+	}
+	return int(mtu.Size)
+}
+
+// domainInterfacesNeedCapabilities returns whether checking the network
+// interfaces requires the capabilities of the domain
+func domainInterfacesNeedCapabilities(interfaces []libvirtxml.DomainInterface) bool {
+	for _, iface := range interfaces {
+		if iface.Driver != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDomainInterfacesDef checks the models, drivers and MTUs of the
+// network interfaces can be used by the domain with the given capabilities,
+// so that the errors are reported before libvirt, or QEMU when starting the
+// domain, rejects them
+func validateDomainInterfacesDef(caps libvirtxml.DomainCaps, interfaces []libvirtxml.DomainInterface) error {
+	for i, iface := range interfaces {
+		model := flattenDomainInterfaceModel(iface.Model)
+
+		if driver := iface.Driver; driver != nil {
+			if model != "virtio" {
+				return fmt.Errorf("The driver of network interface %d is only supported with the virtio model, got '%s'", i, model)
+			}
+			if driver.Name == "vhost" && caps.Domain != "" && caps.Domain != "kvm" {
+				return fmt.Errorf("The vhost driver of network interface %d is only supported by kvm domains, got '%s'", i, caps.Domain)
+			}
+			if caps.VCPU != nil && caps.VCPU.Max > 0 && driver.Queues > caps.VCPU.Max {
+				return fmt.Errorf("The %d queues of network interface %d exceed the %d vCPUs supported by the domain",
+					driver.Queues, i, caps.VCPU.Max)
+			}
+		}
+
+		if iface.MTU != nil {
+			// the MTU is set on the tap device backing the interface
+			if iface.Source == nil || (iface.Source.Network == nil && iface.Source.Bridge == nil) {
+				return fmt.Errorf("The MTU of network interface %d is only supported for interfaces attached to a network or a bridge", i)
+			}
+		}
+	}
+	return nil
+}
+
+// checkDomainInterfacesCapabilities validates the network interfaces of the
+// domain against its capabilities
+func checkDomainInterfacesCapabilities(virConn *libvirt.Connect, domainDef *libvirtxml.Domain) error {
+	if !domainInterfacesNeedCapabilities(domainDef.Devices.Interfaces) {
+		return validateDomainInterfacesDef(libvirtxml.DomainCaps{}, domainDef.Devices.Interfaces)
+	}
+
+	caps, err := getDomainCapabilities(virConn, domainDef)
+	if err != nil {
+		return err
+	}
+	return validateDomainInterfacesDef(caps, domainDef.Devices.Interfaces)
+}
+
+// the backends of the user mode network interfaces
+var domainInterfaceUserBackends = []string{"slirp", "passt"}
+
+// domainInterfacePortForward is a port of the host forwarded to a user mode
+// network interface. libvirt-go-xml doesn't support it yet.
+type domainInterfacePortForward struct {
+	XMLName xml.Name                          `xml:"portForward"`
+	Proto   string                            `xml:"proto,attr,omitempty"`
+	Address string                            `xml:"address,attr,omitempty"`
+	Ranges  []domainInterfacePortForwardRange `xml:"range"`
+}
+
+type domainInterfacePortForwardRange struct {
+	Start uint `xml:"start,attr"`
+	To    uint `xml:"to,attr,omitempty"`
+}
+
+// domainInterfaceUserDef holds the parts of the definition of the network
+// interfaces libvirt-go-xml doesn't read
+type domainInterfaceUserDef struct {
+	Type    string `xml:"type,attr"`
+	Backend struct {
+		Type string `xml:"type,attr"`
+	} `xml:"backend"`
+	PortForwards []domainInterfacePortForward `xml:"portForward"`
+}
+
+// domainInterfacePortForwardSchema returns the schema of the ports of the
+// host forwarded to a user mode network interface
+func domainInterfacePortForwardSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"protocol": {
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      "tcp",
+					ValidateFunc: validateNetworkPortForwardProtocol,
+				},
+				"host_address": {
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: validateNetworkPortForwardAddress,
+				},
+				"host_port": {
+					Type:         schema.TypeInt,
+					Required:     true,
+					ValidateFunc: validateNetworkPortForwardPort,
+				},
+				"guest_port": {
+					Type:         schema.TypeInt,
+					Optional:     true,
+					Computed:     true,
+					ValidateFunc: validateNetworkPortForwardPort,
+				},
+			},
+		},
+	}
+}
+
+// getDomainInterfacePortForwardsFromResource returns the ports of the host
+// forwarded to a network interface. Only the passt backend of user mode
+// interfaces supports them.
+func getDomainInterfacePortForwardsFromResource(d *schema.ResourceData, prefix string) ([]domainInterfacePortForward, error) {
+	count := d.Get(prefix + ".port_forward.#").(int)
+	if count == 0 {
+		return nil, nil
+	}
+	if backend := d.Get(prefix + ".user").(string); backend != "passt" {
+		return nil, fmt.Errorf("The port forwards of %s are only supported by user mode interfaces with the passt backend", prefix)
+	}
+
+	portForwards := make([]domainInterfacePortForward, 0, count)
+	for i := 0; i < count; i++ {
+		forwardPrefix := fmt.Sprintf("%s.port_forward.%d", prefix, i)
+		portForwardRange := domainInterfacePortForwardRange{
+			Start: uint(d.Get(forwardPrefix + ".host_port").(int)),
+		}
+		if guestPort := uint(d.Get(forwardPrefix + ".guest_port").(int)); guestPort != 0 && guestPort != portForwardRange.Start {
+			portForwardRange.To = guestPort
+		}
+		portForwards = append(portForwards, domainInterfacePortForward{
+			Proto:   d.Get(forwardPrefix + ".protocol").(string),
+			Address: d.Get(forwardPrefix + ".host_address").(string),
+			Ranges:  []domainInterfacePortForwardRange{portForwardRange},
+		})
+	}
+	return portForwards, nil
+}
+
+// getDomainInterfaceUserPatches returns the changes adding the backend and
+// the port forwards of a user mode network interface to its XML definition,
+// found at path
+func getDomainInterfaceUserPatches(d *schema.ResourceData, prefix string, path string) ([]xslt.Patch, error) {
+	portForwards, err := getDomainInterfacePortForwardsFromResource(d, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var patches []xslt.Patch
+	if d.Get(prefix+".user").(string) == "passt" {
+		patches = append(patches, xslt.Patch{Action: "append", Path: path, Value: `<backend type="passt"/>`})
+	}
+	for _, portForward := range portForwards {
+		data, err := xml.Marshal(portForward)
+		if err != nil {
+			return nil, fmt.Errorf("Error serializing the port forwards of %s: %s", prefix, err)
+		}
+		patches = append(patches, xslt.Patch{Action: "append", Path: path, Value: string(data)})
+	}
+	return patches, nil
+}
+
+// getDomainInterfacesUserPatches returns the changes adding the backends and
+// port forwards of the user mode network interfaces to the XML definition of
+// the domain
+func getDomainInterfacesUserPatches(d *schema.ResourceData) ([]xslt.Patch, error) {
+	var patches []xslt.Patch
+	for i := 0; i < d.Get("network_interface.#").(int); i++ {
+		ifacePatches, err := getDomainInterfaceUserPatches(d, fmt.Sprintf("network_interface.%d", i),
+			fmt.Sprintf("/domain/devices/interface[%d]", i+1))
+		if err != nil {
+			return nil, err
+		}
+		patches = append(patches, ifacePatches...)
+	}
+	return patches, nil
+}
+
+// getDomainInterfacesUserDefs returns the backends and port forwards of the
+// network interfaces of a domain XML definition, in the same order as the
+// interfaces
+func getDomainInterfacesUserDefs(xmlDesc string) ([]domainInterfaceUserDef, error) {
+	domainDef := struct {
+		XMLName    xml.Name                 `xml:"domain"`
+		Interfaces []domainInterfaceUserDef `xml:"devices>interface"`
+	}{}
+	if err := xml.Unmarshal([]byte(xmlDesc), &domainDef); err != nil {
+		return nil, fmt.Errorf("Error reading libvirt domain XML description: %s", err)
+	}
+	return domainDef.Interfaces, nil
+}
+
+// flattenDomainInterfaceUser returns the backend of a user mode network
+// interface
+func flattenDomainInterfaceUser(userDef domainInterfaceUserDef) string {
+	if userDef.Backend.Type == "" || userDef.Backend.Type == "default" {
+		return "slirp"
+	}
+	return userDef.Backend.Type
+}
+
+// flattenDomainInterfacePortForwards returns the port_forward blocks of a
+// network interface
+func flattenDomainInterfacePortForwards(portForwards []domainInterfacePortForward) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	for _, portForward := range portForwards {
+		protocol := portForward.Proto
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		for _, portForwardRange := range portForward.Ranges {
+			guestPort := portForwardRange.To
+			if guestPort == 0 {
+				guestPort = portForwardRange.Start
+			}
+			result = append(result, map[string]interface{}{
+				"protocol":     protocol,
+				"host_address": portForward.Address,
+				"host_port":    int(portForwardRange.Start),
+				"guest_port":   int(guestPort),
+			})
+		}
+	}
+	return result
+}
+
+// checkDomainUserInterfacesAgent checks that the guest agent is used when
+// waiting for the lease of user mode network interfaces, as their addresses
+// are only known by the guest
+func checkDomainUserInterfacesAgent(diff *schema.ResourceDiff) error {
+	if !diff.NewValueKnown("qemu_agent") || diff.Get("qemu_agent").(bool) {
+		return nil
+	}
+	for i := 0; i < diff.Get("network_interface.#").(int); i++ {
+		prefix := fmt.Sprintf("network_interface.%d", i)
+		if !diff.NewValueKnown(prefix+".user") || !diff.NewValueKnown(prefix+".wait_for_lease") {
+			continue
+		}
+		if diff.Get(prefix+".user").(string) != "" && diff.Get(prefix+".wait_for_lease").(bool) {
+			return fmt.Errorf("%s.wait_for_lease requires qemu_agent to be true: the addresses of user mode interfaces are only known by the guest agent", prefix)
+		}
+	}
+	return nil
+}
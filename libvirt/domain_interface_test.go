@@ -0,0 +1,328 @@
+package libvirt
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/libvirt/libvirt-go-xml"
+)
+
+func TestGetDomainInterfaceDriverFromResource(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibvirtDomain().Schema, map[string]interface{}{
+		"name": "multiqueue",
+		"network_interface": []interface{}{
+			map[string]interface{}{
+				"network_name": "default",
+			},
+			map[string]interface{}{
+				"network_name": "default",
+				"mtu":          9000,
+				"driver": []interface{}{
+					map[string]interface{}{
+						"name":          "vhost",
+						"queues":        4,
+						"rx_queue_size": 1024,
+						"tx_queue_size": 256,
+					},
+				},
+			},
+		},
+	})
+
+	if model := d.Get("network_interface.0.model").(string); model != "virtio" {
+		t.Errorf("Expected the virtio model by default, got '%s'", model)
+	}
+	if driver := getDomainInterfaceDriverFromResource(d, "network_interface.0"); driver != nil {
+		t.Errorf("Expected no driver, got %+v", driver)
+	}
+	if mtu := getDomainInterfaceMTUFromResource(d, "network_interface.0"); mtu != nil {
+		t.Errorf("Expected no MTU, got %+v", mtu)
+	}
+
+	expected := &libvirtxml.DomainInterfaceDriver{
+		Name:        "vhost",
+		Queues:      4,
+		RXQueueSize: 1024,
+		TXQueueSize: 256,
+	}
+	driver := getDomainInterfaceDriverFromResource(d, "network_interface.1")
+	if !reflect.DeepEqual(expected, driver) {
+		t.Errorf("Expected driver %+v, got %+v", expected, driver)
+	}
+	if mtu := getDomainInterfaceMTUFromResource(d, "network_interface.1"); mtu == nil || mtu.Size != 9000 {
+		t.Errorf("Expected a MTU of 9000, got %+v", mtu)
+	}
+
+	flattened := flattenDomainInterfaceDriver(driver)
+	if len(flattened) != 1 || flattened[0]["queues"] != 4 || flattened[0]["name"] != "vhost" {
+		t.Errorf("Unexpected flattened driver: %+v", flattened)
+	}
+	if flattened := flattenDomainInterfaceDriver(&libvirtxml.DomainInterfaceDriver{}); len(flattened) != 0 {
+		t.Errorf("Expected an empty driver not to be flattened, got %+v", flattened)
+	}
+}
+
+func TestValidateDomainInterfaceArguments(t *testing.T) {
+	for _, model := range []string{"virtio", "e1000", "rtl8139", "virtio-net-pci", "spapr-vlan"} {
+		if _, errs := validateDomainInterfaceModel(model, "model"); len(errs) > 0 {
+			t.Errorf("Expected model '%s' to be valid: %v", model, errs)
+		}
+	}
+	for _, model := range []string{"", "virtio net", "e1000,foo=bar"} {
+		if _, errs := validateDomainInterfaceModel(model, "model"); len(errs) == 0 {
+			t.Errorf("Expected model '%s' to be invalid", model)
+		}
+	}
+
+	for _, size := range []int{256, 512, 1024} {
+		if _, errs := validateDomainInterfaceQueueSize(size, "rx_queue_size"); len(errs) > 0 {
+			t.Errorf("Expected queue size %d to be valid: %v", size, errs)
+		}
+	}
+	for _, size := range []int{0, 128, 300, 2048} {
+		if _, errs := validateDomainInterfaceQueueSize(size, "rx_queue_size"); len(errs) == 0 {
+			t.Errorf("Expected queue size %d to be invalid", size)
+		}
+	}
+
+	if _, errs := validateDomainInterfaceQueues(0, "queues"); len(errs) == 0 {
+		t.Errorf("Expected 0 queues to be invalid")
+	}
+	if _, errs := validateDomainInterfaceMTU(67, "mtu"); len(errs) == 0 {
+		t.Errorf("Expected a MTU of 67 to be invalid")
+	}
+	if _, errs := validateDomainInterfaceMTU(1500, "mtu"); len(errs) > 0 {
+		t.Errorf("Expected a MTU of 1500 to be valid: %v", errs)
+	}
+}
+
+func TestValidateDomainInterfacesDef(t *testing.T) {
+	caps := libvirtxml.DomainCaps{
+		Domain: "kvm",
+		VCPU:   &libvirtxml.DomainCapsVCPU{Max: 8},
+	}
+	network := &libvirtxml.DomainInterfaceSource{
+		Network: &libvirtxml.DomainInterfaceSourceNetwork{Network: "default"},
+	}
+	macvtap := &libvirtxml.DomainInterfaceSource{
+		Direct: &libvirtxml.DomainInterfaceSourceDirect{Dev: "eth0", Mode: "bridge"},
+	}
+	iface := func(model string, source *libvirtxml.DomainInterfaceSource, driver *libvirtxml.DomainInterfaceDriver, mtu uint) libvirtxml.DomainInterface {
+		result := libvirtxml.DomainInterface{
+			Model:  &libvirtxml.DomainInterfaceModel{Type: model},
+			Source: source,
+			Driver: driver,
+		}
+		if mtu > 0 {
+			result.MTU = &libvirtxml.DomainInterfaceMTU{Size: mtu}
+		}
+		return result
+	}
+
+	valid := []libvirtxml.DomainInterface{
+		iface("virtio", network, nil, 0),
+		iface("e1000", network, nil, 1400),
+		iface("virtio", network, &libvirtxml.DomainInterfaceDriver{Name: "vhost", Queues: 8}, 9000),
+		iface("rtl8139", macvtap, nil, 0),
+	}
+	if err := validateDomainInterfacesDef(caps, valid); err != nil {
+		t.Errorf("Expected the interfaces to be valid: %s", err)
+	}
+	if !domainInterfacesNeedCapabilities(valid) {
+		t.Errorf("Expected the capabilities to be needed for the driver")
+	}
+	if domainInterfacesNeedCapabilities(valid[:2]) {
+		t.Errorf("Expected the capabilities not to be needed without driver")
+	}
+
+	qemuCaps := libvirtxml.DomainCaps{Domain: "qemu"}
+	for _, tc := range []struct {
+		caps  libvirtxml.DomainCaps
+		iface libvirtxml.DomainInterface
+	}{
+		{caps, iface("e1000", network, &libvirtxml.DomainInterfaceDriver{Queues: 2}, 0)},
+		{caps, iface("virtio", network, &libvirtxml.DomainInterfaceDriver{Queues: 16}, 0)},
+		{qemuCaps, iface("virtio", network, &libvirtxml.DomainInterfaceDriver{Name: "vhost"}, 0)},
+		{caps, iface("virtio", macvtap, nil, 1400)},
+	} {
+		if err := validateDomainInterfacesDef(tc.caps, []libvirtxml.DomainInterface{tc.iface}); err == nil {
+			t.Errorf("Expected interface %+v to be invalid with capabilities %+v", tc.iface, tc.caps)
+		}
+	}
+}
+
+func TestGetDomainInterfacesUserPatches(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibvirtDomain().Schema, map[string]interface{}{
+		"name": "unprivileged",
+		"network_interface": []interface{}{
+			map[string]interface{}{
+				"user": "slirp",
+				"mac":  "52:54:00:00:00:01",
+			},
+			map[string]interface{}{
+				"user": "passt",
+				"mac":  "52:54:00:00:00:02",
+				"port_forward": []interface{}{
+					map[string]interface{}{
+						"host_port":  2222,
+						"guest_port": 22,
+					},
+					map[string]interface{}{
+						"protocol":     "udp",
+						"host_address": "127.0.0.1",
+						"host_port":    5353,
+					},
+				},
+			},
+		},
+	})
+
+	domainDef := libvirtxml.Domain{
+		Name:    "unprivileged",
+		Devices: &libvirtxml.DomainDeviceList{},
+	}
+	var waitForLeases []*libvirtxml.DomainInterface
+	if err := setNetworkInterfaces(d, &domainDef, nil, nil, &waitForLeases); err != nil {
+		t.Fatal(err)
+	}
+	for i, iface := range domainDef.Devices.Interfaces {
+		if iface.Source == nil || iface.Source.User == nil {
+			t.Errorf("Expected network interface %d to be a user mode one, got %+v", i, iface.Source)
+		}
+		if iface.Model == nil || iface.Model.Type != defaultDomainInterfaceModel {
+			t.Errorf("Expected network interface %d to use the virtio model by default, got %+v", i, iface.Model)
+		}
+	}
+
+	data, err := xml.Marshal(domainDef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patches, err := getDomainInterfacesUserPatches(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 3 {
+		t.Fatalf("Expected 3 patches, got %+v", patches)
+	}
+	result, err := patchXML(string(data), patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userDefs, err := getDomainInterfacesUserDefs(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(userDefs) != 2 {
+		t.Fatalf("Expected 2 network interfaces, got %+v", userDefs)
+	}
+	if userDefs[0].Type != "user" || flattenDomainInterfaceUser(userDefs[0]) != "slirp" || len(userDefs[0].PortForwards) != 0 {
+		t.Errorf("Unexpected first network interface: %+v", userDefs[0])
+	}
+	if userDefs[1].Type != "user" || flattenDomainInterfaceUser(userDefs[1]) != "passt" {
+		t.Errorf("Unexpected second network interface: %+v", userDefs[1])
+	}
+
+	expected := []map[string]interface{}{
+		{
+			"protocol":     "tcp",
+			"host_address": "",
+			"host_port":    2222,
+			"guest_port":   22,
+		},
+		{
+			"protocol":     "udp",
+			"host_address": "127.0.0.1",
+			"host_port":    5353,
+			"guest_port":   5353,
+		},
+	}
+	if flattened := flattenDomainInterfacePortForwards(userDefs[1].PortForwards); !reflect.DeepEqual(expected, flattened) {
+		t.Errorf("Expected port forwards %+v, got %+v", expected, flattened)
+	}
+}
+
+func TestGetDomainInterfacePortForwardsNeedPasst(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibvirtDomain().Schema, map[string]interface{}{
+		"name": "forwarded",
+		"network_interface": []interface{}{
+			map[string]interface{}{
+				"user": "slirp",
+				"port_forward": []interface{}{
+					map[string]interface{}{
+						"host_port": 2222,
+					},
+				},
+			},
+			map[string]interface{}{
+				"network_name": "default",
+			},
+		},
+	})
+
+	if _, err := getDomainInterfacesUserPatches(d); err == nil {
+		t.Errorf("Expected port forwards to require the passt backend")
+	}
+	if patches, err := getDomainInterfaceUserPatches(d, "network_interface.1", "/interface"); err != nil || len(patches) != 0 {
+		t.Errorf("Expected no patches for a network interface, got %+v: %v", patches, err)
+	}
+}
+
+func TestCheckDomainUserInterfacesAgent(t *testing.T) {
+	for _, tc := range []struct {
+		qemuAgent    bool
+		waitForLease bool
+		valid        bool
+	}{
+		{qemuAgent: false, waitForLease: false, valid: true},
+		{qemuAgent: false, waitForLease: true, valid: false},
+		{qemuAgent: true, waitForLease: true, valid: true},
+	} {
+		raw, err := config.NewRawConfig(map[string]interface{}{
+			"name":       "user",
+			"qemu_agent": tc.qemuAgent,
+			"network_interface": []interface{}{
+				map[string]interface{}{
+					"user":           "passt",
+					"wait_for_lease": tc.waitForLease,
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = resourceLibvirtDomain().Diff(nil, terraform.NewResourceConfig(raw), nil)
+		if tc.valid && err != nil {
+			t.Errorf("Unexpected error with qemu_agent %t and wait_for_lease %t: %s", tc.qemuAgent, tc.waitForLease, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("Expected an error with qemu_agent %t and wait_for_lease %t", tc.qemuAgent, tc.waitForLease)
+		}
+	}
+}
+
+func TestSuppressDomainInterfaceModelDiff(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibvirtDomain().Schema, map[string]interface{}{})
+	if suppressDomainInterfaceModelDiff("network_interface.0.model", "e1000", "virtio", d) {
+		t.Errorf("Expected a change of model to show without an XSLT")
+	}
+
+	d = schema.TestResourceDataRaw(t, resourceLibvirtDomain().Schema, map[string]interface{}{
+		"xml": []interface{}{
+			map[string]interface{}{
+				"xslt": identitySpaceStripXSLT,
+			},
+		},
+	})
+	if !suppressDomainInterfaceModelDiff("network_interface.0.model", "e1000", "virtio", d) {
+		t.Errorf("Expected the model changed by the XSLT to be kept")
+	}
+	if suppressDomainInterfaceModelDiff("network_interface.1.model", "", "virtio", d) {
+		t.Errorf("Expected a new interface to get the model")
+	}
+}
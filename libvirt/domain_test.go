@@ -0,0 +1,351 @@
+package libvirt
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/libvirt/libvirt-go-xml"
+)
+
+// flattenedBlocks converts the blocks read from the domain to the type
+// returned by ResourceData.Get
+func flattenedBlocks(blocks []map[string]interface{}) []interface{} {
+	result := make([]interface{}, 0, len(blocks))
+	for _, block := range blocks {
+		m := map[string]interface{}{}
+		for k, v := range block {
+			m[k] = v
+		}
+		result = append(result, m)
+	}
+	return result
+}
+
+func TestDomainDevicesRoundTrip(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibvirtDomain().Schema, map[string]interface{}{
+		"name": "roundtrip",
+		"graphics": []interface{}{
+			map[string]interface{}{
+				"type":           "vnc",
+				"listen_type":    "address",
+				"listen_address": "127.0.1.1",
+			},
+		},
+		"video": []interface{}{
+			map[string]interface{}{
+				"type": "vga",
+			},
+		},
+		"console": []interface{}{
+			map[string]interface{}{
+				"type":        "pty",
+				"target_port": "0",
+				"target_type": "serial",
+			},
+			map[string]interface{}{
+				"type":        "pty",
+				"target_port": "1",
+				"target_type": "virtio",
+				"source_path": "/dev/pts/2",
+			},
+		},
+		"boot_device": []interface{}{
+			map[string]interface{}{
+				"dev": []interface{}{"cdrom"},
+			},
+			map[string]interface{}{
+				"dev": []interface{}{"hd", "network"},
+			},
+		},
+		"filesystem": []interface{}{
+			map[string]interface{}{
+				"source": "/tmp",
+				"target": "tmp",
+			},
+			map[string]interface{}{
+				"accessmode": "passthrough",
+				"source":     "/home",
+				"target":     "home",
+				"readonly":   false,
+			},
+		},
+		"nvram": []interface{}{
+			map[string]interface{}{
+				"file":     "/var/lib/libvirt/qemu/nvram/roundtrip_VARS.fd",
+				"template": "/usr/share/OVMF/OVMF_VARS.fd",
+			},
+		},
+	})
+
+	domainDef := libvirtxml.Domain{
+		OS:      &libvirtxml.DomainOS{},
+		Devices: &libvirtxml.DomainDeviceList{},
+	}
+	if err := setGraphics(d, &domainDef, "x86_64"); err != nil {
+		t.Fatal(err)
+	}
+	setVideo(d, &domainDef)
+	setConsoles(d, &domainDef)
+	setBootDevices(d, &domainDef)
+	if err := setFilesystems(d, &domainDef); err != nil {
+		t.Fatal(err)
+	}
+	domainDef.OS.NVRam = &libvirtxml.DomainNVRam{
+		NVRam:    d.Get("nvram.0.file").(string),
+		Template: d.Get("nvram.0.template").(string),
+	}
+
+	data, err := xmlMarshallIndented(domainDef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var readDef libvirtxml.Domain
+	if err := xml.Unmarshal([]byte(data), &readDef); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		key    string
+		blocks []map[string]interface{}
+	}{
+		{"graphics", flattenDomainGraphics(d, readDef.Devices.Graphics)},
+		{"video", flattenDomainVideo(readDef.Devices.Videos)},
+		{"console", flattenDomainConsoles(d, readDef.Devices.Consoles)},
+		{"boot_device", flattenDomainBootDevices(d, readDef.OS.BootDevices)},
+		{"filesystem", flattenDomainFilesystems(readDef.Devices.Filesystems)},
+		{"nvram", flattenDomainNVRam(readDef.OS.NVRam)},
+	} {
+		if expected, got := d.Get(tc.key), flattenedBlocks(tc.blocks); !reflect.DeepEqual(expected, got) {
+			t.Errorf("%s: expected %v, got %v", tc.key, expected, got)
+		}
+	}
+}
+
+func TestFlattenDomainConsolesDrift(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibvirtDomain().Schema, map[string]interface{}{
+		"name": "drift",
+		"console": []interface{}{
+			map[string]interface{}{
+				"type":        "pty",
+				"target_port": "0",
+			},
+		},
+	})
+
+	// libvirt allocates the pty, and adds the default target type
+	port := uint(0)
+	consoles := flattenDomainConsoles(d, []libvirtxml.DomainConsole{
+		{
+			Source: &libvirtxml.DomainChardevSource{
+				Pty: &libvirtxml.DomainChardevSourcePty{Path: "/dev/pts/7"},
+			},
+			Target: &libvirtxml.DomainConsoleTarget{Type: "serial", Port: &port},
+		},
+		{
+			Source: &libvirtxml.DomainChardevSource{
+				File: &libvirtxml.DomainChardevSourceFile{Path: "/var/log/console.log"},
+			},
+			Target: &libvirtxml.DomainConsoleTarget{Type: "virtio", Port: &port},
+		},
+	})
+
+	expected := []map[string]interface{}{
+		{"type": "pty", "source_path": "", "target_port": "0", "target_type": "serial"},
+		{"type": "file", "source_path": "/var/log/console.log", "target_port": "0", "target_type": "virtio"},
+	}
+	if !reflect.DeepEqual(consoles, expected) {
+		t.Errorf("Expected %v, got %v", expected, consoles)
+	}
+}
+
+func TestFlattenDomainBootDevicesDrift(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibvirtDomain().Schema, map[string]interface{}{
+		"name": "drift",
+		"boot_device": []interface{}{
+			map[string]interface{}{
+				"dev": []interface{}{"cdrom"},
+			},
+			map[string]interface{}{
+				"dev": []interface{}{"hd"},
+			},
+		},
+	})
+
+	devs := flattenDomainBootDevices(d, []libvirtxml.DomainBootDevice{{Dev: "network"}, {Dev: "hd"}})
+	expected := []map[string]interface{}{
+		{"dev": []interface{}{"network", "hd"}},
+	}
+	if !reflect.DeepEqual(devs, expected) {
+		t.Errorf("Expected %v, got %v", expected, devs)
+	}
+
+	if devs := flattenDomainBootDevices(d, nil); len(devs) != 0 {
+		t.Errorf("Expected no boot devices, got %v", devs)
+	}
+}
+
+func TestFlattenDomainDisk(t *testing.T) {
+	for _, tc := range []struct {
+		disk     libvirtxml.DomainDisk
+		expected map[string]interface{}
+	}{
+		{
+			libvirtxml.DomainDisk{
+				Device: "cdrom",
+				Source: &libvirtxml.DomainDiskSource{
+					Network: &libvirtxml.DomainDiskSourceNetwork{
+						Protocol: "http",
+						Name:     "/images/install.iso",
+						Hosts:    []libvirtxml.DomainDiskSourceHost{{Name: "127.0.0.1", Port: "8080"}},
+					},
+				},
+			},
+			map[string]interface{}{"volume_id": "", "url": "http://127.0.0.1:8080/images/install.iso", "file": "", "scsi": false, "wwn": ""},
+		},
+		{
+			libvirtxml.DomainDisk{
+				Device: "cdrom",
+				Source: &libvirtxml.DomainDiskSource{
+					File: &libvirtxml.DomainDiskSourceFile{File: "/tmp/install.iso"},
+				},
+				Target: &libvirtxml.DomainDiskTarget{Dev: "hda", Bus: "ide"},
+			},
+			map[string]interface{}{"volume_id": "", "url": "", "file": "/tmp/install.iso", "scsi": false, "wwn": ""},
+		},
+		{
+			libvirtxml.DomainDisk{
+				Device: "disk",
+				WWN:    "5000c50015ea71ac",
+				Target: &libvirtxml.DomainDiskTarget{Dev: "sda", Bus: "scsi"},
+			},
+			map[string]interface{}{"volume_id": "", "url": "", "file": "", "scsi": true, "wwn": "5000c50015ea71ac"},
+		},
+	} {
+		disk, err := flattenDomainDisk(nil, tc.disk, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(disk, tc.expected) {
+			t.Errorf("Expected %v, got %v", tc.expected, disk)
+		}
+	}
+}
+
+func TestDomainHasIgnitionFwCfg(t *testing.T) {
+	domainDef := libvirtxml.Domain{
+		QEMUCommandline: &libvirtxml.DomainQEMUCommandline{
+			Args: []libvirtxml.DomainQEMUCommandlineArg{
+				{Value: "-fw_cfg"},
+				{Value: "name=opt/com.coreos/config,file=/var/lib/libvirt/images/ignition"},
+			},
+		},
+	}
+	if !domainHasIgnitionFwCfg(domainDef, "/var/lib/libvirt/images/ignition") {
+		t.Errorf("Expected the Ignition config to be found")
+	}
+	if domainHasIgnitionFwCfg(domainDef, "/var/lib/libvirt/images/other") {
+		t.Errorf("Expected the Ignition config not to be found")
+	}
+	if domainHasIgnitionFwCfg(libvirtxml.Domain{}, "/var/lib/libvirt/images/ignition") {
+		t.Errorf("Expected no Ignition config without QEMU arguments")
+	}
+}
+
+func TestDomainInterfaceHostname(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibvirtDomain().Schema, map[string]interface{}{
+		"name": "worker",
+		"network_interface": []interface{}{
+			map[string]interface{}{
+				"network_name": "default",
+			},
+			map[string]interface{}{
+				"network_name": "default",
+				"hostname":     "worker-1",
+			},
+		},
+	})
+	if hostname := domainInterfaceHostname(d, "network_interface.0"); hostname != "worker" {
+		t.Errorf("Expected the name of the domain, got %q", hostname)
+	}
+	if hostname := domainInterfaceHostname(d, "network_interface.1"); hostname != "worker-1" {
+		t.Errorf("Expected the hostname of the interface, got %q", hostname)
+	}
+}
+
+func TestNewConfigDriveDiskTarget(t *testing.T) {
+	for _, tc := range []struct {
+		arch    string
+		machine string
+		bus     string
+	}{
+		{"x86_64", "pc-i440fx-2.12", "ide"},
+		{"x86_64", "pc-q35-2.12", "sata"},
+		{"i686", "q35", "sata"},
+		{"aarch64", "virt", "scsi"},
+	} {
+		if target := newConfigDriveDiskTarget(tc.arch, tc.machine); target.Bus != tc.bus {
+			t.Errorf("Expected the %s bus for %s/%s, got %s", tc.bus, tc.arch, tc.machine, target.Bus)
+		}
+	}
+}
+
+func TestFreeDiskTargetDev(t *testing.T) {
+	used := map[string]bool{"vda": true, "vdb": true, "hda": true}
+	for dev, expected := range map[string]string{
+		"vdc": "vdc",
+		"vdb": "vdc",
+		"hda": "hdb",
+	} {
+		if free := freeDiskTargetDev(dev, used); free != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, dev, free)
+		}
+	}
+}
+
+func TestFindDomainDisk(t *testing.T) {
+	domainDef := libvirtxml.Domain{
+		Devices: &libvirtxml.DomainDeviceList{
+			Disks: []libvirtxml.DomainDisk{
+				{
+					Source: &libvirtxml.DomainDiskSource{
+						File: &libvirtxml.DomainDiskSourceFile{File: "/var/lib/libvirt/images/data.qcow2"},
+					},
+					Target: &libvirtxml.DomainDiskTarget{Dev: "vdb"},
+				},
+				{
+					Source: &libvirtxml.DomainDiskSource{
+						Network: &libvirtxml.DomainDiskSourceNetwork{
+							Protocol: "http",
+							Name:     "/boot.iso",
+							Hosts:    []libvirtxml.DomainDiskSourceHost{{Name: "example.com"}},
+						},
+					},
+					Target: &libvirtxml.DomainDiskTarget{Dev: "vdc"},
+				},
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		disk map[string]interface{}
+		dev  string
+	}{
+		{map[string]interface{}{"file": "/var/lib/libvirt/images/data.qcow2"}, "vdb"},
+		{map[string]interface{}{"url": "http://example.com/boot.iso"}, "vdc"},
+		{map[string]interface{}{"file": "/var/lib/libvirt/images/other.qcow2"}, ""},
+	} {
+		diskDef, err := findDomainDisk(nil, domainDef, tc.disk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dev := ""
+		if diskDef != nil {
+			dev = diskDef.Target.Dev
+		}
+		if dev != tc.dev {
+			t.Errorf("Expected disk %q for %v, got %q", tc.dev, tc.disk, dev)
+		}
+	}
+}
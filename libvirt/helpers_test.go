@@ -216,6 +216,45 @@ func testAccCheckLibvirtNetworkDhcpStatus(name string, expectedDhcpStatus string
 	}
 }
 
+// testAccCheckLibvirtNetworkDHCPRanges checks the DHCP range of each
+// address of the network, as "start-end" (empty for no DHCP)
+func testAccCheckLibvirtNetworkDHCPRanges(name string, expected []string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		virConn := testAccProvider.Meta().(*Client).libvirt
+		networkDef, err := getNetworkDef(s, name, *virConn)
+		if err != nil {
+			return err
+		}
+		var actual []string
+		for _, ip := range networkDef.IPs {
+			dhcpRange := ""
+			if ip.DHCP != nil && len(ip.DHCP.Ranges) > 0 {
+				dhcpRange = ip.DHCP.Ranges[0].Start + "-" + ip.DHCP.Ranges[0].End
+			}
+			actual = append(actual, dhcpRange)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			return fmt.Errorf("Expected DHCP ranges %v, got %v", expected, actual)
+		}
+		return nil
+	}
+}
+
+// testAccCheckLibvirtNetworkForward checks the forward element of the network
+func testAccCheckLibvirtNetworkForward(name string, expected *libvirtxml.NetworkForward) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		virConn := testAccProvider.Meta().(*Client).libvirt
+		networkDef, err := getNetworkDef(s, name, *virConn)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(networkDef.Forward, expected) {
+			return fmt.Errorf("Expected forward %#v, got %#v", expected, networkDef.Forward)
+		}
+		return nil
+	}
+}
+
 // testAccCheckLibvirtNetworkBridge checks the bridge exists and has the expected properties
 func testAccCheckLibvirtNetworkBridge(resourceName string, bridgeName string) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
@@ -0,0 +1,164 @@
+package xslt
+
+import (
+	"fmt"
+	"log"
+)
+
+// Patch is a change of a document: the action is set, append or remove,
+// the path selects the nodes to change and the value is the new value of
+// the nodes for set and the XML fragment added to them for append
+type Patch struct {
+	Action string
+	Path   string
+	Value  string
+}
+
+// CompileXPath checks that an expression can be used as the path of a patch
+func CompileXPath(expr string) error {
+	_, err := compileXPath(expr)
+	return err
+}
+
+// ApplyPatches applies the patches to the xml data, one after the other.
+// Paths can use the prefixes of namespaces, besides the ones declared by
+// the document element.
+func ApplyPatches(xml string, patches []Patch, namespaces map[string]string) (string, error) {
+	if len(patches) == 0 {
+		return xml, nil
+	}
+
+	doc, err := parseXMLTree(xml)
+	if err != nil {
+		return xml, err
+	}
+	for _, patch := range patches {
+		if err := applyPatch(doc, patch, namespaces); err != nil {
+			return xml, fmt.Errorf("can't %s %q: %s", patch.Action, patch.Path, err)
+		}
+		doc.renumber()
+	}
+
+	patchedXML := serializeXMLTree(doc)
+	log.Printf("[DEBUG] Patched XML:\n%s", patchedXML)
+	return patchedXML, nil
+}
+
+// applyPatch applies a patch to a document. The path is evaluated from
+// the document, so it may be written relative to it.
+func applyPatch(doc *xmlNode, patch Patch, namespaces map[string]string) error {
+	expr, err := compileXPath(patch.Path)
+	if err != nil {
+		return err
+	}
+	root := doc.Children[len(doc.Children)-1]
+	for _, child := range doc.Children {
+		if child.Type == xmlElementNode {
+			root = child
+		}
+	}
+	env := &xpathEnv{
+		namespace: func(prefix string) (string, bool) {
+			if space, ok := root.lookupNamespace(prefix); ok {
+				return space, true
+			}
+			space, ok := namespaces[prefix]
+			return space, ok
+		},
+	}
+
+	nodes, err := evalXPathNodeSet(expr, doc, env)
+	if err != nil {
+		return err
+	}
+
+	switch patch.Action {
+	case "set":
+		if len(nodes) == 0 {
+			// setting a missing attribute adds it
+			added, err := addPatchAttribute(doc, expr, env, patch.Value)
+			if err != nil || added {
+				return err
+			}
+			return fmt.Errorf("the path doesn't select any node")
+		}
+		for _, node := range nodes {
+			switch node.Type {
+			case xmlElementNode:
+				for _, child := range node.Children {
+					child.Parent = nil
+				}
+				node.Children = nil
+				if patch.Value != "" {
+					node.appendChild(&xmlNode{Type: xmlTextNode, Data: patch.Value})
+				}
+			case xmlDocumentNode:
+				return fmt.Errorf("the document can't be set")
+			default:
+				node.Data = patch.Value
+			}
+		}
+	case "append":
+		if len(nodes) == 0 {
+			return fmt.Errorf("the path doesn't select any node")
+		}
+		for _, node := range nodes {
+			if node.Type != xmlElementNode {
+				return fmt.Errorf("nodes can only be appended to elements")
+			}
+			// each element gets its own copy of the fragment
+			fragment, err := parseXMLFragment(patch.Value, node)
+			if err != nil {
+				return fmt.Errorf("invalid value: %s", err)
+			}
+			for _, child := range fragment {
+				node.appendChild(child)
+			}
+		}
+	case "remove":
+		// removing nodes which are already missing is not an error
+		for _, node := range nodes {
+			if node.Type == xmlDocumentNode || node == root {
+				return fmt.Errorf("the document element can't be removed")
+			}
+			node.remove()
+		}
+	default:
+		return fmt.Errorf("unknown action")
+	}
+	return nil
+}
+
+// addPatchAttribute adds an attribute selected by a path ending with
+// @name to the elements selected by the rest of the path. It returns
+// whether the path had this form and selected elements.
+func addPatchAttribute(doc *xmlNode, expr xpathExpr, env *xpathEnv, value string) (bool, error) {
+	path, ok := expr.(*xpathPath)
+	if !ok || len(path.steps) == 0 {
+		return false, nil
+	}
+	last := path.steps[len(path.steps)-1]
+	if last.axis != "attribute" || last.test.nodeType != "" || last.test.local == "*" || len(last.predicates) != 0 {
+		return false, nil
+	}
+
+	space := ""
+	if last.test.prefix != "" {
+		space, _ = env.namespace(last.test.prefix)
+	}
+	parentPath := &xpathPath{start: path.start, absolute: path.absolute, steps: path.steps[:len(path.steps)-1]}
+	elements, err := evalXPathNodeSet(parentPath, doc, env)
+	if err != nil {
+		return false, err
+	}
+
+	added := false
+	for _, element := range elements {
+		if element.Type != xmlElementNode {
+			continue
+		}
+		element.setAttr(last.test.prefix, space, last.test.local, value)
+		added = true
+	}
+	return added, nil
+}
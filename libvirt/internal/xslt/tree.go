@@ -0,0 +1,491 @@
+package xslt
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// xmlNodeType is the type of a node of the XPath data model
+type xmlNodeType int
+
+const (
+	xmlDocumentNode xmlNodeType = iota
+	xmlElementNode
+	xmlAttributeNode
+	xmlTextNode
+	xmlCommentNode
+	xmlProcInstNode
+)
+
+const (
+	xmlNamespace   = "http://www.w3.org/XML/1998/namespace"
+	xmlnsNamespace = "http://www.w3.org/2000/xmlns/"
+)
+
+// xmlNamespaceDecl is a namespace declaration of an element. An empty
+// prefix declares the default namespace.
+type xmlNamespaceDecl struct {
+	Prefix string
+	URI    string
+}
+
+// xmlNode is a node of a mutable XML tree, used by the XPath, XSLT and
+// patch engines.
+//
+// Elements and attributes keep both the prefix they were written with and
+// the namespace it resolves to, so that documents can be written back as
+// they were read. Processing instructions keep their target in Local.
+type xmlNode struct {
+	Type       xmlNodeType
+	Prefix     string
+	Space      string
+	Local      string
+	Data       string
+	Parent     *xmlNode
+	Children   []*xmlNode
+	Attrs      []*xmlNode
+	Namespaces []xmlNamespaceDecl
+
+	// order is the position of the node in document order, see
+	// renumber
+	order int
+}
+
+// name returns the qualified name of the node, as written in the document
+func (n *xmlNode) name() string {
+	if n.Prefix != "" {
+		return n.Prefix + ":" + n.Local
+	}
+	return n.Local
+}
+
+// root returns the document, or the topmost node, containing the node
+func (n *xmlNode) root() *xmlNode {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	return n
+}
+
+// stringValue returns the string-value of the node as defined by XPath
+func (n *xmlNode) stringValue() string {
+	switch n.Type {
+	case xmlDocumentNode, xmlElementNode:
+		var buf strings.Builder
+		n.appendText(&buf)
+		return buf.String()
+	default:
+		return n.Data
+	}
+}
+
+func (n *xmlNode) appendText(buf *strings.Builder) {
+	for _, child := range n.Children {
+		switch child.Type {
+		case xmlTextNode:
+			buf.WriteString(child.Data)
+		case xmlElementNode:
+			child.appendText(buf)
+		}
+	}
+}
+
+// attr returns the attribute of an element with the given namespace and
+// local name, or nil
+func (n *xmlNode) attr(space, local string) *xmlNode {
+	for _, attr := range n.Attrs {
+		if attr.Space == space && attr.Local == local {
+			return attr
+		}
+	}
+	return nil
+}
+
+// attrValue returns the value of the attribute without namespace with the
+// given name, and whether it is present
+func (n *xmlNode) attrValue(local string) (string, bool) {
+	if attr := n.attr("", local); attr != nil {
+		return attr.Data, true
+	}
+	return "", false
+}
+
+// lookupNamespace returns the namespace the prefix resolves to in the scope
+// of the node
+func (n *xmlNode) lookupNamespace(prefix string) (string, bool) {
+	switch prefix {
+	case "xml":
+		return xmlNamespace, true
+	case "xmlns":
+		return xmlnsNamespace, true
+	}
+	for e := n; e != nil; e = e.Parent {
+		for _, ns := range e.Namespaces {
+			if ns.Prefix == prefix {
+				return ns.URI, true
+			}
+		}
+	}
+	if prefix == "" {
+		return "", true
+	}
+	return "", false
+}
+
+// inScopeNamespaces returns the namespace declarations visible from the node
+func (n *xmlNode) inScopeNamespaces() []xmlNamespaceDecl {
+	seen := map[string]bool{}
+	var result []xmlNamespaceDecl
+	for e := n; e != nil; e = e.Parent {
+		for _, ns := range e.Namespaces {
+			if !seen[ns.Prefix] {
+				seen[ns.Prefix] = true
+				result = append(result, ns)
+			}
+		}
+	}
+	return result
+}
+
+// appendChild adds a node as the last child of the node
+func (n *xmlNode) appendChild(child *xmlNode) {
+	child.Parent = n
+	n.Children = append(n.Children, child)
+}
+
+// setAttr sets the value of an attribute of an element, adding it if needed
+func (n *xmlNode) setAttr(prefix, space, local, value string) *xmlNode {
+	if attr := n.attr(space, local); attr != nil {
+		attr.Data = value
+		return attr
+	}
+	attr := &xmlNode{
+		Type:   xmlAttributeNode,
+		Prefix: prefix,
+		Space:  space,
+		Local:  local,
+		Data:   value,
+		Parent: n,
+	}
+	n.Attrs = append(n.Attrs, attr)
+	return attr
+}
+
+// remove detaches the node from its parent
+func (n *xmlNode) remove() {
+	parent := n.Parent
+	if parent == nil {
+		return
+	}
+	nodes := &parent.Children
+	if n.Type == xmlAttributeNode {
+		nodes = &parent.Attrs
+	}
+	for i, node := range *nodes {
+		if node == n {
+			*nodes = append((*nodes)[:i], (*nodes)[i+1:]...)
+			break
+		}
+	}
+	n.Parent = nil
+}
+
+// clone returns a deep copy of the node, without parent
+func (n *xmlNode) clone() *xmlNode {
+	c := &xmlNode{
+		Type:   n.Type,
+		Prefix: n.Prefix,
+		Space:  n.Space,
+		Local:  n.Local,
+		Data:   n.Data,
+	}
+	c.Namespaces = append(c.Namespaces, n.Namespaces...)
+	for _, attr := range n.Attrs {
+		a := attr.clone()
+		a.Parent = c
+		c.Attrs = append(c.Attrs, a)
+	}
+	for _, child := range n.Children {
+		c.appendChild(child.clone())
+	}
+	return c
+}
+
+// renumber records the document order of the nodes of the tree, which the
+// XPath engine relies on to sort node-sets. It has to be called again after
+// the tree is modified.
+func (n *xmlNode) renumber() {
+	counter := 0
+	var walk func(node *xmlNode)
+	walk = func(node *xmlNode) {
+		node.order = counter
+		counter++
+		for _, attr := range node.Attrs {
+			attr.order = counter
+			counter++
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(n)
+}
+
+// parseXMLTree parses a XML document. Whitespace outside of the document
+// element, the XML declaration and DOCTYPE declarations are dropped.
+func parseXMLTree(data string) (*xmlNode, error) {
+	doc := &xmlNode{Type: xmlDocumentNode}
+	if err := parseXMLInto(doc, strings.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	elements := 0
+	for _, child := range doc.Children {
+		switch child.Type {
+		case xmlElementNode:
+			elements++
+		case xmlTextNode:
+			return nil, fmt.Errorf("unexpected text outside of the document element")
+		}
+	}
+	if elements != 1 {
+		return nil, fmt.Errorf("expected exactly one document element, found %d", elements)
+	}
+
+	doc.renumber()
+	return doc, nil
+}
+
+// parseXMLFragment parses a sequence of XML nodes, which may refer to the
+// namespaces in scope of the node the fragment is meant to be added to
+func parseXMLFragment(data string, scope *xmlNode) ([]*xmlNode, error) {
+	wrapper := &xmlNode{Type: xmlElementNode, Local: "fragment"}
+	if scope != nil {
+		wrapper.Namespaces = scope.inScopeNamespaces()
+	}
+	if err := parseXMLInto(wrapper, strings.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	nodes := wrapper.Children
+	for _, node := range nodes {
+		node.Parent = nil
+	}
+	return nodes, nil
+}
+
+// parseXMLInto parses XML content and adds it to the children of parent
+func parseXMLInto(parent *xmlNode, r io.Reader) error {
+	decoder := xml.NewDecoder(r)
+	current := parent
+	for {
+		// namespaces are resolved by hand, so that the prefixes are kept
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			element := &xmlNode{
+				Type:   xmlElementNode,
+				Prefix: t.Name.Space,
+				Local:  t.Name.Local,
+			}
+			current.appendChild(element)
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					element.Namespaces = append(element.Namespaces, xmlNamespaceDecl{URI: a.Value})
+				case a.Name.Space == "xmlns":
+					element.Namespaces = append(element.Namespaces, xmlNamespaceDecl{Prefix: a.Name.Local, URI: a.Value})
+				default:
+					element.Attrs = append(element.Attrs, &xmlNode{
+						Type:   xmlAttributeNode,
+						Prefix: a.Name.Space,
+						Local:  a.Name.Local,
+						Data:   a.Value,
+						Parent: element,
+					})
+				}
+			}
+
+			space, ok := element.lookupNamespace(element.Prefix)
+			if !ok {
+				return fmt.Errorf("undeclared namespace prefix %q in element %s", element.Prefix, element.name())
+			}
+			element.Space = space
+			for _, attr := range element.Attrs {
+				// attributes without prefix have no namespace
+				if attr.Prefix == "" {
+					continue
+				}
+				space, ok := element.lookupNamespace(attr.Prefix)
+				if !ok {
+					return fmt.Errorf("undeclared namespace prefix %q in attribute %s", attr.Prefix, attr.name())
+				}
+				attr.Space = space
+			}
+			current = element
+		case xml.EndElement:
+			name := t.Name.Local
+			if t.Name.Space != "" {
+				name = t.Name.Space + ":" + name
+			}
+			if current == parent || current.name() != name {
+				return fmt.Errorf("unexpected end element </%s>", name)
+			}
+			current = current.Parent
+		case xml.CharData:
+			if current == parent && parent.Type == xmlDocumentNode {
+				if len(bytes.TrimSpace(t)) != 0 {
+					return fmt.Errorf("unexpected text outside of the document element")
+				}
+				continue
+			}
+			if n := len(current.Children); n > 0 && current.Children[n-1].Type == xmlTextNode {
+				current.Children[n-1].Data += string(t)
+				continue
+			}
+			current.appendChild(&xmlNode{Type: xmlTextNode, Data: string(t)})
+		case xml.Comment:
+			current.appendChild(&xmlNode{Type: xmlCommentNode, Data: string(t)})
+		case xml.ProcInst:
+			if t.Target == "xml" {
+				continue
+			}
+			current.appendChild(&xmlNode{Type: xmlProcInstNode, Local: t.Target, Data: string(t.Inst)})
+		case xml.Directive:
+			// DOCTYPE declarations are not part of the data model
+		}
+	}
+	if current != parent {
+		return fmt.Errorf("element <%s> is not closed", current.name())
+	}
+	return nil
+}
+
+// xmlWriter serializes a tree, declaring the namespaces used by elements
+// and attributes which are not declared in scope
+type xmlWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *xmlWriter) writeNode(n *xmlNode, scope map[string]string) {
+	switch n.Type {
+	case xmlDocumentNode:
+		for _, child := range n.Children {
+			w.writeNode(child, scope)
+		}
+	case xmlElementNode:
+		w.writeElement(n, scope)
+	case xmlTextNode:
+		w.buf.WriteString(escapeXMLText(n.Data))
+	case xmlCommentNode:
+		fmt.Fprintf(&w.buf, "<!--%s-->", n.Data)
+	case xmlProcInstNode:
+		if n.Data == "" {
+			fmt.Fprintf(&w.buf, "<?%s?>", n.Local)
+		} else {
+			fmt.Fprintf(&w.buf, "<?%s %s?>", n.Local, n.Data)
+		}
+	case xmlAttributeNode:
+		// attributes are written with their element
+	}
+}
+
+func (w *xmlWriter) writeElement(n *xmlNode, parentScope map[string]string) {
+	scope := make(map[string]string, len(parentScope))
+	for prefix, uri := range parentScope {
+		scope[prefix] = uri
+	}
+
+	var decls []xmlNamespaceDecl
+	declare := func(prefix, uri string) {
+		if current, ok := scope[prefix]; ok && current == uri {
+			return
+		}
+		if _, ok := scope[prefix]; !ok && prefix == "" && uri == "" {
+			return
+		}
+		scope[prefix] = uri
+		decls = append(decls, xmlNamespaceDecl{Prefix: prefix, URI: uri})
+	}
+	for _, ns := range n.Namespaces {
+		declare(ns.Prefix, ns.URI)
+	}
+	if n.Prefix != "xml" {
+		declare(n.Prefix, n.Space)
+	}
+	for _, attr := range n.Attrs {
+		if attr.Prefix != "" && attr.Prefix != "xml" {
+			declare(attr.Prefix, attr.Space)
+		}
+	}
+
+	w.buf.WriteString("<" + n.name())
+	for _, ns := range decls {
+		if ns.Prefix == "" {
+			fmt.Fprintf(&w.buf, " xmlns=\"%s\"", escapeXMLAttr(ns.URI))
+		} else {
+			fmt.Fprintf(&w.buf, " xmlns:%s=\"%s\"", ns.Prefix, escapeXMLAttr(ns.URI))
+		}
+	}
+	for _, attr := range n.Attrs {
+		fmt.Fprintf(&w.buf, " %s=\"%s\"", attr.name(), escapeXMLAttr(attr.Data))
+	}
+	if len(n.Children) == 0 {
+		w.buf.WriteString("/>")
+		return
+	}
+	w.buf.WriteString(">")
+	for _, child := range n.Children {
+		w.writeNode(child, scope)
+	}
+	w.buf.WriteString("</" + n.name() + ">")
+}
+
+// serializeXMLTree returns the XML representation of a node
+func serializeXMLTree(n *xmlNode) string {
+	var w xmlWriter
+	scope := map[string]string{}
+	if n.Type != xmlDocumentNode && n.Parent != nil {
+		for _, ns := range n.Parent.inScopeNamespaces() {
+			scope[ns.Prefix] = ns.URI
+		}
+	}
+	w.writeNode(n, scope)
+	return w.buf.String()
+}
+
+var (
+	xmlTextReplacer = strings.NewReplacer(
+		"&", "&amp;",
+		"<", "&lt;",
+		">", "&gt;",
+		"\r", "&#13;",
+	)
+	xmlAttrReplacer = strings.NewReplacer(
+		"&", "&amp;",
+		"<", "&lt;",
+		">", "&gt;",
+		"\"", "&quot;",
+		"\n", "&#10;",
+		"\r", "&#13;",
+		"\t", "&#9;",
+	)
+)
+
+func escapeXMLText(s string) string {
+	return xmlTextReplacer.Replace(s)
+}
+
+func escapeXMLAttr(s string) string {
+	return xmlAttrReplacer.Replace(s)
+}
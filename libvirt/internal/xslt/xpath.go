@@ -0,0 +1,1339 @@
+package xslt
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// This file implements XPath 1.0 over the trees of tree.go, as
+// used by the XSLT and patch engines. The namespace axis, the id() and
+// lang() functions and the extension functions are not supported.
+
+// xpathNodeSet is a node-set value, always sorted in document order
+type xpathNodeSet []*xmlNode
+
+// xpathEnv is what an expression can refer to besides the context node
+type xpathEnv struct {
+	// variable returns the value of a variable
+	variable func(name string) (interface{}, bool)
+	// namespace resolves the prefixes of the names tests
+	namespace func(prefix string) (string, bool)
+	// current is the node returned by the current() function
+	current *xmlNode
+}
+
+type xpathContext struct {
+	node     *xmlNode
+	position int
+	size     int
+	env      *xpathEnv
+}
+
+// xpathExpr is a compiled XPath expression
+type xpathExpr interface {
+	eval(ctx *xpathContext) (interface{}, error)
+}
+
+// compileXPath parses a XPath expression
+func compileXPath(expr string) (xpathExpr, error) {
+	tokens, err := lexXPath(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid XPath expression %q: %s", expr, err)
+	}
+	p := &xpathParser{tokens: tokens}
+	e, err := p.parseExpr()
+	if err == nil && p.peek().kind != xpathTokenEOF {
+		err = fmt.Errorf("unexpected %q", p.peek().value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid XPath expression %q: %s", expr, err)
+	}
+	return e, nil
+}
+
+// evalXPath evaluates an expression with the node as context node
+func evalXPath(expr xpathExpr, node *xmlNode, env *xpathEnv) (interface{}, error) {
+	return expr.eval(&xpathContext{node: node, position: 1, size: 1, env: env})
+}
+
+// evalXPathNodeSet evaluates an expression which has to return a node-set
+func evalXPathNodeSet(expr xpathExpr, node *xmlNode, env *xpathEnv) (xpathNodeSet, error) {
+	value, err := evalXPath(expr, node, env)
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := value.(xpathNodeSet)
+	if !ok {
+		return nil, fmt.Errorf("expression doesn't return a node-set")
+	}
+	return nodes, nil
+}
+
+// lexer
+
+type xpathTokenKind int
+
+const (
+	xpathTokenEOF xpathTokenKind = iota
+	xpathTokenNumber
+	xpathTokenLiteral
+	xpathTokenName
+	xpathTokenNameTest
+	xpathTokenOperator
+	xpathTokenVariable
+	xpathTokenPunct
+)
+
+type xpathToken struct {
+	kind  xpathTokenKind
+	value string
+}
+
+func isNCNameStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isNCNameChar(r rune) bool {
+	return isNCNameStart(r) || r == '-' || r == '.' || unicode.IsDigit(r) ||
+		unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Mc, r)
+}
+
+func lexXPath(expr string) ([]xpathToken, error) {
+	var tokens []xpathToken
+
+	// an operator is expected after anything that can end an operand, this
+	// disambiguates "*" and the operator names
+	operatorExpected := func() bool {
+		if len(tokens) == 0 {
+			return false
+		}
+		last := tokens[len(tokens)-1]
+		switch last.kind {
+		case xpathTokenOperator:
+			return false
+		case xpathTokenPunct:
+			switch last.value {
+			case "@", "::", "(", "[", ",":
+				return false
+			}
+		}
+		return true
+	}
+
+	readNCName := func(i int) int {
+		for i < len(expr) {
+			r, size := utf8.DecodeRuneInString(expr[i:])
+			if !isNCNameChar(r) {
+				break
+			}
+			i += size
+		}
+		return i
+	}
+
+	i := 0
+	for i < len(expr) {
+		r, size := utf8.DecodeRuneInString(expr[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '"' || r == '\'':
+			end := strings.IndexRune(expr[i+1:], r)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string literal")
+			}
+			tokens = append(tokens, xpathToken{xpathTokenLiteral, expr[i+1 : i+1+end]})
+			i += end + 2
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(expr) && expr[i+1] >= '0' && expr[i+1] <= '9'):
+			start := i
+			for i < len(expr) && (expr[i] >= '0' && expr[i] <= '9' || expr[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, xpathToken{xpathTokenNumber, expr[start:i]})
+		case r == '$':
+			start := i + 1
+			end := readNCName(start)
+			if end < len(expr) && expr[end] == ':' {
+				end = readNCName(end + 1)
+			}
+			if end == start {
+				return nil, fmt.Errorf("missing variable name")
+			}
+			tokens = append(tokens, xpathToken{xpathTokenVariable, expr[start:end]})
+			i = end
+		case isNCNameStart(r):
+			start := i
+			end := readNCName(i)
+			kind := xpathTokenName
+			if end+1 < len(expr) && expr[end] == ':' && expr[end+1] != ':' {
+				if expr[end+1] == '*' {
+					end += 2
+					kind = xpathTokenNameTest
+				} else {
+					end = readNCName(end + 1)
+				}
+			}
+			name := expr[start:end]
+			i = end
+			if operatorExpected() {
+				switch name {
+				case "and", "or", "div", "mod":
+					tokens = append(tokens, xpathToken{xpathTokenOperator, name})
+					continue
+				}
+				return nil, fmt.Errorf("unexpected name %q", name)
+			}
+			tokens = append(tokens, xpathToken{kind, name})
+		case r == '*':
+			i++
+			if operatorExpected() {
+				tokens = append(tokens, xpathToken{xpathTokenOperator, "*"})
+			} else {
+				tokens = append(tokens, xpathToken{xpathTokenNameTest, "*"})
+			}
+		default:
+			var op string
+			for _, candidate := range []string{"//", "!=", "<=", ">=", "::", "..", "/", "|", "+", "-", "=", "<", ">", "(", ")", "[", "]", ".", "@", ","} {
+				if strings.HasPrefix(expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q", r)
+			}
+			i += len(op)
+			kind := xpathTokenPunct
+			switch op {
+			case "/", "//", "|", "+", "-", "=", "!=", "<", "<=", ">", ">=":
+				kind = xpathTokenOperator
+			}
+			tokens = append(tokens, xpathToken{kind, op})
+		}
+	}
+	return append(tokens, xpathToken{xpathTokenEOF, ""}), nil
+}
+
+// parser
+
+type xpathParser struct {
+	tokens []xpathToken
+	pos    int
+}
+
+func (p *xpathParser) peek() xpathToken {
+	return p.tokens[p.pos]
+}
+
+func (p *xpathParser) peekAt(offset int) xpathToken {
+	if p.pos+offset >= len(p.tokens) {
+		return xpathToken{kind: xpathTokenEOF}
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *xpathParser) next() xpathToken {
+	t := p.tokens[p.pos]
+	if t.kind != xpathTokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *xpathParser) isOperator(ops ...string) bool {
+	t := p.peek()
+	if t.kind != xpathTokenOperator {
+		return false
+	}
+	for _, op := range ops {
+		if t.value == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *xpathParser) isPunct(value string) bool {
+	t := p.peek()
+	return t.kind == xpathTokenPunct && t.value == value
+}
+
+func (p *xpathParser) expect(value string) error {
+	if !p.isPunct(value) {
+		if p.peek().kind == xpathTokenEOF {
+			return fmt.Errorf("expected %q at end of expression", value)
+		}
+		return fmt.Errorf("expected %q, got %q", value, p.peek().value)
+	}
+	p.next()
+	return nil
+}
+
+func (p *xpathParser) parseExpr() (xpathExpr, error) {
+	return p.parseBinary(0)
+}
+
+// xpathPrecedence lists the binary operators by increasing precedence
+var xpathPrecedence = [][]string{
+	{"or"},
+	{"and"},
+	{"=", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "div", "mod"},
+}
+
+func (p *xpathParser) parseBinary(level int) (xpathExpr, error) {
+	if level == len(xpathPrecedence) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator(xpathPrecedence[level]...) {
+		op := p.next().value
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &xpathBinary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *xpathParser) parseUnary() (xpathExpr, error) {
+	if p.isOperator("-") {
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &xpathNegate{expr}, nil
+	}
+	return p.parseUnion()
+}
+
+func (p *xpathParser) parseUnion() (xpathExpr, error) {
+	left, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("|") {
+		p.next()
+		right, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		left = &xpathUnion{left, right}
+	}
+	return left, nil
+}
+
+// startsPrimaryExpr returns whether the next tokens start a primary
+// expression rather than a location path
+func (p *xpathParser) startsPrimaryExpr() bool {
+	t := p.peek()
+	switch t.kind {
+	case xpathTokenVariable, xpathTokenLiteral, xpathTokenNumber:
+		return true
+	case xpathTokenPunct:
+		return t.value == "("
+	case xpathTokenName:
+		if next := p.peekAt(1); next.kind == xpathTokenPunct && next.value == "(" {
+			switch t.value {
+			case "node", "text", "comment", "processing-instruction":
+				return false
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (p *xpathParser) parsePath() (xpathExpr, error) {
+	if p.startsPrimaryExpr() {
+		primary, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		predicates, err := p.parsePredicates()
+		if err != nil {
+			return nil, err
+		}
+		var expr xpathExpr = primary
+		if len(predicates) > 0 {
+			expr = &xpathFilter{expr: primary, predicates: predicates}
+		}
+		if !p.isOperator("/", "//") {
+			return expr, nil
+		}
+		path := &xpathPath{start: expr}
+		if err := p.parseRelativePath(path, true); err != nil {
+			return nil, err
+		}
+		return path, nil
+	}
+
+	path := &xpathPath{}
+	if p.isOperator("/", "//") {
+		path.absolute = true
+		if p.isOperator("/") {
+			p.next()
+			// "/" alone selects the root
+			if !p.startsStep() {
+				return path, nil
+			}
+		}
+	}
+	if err := p.parseRelativePath(path, path.absolute && p.isOperator("//")); err != nil {
+		return nil, err
+	}
+	return path, nil
+}
+
+func (p *xpathParser) startsStep() bool {
+	t := p.peek()
+	switch t.kind {
+	case xpathTokenName, xpathTokenNameTest:
+		return true
+	case xpathTokenPunct:
+		return t.value == "." || t.value == ".." || t.value == "@"
+	}
+	return false
+}
+
+// parseRelativePath parses steps separated by "/" or "//". When
+// separatorFirst is set, a separator is expected before the first step.
+func (p *xpathParser) parseRelativePath(path *xpathPath, separatorFirst bool) error {
+	expectSeparator := separatorFirst
+	for {
+		if expectSeparator {
+			if !p.isOperator("/", "//") {
+				return nil
+			}
+			if p.next().value == "//" {
+				path.steps = append(path.steps, &xpathStep{axis: "descendant-or-self", test: xpathNodeTest{nodeType: "node"}})
+			}
+		}
+		step, err := p.parseStep()
+		if err != nil {
+			return err
+		}
+		path.steps = append(path.steps, step)
+		expectSeparator = true
+	}
+}
+
+var xpathAxes = map[string]bool{
+	"ancestor":           true,
+	"ancestor-or-self":   true,
+	"attribute":          true,
+	"child":              true,
+	"descendant":         true,
+	"descendant-or-self": true,
+	"following":          true,
+	"following-sibling":  true,
+	"parent":             true,
+	"preceding":          true,
+	"preceding-sibling":  true,
+	"self":               true,
+}
+
+func (p *xpathParser) parseStep() (*xpathStep, error) {
+	if p.isPunct(".") {
+		p.next()
+		return &xpathStep{axis: "self", test: xpathNodeTest{nodeType: "node"}}, nil
+	}
+	if p.isPunct("..") {
+		p.next()
+		return &xpathStep{axis: "parent", test: xpathNodeTest{nodeType: "node"}}, nil
+	}
+
+	step := &xpathStep{axis: "child"}
+	if p.isPunct("@") {
+		p.next()
+		step.axis = "attribute"
+	} else if t, next := p.peek(), p.peekAt(1); t.kind == xpathTokenName && next.kind == xpathTokenPunct && next.value == "::" {
+		if t.value == "namespace" {
+			return nil, fmt.Errorf("the namespace axis is not supported")
+		}
+		if !xpathAxes[t.value] {
+			return nil, fmt.Errorf("unknown axis %q", t.value)
+		}
+		step.axis = t.value
+		p.next()
+		p.next()
+	}
+
+	t := p.next()
+	switch t.kind {
+	case xpathTokenNameTest:
+		if t.value == "*" {
+			step.test = xpathNodeTest{local: "*"}
+		} else {
+			step.test = xpathNodeTest{prefix: strings.TrimSuffix(t.value, ":*"), local: "*"}
+		}
+	case xpathTokenName:
+		if next := p.peek(); next.kind == xpathTokenPunct && next.value == "(" {
+			switch t.value {
+			case "node", "text", "comment", "processing-instruction":
+			default:
+				return nil, fmt.Errorf("unexpected function call %s() in location path", t.value)
+			}
+			p.next()
+			step.test = xpathNodeTest{nodeType: t.value}
+			if t.value == "processing-instruction" && p.peek().kind == xpathTokenLiteral {
+				step.test.local = p.next().value
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if i := strings.IndexByte(t.value, ':'); i >= 0 {
+			step.test = xpathNodeTest{prefix: t.value[:i], local: t.value[i+1:]}
+		} else {
+			step.test = xpathNodeTest{local: t.value}
+		}
+	case xpathTokenEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	default:
+		return nil, fmt.Errorf("unexpected %q", t.value)
+	}
+
+	predicates, err := p.parsePredicates()
+	if err != nil {
+		return nil, err
+	}
+	step.predicates = predicates
+	return step, nil
+}
+
+func (p *xpathParser) parsePredicates() ([]xpathExpr, error) {
+	var predicates []xpathExpr
+	for p.isPunct("[") {
+		p.next()
+		predicate, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, predicate)
+	}
+	return predicates, nil
+}
+
+func (p *xpathParser) parsePrimary() (xpathExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case xpathTokenVariable:
+		return &xpathVariable{t.value}, nil
+	case xpathTokenLiteral:
+		return &xpathLiteral{t.value}, nil
+	case xpathTokenNumber:
+		value, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.value)
+		}
+		return &xpathNumber{value}, nil
+	case xpathTokenPunct:
+		// startsPrimaryExpr only accepts "("
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	}
+
+	// function call
+	p.next()
+	call := &xpathFunctionCall{name: t.value}
+	if !p.isPunct(")") {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if !p.isPunct(",") {
+				break
+			}
+			p.next()
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	arity, ok := xpathFunctions[call.name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported function %s()", call.name)
+	}
+	if len(call.args) < arity.min || (arity.max >= 0 && len(call.args) > arity.max) {
+		return nil, fmt.Errorf("wrong number of arguments for %s()", call.name)
+	}
+	return call, nil
+}
+
+// expressions
+
+type xpathLiteral struct {
+	value string
+}
+
+func (e *xpathLiteral) eval(ctx *xpathContext) (interface{}, error) {
+	return e.value, nil
+}
+
+type xpathNumber struct {
+	value float64
+}
+
+func (e *xpathNumber) eval(ctx *xpathContext) (interface{}, error) {
+	return e.value, nil
+}
+
+type xpathVariable struct {
+	name string
+}
+
+func (e *xpathVariable) eval(ctx *xpathContext) (interface{}, error) {
+	if ctx.env != nil && ctx.env.variable != nil {
+		if value, ok := ctx.env.variable(e.name); ok {
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("undefined variable $%s", e.name)
+}
+
+type xpathNegate struct {
+	expr xpathExpr
+}
+
+func (e *xpathNegate) eval(ctx *xpathContext) (interface{}, error) {
+	value, err := e.expr.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return -xpathNumberValue(value), nil
+}
+
+type xpathUnion struct {
+	left, right xpathExpr
+}
+
+func (e *xpathUnion) eval(ctx *xpathContext) (interface{}, error) {
+	var result xpathNodeSet
+	for _, expr := range []xpathExpr{e.left, e.right} {
+		value, err := expr.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		nodes, ok := value.(xpathNodeSet)
+		if !ok {
+			return nil, fmt.Errorf("the operands of | have to be node-sets")
+		}
+		result = append(result, nodes...)
+	}
+	return sortNodeSet(result), nil
+}
+
+type xpathBinary struct {
+	op          string
+	left, right xpathExpr
+}
+
+func (e *xpathBinary) eval(ctx *xpathContext) (interface{}, error) {
+	left, err := e.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// and and or don't evaluate their right operand when not needed
+	switch e.op {
+	case "and":
+		if !xpathBooleanValue(left) {
+			return false, nil
+		}
+	case "or":
+		if xpathBooleanValue(left) {
+			return true, nil
+		}
+	}
+
+	right, err := e.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "and", "or":
+		return xpathBooleanValue(right), nil
+	case "=", "!=", "<", "<=", ">", ">=":
+		return xpathCompare(e.op, left, right), nil
+	}
+
+	l, r := xpathNumberValue(left), xpathNumberValue(right)
+	switch e.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "div":
+		return l / r, nil
+	default:
+		return math.Mod(l, r), nil
+	}
+}
+
+// xpathCompare implements the comparisons of XPath, where a node-set
+// compares true when any of its nodes does
+func xpathCompare(op string, left, right interface{}) bool {
+	leftNodes, leftIsNodeSet := left.(xpathNodeSet)
+	rightNodes, rightIsNodeSet := right.(xpathNodeSet)
+
+	switch {
+	case leftIsNodeSet && rightIsNodeSet:
+		for _, l := range leftNodes {
+			for _, r := range rightNodes {
+				if xpathCompareAtoms(op, l.stringValue(), r.stringValue()) {
+					return true
+				}
+			}
+		}
+		return false
+	case leftIsNodeSet:
+		if b, ok := right.(bool); ok {
+			return xpathCompareAtoms(op, xpathBooleanValue(left), b)
+		}
+		for _, l := range leftNodes {
+			if xpathCompareAtoms(op, xpathAtomOfType(l.stringValue(), right), right) {
+				return true
+			}
+		}
+		return false
+	case rightIsNodeSet:
+		if b, ok := left.(bool); ok {
+			return xpathCompareAtoms(op, b, xpathBooleanValue(right))
+		}
+		for _, r := range rightNodes {
+			if xpathCompareAtoms(op, left, xpathAtomOfType(r.stringValue(), left)) {
+				return true
+			}
+		}
+		return false
+	}
+	return xpathCompareAtoms(op, left, right)
+}
+
+// xpathAtomOfType converts the string-value of a node to the type of the
+// value it is compared to
+func xpathAtomOfType(value string, other interface{}) interface{} {
+	if _, ok := other.(float64); ok {
+		return xpathNumberValue(value)
+	}
+	return value
+}
+
+func xpathCompareAtoms(op string, left, right interface{}) bool {
+	switch op {
+	case "=", "!=":
+		var equal bool
+		_, leftIsBool := left.(bool)
+		_, rightIsBool := right.(bool)
+		_, leftIsNumber := left.(float64)
+		_, rightIsNumber := right.(float64)
+		switch {
+		case leftIsBool || rightIsBool:
+			equal = xpathBooleanValue(left) == xpathBooleanValue(right)
+		case leftIsNumber || rightIsNumber:
+			equal = xpathNumberValue(left) == xpathNumberValue(right)
+		default:
+			equal = xpathStringValue(left) == xpathStringValue(right)
+		}
+		return equal == (op == "=")
+	}
+
+	l, r := xpathNumberValue(left), xpathNumberValue(right)
+	switch op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	default:
+		return l >= r
+	}
+}
+
+type xpathFilter struct {
+	expr       xpathExpr
+	predicates []xpathExpr
+}
+
+func (e *xpathFilter) eval(ctx *xpathContext) (interface{}, error) {
+	value, err := e.expr.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := value.(xpathNodeSet)
+	if !ok {
+		return nil, fmt.Errorf("predicates can only filter node-sets")
+	}
+	return applyXPathPredicates(ctx, nodes, e.predicates)
+}
+
+type xpathNodeTest struct {
+	// nodeType is set for the node(), text(), comment() and
+	// processing-instruction() tests, which keeps its target in local
+	nodeType string
+	prefix   string
+	local    string
+}
+
+func (t *xpathNodeTest) matches(ctx *xpathContext, n *xmlNode, axis string) (bool, error) {
+	switch t.nodeType {
+	case "node":
+		return true, nil
+	case "text":
+		return n.Type == xmlTextNode, nil
+	case "comment":
+		return n.Type == xmlCommentNode, nil
+	case "processing-instruction":
+		return n.Type == xmlProcInstNode && (t.local == "" || n.Local == t.local), nil
+	}
+
+	// the principal node type of the attribute axis is attribute, and
+	// element for the others
+	if axis == "attribute" {
+		if n.Type != xmlAttributeNode {
+			return false, nil
+		}
+	} else if n.Type != xmlElementNode {
+		return false, nil
+	}
+
+	if t.prefix == "" && t.local == "*" {
+		return true, nil
+	}
+	space := ""
+	if t.prefix != "" {
+		var ok bool
+		if ctx.env != nil && ctx.env.namespace != nil {
+			space, ok = ctx.env.namespace(t.prefix)
+		}
+		if !ok {
+			return false, fmt.Errorf("undeclared namespace prefix %q", t.prefix)
+		}
+	}
+	return n.Space == space && (t.local == "*" || n.Local == t.local), nil
+}
+
+type xpathStep struct {
+	axis       string
+	test       xpathNodeTest
+	predicates []xpathExpr
+}
+
+type xpathPath struct {
+	// start is the expression the path starts from, if any
+	start    xpathExpr
+	absolute bool
+	steps    []*xpathStep
+}
+
+func (e *xpathPath) eval(ctx *xpathContext) (interface{}, error) {
+	var nodes xpathNodeSet
+	switch {
+	case e.start != nil:
+		value, err := e.start.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if nodes, ok = value.(xpathNodeSet); !ok {
+			return nil, fmt.Errorf("location paths can only start from node-sets")
+		}
+	case e.absolute:
+		nodes = xpathNodeSet{ctx.node.root()}
+	default:
+		nodes = xpathNodeSet{ctx.node}
+	}
+
+	for _, step := range e.steps {
+		var result xpathNodeSet
+		for _, node := range nodes {
+			var selected xpathNodeSet
+			for _, candidate := range xpathAxisNodes(step.axis, node) {
+				ok, err := step.test.matches(ctx, candidate, step.axis)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					selected = append(selected, candidate)
+				}
+			}
+			selected, err := applyXPathPredicates(ctx, selected, step.predicates)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, selected...)
+		}
+		nodes = sortNodeSet(result)
+	}
+	return nodes, nil
+}
+
+// applyXPathPredicates filters nodes, given in the order of the axis they
+// were selected from
+func applyXPathPredicates(ctx *xpathContext, nodes xpathNodeSet, predicates []xpathExpr) (xpathNodeSet, error) {
+	for _, predicate := range predicates {
+		var result xpathNodeSet
+		for i, node := range nodes {
+			value, err := predicate.eval(&xpathContext{node: node, position: i + 1, size: len(nodes), env: ctx.env})
+			if err != nil {
+				return nil, err
+			}
+			keep := false
+			if number, ok := value.(float64); ok {
+				keep = number == float64(i+1)
+			} else {
+				keep = xpathBooleanValue(value)
+			}
+			if keep {
+				result = append(result, node)
+			}
+		}
+		nodes = result
+	}
+	return nodes, nil
+}
+
+// xpathAxisNodes returns the nodes of an axis, in the order of the axis
+func xpathAxisNodes(axis string, n *xmlNode) xpathNodeSet {
+	var nodes xpathNodeSet
+	switch axis {
+	case "self":
+		nodes = append(nodes, n)
+	case "child":
+		if n.Type != xmlAttributeNode {
+			nodes = append(nodes, n.Children...)
+		}
+	case "attribute":
+		if n.Type == xmlElementNode {
+			nodes = append(nodes, n.Attrs...)
+		}
+	case "parent":
+		if n.Parent != nil {
+			nodes = append(nodes, n.Parent)
+		}
+	case "ancestor", "ancestor-or-self":
+		if axis == "ancestor-or-self" {
+			nodes = append(nodes, n)
+		}
+		for p := n.Parent; p != nil; p = p.Parent {
+			nodes = append(nodes, p)
+		}
+	case "descendant", "descendant-or-self":
+		if axis == "descendant-or-self" {
+			nodes = append(nodes, n)
+		}
+		if n.Type != xmlAttributeNode {
+			nodes = appendXPathDescendants(nodes, n)
+		}
+	case "following-sibling", "preceding-sibling":
+		if n.Parent == nil || n.Type == xmlAttributeNode {
+			break
+		}
+		siblings := n.Parent.Children
+		for i, sibling := range siblings {
+			if sibling != n {
+				continue
+			}
+			if axis == "following-sibling" {
+				nodes = append(nodes, siblings[i+1:]...)
+			} else {
+				for j := i - 1; j >= 0; j-- {
+					nodes = append(nodes, siblings[j])
+				}
+			}
+			break
+		}
+	case "following":
+		// the following nodes are the descendants of the following
+		// siblings of the node and of its ancestors
+		start := n
+		if n.Type == xmlAttributeNode {
+			start = n.Parent
+			nodes = appendXPathDescendants(nodes, start)
+		}
+		for e := start; e != nil && e.Parent != nil; e = e.Parent {
+			for _, sibling := range xpathAxisNodes("following-sibling", e) {
+				nodes = append(nodes, sibling)
+				nodes = appendXPathDescendants(nodes, sibling)
+			}
+		}
+	case "preceding":
+		start := n
+		if n.Type == xmlAttributeNode {
+			start = n.Parent
+		}
+		for e := start; e != nil && e.Parent != nil; e = e.Parent {
+			for _, sibling := range xpathAxisNodes("preceding-sibling", e) {
+				var subtree xpathNodeSet
+				subtree = appendXPathDescendants(append(subtree, sibling), sibling)
+				for i := len(subtree) - 1; i >= 0; i-- {
+					nodes = append(nodes, subtree[i])
+				}
+			}
+		}
+	}
+	return nodes
+}
+
+func appendXPathDescendants(nodes xpathNodeSet, n *xmlNode) xpathNodeSet {
+	for _, child := range n.Children {
+		nodes = append(nodes, child)
+		nodes = appendXPathDescendants(nodes, child)
+	}
+	return nodes
+}
+
+// sortNodeSet sorts nodes in document order and removes the duplicates
+func sortNodeSet(nodes xpathNodeSet) xpathNodeSet {
+	if len(nodes) < 2 {
+		return nodes
+	}
+	seen := make(map[*xmlNode]bool, len(nodes))
+	result := make(xpathNodeSet, 0, len(nodes))
+	for _, node := range nodes {
+		if !seen[node] {
+			seen[node] = true
+			result = append(result, node)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].order < result[j].order
+	})
+	return result
+}
+
+// conversions
+
+func xpathStringValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case float64:
+		return xpathFormatNumber(v)
+	case xpathNodeSet:
+		if len(v) == 0 {
+			return ""
+		}
+		return v[0].stringValue()
+	}
+	return ""
+}
+
+// xpathFormatNumber converts a number to a string like libxslt does, so
+// that stylesheets give the same results as with xsltproc: integers are
+// written without decimals, and the other numbers with 15 significant
+// digits and no trailing zeros, using an exponent when they are very small
+// or very large
+func xpathFormatNumber(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "Infinity"
+	case math.IsInf(v, -1):
+		return "-Infinity"
+	case v > math.MinInt32 && v < math.MaxInt32 && v == math.Trunc(v):
+		return strconv.Itoa(int(v))
+	}
+
+	abs := math.Abs(v)
+	if abs > 1e9 || abs < 1e-5 {
+		s := strconv.FormatFloat(v, 'e', 14, 64)
+		i := strings.IndexByte(s, 'e')
+		return strings.TrimSuffix(strings.TrimRight(s[:i], "0"), ".") + s[i:]
+	}
+	digits := 15
+	if exponent := int(math.Log10(abs)); exponent > 0 {
+		digits -= exponent + 1
+	} else {
+		digits -= exponent
+	}
+	s := strconv.FormatFloat(v, 'f', digits, 64)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+func xpathNumberValue(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	}
+
+	s := strings.TrimSpace(xpathStringValue(value))
+	// XPath numbers have no exponent, sign or special values
+	valid := s != "" && s != "." && s != "-" && s != "-."
+	for i, r := range s {
+		if !(r >= '0' && r <= '9' || r == '.' || (r == '-' && i == 0)) {
+			valid = false
+		}
+	}
+	if !valid || strings.Count(s, ".") > 1 {
+		return math.NaN()
+	}
+	number, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return number
+}
+
+func xpathBooleanValue(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	case xpathNodeSet:
+		return len(v) > 0
+	}
+	return false
+}
+
+// functions
+
+type xpathArity struct {
+	min, max int
+}
+
+// xpathFunctions lists the supported functions, with their number of
+// arguments. A negative maximum means any number of arguments.
+var xpathFunctions = map[string]xpathArity{
+	"last":             {0, 0},
+	"position":         {0, 0},
+	"count":            {1, 1},
+	"local-name":       {0, 1},
+	"namespace-uri":    {0, 1},
+	"name":             {0, 1},
+	"string":           {0, 1},
+	"concat":           {2, -1},
+	"starts-with":      {2, 2},
+	"contains":         {2, 2},
+	"substring-before": {2, 2},
+	"substring-after":  {2, 2},
+	"substring":        {2, 3},
+	"string-length":    {0, 1},
+	"normalize-space":  {0, 1},
+	"translate":        {3, 3},
+	"boolean":          {1, 1},
+	"not":              {1, 1},
+	"true":             {0, 0},
+	"false":            {0, 0},
+	"number":           {0, 1},
+	"sum":              {1, 1},
+	"floor":            {1, 1},
+	"ceiling":          {1, 1},
+	"round":            {1, 1},
+	"current":          {0, 0},
+}
+
+type xpathFunctionCall struct {
+	name string
+	args []xpathExpr
+}
+
+func (e *xpathFunctionCall) eval(ctx *xpathContext) (interface{}, error) {
+	args := make([]interface{}, len(e.args))
+	for i, arg := range e.args {
+		value, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+
+	// the functions taking an optional argument default to the context node
+	argOrContext := func() interface{} {
+		if len(args) > 0 {
+			return args[0]
+		}
+		return xpathNodeSet{ctx.node}
+	}
+	nodeSetArg := func(i int) (xpathNodeSet, error) {
+		nodes, ok := args[i].(xpathNodeSet)
+		if !ok {
+			return nil, fmt.Errorf("the argument of %s() has to be a node-set", e.name)
+		}
+		return nodes, nil
+	}
+	firstNode := func() (*xmlNode, error) {
+		if len(args) == 0 {
+			return ctx.node, nil
+		}
+		nodes, err := nodeSetArg(0)
+		if err != nil || len(nodes) == 0 {
+			return nil, err
+		}
+		return nodes[0], nil
+	}
+	stringArg := func(i int) string {
+		return xpathStringValue(args[i])
+	}
+
+	switch e.name {
+	case "last":
+		return float64(ctx.size), nil
+	case "position":
+		return float64(ctx.position), nil
+	case "count":
+		nodes, err := nodeSetArg(0)
+		if err != nil {
+			return nil, err
+		}
+		return float64(len(nodes)), nil
+	case "local-name", "namespace-uri", "name":
+		node, err := firstNode()
+		if err != nil || node == nil {
+			return "", err
+		}
+		if node.Type != xmlElementNode && node.Type != xmlAttributeNode && node.Type != xmlProcInstNode {
+			return "", nil
+		}
+		switch e.name {
+		case "local-name":
+			return node.Local, nil
+		case "namespace-uri":
+			return node.Space, nil
+		}
+		return node.name(), nil
+	case "string":
+		return xpathStringValue(argOrContext()), nil
+	case "concat":
+		var buf strings.Builder
+		for i := range args {
+			buf.WriteString(stringArg(i))
+		}
+		return buf.String(), nil
+	case "starts-with":
+		return strings.HasPrefix(stringArg(0), stringArg(1)), nil
+	case "contains":
+		return strings.Contains(stringArg(0), stringArg(1)), nil
+	case "substring-before":
+		s, sep := stringArg(0), stringArg(1)
+		if i := strings.Index(s, sep); i >= 0 {
+			return s[:i], nil
+		}
+		return "", nil
+	case "substring-after":
+		s, sep := stringArg(0), stringArg(1)
+		if i := strings.Index(s, sep); i >= 0 {
+			return s[i+len(sep):], nil
+		}
+		return "", nil
+	case "substring":
+		return xpathSubstring(stringArg(0), args[1:]), nil
+	case "string-length":
+		return float64(utf8.RuneCountInString(xpathStringValue(argOrContext()))), nil
+	case "normalize-space":
+		return strings.Join(strings.Fields(xpathStringValue(argOrContext())), " "), nil
+	case "translate":
+		from, to := []rune(stringArg(1)), []rune(stringArg(2))
+		return strings.Map(func(r rune) rune {
+			for i, f := range from {
+				if f == r {
+					if i < len(to) {
+						return to[i]
+					}
+					return -1
+				}
+			}
+			return r
+		}, stringArg(0)), nil
+	case "boolean":
+		return xpathBooleanValue(args[0]), nil
+	case "not":
+		return !xpathBooleanValue(args[0]), nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "number":
+		return xpathNumberValue(argOrContext()), nil
+	case "sum":
+		nodes, err := nodeSetArg(0)
+		if err != nil {
+			return nil, err
+		}
+		sum := 0.0
+		for _, node := range nodes {
+			sum += xpathNumberValue(node.stringValue())
+		}
+		return sum, nil
+	case "floor":
+		return math.Floor(xpathNumberValue(args[0])), nil
+	case "ceiling":
+		return math.Ceil(xpathNumberValue(args[0])), nil
+	case "round":
+		return xpathRound(xpathNumberValue(args[0])), nil
+	case "current":
+		if ctx.env != nil && ctx.env.current != nil {
+			return xpathNodeSet{ctx.env.current}, nil
+		}
+		return xpathNodeSet{ctx.node}, nil
+	}
+	return nil, fmt.Errorf("unsupported function %s()", e.name)
+}
+
+func xpathRound(x float64) float64 {
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return x
+	}
+	return math.Floor(x + 0.5)
+}
+
+// xpathSubstring implements substring(), which counts characters from 1
+// and rounds its arguments
+func xpathSubstring(s string, args []interface{}) string {
+	runes := []rune(s)
+	start := xpathRound(xpathNumberValue(args[0]))
+	end := math.Inf(1)
+	if len(args) > 1 {
+		end = start + xpathRound(xpathNumberValue(args[1]))
+	}
+
+	var buf strings.Builder
+	for i, r := range runes {
+		position := float64(i + 1)
+		if position >= start && position < end {
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,116 @@
+package xslt
+
+import (
+	"math"
+	"testing"
+)
+
+const xpathTestXML = `<domain type="kvm" xmlns:qemu="http://libvirt.org/schemas/domain/qemu/1.0">
+  <name>test</name>
+  <memory unit="KiB">524288</memory>
+  <devices>
+    <disk type="file" device="disk"><target dev="vda" bus="virtio"/></disk>
+    <disk type="file" device="cdrom"><target dev="hda" bus="ide"/></disk>
+    <interface type="network"><model type="virtio"/></interface>
+    <!-- console -->
+    <console type="pty"/>
+  </devices>
+  <qemu:commandline><qemu:arg value="-snapshot"/></qemu:commandline>
+</domain>`
+
+func TestEvalXPath(t *testing.T) {
+	doc, err := parseXMLTree(xpathTestXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &xpathEnv{namespace: doc.Children[0].lookupNamespace}
+
+	for _, tc := range []struct {
+		expr     string
+		expected string
+	}{
+		{"/domain/name", "test"},
+		{"string(/domain/@type)", "kvm"},
+		{"count(//disk)", "2"},
+		{"//disk[@device='cdrom']/target/@dev", "hda"},
+		{"//disk[2]/target/@bus", "ide"},
+		{"//disk[last()]/@device", "cdrom"},
+		{"//target[../@device='disk']/@dev", "vda"},
+		{"name(//disk[1]/following-sibling::*[1])", "disk"},
+		{"name(//console/preceding-sibling::*[1])", "interface"},
+		{"count(//devices/comment())", "1"},
+		{"/domain/memory * 2 div 1024", "1024"},
+		{"/domain/memory > 100000 and not(/domain/vcpu)", "true"},
+		{"concat(//model/@type, '-', substring('abcdef', 2, 3))", "virtio-bcd"},
+		{"translate(normalize-space('  a  b '), 'ab', 'AB')", "A B"},
+		{"//qemu:arg/@value", "-snapshot"},
+		{"local-name(/domain/qemu:commandline)", "commandline"},
+		{"count(//@*[. = 'file'])", "2"},
+		{"sum(//disk/target/@dev | //console) = 0", "false"},
+		{"-(3 - 5) mod 3", "2"},
+		{"round(2.5) + floor(-1.5) + ceiling(0.2)", "2"},
+		{"substring-after(//memory/@unit, 'K')", "iB"},
+		{"boolean(//disk[@device='floppy'])", "false"},
+	} {
+		expr, err := compileXPath(tc.expr)
+		if err != nil {
+			t.Errorf("%s: %s", tc.expr, err)
+			continue
+		}
+		value, err := evalXPath(expr, doc, env)
+		if err != nil {
+			t.Errorf("%s: %s", tc.expr, err)
+			continue
+		}
+		if result := xpathStringValue(value); result != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.expr, tc.expected, result)
+		}
+	}
+}
+
+func TestCompileXPathErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"/domain/",
+		"//disk[@device='cdrom'",
+		"'unterminated",
+		"/domain/foo()",
+		"unknown(1)",
+		"namespace::*",
+		"count()",
+		"/domain/devices disk",
+	} {
+		if _, err := compileXPath(expr); err == nil {
+			t.Errorf("Expected %q not to compile", expr)
+		}
+	}
+}
+
+func TestXPathFormatNumber(t *testing.T) {
+	// the results of xsltproc
+	for _, tc := range []struct {
+		number   float64
+		expected string
+	}{
+		{0, "0"},
+		{math.Copysign(0, -1), "0"},
+		{42, "42"},
+		{-7, "-7"},
+		{0.1 + 0.2, "0.3"},
+		{1.0 / 3, "0.333333333333333"},
+		{2.0 / 3, "0.666666666666667"},
+		{-2.5, "-2.5"},
+		{123456.789, "123456.789"},
+		{3000000000, "3e+09"},
+		{1e10, "1e+10"},
+		{0.000001, "1e-06"},
+		{1.5e-7, "1.5e-07"},
+		{math.Inf(1), "Infinity"},
+		{math.Inf(-1), "-Infinity"},
+		{math.NaN(), "NaN"},
+	} {
+		if result := xpathStringValue(tc.number); result != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.number, tc.expected, result)
+		}
+	}
+}
@@ -0,0 +1,1315 @@
+// Package xslt applies the XSLT stylesheets and the XPath based patches of
+// the xml blocks of the resources, without depending on libxslt.
+//
+// The XSLT 1.0 processor supports what is needed to tweak libvirt
+// definitions: templates and modes, the control instructions, variables and
+// parameters, sorting and the creation of every kind of node, with the xml
+// and text output methods. Imports, includes, keys, attribute sets,
+// numbering and the html output method are not supported: stylesheets using
+// them parse, but fail when applied. The output is not indented.
+package xslt
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	xsltNamespace = "http://www.w3.org/1999/XSL/Transform"
+
+	// xsltMaxDepth limits the nesting of templates, so that a recursive
+	// stylesheet fails instead of overflowing the stack of the plugin
+	xsltMaxDepth = 1000
+)
+
+// xsltTemplate is one alternative of the pattern of a template, or a named
+// template
+type xsltTemplate struct {
+	node     *xmlNode
+	match    *xpathPath
+	mode     string
+	priority float64
+}
+
+// xsltNameTest is a name test of xsl:strip-space or xsl:preserve-space
+type xsltNameTest struct {
+	space    string
+	local    string
+	priority float64
+}
+
+// xsltAVTPart is a part of an attribute value template, either a literal
+// string or an expression
+type xsltAVTPart struct {
+	literal string
+	expr    xpathExpr
+}
+
+// Stylesheet is a parsed XSLT stylesheet
+type Stylesheet struct {
+	templates          []*xsltTemplate
+	named              map[string]*xsltTemplate
+	globals            []*xmlNode
+	stripSpace         []xsltNameTest
+	preserveSpace      []xsltNameTest
+	omitXMLDeclaration bool
+	textOutput         bool
+
+	// unsupported lists the features of XSLT 1.0 the stylesheet uses which
+	// this processor doesn't implement
+	unsupported []string
+
+	exprs map[string]xpathExpr
+	avts  map[string][]xsltAVTPart
+}
+
+// Parse parses a stylesheet and compiles all its expressions. A stylesheet
+// using features which are not supported is not an error, see Unsupported.
+func Parse(xslt string) (*Stylesheet, error) {
+	// we trim the xslt as it may contain space before the xml declaration
+	// because of HCL heredoc
+	doc, err := parseXMLTree(strings.TrimSpace(xslt))
+	if err != nil {
+		return nil, err
+	}
+
+	var root *xmlNode
+	for _, child := range doc.Children {
+		if child.Type == xmlElementNode {
+			root = child
+		}
+	}
+	if root.Space != xsltNamespace || (root.Local != "stylesheet" && root.Local != "transform") {
+		return nil, fmt.Errorf("the document element has to be xsl:stylesheet or xsl:transform")
+	}
+	stripStylesheetSpace(root)
+
+	s := &Stylesheet{
+		named: map[string]*xsltTemplate{},
+		exprs: map[string]xpathExpr{},
+		avts:  map[string][]xsltAVTPart{},
+	}
+	for _, n := range root.Children {
+		if n.Type == xmlTextNode {
+			return nil, fmt.Errorf("unexpected text %q in xsl:%s", strings.TrimSpace(n.Data), root.Local)
+		}
+		// top-level elements of other namespaces are ignored
+		if n.Type != xmlElementNode || n.Space != xsltNamespace {
+			continue
+		}
+		if err := s.parseTopLevel(n); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Unsupported returns the features used by the stylesheet which are valid
+// XSLT 1.0 but can't be applied
+func (s *Stylesheet) Unsupported() []string {
+	return s.unsupported
+}
+
+// addUnsupported records the use of a feature which is not supported, once
+func (s *Stylesheet) addUnsupported(feature string) {
+	for _, f := range s.unsupported {
+		if f == feature {
+			return
+		}
+	}
+	s.unsupported = append(s.unsupported, feature)
+}
+
+// stripStylesheetSpace removes the whitespace-only text nodes of the
+// stylesheet, except in xsl:text
+func stripStylesheetSpace(n *xmlNode) {
+	if n.Space == xsltNamespace && n.Local == "text" {
+		return
+	}
+	if space := n.attr(xmlNamespace, "space"); space != nil && space.Data == "preserve" {
+		return
+	}
+	children := n.Children[:0]
+	for _, child := range n.Children {
+		if child.Type == xmlTextNode && strings.TrimSpace(child.Data) == "" {
+			continue
+		}
+		if child.Type == xmlCommentNode || child.Type == xmlProcInstNode {
+			continue
+		}
+		if child.Type == xmlElementNode {
+			stripStylesheetSpace(child)
+		}
+		children = append(children, child)
+	}
+	n.Children = children
+}
+
+func (s *Stylesheet) parseTopLevel(n *xmlNode) error {
+	switch n.Local {
+	case "template":
+		return s.parseTemplate(n)
+	case "variable", "param":
+		if err := s.compileVariable(n); err != nil {
+			return err
+		}
+		s.globals = append(s.globals, n)
+	case "output":
+		switch method, _ := n.attrValue("method"); method {
+		case "", "xml":
+		case "text":
+			s.textOutput = true
+		default:
+			s.addUnsupported(fmt.Sprintf("output method %q", method))
+		}
+		if omit, ok := n.attrValue("omit-xml-declaration"); ok {
+			s.omitXMLDeclaration = omit == "yes"
+		}
+	case "strip-space", "preserve-space":
+		elements, ok := n.attrValue("elements")
+		if !ok {
+			return fmt.Errorf("xsl:%s requires an elements attribute", n.Local)
+		}
+		for _, name := range strings.Fields(elements) {
+			test := xsltNameTest{local: name}
+			switch {
+			case name == "*":
+				test.priority = -0.5
+			case strings.HasSuffix(name, ":*"):
+				test.priority = -0.25
+				test.local = "*"
+				space, ok := n.lookupNamespace(strings.TrimSuffix(name, ":*"))
+				if !ok {
+					return fmt.Errorf("undeclared namespace prefix in %q", name)
+				}
+				test.space = space
+			case strings.Contains(name, ":"):
+				parts := strings.SplitN(name, ":", 2)
+				space, ok := n.lookupNamespace(parts[0])
+				if !ok {
+					return fmt.Errorf("undeclared namespace prefix in %q", name)
+				}
+				test.space, test.local = space, parts[1]
+			}
+			if n.Local == "strip-space" {
+				s.stripSpace = append(s.stripSpace, test)
+			} else {
+				s.preserveSpace = append(s.preserveSpace, test)
+			}
+		}
+	case "import", "include", "key", "attribute-set", "decimal-format", "namespace-alias":
+		s.addUnsupported("xsl:" + n.Local)
+	default:
+		return fmt.Errorf("unknown XSLT element xsl:%s", n.Local)
+	}
+	return nil
+}
+
+func (s *Stylesheet) parseTemplate(n *xmlNode) error {
+	name, hasName := n.attrValue("name")
+	pattern, hasMatch := n.attrValue("match")
+	if !hasName && !hasMatch {
+		return fmt.Errorf("xsl:template requires a match or a name attribute")
+	}
+	mode, _ := n.attrValue("mode")
+
+	if err := s.compileTemplateBody(n); err != nil {
+		return err
+	}
+
+	if hasName {
+		s.named[name] = &xsltTemplate{node: n}
+	}
+	if !hasMatch {
+		return nil
+	}
+
+	expr, err := compileXPath(pattern)
+	if err != nil {
+		return err
+	}
+	var priority *float64
+	if value, ok := n.attrValue("priority"); ok {
+		p := xpathNumberValue(value)
+		if math.IsNaN(p) {
+			return fmt.Errorf("invalid priority %q", value)
+		}
+		priority = &p
+	}
+
+	// each alternative of a pattern is handled as a separate template
+	var alternatives []xpathExpr
+	var flatten func(e xpathExpr)
+	flatten = func(e xpathExpr) {
+		if union, ok := e.(*xpathUnion); ok {
+			flatten(union.left)
+			flatten(union.right)
+			return
+		}
+		alternatives = append(alternatives, e)
+	}
+	flatten(expr)
+
+	for _, alternative := range alternatives {
+		path, ok := alternative.(*xpathPath)
+		if !ok || path.start != nil {
+			return fmt.Errorf("unsupported pattern %q", pattern)
+		}
+		for _, step := range path.steps {
+			if step.axis != "child" && step.axis != "attribute" && step.axis != "descendant-or-self" {
+				return fmt.Errorf("invalid pattern %q: only the child and attribute axes are allowed", pattern)
+			}
+		}
+		template := &xsltTemplate{
+			node:     n,
+			match:    path,
+			mode:     mode,
+			priority: defaultPatternPriority(path),
+		}
+		if priority != nil {
+			template.priority = *priority
+		}
+		s.templates = append(s.templates, template)
+	}
+	return nil
+}
+
+// defaultPatternPriority returns the priority of a pattern as defined by
+// XSLT: more specific patterns win over generic ones
+func defaultPatternPriority(path *xpathPath) float64 {
+	if path.absolute || len(path.steps) != 1 || len(path.steps[0].predicates) != 0 {
+		return 0.5
+	}
+	test := path.steps[0].test
+	switch {
+	case test.nodeType == "processing-instruction" && test.local != "":
+		return 0
+	case test.nodeType != "":
+		return -0.5
+	case test.prefix == "" && test.local == "*":
+		return -0.5
+	case test.local == "*":
+		return -0.25
+	}
+	return 0
+}
+
+// compiling
+
+func (s *Stylesheet) compileExpr(n *xmlNode, attr string, required bool) error {
+	value, ok := n.attrValue(attr)
+	if !ok {
+		if required {
+			return fmt.Errorf("xsl:%s requires a %s attribute", n.Local, attr)
+		}
+		return nil
+	}
+	if _, ok := s.exprs[value]; ok {
+		return nil
+	}
+	expr, err := compileXPath(value)
+	if err != nil {
+		return err
+	}
+	s.exprs[value] = expr
+	return nil
+}
+
+func (s *Stylesheet) compileAVT(n *xmlNode, attr string, required bool) error {
+	value, ok := n.attrValue(attr)
+	if !ok {
+		if required {
+			return fmt.Errorf("xsl:%s requires a %s attribute", n.Local, attr)
+		}
+		return nil
+	}
+	return s.compileAVTValue(value)
+}
+
+func (s *Stylesheet) compileAVTValue(value string) error {
+	if _, ok := s.avts[value]; ok {
+		return nil
+	}
+
+	var parts []xsltAVTPart
+	var literal strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '{' && i+1 < len(value) && value[i+1] == '{':
+			literal.WriteByte('{')
+			i++
+		case c == '}' && i+1 < len(value) && value[i+1] == '}':
+			literal.WriteByte('}')
+			i++
+		case c == '}':
+			return fmt.Errorf("unbalanced } in attribute value template %q", value)
+		case c == '{':
+			end := strings.IndexByte(value[i:], '}')
+			if end < 0 {
+				return fmt.Errorf("unbalanced { in attribute value template %q", value)
+			}
+			expr, err := compileXPath(value[i+1 : i+end])
+			if err != nil {
+				return err
+			}
+			if literal.Len() > 0 {
+				parts = append(parts, xsltAVTPart{literal: literal.String()})
+				literal.Reset()
+			}
+			parts = append(parts, xsltAVTPart{expr: expr})
+			i += end
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	if literal.Len() > 0 {
+		parts = append(parts, xsltAVTPart{literal: literal.String()})
+	}
+	s.avts[value] = parts
+	return nil
+}
+
+func (s *Stylesheet) compileVariable(n *xmlNode) error {
+	if _, ok := n.attrValue("name"); !ok {
+		return fmt.Errorf("xsl:%s requires a name attribute", n.Local)
+	}
+	if err := s.compileExpr(n, "select", false); err != nil {
+		return err
+	}
+	return s.compileBody(n)
+}
+
+// compileTemplateBody compiles a template, which starts with its parameters
+func (s *Stylesheet) compileTemplateBody(n *xmlNode) error {
+	params := true
+	for _, child := range n.Children {
+		isParam := child.Type == xmlElementNode && child.Space == xsltNamespace && child.Local == "param"
+		if isParam && !params {
+			return fmt.Errorf("xsl:param has to be at the start of the template")
+		}
+		params = isParam
+		if isParam {
+			if err := s.compileVariable(child); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.compileNode(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Stylesheet) compileBody(n *xmlNode) error {
+	for _, child := range n.Children {
+		if err := s.compileNode(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Stylesheet) compileNode(n *xmlNode) error {
+	if n.Type != xmlElementNode {
+		return nil
+	}
+
+	// literal result element
+	if n.Space != xsltNamespace {
+		for _, attr := range n.Attrs {
+			if attr.Space == xsltNamespace {
+				if attr.Local == "use-attribute-sets" {
+					s.addUnsupported("attribute sets")
+				}
+				continue
+			}
+			if err := s.compileAVTValue(attr.Data); err != nil {
+				return err
+			}
+		}
+		return s.compileBody(n)
+	}
+
+	// checkChildren checks that the children are only the allowed
+	// instructions, the others being compiled as a template body
+	checkChildren := func(allowed ...string) error {
+		for _, child := range n.Children {
+			if child.Type == xmlTextNode {
+				return fmt.Errorf("unexpected text in xsl:%s", n.Local)
+			}
+			if child.Type != xmlElementNode {
+				continue
+			}
+			ok := false
+			for _, name := range allowed {
+				if child.Space == xsltNamespace && child.Local == name {
+					ok = true
+				}
+			}
+			if !ok {
+				return fmt.Errorf("unexpected element %s in xsl:%s", child.name(), n.Local)
+			}
+		}
+		return nil
+	}
+
+	switch n.Local {
+	case "apply-templates", "for-each", "call-template":
+		switch n.Local {
+		case "apply-templates":
+			if err := s.compileExpr(n, "select", false); err != nil {
+				return err
+			}
+		case "for-each":
+			if err := s.compileExpr(n, "select", true); err != nil {
+				return err
+			}
+		case "call-template":
+			if _, ok := n.attrValue("name"); !ok {
+				return fmt.Errorf("xsl:call-template requires a name attribute")
+			}
+		}
+		body := false
+		for _, child := range n.Children {
+			if child.Type == xmlElementNode && child.Space == xsltNamespace {
+				switch child.Local {
+				case "sort":
+					if n.Local == "call-template" || body {
+						return fmt.Errorf("unexpected xsl:sort in xsl:%s", n.Local)
+					}
+					if err := s.compileExpr(child, "select", false); err != nil {
+						return err
+					}
+					if _, ok := child.attrValue("select"); !ok {
+						s.exprs["."], _ = compileXPath(".")
+					}
+					for _, attr := range []string{"order", "data-type", "lang", "case-order"} {
+						if err := s.compileAVT(child, attr, false); err != nil {
+							return err
+						}
+					}
+					continue
+				case "with-param":
+					if n.Local == "for-each" {
+						return fmt.Errorf("unexpected xsl:with-param in xsl:for-each")
+					}
+					if err := s.compileVariable(child); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			if n.Local != "for-each" {
+				if child.Type == xmlTextNode {
+					return fmt.Errorf("unexpected text in xsl:%s", n.Local)
+				}
+				return fmt.Errorf("unexpected element %s in xsl:%s", child.name(), n.Local)
+			}
+			body = true
+			if err := s.compileNode(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "if":
+		if err := s.compileExpr(n, "test", true); err != nil {
+			return err
+		}
+		return s.compileBody(n)
+	case "choose":
+		if err := checkChildren("when", "otherwise"); err != nil {
+			return err
+		}
+		for i, child := range n.Children {
+			if child.Local == "otherwise" {
+				if i != len(n.Children)-1 {
+					return fmt.Errorf("xsl:otherwise has to be the last element of xsl:choose")
+				}
+			} else if err := s.compileExpr(child, "test", true); err != nil {
+				return err
+			}
+			if err := s.compileBody(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "value-of", "copy-of":
+		if err := s.compileExpr(n, "select", true); err != nil {
+			return err
+		}
+		return checkChildren()
+	case "copy":
+		if _, ok := n.attrValue("use-attribute-sets"); ok {
+			s.addUnsupported("attribute sets")
+		}
+		return s.compileBody(n)
+	case "element", "attribute":
+		if err := s.compileAVT(n, "name", true); err != nil {
+			return err
+		}
+		if err := s.compileAVT(n, "namespace", false); err != nil {
+			return err
+		}
+		if _, ok := n.attrValue("use-attribute-sets"); ok {
+			s.addUnsupported("attribute sets")
+		}
+		return s.compileBody(n)
+	case "processing-instruction":
+		if err := s.compileAVT(n, "name", true); err != nil {
+			return err
+		}
+		return s.compileBody(n)
+	case "comment", "message", "fallback":
+		return s.compileBody(n)
+	case "text":
+		for _, child := range n.Children {
+			if child.Type != xmlTextNode {
+				return fmt.Errorf("xsl:text can only contain text")
+			}
+		}
+		return nil
+	case "variable":
+		return s.compileVariable(n)
+	case "number", "apply-imports":
+		s.addUnsupported("xsl:" + n.Local)
+		return nil
+	}
+	return fmt.Errorf("unknown XSLT instruction xsl:%s", n.Local)
+}
+
+// execution
+
+// xsltScope is a variable binding, chained to the bindings visible from it
+type xsltScope struct {
+	name   string
+	value  interface{}
+	parent *xsltScope
+}
+
+func (scope *xsltScope) lookup(name string) (interface{}, bool) {
+	for ; scope != nil; scope = scope.parent {
+		if scope.name == name {
+			return scope.value, true
+		}
+	}
+	return nil, false
+}
+
+type xsltContext struct {
+	node     *xmlNode
+	position int
+	size     int
+	scope    *xsltScope
+	mode     string
+	depth    int
+}
+
+func (ctx *xsltContext) with(node *xmlNode, position, size int) *xsltContext {
+	c := *ctx
+	c.node, c.position, c.size = node, position, size
+	return &c
+}
+
+// xsltPatternMatch identifies the nodes of a document matched by a pattern
+type xsltPatternMatch struct {
+	template *xsltTemplate
+	root     *xmlNode
+}
+
+type xsltProcessor struct {
+	stylesheet *Stylesheet
+	// absoluteMatches caches the nodes matched by the absolute patterns
+	absoluteMatches map[xsltPatternMatch]map[*xmlNode]bool
+}
+
+// Transform applies the stylesheet to a document
+func (s *Stylesheet) Transform(xml string) (string, error) {
+	if len(s.unsupported) > 0 {
+		return "", fmt.Errorf("the stylesheet uses features which are not supported: %s", strings.Join(s.unsupported, ", "))
+	}
+
+	doc, err := parseXMLTree(xml)
+	if err != nil {
+		return "", err
+	}
+	s.stripSourceSpace(doc)
+	doc.renumber()
+
+	p := &xsltProcessor{
+		stylesheet:      s,
+		absoluteMatches: map[xsltPatternMatch]map[*xmlNode]bool{},
+	}
+	ctx := &xsltContext{node: doc, position: 1, size: 1}
+	for _, global := range s.globals {
+		name, _ := global.attrValue("name")
+		value, err := p.evalVariable(global, ctx)
+		if err != nil {
+			return "", err
+		}
+		ctx.scope = &xsltScope{name: name, value: value, parent: ctx.scope}
+	}
+
+	result := &xmlNode{Type: xmlDocumentNode}
+	if err := p.applyTemplates(ctx, xpathNodeSet{doc}, nil, result); err != nil {
+		return "", err
+	}
+
+	if s.textOutput {
+		return result.stringValue(), nil
+	}
+
+	var output strings.Builder
+	if !s.omitXMLDeclaration {
+		output.WriteString("<?xml version=\"1.0\"?>\n")
+	}
+	output.WriteString(serializeXMLTree(result))
+	output.WriteString("\n")
+	return output.String(), nil
+}
+
+// stripSourceSpace removes the whitespace-only text nodes of the elements
+// listed by xsl:strip-space
+func (s *Stylesheet) stripSourceSpace(n *xmlNode) {
+	if len(s.stripSpace) == 0 {
+		return
+	}
+	bestPriority := func(tests []xsltNameTest) float64 {
+		best := math.Inf(-1)
+		for _, test := range tests {
+			var matches bool
+			switch {
+			case test.priority == -0.5:
+				matches = true
+			case test.local == "*":
+				matches = test.space == n.Space
+			default:
+				matches = test.space == n.Space && test.local == n.Local
+			}
+			if matches {
+				best = math.Max(best, test.priority)
+			}
+		}
+		return best
+	}
+
+	strip := false
+	if n.Type == xmlElementNode {
+		strip = bestPriority(s.stripSpace) > bestPriority(s.preserveSpace)
+		if space := n.attr(xmlNamespace, "space"); space != nil && space.Data == "preserve" {
+			strip = false
+		}
+	}
+
+	children := n.Children[:0]
+	for _, child := range n.Children {
+		if strip && child.Type == xmlTextNode && strings.TrimSpace(child.Data) == "" {
+			continue
+		}
+		if child.Type == xmlElementNode {
+			s.stripSourceSpace(child)
+		}
+		children = append(children, child)
+	}
+	n.Children = children
+}
+
+func (p *xsltProcessor) env(instruction *xmlNode, ctx *xsltContext) *xpathEnv {
+	return &xpathEnv{
+		variable:  ctx.scope.lookup,
+		namespace: instruction.lookupNamespace,
+		current:   ctx.node,
+	}
+}
+
+// eval evaluates the expression of an attribute of an instruction
+func (p *xsltProcessor) eval(instruction *xmlNode, attr string, ctx *xsltContext) (interface{}, error) {
+	return p.evalExpr(instruction, mustAttrValue(instruction, attr), ctx)
+}
+
+// evalExpr evaluates an expression compiled with the stylesheet
+func (p *xsltProcessor) evalExpr(instruction *xmlNode, expr string, ctx *xsltContext) (interface{}, error) {
+	return p.stylesheet.exprs[expr].eval(&xpathContext{
+		node:     ctx.node,
+		position: ctx.position,
+		size:     ctx.size,
+		env:      p.env(instruction, ctx),
+	})
+}
+
+// evalAVT evaluates an attribute value template
+func (p *xsltProcessor) evalAVT(instruction *xmlNode, value string, ctx *xsltContext) (string, error) {
+	var result strings.Builder
+	for _, part := range p.stylesheet.avts[value] {
+		if part.expr == nil {
+			result.WriteString(part.literal)
+			continue
+		}
+		v, err := part.expr.eval(&xpathContext{
+			node:     ctx.node,
+			position: ctx.position,
+			size:     ctx.size,
+			env:      p.env(instruction, ctx),
+		})
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(xpathStringValue(v))
+	}
+	return result.String(), nil
+}
+
+// matches returns whether a template matches a node: a node matches a
+// pattern if it is selected by the pattern from one of its ancestors
+func (p *xsltProcessor) matches(template *xsltTemplate, node *xmlNode, ctx *xsltContext) (bool, error) {
+	env := p.env(template.node, ctx)
+	if template.match.absolute {
+		key := xsltPatternMatch{template, node.root()}
+		matched, ok := p.absoluteMatches[key]
+		if !ok {
+			nodes, err := evalXPathNodeSet(template.match, node.root(), env)
+			if err != nil {
+				return false, err
+			}
+			matched = make(map[*xmlNode]bool, len(nodes))
+			for _, n := range nodes {
+				matched[n] = true
+			}
+			p.absoluteMatches[key] = matched
+		}
+		return matched[node], nil
+	}
+
+	for context := node.Parent; context != nil; context = context.Parent {
+		nodes, err := evalXPathNodeSet(template.match, context, env)
+		if err != nil {
+			return false, err
+		}
+		for _, n := range nodes {
+			if n == node {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// findTemplate returns the template of the highest priority matching the
+// node, the last one in the stylesheet winning the conflicts
+func (p *xsltProcessor) findTemplate(node *xmlNode, ctx *xsltContext) (*xsltTemplate, error) {
+	var best *xsltTemplate
+	for _, template := range p.stylesheet.templates {
+		if template.mode != ctx.mode {
+			continue
+		}
+		if best != nil && template.priority < best.priority {
+			continue
+		}
+		ok, err := p.matches(template, node, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			best = template
+		}
+	}
+	return best, nil
+}
+
+// evalParams evaluates the xsl:with-param children of an instruction
+func (p *xsltProcessor) evalParams(instruction *xmlNode, ctx *xsltContext) (map[string]interface{}, error) {
+	params := map[string]interface{}{}
+	for _, child := range instruction.Children {
+		if child.Type != xmlElementNode || child.Space != xsltNamespace || child.Local != "with-param" {
+			continue
+		}
+		name, _ := child.attrValue("name")
+		value, err := p.evalVariable(child, ctx)
+		if err != nil {
+			return nil, err
+		}
+		params[name] = value
+	}
+	return params, nil
+}
+
+func (p *xsltProcessor) applyTemplates(ctx *xsltContext, nodes xpathNodeSet, params map[string]interface{}, out *xmlNode) error {
+	for i, node := range nodes {
+		nodeCtx := ctx.with(node, i+1, len(nodes))
+		template, err := p.findTemplate(node, nodeCtx)
+		if err != nil {
+			return err
+		}
+		if template != nil {
+			if err := p.instantiate(template.node, nodeCtx, params, out); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// built-in template rules
+		switch node.Type {
+		case xmlDocumentNode, xmlElementNode:
+			if err := p.applyTemplates(nodeCtx, node.Children, nil, out); err != nil {
+				return err
+			}
+		case xmlTextNode, xmlAttributeNode:
+			appendResultText(out, node.Data)
+		}
+	}
+	return nil
+}
+
+// instantiate executes a template, binding its parameters
+func (p *xsltProcessor) instantiate(template *xmlNode, ctx *xsltContext, params map[string]interface{}, out *xmlNode) error {
+	if ctx.depth >= xsltMaxDepth {
+		return fmt.Errorf("templates are nested too deeply, the stylesheet probably recurses infinitely")
+	}
+	c := *ctx
+	c.depth++
+	ctx = &c
+
+	body := template.Children
+	for len(body) > 0 {
+		param := body[0]
+		if param.Type != xmlElementNode || param.Space != xsltNamespace || param.Local != "param" {
+			break
+		}
+		name, _ := param.attrValue("name")
+		value, ok := params[name]
+		if !ok {
+			var err error
+			if value, err = p.evalVariable(param, ctx); err != nil {
+				return err
+			}
+		}
+		ctx.scope = &xsltScope{name: name, value: value, parent: ctx.scope}
+		body = body[1:]
+	}
+	return p.executeSequence(body, ctx, out)
+}
+
+// evalVariable returns the value of a variable or a parameter: its select
+// expression, or the result tree fragment of its content
+func (p *xsltProcessor) evalVariable(n *xmlNode, ctx *xsltContext) (interface{}, error) {
+	if _, ok := n.attrValue("select"); ok {
+		return p.eval(n, "select", ctx)
+	}
+	if len(n.Children) == 0 {
+		return "", nil
+	}
+	fragment := &xmlNode{Type: xmlDocumentNode}
+	if err := p.executeSequence(n.Children, ctx, fragment); err != nil {
+		return nil, err
+	}
+	fragment.renumber()
+	return xpathNodeSet{fragment}, nil
+}
+
+func (p *xsltProcessor) executeSequence(body []*xmlNode, ctx *xsltContext, out *xmlNode) error {
+	for _, n := range body {
+		// variables are visible from the following siblings
+		if n.Type == xmlElementNode && n.Space == xsltNamespace && n.Local == "variable" {
+			name, _ := n.attrValue("name")
+			value, err := p.evalVariable(n, ctx)
+			if err != nil {
+				return err
+			}
+			c := *ctx
+			c.scope = &xsltScope{name: name, value: value, parent: ctx.scope}
+			ctx = &c
+			continue
+		}
+		if err := p.execute(n, ctx, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortNodes sorts the nodes selected by an instruction according to its
+// xsl:sort children
+func (p *xsltProcessor) sortNodes(instruction *xmlNode, nodes xpathNodeSet, ctx *xsltContext) (xpathNodeSet, error) {
+	type sortKey struct {
+		values     []interface{}
+		descending bool
+		numeric    bool
+	}
+	var keys []*sortKey
+	for _, child := range instruction.Children {
+		if child.Type != xmlElementNode || child.Space != xsltNamespace || child.Local != "sort" {
+			continue
+		}
+		key := &sortKey{}
+		for _, attr := range []string{"order", "data-type"} {
+			value, ok := child.attrValue(attr)
+			if !ok {
+				continue
+			}
+			value, err := p.evalAVT(child, value, ctx)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case attr == "order" && value == "descending":
+				key.descending = true
+			case attr == "data-type" && value == "number":
+				key.numeric = true
+			}
+		}
+		selectExpr, ok := child.attrValue("select")
+		if !ok {
+			selectExpr = "."
+		}
+		for i, node := range nodes {
+			value, err := p.evalExpr(child, selectExpr, ctx.with(node, i+1, len(nodes)))
+			if err != nil {
+				return nil, err
+			}
+			if key.numeric {
+				key.values = append(key.values, xpathNumberValue(value))
+			} else {
+				key.values = append(key.values, xpathStringValue(value))
+			}
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nodes, nil
+	}
+
+	indexes := make([]int, len(nodes))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		i, j := indexes[a], indexes[b]
+		for _, key := range keys {
+			var less, greater bool
+			if key.numeric {
+				x, y := key.values[i].(float64), key.values[j].(float64)
+				// NaN sorts before the numbers
+				less = (math.IsNaN(x) && !math.IsNaN(y)) || x < y
+				greater = (math.IsNaN(y) && !math.IsNaN(x)) || x > y
+			} else {
+				x, y := key.values[i].(string), key.values[j].(string)
+				less, greater = x < y, x > y
+			}
+			if key.descending {
+				less, greater = greater, less
+			}
+			if less || greater {
+				return less
+			}
+		}
+		return false
+	})
+
+	sorted := make(xpathNodeSet, len(nodes))
+	for i, index := range indexes {
+		sorted[i] = nodes[index]
+	}
+	return sorted, nil
+}
+
+// execute executes an instruction or a literal result element
+func (p *xsltProcessor) execute(n *xmlNode, ctx *xsltContext, out *xmlNode) error {
+	switch n.Type {
+	case xmlTextNode:
+		appendResultText(out, n.Data)
+		return nil
+	case xmlElementNode:
+	default:
+		return nil
+	}
+
+	if n.Space != xsltNamespace {
+		element := &xmlNode{
+			Type:   xmlElementNode,
+			Prefix: n.Prefix,
+			Space:  n.Space,
+			Local:  n.Local,
+		}
+		for _, attr := range n.Attrs {
+			if attr.Space == xsltNamespace {
+				continue
+			}
+			value, err := p.evalAVT(n, attr.Data, ctx)
+			if err != nil {
+				return err
+			}
+			element.setAttr(attr.Prefix, attr.Space, attr.Local, value)
+		}
+		out.appendChild(element)
+		return p.executeSequence(n.Children, ctx, element)
+	}
+
+	switch n.Local {
+	case "apply-templates":
+		var nodes xpathNodeSet
+		if _, ok := n.attrValue("select"); ok {
+			value, err := p.eval(n, "select", ctx)
+			if err != nil {
+				return err
+			}
+			var isNodeSet bool
+			if nodes, isNodeSet = value.(xpathNodeSet); !isNodeSet {
+				return fmt.Errorf("the select expression of xsl:apply-templates has to return a node-set")
+			}
+		} else if ctx.node.Type != xmlAttributeNode {
+			nodes = ctx.node.Children
+		}
+		nodes, err := p.sortNodes(n, nodes, ctx)
+		if err != nil {
+			return err
+		}
+		params, err := p.evalParams(n, ctx)
+		if err != nil {
+			return err
+		}
+		c := *ctx
+		c.mode, _ = n.attrValue("mode")
+		return p.applyTemplates(&c, nodes, params, out)
+	case "call-template":
+		name, _ := n.attrValue("name")
+		template, ok := p.stylesheet.named[name]
+		if !ok {
+			return fmt.Errorf("there is no template named %q", name)
+		}
+		params, err := p.evalParams(n, ctx)
+		if err != nil {
+			return err
+		}
+		return p.instantiate(template.node, ctx, params, out)
+	case "for-each":
+		value, err := p.eval(n, "select", ctx)
+		if err != nil {
+			return err
+		}
+		nodes, ok := value.(xpathNodeSet)
+		if !ok {
+			return fmt.Errorf("the select expression of xsl:for-each has to return a node-set")
+		}
+		if nodes, err = p.sortNodes(n, nodes, ctx); err != nil {
+			return err
+		}
+		var body []*xmlNode
+		for _, child := range n.Children {
+			if child.Type != xmlElementNode || child.Space != xsltNamespace || child.Local != "sort" {
+				body = append(body, child)
+			}
+		}
+		for i, node := range nodes {
+			if err := p.executeSequence(body, ctx.with(node, i+1, len(nodes)), out); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "if":
+		value, err := p.eval(n, "test", ctx)
+		if err != nil {
+			return err
+		}
+		if xpathBooleanValue(value) {
+			return p.executeSequence(n.Children, ctx, out)
+		}
+		return nil
+	case "choose":
+		for _, child := range n.Children {
+			if child.Local == "otherwise" {
+				return p.executeSequence(child.Children, ctx, out)
+			}
+			value, err := p.eval(child, "test", ctx)
+			if err != nil {
+				return err
+			}
+			if xpathBooleanValue(value) {
+				return p.executeSequence(child.Children, ctx, out)
+			}
+		}
+		return nil
+	case "value-of":
+		value, err := p.eval(n, "select", ctx)
+		if err != nil {
+			return err
+		}
+		appendResultText(out, xpathStringValue(value))
+		return nil
+	case "copy-of":
+		value, err := p.eval(n, "select", ctx)
+		if err != nil {
+			return err
+		}
+		nodes, ok := value.(xpathNodeSet)
+		if !ok {
+			appendResultText(out, xpathStringValue(value))
+			return nil
+		}
+		for _, node := range nodes {
+			if err := copyResultNode(node, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "copy":
+		node := ctx.node
+		switch node.Type {
+		case xmlDocumentNode:
+			return p.executeSequence(n.Children, ctx, out)
+		case xmlElementNode:
+			element := &xmlNode{
+				Type:   xmlElementNode,
+				Prefix: node.Prefix,
+				Space:  node.Space,
+				Local:  node.Local,
+			}
+			element.Namespaces = append(element.Namespaces, node.Namespaces...)
+			out.appendChild(element)
+			return p.executeSequence(n.Children, ctx, element)
+		}
+		return copyResultNode(node, out)
+	case "element", "attribute":
+		qname, err := p.evalAVT(n, mustAttrValue(n, "name"), ctx)
+		if err != nil {
+			return err
+		}
+		prefix, local := "", qname
+		if i := strings.IndexByte(qname, ':'); i >= 0 {
+			prefix, local = qname[:i], qname[i+1:]
+		}
+		if local == "" || strings.ContainsAny(local, ": \t\n") {
+			return fmt.Errorf("invalid name %q in xsl:%s", qname, n.Local)
+		}
+
+		var space string
+		if namespace, ok := n.attrValue("namespace"); ok {
+			if space, err = p.evalAVT(n, namespace, ctx); err != nil {
+				return err
+			}
+			if space != "" && prefix == "" && n.Local == "attribute" {
+				// attributes in a namespace need a prefix
+				prefix = "ns"
+			}
+		} else if prefix != "" || n.Local == "element" {
+			// unprefixed attributes are in no namespace
+			var ok bool
+			if space, ok = n.lookupNamespace(prefix); !ok {
+				return fmt.Errorf("undeclared namespace prefix %q in xsl:%s", prefix, n.Local)
+			}
+		}
+
+		if n.Local == "element" {
+			element := &xmlNode{Type: xmlElementNode, Prefix: prefix, Space: space, Local: local}
+			out.appendChild(element)
+			return p.executeSequence(n.Children, ctx, element)
+		}
+		value, err := p.evalContent(n, ctx)
+		if err != nil {
+			return err
+		}
+		return addResultAttr(out, &xmlNode{Type: xmlAttributeNode, Prefix: prefix, Space: space, Local: local, Data: value})
+	case "text":
+		appendResultText(out, n.stringValue())
+		return nil
+	case "comment":
+		value, err := p.evalContent(n, ctx)
+		if err != nil {
+			return err
+		}
+		out.appendChild(&xmlNode{Type: xmlCommentNode, Data: value})
+		return nil
+	case "processing-instruction":
+		target, err := p.evalAVT(n, mustAttrValue(n, "name"), ctx)
+		if err != nil {
+			return err
+		}
+		value, err := p.evalContent(n, ctx)
+		if err != nil {
+			return err
+		}
+		out.appendChild(&xmlNode{Type: xmlProcInstNode, Local: target, Data: value})
+		return nil
+	case "message":
+		value, err := p.evalContent(n, ctx)
+		if err != nil {
+			return err
+		}
+		if terminate, _ := n.attrValue("terminate"); terminate == "yes" {
+			return fmt.Errorf("stylesheet terminated: %s", value)
+		}
+		log.Printf("[INFO] XSLT message: %s", value)
+		return nil
+	case "fallback":
+		// the instructions are all supported
+		return nil
+	}
+	return fmt.Errorf("unsupported XSLT instruction xsl:%s", n.Local)
+}
+
+// evalContent returns the string value of the content of an instruction
+func (p *xsltProcessor) evalContent(n *xmlNode, ctx *xsltContext) (string, error) {
+	fragment := &xmlNode{Type: xmlDocumentNode}
+	if err := p.executeSequence(n.Children, ctx, fragment); err != nil {
+		return "", err
+	}
+	return fragment.stringValue(), nil
+}
+
+func mustAttrValue(n *xmlNode, local string) string {
+	value, _ := n.attrValue(local)
+	return value
+}
+
+// appendResultText adds text to a result tree, merging adjacent text nodes
+func appendResultText(out *xmlNode, text string) {
+	if text == "" {
+		return
+	}
+	if n := len(out.Children); n > 0 && out.Children[n-1].Type == xmlTextNode {
+		out.Children[n-1].Data += text
+		return
+	}
+	out.appendChild(&xmlNode{Type: xmlTextNode, Data: text})
+}
+
+// addResultAttr adds an attribute to the element being created
+func addResultAttr(out *xmlNode, attr *xmlNode) error {
+	if out.Type != xmlElementNode {
+		return fmt.Errorf("attribute %s can only be added to an element", attr.name())
+	}
+	if len(out.Children) > 0 {
+		return fmt.Errorf("attribute %s can't be added after the children of element %s", attr.name(), out.name())
+	}
+	out.setAttr(attr.Prefix, attr.Space, attr.Local, attr.Data)
+	return nil
+}
+
+// copyResultNode adds a deep copy of a node to a result tree
+func copyResultNode(node *xmlNode, out *xmlNode) error {
+	switch node.Type {
+	case xmlDocumentNode:
+		for _, child := range node.Children {
+			if err := copyResultNode(child, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	case xmlAttributeNode:
+		return addResultAttr(out, node)
+	case xmlTextNode:
+		appendResultText(out, node.Data)
+		return nil
+	}
+
+	c := node.clone()
+	if node.Type == xmlElementNode {
+		// keep the namespaces the copy may depend on
+		c.Namespaces = node.inScopeNamespaces()
+	}
+	out.appendChild(c)
+	return nil
+}
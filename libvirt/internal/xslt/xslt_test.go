@@ -0,0 +1,161 @@
+package xslt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func transform(xml string, xslt string) (string, error) {
+	stylesheet, err := Parse(xslt)
+	if err != nil {
+		return "", err
+	}
+	return stylesheet.Transform(xml)
+}
+
+func TestTransformDomain(t *testing.T) {
+	// the example of examples/xslt, and the addition of QEMU arguments
+	const xslt = `
+<?xml version="1.0" ?>
+<xsl:stylesheet version="1.0"
+                xmlns:xsl="http://www.w3.org/1999/XSL/Transform"
+                xmlns:qemu="http://libvirt.org/schemas/domain/qemu/1.0">
+  <xsl:output omit-xml-declaration="yes" indent="yes"/>
+  <xsl:template match="node()|@*">
+     <xsl:copy>
+       <xsl:apply-templates select="node()|@*"/>
+     </xsl:copy>
+  </xsl:template>
+
+  <xsl:template match="/domain/devices/interface[@type='network']/model/@type">
+    <xsl:attribute name="type">
+      <xsl:value-of select="'e1000'"/>
+    </xsl:attribute>
+  </xsl:template>
+
+  <xsl:template match="/domain">
+    <xsl:copy>
+      <xsl:apply-templates select="@*|node()"/>
+      <qemu:commandline>
+        <xsl:for-each select="devices/disk">
+          <xsl:sort select="target/@dev" order="descending"/>
+          <qemu:arg value="{target/@dev}"/>
+        </xsl:for-each>
+      </qemu:commandline>
+    </xsl:copy>
+  </xsl:template>
+</xsl:stylesheet>
+`
+	const inXML = `<domain type="kvm"><devices>` +
+		`<disk><target dev="vda"/></disk><disk><target dev="vdb"/></disk>` +
+		`<interface type="network"><model type="virtio"/></interface>` +
+		`</devices></domain>`
+	const outXML = `<domain type="kvm"><devices>` +
+		`<disk><target dev="vda"/></disk><disk><target dev="vdb"/></disk>` +
+		`<interface type="network"><model type="e1000"/></interface>` +
+		`</devices><qemu:commandline xmlns:qemu="http://libvirt.org/schemas/domain/qemu/1.0">` +
+		`<qemu:arg value="vdb"/><qemu:arg value="vda"/></qemu:commandline></domain>` + "\n"
+
+	result, err := transform(inXML, xslt)
+	assert.Nil(t, err)
+	assert.Equal(t, outXML, result)
+}
+
+func TestTransformInstructions(t *testing.T) {
+	const xslt = `
+<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+  <xsl:output omit-xml-declaration="yes"/>
+  <xsl:variable name="prefix" select="'net-'"/>
+  <xsl:template match="/">
+    <networks count="{count(//network)}">
+      <xsl:apply-templates select="//network" mode="list">
+        <xsl:with-param name="suffix">!</xsl:with-param>
+      </xsl:apply-templates>
+    </networks>
+  </xsl:template>
+  <xsl:template match="network" mode="list">
+    <xsl:param name="suffix"/>
+    <xsl:variable name="name" select="concat($prefix, @name)"/>
+    <xsl:element name="{@type}">
+      <xsl:if test="position() = 1">
+        <xsl:attribute name="first">yes</xsl:attribute>
+      </xsl:if>
+      <xsl:choose>
+        <xsl:when test="@type = 'nat'"><xsl:value-of select="$name"/></xsl:when>
+        <xsl:otherwise><xsl:call-template name="upper"><xsl:with-param name="s" select="$name"/></xsl:call-template></xsl:otherwise>
+      </xsl:choose>
+      <xsl:value-of select="$suffix"/>
+      <xsl:comment>copied</xsl:comment>
+      <xsl:copy-of select="ip"/>
+    </xsl:element>
+  </xsl:template>
+  <xsl:template name="upper">
+    <xsl:param name="s"/>
+    <xsl:value-of select="translate($s, 'abcdefghijklmnopqrstuvwxyz', 'ABCDEFGHIJKLMNOPQRSTUVWXYZ')"/>
+  </xsl:template>
+</xsl:stylesheet>
+`
+	const inXML = `<networks><network name="a" type="nat"><ip address="10.0.0.1"/></network><network name="b" type="route"/></networks>`
+	const outXML = `<networks count="2"><nat first="yes">net-a!<!--copied--><ip address="10.0.0.1"/></nat><route>NET-B!<!--copied--></route></networks>` + "\n"
+
+	result, err := transform(inXML, xslt)
+	assert.Nil(t, err)
+	assert.Equal(t, outXML, result)
+}
+
+func TestTransformText(t *testing.T) {
+	const xslt = `
+<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+  <xsl:output method="text"/>
+  <xsl:template match="/">
+    <xsl:for-each select="//book"><xsl:value-of select="@price * 3"/>;</xsl:for-each>
+  </xsl:template>
+</xsl:stylesheet>
+`
+	result, err := transform(`<books><book price="0.1"/><book price="2"/></books>`, xslt)
+	assert.Nil(t, err)
+	assert.Equal(t, "0.3;6;", result)
+}
+
+func TestTransformErrors(t *testing.T) {
+	const inXML = "<books><book format=\"paper\"/></books>"
+	for _, xslt := range []string{
+		// not XML
+		`<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">`,
+		// not a stylesheet
+		`<books/>`,
+		// not XSLT 1.0
+		`<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform"><xsl:template match="/"><xsl:foo/></xsl:template></xsl:stylesheet>`,
+		// invalid expression
+		`<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform"><xsl:template match="book[">x</xsl:template></xsl:stylesheet>`,
+	} {
+		_, err := Parse(xslt)
+		assert.NotNil(t, err, xslt)
+	}
+
+	for _, xslt := range []string{
+		// infinite recursion
+		`<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform"><xsl:template match="/"><xsl:apply-templates select="."/></xsl:template></xsl:stylesheet>`,
+		// explicit termination
+		`<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform"><xsl:template match="/"><xsl:message terminate="yes">no</xsl:message></xsl:template></xsl:stylesheet>`,
+	} {
+		_, err := transform(inXML, xslt)
+		assert.NotNil(t, err, xslt)
+	}
+}
+
+func TestTransformUnsupported(t *testing.T) {
+	for xslt, unsupported := range map[string][]string{
+		`<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform"><xsl:import href="other.xsl"/><xsl:key name="k" match="book" use="@id"/></xsl:stylesheet>`: {"xsl:import", "xsl:key"},
+		`<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform"><xsl:template match="/"><xsl:number/></xsl:template></xsl:stylesheet>`:                     {"xsl:number"},
+		`<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform"><xsl:output method="html"/></xsl:stylesheet>`:                                              {`output method "html"`},
+	} {
+		// the stylesheets are valid, but can't be applied
+		stylesheet, err := Parse(xslt)
+		assert.Nil(t, err, xslt)
+		assert.Equal(t, unsupported, stylesheet.Unsupported())
+		_, err = stylesheet.Transform("<books/>")
+		assert.NotNil(t, err, xslt)
+	}
+}
@@ -1,10 +1,13 @@
 package libvirt
 
 import (
+	"bytes"
+	"encoding/xml"
 	"fmt"
 	"log"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/helper/schema"
@@ -53,7 +56,7 @@ func getIPsFromResource(d *schema.ResourceData) ([]libvirtxml.NetworkIP, error)
 	// check if DHCP must be enabled by default
 	var dhcpEnabled bool
 	netMode := getNetModeFromResource(d)
-	if netMode == netModeIsolated || netMode == netModeNat || netMode == netModeRoute {
+	if netMode == netModeIsolated || netMode == netModeNat || netMode == netModeRoute || netMode == netModeOpen {
 		dhcpEnabled = true
 	}
 
@@ -71,7 +74,15 @@ func getIPsFromResource(d *schema.ResourceData) ([]libvirtxml.NetworkIP, error)
 			dhcpEnabled = dhcpEnabledByUser.(bool)
 		}
 
-		if dhcpEnabled {
+		// the settings of the address family take precedence
+		enabled := dhcpEnabled
+		if ok, familyEnabled, err := getDHCPFromFamilyResource(d, addressI.(string), dni.Family, dhcp); err != nil {
+			return nil, err
+		} else if ok {
+			enabled = familyEnabled
+		}
+
+		if enabled {
 			dni.DHCP = dhcp
 		} else {
 			// if a network exist with enabled but an user want to disable it
@@ -85,6 +96,117 @@ func getIPsFromResource(d *schema.ResourceData) ([]libvirtxml.NetworkIP, error)
 	return ipsPtrsLst, nil
 }
 
+// modes of the router advertisements of IPv6 networks
+const (
+	// DHCPv6 assigns the addresses in the DHCP range
+	raModeStateful = "stateful"
+	// the hosts configure their addresses themselves, without DHCPv6
+	raModeSLAAC = "slaac"
+)
+
+func validateNetworkRAMode(v interface{}, k string) ([]string, []error) {
+	switch v.(string) {
+	case raModeStateful, raModeSLAAC:
+		return nil, nil
+	}
+	return nil, []error{fmt.Errorf("%q: must be '%s' or '%s', got '%s'", k, raModeStateful, raModeSLAAC, v)}
+}
+
+// getNetworkIPFamily returns the family of an address of a network: libvirt
+// omits it for IPv4
+func getNetworkIPFamily(address libvirtxml.NetworkIP) string {
+	if address.Family == "" {
+		return "ipv4"
+	}
+	return address.Family
+}
+
+// getDHCPFromFamilyResource applies the settings of the "ipv4" or "ipv6"
+// block to the DHCP configuration of an address. It returns whether there
+// are settings for the family and if DHCP must be enabled.
+func getDHCPFromFamilyResource(d *schema.ResourceData, address string, family string, dhcp *libvirtxml.NetworkDHCP) (bool, bool, error) {
+	if d.Get(family+".#").(int) == 0 {
+		return false, false, nil
+	}
+	prefix := family + ".0"
+
+	var enabled bool
+	if family == "ipv6" {
+		enabled = d.Get(prefix+".ra_mode").(string) == raModeStateful
+	} else {
+		enabled = d.Get(prefix + ".dhcp_enabled").(bool)
+	}
+
+	start := d.Get(prefix + ".dhcp_start").(string)
+	end := d.Get(prefix + ".dhcp_end").(string)
+	if start != "" || end != "" {
+		if err := checkDHCPRange(address, start, end); err != nil {
+			return false, false, fmt.Errorf("Invalid DHCP range in '%s': %s", family, err)
+		}
+		dhcp.Ranges = []libvirtxml.NetworkDHCPRange{
+			{
+				Start: net.ParseIP(start).String(),
+				End:   net.ParseIP(end).String(),
+			},
+		}
+	}
+
+	return true, enabled, nil
+}
+
+// flattenNetworkIPFamily returns the "ipv4" or "ipv6" block of an address.
+// The DHCP range is only reported when the block declares one, as libvirt
+// gets a default one otherwise.
+func flattenNetworkIPFamily(d *schema.ResourceData, family string, address libvirtxml.NetworkIP) []map[string]interface{} {
+	var dhcpRange *libvirtxml.NetworkDHCPRange
+	if address.DHCP != nil && len(address.DHCP.Ranges) > 0 {
+		dhcpRange = &address.DHCP.Ranges[0]
+	}
+
+	block := map[string]interface{}{
+		"dhcp_start": "",
+		"dhcp_end":   "",
+	}
+	if family == "ipv6" {
+		block["ra_mode"] = raModeSLAAC
+		if dhcpRange != nil {
+			block["ra_mode"] = raModeStateful
+		}
+	} else {
+		block["dhcp_enabled"] = dhcpRange != nil
+	}
+	if dhcpRange != nil && d.Get(family+".0.dhcp_start").(string) != "" {
+		block["dhcp_start"] = dhcpRange.Start
+		block["dhcp_end"] = dhcpRange.End
+	}
+	return []map[string]interface{}{block}
+}
+
+// checkDHCPRange checks a DHCP range is inside of the network of an address
+func checkDHCPRange(address string, start string, end string) error {
+	if start == "" || end == "" {
+		return fmt.Errorf("both the start and the end of the range must be given")
+	}
+	_, ipNet, err := net.ParseCIDR(address)
+	if err != nil {
+		return fmt.Errorf("Error parsing addresses definition '%s': %s", address, err)
+	}
+
+	startIP, endIP := net.ParseIP(start), net.ParseIP(end)
+	for _, ip := range []net.IP{startIP, endIP} {
+		if ip == nil {
+			return fmt.Errorf("could not parse the range %s-%s", start, end)
+		}
+		if !ipNet.Contains(ip) {
+			return fmt.Errorf("%s is not in %s", ip, address)
+		}
+	}
+	if bytes.Compare(startIP.To16(), endIP.To16()) > 0 {
+		return fmt.Errorf("the start of the range %s-%s is after its end", start, end)
+	}
+	return nil
+}
+
 func getNetworkIPConfig(address string) (*libvirtxml.NetworkIP, *libvirtxml.NetworkDHCP, error) {
 	_, ipNet, err := net.ParseCIDR(address)
 	if err != nil {
@@ -146,6 +268,153 @@ func getBridgeFromResource(d *schema.ResourceData) *libvirtxml.NetworkBridge {
 	return bridge
 }
 
+// checkNetworkForwardResource checks the settings of the forward block
+// can be used with the given network mode
+func checkNetworkForwardResource(d *schema.ResourceData, mode string) error {
+	if mode == netModeIsolated && d.Get("forward.#").(int) > 0 {
+		return fmt.Errorf("'forward' can't be used in the %s network mode", mode)
+	}
+	if d.Get("forward.0.nat.#").(int) > 0 && mode != netModeNat {
+		return fmt.Errorf("'forward.nat' can only be used in the %s network mode", netModeNat)
+	}
+	if len(d.Get("forward.0.interfaces").([]interface{})) > 0 {
+		switch mode {
+		case netModeBridge, netModePrivate, netModeVEPA, netModePassthrough:
+		default:
+			return fmt.Errorf("'forward.interfaces' can't be used in the %s network mode", mode)
+		}
+	}
+	if d.Get("forward.0.pf").(string) != "" && mode != netModeHostdev {
+		return fmt.Errorf("'forward.pf' can only be used in the %s network mode", netModeHostdev)
+	}
+	if d.Get("forward.0.dev").(string) != "" && (mode == netModeBridge || mode == netModeHostdev) {
+		return fmt.Errorf("'forward.dev' can't be used in the %s network mode", mode)
+	}
+	if len(d.Get("addresses").([]interface{})) > 0 {
+		switch mode {
+		case netModeBridge, netModePrivate, netModeVEPA, netModePassthrough, netModeHostdev:
+			return fmt.Errorf("'addresses' can't be used in the %s network mode", mode)
+		}
+	}
+	return nil
+}
+
+// getForwardInterfacesFromResource returns the pool of host interfaces
+// the network forwards to
+func getForwardInterfacesFromResource(d *schema.ResourceData) []libvirtxml.NetworkForwardInterface {
+	var interfaces []libvirtxml.NetworkForwardInterface
+	for _, dev := range d.Get("forward.0.interfaces").([]interface{}) {
+		interfaces = append(interfaces, libvirtxml.NetworkForwardInterface{Dev: dev.(string)})
+	}
+	return interfaces
+}
+
+// getNATFromResource returns the address and port ranges used for NAT,
+// or nil when the defaults must be used
+func getNATFromResource(d *schema.ResourceData) (*libvirtxml.NetworkForwardNAT, error) {
+	if d.Get("forward.0.nat.#").(int) == 0 {
+		return nil, nil
+	}
+	natPrefix := "forward.0.nat.0"
+	nat := &libvirtxml.NetworkForwardNAT{}
+
+	start := d.Get(natPrefix + ".address_start").(string)
+	end := d.Get(natPrefix + ".address_end").(string)
+	if start != "" || end != "" {
+		startIP, endIP := net.ParseIP(start).To4(), net.ParseIP(end).To4()
+		if startIP == nil || endIP == nil {
+			return nil, fmt.Errorf("NAT address range '%s'-'%s' must be given by two IPv4 addresses", start, end)
+		}
+		if bytes.Compare(startIP, endIP) > 0 {
+			return nil, fmt.Errorf("NAT address range start '%s' is after its end '%s'", start, end)
+		}
+		nat.Addresses = []libvirtxml.NetworkForwardNATAddress{{Start: startIP.String(), End: endIP.String()}}
+	}
+
+	portStart := d.Get(natPrefix + ".port_start").(int)
+	portEnd := d.Get(natPrefix + ".port_end").(int)
+	if portStart < 1 || portEnd > 65535 || portStart > portEnd {
+		return nil, fmt.Errorf("Invalid NAT port range %d-%d", portStart, portEnd)
+	}
+	nat.Ports = []libvirtxml.NetworkForwardNATPort{{Start: uint(portStart), End: uint(portEnd)}}
+
+	return nat, nil
+}
+
+// networkForwardIsDefault returns true when the forward element of the network
+// definition only holds what libvirt sets up by itself for the mode
+func networkForwardIsDefault(forward *libvirtxml.NetworkForward) bool {
+	if forward.Dev != "" || len(forward.Interfaces) > 0 || len(forward.PFs) > 0 {
+		return false
+	}
+	return networkForwardNATIsDefault(forward.NAT)
+}
+
+// networkForwardNATIsDefault returns true when the NAT element of the network
+// definition is missing or only holds the default port range
+func networkForwardNATIsDefault(nat *libvirtxml.NetworkForwardNAT) bool {
+	if nat == nil {
+		return true
+	}
+	if len(nat.Addresses) > 0 || len(nat.Ports) > 1 {
+		return false
+	}
+	return len(nat.Ports) == 0 || (nat.Ports[0].Start == 1024 && nat.Ports[0].End == 65535)
+}
+
+// flattenNetworkForward returns the forward block of the resource
+// from the forward element of the network definition
+func flattenNetworkForward(d *schema.ResourceData, forward *libvirtxml.NetworkForward) []map[string]interface{} {
+	interfaces := []string{}
+	for _, iface := range forward.Interfaces {
+		interfaces = append(interfaces, iface.Dev)
+	}
+	// libvirt lists the interface given in 'dev' when no pool is given
+	if len(interfaces) == 1 && interfaces[0] == forward.Dev && len(d.Get("forward.0.interfaces").([]interface{})) == 0 {
+		interfaces = []string{}
+	}
+
+	pf := ""
+	if len(forward.PFs) > 0 {
+		pf = forward.PFs[0].Dev
+	}
+
+	// libvirt only keeps the managed attribute for hostdev networks
+	managed := true
+	if forward.Mode == netModeHostdev {
+		managed = forward.Managed == "yes"
+	}
+
+	nat := []map[string]interface{}{}
+	if forward.NAT != nil && (d.Get("forward.0.nat.#").(int) > 0 || !networkForwardNATIsDefault(forward.NAT)) {
+		natRange := map[string]interface{}{
+			"address_start": "",
+			"address_end":   "",
+			"port_start":    1024,
+			"port_end":      65535,
+		}
+		if len(forward.NAT.Addresses) > 0 {
+			natRange["address_start"] = forward.NAT.Addresses[0].Start
+			natRange["address_end"] = forward.NAT.Addresses[0].End
+		}
+		if len(forward.NAT.Ports) > 0 {
+			natRange["port_start"] = int(forward.NAT.Ports[0].Start)
+			natRange["port_end"] = int(forward.NAT.Ports[0].End)
+		}
+		nat = append(nat, natRange)
+	}
+
+	return []map[string]interface{}{
+		{
+			"dev":        forward.Dev,
+			"interfaces": interfaces,
+			"pf":         pf,
+			"managed":    managed,
+			"nat":        nat,
+		},
+	}
+}
+
 // getDomainFromResource returns a libvirt's NetworkDomain
 // from the ResourceData provided.
 func getDomainFromResource(d *schema.ResourceData) *libvirtxml.NetworkDomain {
@@ -174,3 +443,411 @@ func getMTUFromResource(d *schema.ResourceData) *libvirtxml.NetworkMTU {
 
 	return nil
 }
+
+// newNetworkDefFromResource returns the libvirt network definition for the
+// resource
+func newNetworkDefFromResource(d *schema.ResourceData) (libvirtxml.Network, error) {
+	networkDef := newNetworkDef()
+	networkDef.Name = d.Get("name").(string)
+	networkDef.Domain = getDomainFromResource(d)
+
+	// use a bridge provided by the user, or create one otherwise (libvirt will assign on automatically when empty)
+	networkDef.Bridge = getBridgeFromResource(d)
+
+	networkDef.MTU = getMTUFromResource(d)
+	networkDef.Bandwidth = getNetworkBandwidthFromResource(d)
+
+	// check the network mode
+	networkDef.Forward = &libvirtxml.NetworkForward{
+		Mode: getNetModeFromResource(d),
+	}
+	if err := checkNetworkForwardResource(d, networkDef.Forward.Mode); err != nil {
+		return networkDef, err
+	}
+	switch networkDef.Forward.Mode {
+	case netModeIsolated, netModeNat, netModeRoute, netModeOpen:
+		if networkDef.Forward.Mode == netModeIsolated {
+			// there is no forwarding when using an isolated network
+			networkDef.Forward = nil
+		} else {
+			networkDef.Forward.Dev = d.Get("forward.0.dev").(string)
+			if networkDef.Forward.Mode == netModeNat {
+				nat, err := getNATFromResource(d)
+				if err != nil {
+					return networkDef, err
+				}
+				if nat != nil {
+					networkDef.Forward.NAT = nat
+				}
+			} else {
+				// there is no NAT when using a routed or open network
+				networkDef.Forward.NAT = nil
+			}
+		}
+
+		// if addresses are given set dhcp for these
+		ips, err := getIPsFromResource(d)
+		if err != nil {
+			return networkDef, fmt.Errorf("Could not set DHCP from adresses '%s'", err)
+		}
+		networkDef.IPs = ips
+
+		dnsEnabled, err := getDNSEnableFromResource(d)
+		if err != nil {
+			return networkDef, err
+		}
+
+		dnsForwarders, err := getDNSForwardersFromResource(d)
+		if err != nil {
+			return networkDef, err
+		}
+
+		dnsSRVs, err := getDNSSRVFromResource(d)
+		if err != nil {
+			return networkDef, err
+		}
+
+		dnsHosts, err := getDNSHostsFromResource(d)
+		if err != nil {
+			return networkDef, err
+		}
+
+		dns := libvirtxml.NetworkDNS{
+			Enable:     dnsEnabled,
+			Forwarders: dnsForwarders,
+			Host:       dnsHosts,
+			SRVs:       dnsSRVs,
+		}
+		networkDef.DNS = &dns
+
+	case netModeBridge:
+		interfaces := getForwardInterfacesFromResource(d)
+		if len(interfaces) > 0 {
+			// a pool of host interfaces connected with macvtap in bridge mode
+			if networkDef.Bridge.Name != "" {
+				return networkDef, fmt.Errorf("'bridge' and 'forward.interfaces' can't be used together in the bridged network mode")
+			}
+			networkDef.Forward.NAT = nil
+			networkDef.Forward.Interfaces = interfaces
+			networkDef.Bridge = nil
+			break
+		}
+		if networkDef.Bridge.Name == "" {
+			return networkDef, fmt.Errorf("'bridge' or 'forward.interfaces' must be provided when using the bridged network mode")
+		}
+		// Bridges cannot forward
+		networkDef.Forward = nil
+
+	case netModePrivate, netModeVEPA, netModePassthrough:
+		interfaces := getForwardInterfacesFromResource(d)
+		if len(interfaces) == 0 && d.Get("forward.0.dev").(string) == "" {
+			return networkDef, fmt.Errorf("'forward.interfaces' must be provided when using the %s network mode", networkDef.Forward.Mode)
+		}
+		// the guests are connected directly to the host interfaces with macvtap
+		networkDef.Forward.NAT = nil
+		networkDef.Forward.Dev = d.Get("forward.0.dev").(string)
+		networkDef.Forward.Interfaces = interfaces
+		networkDef.Bridge = nil
+
+	case netModeHostdev:
+		pf := d.Get("forward.0.pf").(string)
+		if pf == "" {
+			return networkDef, fmt.Errorf("'forward.pf' must be provided when using the hostdev network mode")
+		}
+		// the guests get one of the virtual functions of the SR-IOV device
+		networkDef.Forward.NAT = nil
+		networkDef.Forward.PFs = []libvirtxml.NetworkForwardPF{{Dev: pf}}
+		networkDef.Forward.Managed = "no"
+		if d.Get("forward.0.managed").(bool) {
+			networkDef.Forward.Managed = "yes"
+		}
+		networkDef.Bridge = nil
+
+	default:
+		return networkDef, fmt.Errorf("unsupported network mode '%s'", networkDef.Forward.Mode)
+	}
+
+	// parse any static routes
+	routes, err := getRoutesFromResource(d)
+	if err != nil {
+		return networkDef, err
+	}
+	networkDef.Routes = routes
+
+	return networkDef, nil
+}
+
+// attributes of a network that libvirt can't change in a running network:
+// changing any of them means redefining and restarting the network
+var networkRestartKeys = []string{
+	"addresses",
+	"bandwidth",
+	"forward",
+	"mtu",
+	"routes",
+	dnsPrefix + ".enabled",
+	dnsPrefix + ".forwarders",
+}
+
+// resourceChanges is implemented by schema.ResourceData and
+// resourceDiffChanges, so the same checks run when applying and planning
+type resourceChanges interface {
+	HasChange(key string) bool
+}
+
+// resourceDiffChanges looks for the changes in the attributes of a plan:
+// schema.ResourceDiff.HasChange takes the defaults of the arguments of a
+// block missing from the configuration as changes
+type resourceDiffChanges struct {
+	diff *schema.ResourceDiff
+}
+
+func (c resourceDiffChanges) HasChange(key string) bool {
+	for _, k := range c.diff.GetChangedKeysPrefix(key) {
+		if k == key || strings.HasPrefix(k, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// networkUpdateRequiresRestart returns whether the changes in a network can
+// only be applied redefining and restarting it
+func networkUpdateRequiresRestart(d resourceChanges) bool {
+	for _, key := range networkRestartKeys {
+		if d.HasChange(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderNetworkXML returns the XML definition of the network of the resource,
+// as transformed by its xml block
+func renderNetworkXML(d *schema.ResourceData) (string, error) {
+	networkDef, err := newNetworkDefFromResource(d)
+	if err != nil {
+		return "", err
+	}
+	networkDef.UUID = d.Id()
+
+	data, err := xmlMarshallIndented(networkDef)
+	if err != nil {
+		return "", fmt.Errorf("Error serializing libvirt network: %s", err)
+	}
+	log.Printf("[DEBUG] Generated XML for libvirt network:\n%s", data)
+
+	data, err = transformResourceXML(data, d)
+	if err != nil {
+		return "", fmt.Errorf("Error transforming the XML definition: %s", err)
+	}
+	return data, nil
+}
+
+// redefineAndRestartNetwork replaces the definition of a network with the
+// one of the resource and restarts it when it is active. The static DHCP hosts added to the
+// network by the domains using it are kept.
+func redefineAndRestartNetwork(d *schema.ResourceData, virConn *libvirt.Connect, network *libvirt.Network) error {
+	networkName := d.Get("name").(string)
+
+	currentDef, err := getXMLNetworkDefFromLibvirt(network)
+	if err != nil {
+		return err
+	}
+	currentHosts, err := getNetworkIPDHCPHosts(network)
+	if err != nil {
+		return err
+	}
+
+	data, err := renderNetworkXML(d)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] Redefining libvirt network %s: %s", networkName, data)
+	redefined, err := virConn.NetworkDefineXML(data)
+	if err != nil {
+		return fmt.Errorf("Error redefining libvirt network: %s - %s", err, data)
+	}
+	defer redefined.Free()
+	d.Set("rendered_xml", data)
+
+	// the hosts are added to the new definition as they are, as libvirtxml
+	// doesn't support all their settings (eg, the lease time)
+	redefinedXMLDesc, err := redefined.GetXMLDesc(libvirt.NETWORK_XML_INACTIVE)
+	if err != nil {
+		return fmt.Errorf("Error retrieving libvirt network XML description: %s", err)
+	}
+	var redefinedDef libvirtxml.Network
+	if err := xml.Unmarshal([]byte(redefinedXMLDesc), &redefinedDef); err != nil {
+		return fmt.Errorf("Error reading libvirt network XML description: %s", err)
+	}
+	hosts, err := assignNetworkDHCPHosts(currentDef, currentHosts, redefinedDef)
+	if err != nil {
+		return err
+	}
+	for i := range hosts {
+		for _, host := range hosts[i] {
+			hostData, err := xmlMarshallIndented(host)
+			if err != nil {
+				return fmt.Errorf("Error serializing DHCP host: %s", err)
+			}
+			if err := redefined.Update(libvirt.NETWORK_UPDATE_COMMAND_ADD_LAST, libvirt.NETWORK_SECTION_IP_DHCP_HOST,
+				i, hostData, libvirt.NETWORK_UPDATE_AFFECT_CONFIG); err != nil {
+				return fmt.Errorf("Error keeping DHCP host %s in network %s: %s", hostData, networkName, err)
+			}
+		}
+	}
+
+	// an inactive network picks up the new definition when it is started
+	active, err := network.IsActive()
+	if err != nil {
+		return fmt.Errorf("Couldn't determine if network is active: %s", err)
+	}
+	if !active {
+		return nil
+	}
+
+	log.Printf("[INFO] Restarting network %s to apply the changes", networkName)
+	if err := network.Destroy(); err != nil {
+		return fmt.Errorf("Error stopping network %s: %s", networkName, err)
+	}
+	if err := network.Create(); err != nil {
+		return fmt.Errorf("Error starting network %s: %s", networkName, err)
+	}
+
+	stateConf := &resource.StateChangeConf{
+		Pending:    []string{"BUILD"},
+		Target:     []string{"ACTIVE"},
+		Refresh:    waitForNetworkActive(*network),
+		Timeout:    1 * time.Minute,
+		Delay:      5 * time.Second,
+		MinTimeout: 3 * time.Second,
+	}
+	if _, err := stateConf.WaitForState(); err != nil {
+		return fmt.Errorf("Error waiting for network to reach ACTIVE state: %s", err)
+	}
+	return nil
+}
+
+// assignNetworkDHCPHosts returns the static DHCP hosts of the addresses of a
+// network definition (`fromHosts`, in the order of `from.IPs`) for the
+// addresses of another one, in the order of `to.IPs`. Hosts with an IP go to
+// the address serving it, and the ones without (eg, IPv6 hosts given by id)
+// to the first address with DHCP of the same family.
+func assignNetworkDHCPHosts(from libvirtxml.Network, fromHosts [][]networkDHCPHost, to libvirtxml.Network) ([][]networkDHCPHost, error) {
+	toNets := make([]*net.IPNet, len(to.IPs))
+	for i, toIP := range to.IPs {
+		cidr, err := getNetworkIPCIDR(toIP)
+		if err != nil {
+			return nil, err
+		}
+		if _, toNets[i], err = net.ParseCIDR(cidr); err != nil {
+			return nil, err
+		}
+	}
+
+	hosts := make([][]networkDHCPHost, len(to.IPs))
+	for i := range fromHosts {
+		if i >= len(from.IPs) {
+			break
+		}
+		fromIPv4 := net.ParseIP(from.IPs[i].Address).To4() != nil
+
+		for _, host := range fromHosts[i] {
+			hostIP := net.ParseIP(host.IP)
+			target := -1
+			for j, toIP := range to.IPs {
+				if toIP.DHCP == nil {
+					continue
+				}
+				if hostIP != nil && toNets[j].Contains(hostIP) ||
+					hostIP == nil && (toNets[j].IP.To4() != nil) == fromIPv4 {
+					target = j
+					break
+				}
+			}
+			if target < 0 {
+				log.Printf("[WARN] Dropping DHCP host %+v from network %s: no address with DHCP serves it", host, to.Name)
+				continue
+			}
+			hosts[target] = append(hosts[target], host)
+		}
+	}
+	return hosts, nil
+}
+
+// updateNetworkDHCPRanges adds and removes the DHCP ranges of the addresses
+// of a running network, for enabling or disabling DHCP and changing the
+// ranges
+func updateNetworkDHCPRanges(d *schema.ResourceData, network *libvirt.Network) error {
+	if !d.HasChange("dhcp") && !d.HasChange("ipv4") && !d.HasChange("ipv6") {
+		return nil
+	}
+
+	ips, err := getIPsFromResource(d)
+	if err != nil {
+		return err
+	}
+	currentDef, err := getXMLNetworkDefFromLibvirt(network)
+	if err != nil {
+		return err
+	}
+
+	for i, ip := range ips {
+		var current, wanted []libvirtxml.NetworkDHCPRange
+		if i < len(currentDef.IPs) && currentDef.IPs[i].DHCP != nil {
+			current = currentDef.IPs[i].DHCP.Ranges
+		}
+		if ip.DHCP != nil {
+			wanted = ip.DHCP.Ranges
+		}
+
+		for _, dhcpRange := range current {
+			if containsNetworkDHCPRange(wanted, dhcpRange) {
+				continue
+			}
+			if err := updateNetworkSection(network, libvirt.NETWORK_UPDATE_COMMAND_DELETE,
+				libvirt.NETWORK_SECTION_IP_DHCP_RANGE, i, dhcpRange); err != nil {
+				return fmt.Errorf("Error removing DHCP range %s-%s: %s", dhcpRange.Start, dhcpRange.End, err)
+			}
+		}
+		for _, dhcpRange := range wanted {
+			if containsNetworkDHCPRange(current, dhcpRange) {
+				continue
+			}
+			if err := updateNetworkSection(network, libvirt.NETWORK_UPDATE_COMMAND_ADD_LAST,
+				libvirt.NETWORK_SECTION_IP_DHCP_RANGE, i, dhcpRange); err != nil {
+				return fmt.Errorf("Error adding DHCP range %s-%s: %s", dhcpRange.Start, dhcpRange.End, err)
+			}
+		}
+	}
+
+	d.SetPartial("dhcp")
+	d.SetPartial("ipv4")
+	d.SetPartial("ipv6")
+	return nil
+}
+
+func containsNetworkDHCPRange(ranges []libvirtxml.NetworkDHCPRange, dhcpRange libvirtxml.NetworkDHCPRange) bool {
+	for _, r := range ranges {
+		if r.Start == dhcpRange.Start && r.End == dhcpRange.End {
+			return true
+		}
+	}
+	return false
+}
+
+// updateNetworkSection applies a change to a section of both the running
+// network and its persistent definition
+func updateNetworkSection(network *libvirt.Network, command libvirt.NetworkUpdateCommand,
+	section libvirt.NetworkUpdateSection, parentIndex int, def interface{}) error {
+	data, err := xmlMarshallIndented(def)
+	if err != nil {
+		return fmt.Errorf("serialize update: %s", err)
+	}
+
+	log.Printf("[DEBUG] Updating network section %d with XML: %s", section, data)
+	return network.Update(command, section, parentIndex, data,
+		libvirt.NETWORK_UPDATE_AFFECT_LIVE|libvirt.NETWORK_UPDATE_AFFECT_CONFIG)
+}
@@ -4,6 +4,9 @@ import (
 	"encoding/xml"
 	"fmt"
 	"log"
+	"net"
+	"strings"
+	"time"
 
 	libvirt "github.com/libvirt/libvirt-go"
 	"github.com/libvirt/libvirt-go-xml"
@@ -12,7 +15,7 @@ import (
 // HasDHCP checks if the network has a DHCP server managed by libvirt
 func HasDHCP(net libvirtxml.Network) bool {
 	if net.Forward != nil {
-		if net.Forward.Mode == "nat" || net.Forward.Mode == "route" || net.Forward.Mode == "" {
+		if net.Forward.Mode == "nat" || net.Forward.Mode == "route" || net.Forward.Mode == "open" || net.Forward.Mode == "" {
 			return true
 		}
 	}
@@ -81,14 +84,35 @@ func getHostXMLDesc(ip, mac, name string) string {
 func addHost(n *libvirt.Network, ip, mac, name string) error {
 	xmlDesc := getHostXMLDesc(ip, mac, name)
 	log.Printf("Adding host with XML:\n%s", xmlDesc)
-	return n.Update(libvirt.NETWORK_UPDATE_COMMAND_ADD_LAST, libvirt.NETWORK_SECTION_IP_DHCP_HOST, -1, xmlDesc, libvirt.NETWORK_UPDATE_AFFECT_CURRENT)
+	return updateNetworkHost(n, libvirt.NETWORK_UPDATE_COMMAND_ADD_LAST, xmlDesc)
 }
 
 // Update a static host from the network
 func updateHost(n *libvirt.Network, ip, mac, name string) error {
 	xmlDesc := getHostXMLDesc(ip, mac, name)
 	log.Printf("Updating host with XML:\n%s", xmlDesc)
-	return n.Update(libvirt.NETWORK_UPDATE_COMMAND_MODIFY, libvirt.NETWORK_SECTION_IP_DHCP_HOST, -1, xmlDesc, libvirt.NETWORK_UPDATE_AFFECT_CURRENT)
+	return updateNetworkHost(n, libvirt.NETWORK_UPDATE_COMMAND_MODIFY, xmlDesc)
+}
+
+// Removes a static host from the network
+func removeHost(n *libvirt.Network, ip, mac, name string) error {
+	xmlDesc := getHostXMLDesc(ip, mac, name)
+	log.Printf("Removing host with XML:\n%s", xmlDesc)
+	return updateNetworkHost(n, libvirt.NETWORK_UPDATE_COMMAND_DELETE, xmlDesc)
+}
+
+// updateNetworkHost changes the static hosts in the persistent definition of
+// the network and, when it is active, in the running network too
+func updateNetworkHost(n *libvirt.Network, command libvirt.NetworkUpdateCommand, xmlDesc string) error {
+	active, err := n.IsActive()
+	if err != nil {
+		return fmt.Errorf("Couldn't determine if network is active: %s", err)
+	}
+	flags := libvirt.NETWORK_UPDATE_AFFECT_CONFIG
+	if active {
+		flags |= libvirt.NETWORK_UPDATE_AFFECT_LIVE
+	}
+	return n.Update(command, libvirt.NETWORK_SECTION_IP_DHCP_HOST, -1, xmlDesc, flags)
 }
 
 // Tries to update first, if that fails, it will add it
@@ -99,3 +123,177 @@ func updateOrAddHost(n *libvirt.Network, ip, mac, name string) error {
 	}
 	return err
 }
+
+// getNetworkIPCIDR returns the CIDR of the network served by one of the
+// addresses of the host in the network (eg, 10.10.8.0/24 for 10.10.8.1)
+func getNetworkIPCIDR(address libvirtxml.NetworkIP) (string, error) {
+	addr := net.ParseIP(address.Address)
+	if addr == nil {
+		return "", fmt.Errorf("Error parsing IP '%s'", address.Address)
+	}
+	bits := net.IPv6len * 8
+	if addr.To4() != nil {
+		bits = net.IPv4len * 8
+	}
+
+	prefix := int(address.Prefix)
+	if address.Netmask != "" {
+		netmask := net.ParseIP(address.Netmask)
+		if netmask == nil || netmask.To4() == nil {
+			return "", fmt.Errorf("Error parsing netmask '%s'", address.Netmask)
+		}
+		prefix, _ = net.IPMask(netmask.To4()).Size()
+	}
+
+	mask := net.CIDRMask(prefix, bits)
+	return fmt.Sprintf("%s/%d", addr.Mask(mask), prefix), nil
+}
+
+// networkDHCPHost is a static DHCP host of a network. libvirtxml doesn't
+// support the lease time of the hosts yet.
+type networkDHCPHost struct {
+	XMLName xml.Name          `xml:"host"`
+	ID      string            `xml:"id,attr,omitempty"`
+	MAC     string            `xml:"mac,attr,omitempty"`
+	Name    string            `xml:"name,attr,omitempty"`
+	IP      string            `xml:"ip,attr,omitempty"`
+	Lease   *networkDHCPLease `xml:"lease"`
+}
+
+// networkDHCPLease is the lease time of a static DHCP host: an expiry of
+// zero means the lease never expires
+type networkDHCPLease struct {
+	Expiry uint   `xml:"expiry,attr"`
+	Unit   string `xml:"unit,attr,omitempty"`
+}
+
+const networkDHCPLeaseInfinite = "infinite"
+
+// newNetworkDHCPLease returns the lease for a lease time given as
+// "infinite" or as a duration (eg, "30m" or "12h")
+func newNetworkDHCPLease(leaseTime string) (*networkDHCPLease, error) {
+	if leaseTime == "" {
+		return nil, nil
+	}
+	if leaseTime == networkDHCPLeaseInfinite {
+		return &networkDHCPLease{Expiry: 0}, nil
+	}
+
+	duration, err := time.ParseDuration(leaseTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lease time '%s': it must be '%s' or a duration like '30m' or '12h'", leaseTime, networkDHCPLeaseInfinite)
+	}
+	if duration < 2*time.Minute || duration%time.Second != 0 {
+		return nil, fmt.Errorf("invalid lease time '%s': it must be a number of seconds, of at least 2 minutes", leaseTime)
+	}
+
+	switch {
+	case duration%time.Hour == 0:
+		return &networkDHCPLease{Expiry: uint(duration / time.Hour), Unit: "hours"}, nil
+	case duration%time.Minute == 0:
+		return &networkDHCPLease{Expiry: uint(duration / time.Minute), Unit: "minutes"}, nil
+	default:
+		return &networkDHCPLease{Expiry: uint(duration / time.Second), Unit: "seconds"}, nil
+	}
+}
+
+// leaseTime returns the lease time in the format used in the resources
+func (l *networkDHCPLease) leaseTime() string {
+	if l == nil {
+		return ""
+	}
+	if l.Expiry == 0 {
+		return networkDHCPLeaseInfinite
+	}
+
+	unit := time.Minute // libvirt's default
+	switch l.Unit {
+	case "seconds":
+		unit = time.Second
+	case "hours":
+		unit = time.Hour
+	}
+	return (time.Duration(l.Expiry) * unit).String()
+}
+
+// getNetworkDHCPHosts returns the static DHCP hosts of all the addresses
+// of a network
+func getNetworkDHCPHosts(network Network) ([]networkDHCPHost, error) {
+	ipHosts, err := getNetworkIPDHCPHosts(network)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []networkDHCPHost
+	for _, ip := range ipHosts {
+		hosts = append(hosts, ip...)
+	}
+	return hosts, nil
+}
+
+// getNetworkIPDHCPHosts returns the static DHCP hosts of each address of a
+// network, in the order of the addresses in its definition
+func getNetworkIPDHCPHosts(network Network) ([][]networkDHCPHost, error) {
+	networkXMLDesc, err := network.GetXMLDesc(0)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving libvirt network XML description: %s", err)
+	}
+
+	var networkDef struct {
+		IPs []struct {
+			DHCP *struct {
+				Hosts []networkDHCPHost `xml:"host"`
+			} `xml:"dhcp"`
+		} `xml:"ip"`
+	}
+	if err := xml.Unmarshal([]byte(networkXMLDesc), &networkDef); err != nil {
+		return nil, fmt.Errorf("Error reading libvirt network XML description: %s", err)
+	}
+
+	hosts := make([][]networkDHCPHost, len(networkDef.IPs))
+	for i, ip := range networkDef.IPs {
+		if ip.DHCP != nil {
+			hosts[i] = ip.DHCP.Hosts
+		}
+	}
+	return hosts, nil
+}
+
+// getNetworkIPIndexForHost returns the index of the address of a network
+// serving a static DHCP host
+func getNetworkIPIndexForHost(networkDef libvirtxml.Network, address string) (int, error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return -1, fmt.Errorf("Could not parse address '%s'", address)
+	}
+	for i, networkIP := range networkDef.IPs {
+		cidr, err := getNetworkIPCIDR(networkIP)
+		if err != nil {
+			return -1, err
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return -1, err
+		}
+		if ipNet.Contains(ip) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("network %s has no address serving %s", networkDef.Name, address)
+}
+
+// networkDHCPHostID returns the terraform id of a static DHCP host: the IP
+// of a host is unique inside of its network
+func networkDHCPHostID(networkID string, ip string) string {
+	return networkID + "/" + ip
+}
+
+// parseNetworkDHCPHostID splits a static DHCP host id in the UUID of its
+// network and its IP
+func parseNetworkDHCPHostID(id string) (string, string, error) {
+	parts := strings.SplitN(id, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid DHCP host id '%s': it should be 'networkUUID/IP'", id)
+	}
+	return parts[0], parts[1], nil
+}
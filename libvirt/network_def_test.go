@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/xml"
 	"errors"
+	"reflect"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
@@ -196,3 +197,138 @@ func TestGetHostXMLDesc(t *testing.T) {
 		t.Errorf("expected name %s, got %s", name, dd.Name)
 	}
 }
+
+func TestGetNetworkIPCIDR(t *testing.T) {
+	for _, tc := range []struct {
+		address  libvirtxml.NetworkIP
+		expected string
+	}{
+		{libvirtxml.NetworkIP{Address: "10.10.8.1", Prefix: 24}, "10.10.8.0/24"},
+		{libvirtxml.NetworkIP{Address: "192.168.122.1", Netmask: "255.255.255.0"}, "192.168.122.0/24"},
+		{libvirtxml.NetworkIP{Address: "2001:db8:ca2:2::1", Prefix: 64}, "2001:db8:ca2:2::/64"},
+	} {
+		cidr, err := getNetworkIPCIDR(tc.address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cidr != tc.expected {
+			t.Errorf("Expected %s, got %s", tc.expected, cidr)
+		}
+	}
+
+	if _, err := getNetworkIPCIDR(libvirtxml.NetworkIP{Address: "not-an-ip"}); err == nil {
+		t.Errorf("Expected an error for an invalid address")
+	}
+}
+
+func TestNetworkDHCPLease(t *testing.T) {
+	for _, tc := range []struct {
+		leaseTime string
+		expected  *networkDHCPLease
+		read      string
+	}{
+		{"", nil, ""},
+		{"infinite", &networkDHCPLease{Expiry: 0}, "infinite"},
+		{"12h", &networkDHCPLease{Expiry: 12, Unit: "hours"}, "12h0m0s"},
+		{"90m", &networkDHCPLease{Expiry: 90, Unit: "minutes"}, "1h30m0s"},
+		{"150s", &networkDHCPLease{Expiry: 150, Unit: "seconds"}, "2m30s"},
+	} {
+		lease, err := newNetworkDHCPLease(tc.leaseTime)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.leaseTime, err)
+		}
+		if !reflect.DeepEqual(lease, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.leaseTime, tc.expected, lease)
+		}
+		if r := lease.leaseTime(); r != tc.read {
+			t.Errorf("%s: expected lease time %s, got %s", tc.leaseTime, tc.read, r)
+		}
+	}
+
+	// libvirt uses minutes by default
+	if r := (&networkDHCPLease{Expiry: 5}).leaseTime(); r != "5m0s" {
+		t.Errorf("expected 5m0s, got %s", r)
+	}
+
+	for _, leaseTime := range []string{"forever", "1m", "-1h", "150.5s"} {
+		if _, err := newNetworkDHCPLease(leaseTime); err == nil {
+			t.Errorf("expected an error for lease time '%s'", leaseTime)
+		}
+	}
+}
+
+func TestGetNetworkDHCPHosts(t *testing.T) {
+	net := NetworkMock{
+		GetXMLDescReply: `
+		<network>
+		  <name>k8snet</name>
+		  <ip address='10.17.3.1' prefix='24'>
+		    <dhcp>
+		      <range start='10.17.3.2' end='10.17.3.254'/>
+		      <host mac='52:54:00:6c:3c:01' name='worker' ip='10.17.3.10'>
+		        <lease expiry='12' unit='hours'/>
+		      </host>
+		      <host mac='52:54:00:6c:3c:02' ip='10.17.3.11'/>
+		    </dhcp>
+		  </ip>
+		  <ip family='ipv6' address='2001:db8:ca2:2::1' prefix='64'>
+		    <dhcp>
+		      <host name='worker' ip='2001:db8:ca2:2::10'/>
+		    </dhcp>
+		  </ip>
+		</network>`,
+	}
+
+	hosts, err := getNetworkDHCPHosts(net)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 3 {
+		t.Fatalf("expected 3 hosts, got %d", len(hosts))
+	}
+	if hosts[0].MAC != "52:54:00:6c:3c:01" || hosts[0].Name != "worker" || hosts[0].IP != "10.17.3.10" {
+		t.Errorf("unexpected host: %v", hosts[0])
+	}
+	if hosts[0].Lease.leaseTime() != "12h0m0s" {
+		t.Errorf("unexpected lease time: %s", hosts[0].Lease.leaseTime())
+	}
+	if hosts[1].Lease != nil {
+		t.Errorf("unexpected lease: %v", hosts[1].Lease)
+	}
+	if hosts[2].IP != "2001:db8:ca2:2::10" {
+		t.Errorf("unexpected host: %v", hosts[2])
+	}
+
+	networkDef, err := getXMLNetworkDefFromLibvirt(net)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for address, expected := range map[string]int{"10.17.3.10": 0, "2001:db8:ca2:2::10": 1} {
+		index, err := getNetworkIPIndexForHost(networkDef, address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index != expected {
+			t.Errorf("%s: expected index %d, got %d", address, expected, index)
+		}
+	}
+	if _, err := getNetworkIPIndexForHost(networkDef, "10.17.4.10"); err == nil {
+		t.Errorf("expected an error for an address out of the network")
+	}
+}
+
+func TestParseNetworkDHCPHostID(t *testing.T) {
+	networkID, ip, err := parseNetworkDHCPHostID(networkDHCPHostID("4d7c2a6a-0d2b-4a8d-8a0b-3c3c0c9bd9c1", "2001:db8:ca2:2::10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if networkID != "4d7c2a6a-0d2b-4a8d-8a0b-3c3c0c9bd9c1" || ip != "2001:db8:ca2:2::10" {
+		t.Errorf("unexpected network id and ip: %s %s", networkID, ip)
+	}
+
+	for _, id := range []string{"", "4d7c2a6a-0d2b-4a8d-8a0b-3c3c0c9bd9c1", "/10.17.3.10"} {
+		if _, _, err := parseNetworkDHCPHostID(id); err == nil {
+			t.Errorf("expected an error parsing DHCP host id '%s'", id)
+		}
+	}
+}
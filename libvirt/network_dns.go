@@ -215,47 +215,115 @@ func getDNSEnableFromResource(d *schema.ResourceData) (string, error) {
 // getDNSSRVFromResource returns a list of libvirt's DNS SRVs
 // in the network definition
 func getDNSSRVFromResource(d *schema.ResourceData) ([]libvirtxml.NetworkDNSSRV, error) {
+	return parseNetworkDNSSRVsChange(d.Get(dnsPrefix + ".srvs"))
+}
+
+// updateDNSSRVs detects changes in the DNS SRV entries
+// updating the network definition accordingly
+func updateDNSSRVs(d *schema.ResourceData, network *libvirt.Network) error {
+	srvsKey := dnsPrefix + ".srvs"
+	if !d.HasChange(srvsKey) {
+		return nil
+	}
+	oldInterface, newInterface := d.GetChange(srvsKey)
+
+	oldEntries, err := parseNetworkDNSSRVsChange(oldInterface)
+	if err != nil {
+		return fmt.Errorf("parse old %s: %s", srvsKey, err)
+	}
+
+	newEntries, err := parseNetworkDNSSRVsChange(newInterface)
+	if err != nil {
+		return fmt.Errorf("parse new %s: %s", srvsKey, err)
+	}
+
+	// process all the old SRV entries that must be removed
+	for _, oldEntry := range oldEntries {
+		if containsNetworkDNSSRV(newEntries, oldEntry) {
+			continue
+		}
+
+		data, err := xmlMarshallIndented(oldEntry)
+		if err != nil {
+			return fmt.Errorf("serialize update: %s", err)
+		}
+
+		err = network.Update(libvirt.NETWORK_UPDATE_COMMAND_DELETE, libvirt.NETWORK_SECTION_DNS_SRV, -1, data, libvirt.NETWORK_UPDATE_AFFECT_LIVE|libvirt.NETWORK_UPDATE_AFFECT_CONFIG)
+		if err != nil {
+			return fmt.Errorf("delete %s.%s: %s", oldEntry.Service, oldEntry.Protocol, err)
+		}
+	}
+
+	// process all the new SRV entries that must be added
+	for _, newEntry := range newEntries {
+		if containsNetworkDNSSRV(oldEntries, newEntry) {
+			continue
+		}
+
+		data, err := xmlMarshallIndented(newEntry)
+		if err != nil {
+			return fmt.Errorf("serialize update: %s", err)
+		}
+
+		err = network.Update(libvirt.NETWORK_UPDATE_COMMAND_ADD_LAST, libvirt.NETWORK_SECTION_DNS_SRV, -1, data, libvirt.NETWORK_UPDATE_AFFECT_LIVE|libvirt.NETWORK_UPDATE_AFFECT_CONFIG)
+		if err != nil {
+			return fmt.Errorf("add %v: %s", newEntry, err)
+		}
+	}
+
+	d.SetPartial(srvsKey)
+	return nil
+}
+
+func containsNetworkDNSSRV(entries []libvirtxml.NetworkDNSSRV, entry libvirtxml.NetworkDNSSRV) bool {
+	for _, e := range entries {
+		if reflect.DeepEqual(e, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseNetworkDNSSRVsChange(change interface{}) ([]libvirtxml.NetworkDNSSRV, error) {
+	slice, ok := change.([]interface{})
+	if !ok {
+		return nil, errors.New("not slice")
+	}
+
 	var dnsSRVs []libvirtxml.NetworkDNSSRV
+	for i, entryInterface := range slice {
+		entryMap, ok := entryInterface.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("entry %d is not a map", i)
+		}
 
-	if dnsSRVCount, ok := d.GetOk(dnsPrefix + ".srvs.#"); ok {
-		for i := 0; i < dnsSRVCount.(int); i++ {
-			srv := libvirtxml.NetworkDNSSRV{}
-			srvPrefix := fmt.Sprintf(dnsPrefix+".srvs.%d", i)
-			if service, ok := d.GetOk(srvPrefix + ".service"); ok {
-				srv.Service = service.(string)
-			}
-			if protocol, ok := d.GetOk(srvPrefix + ".protocol"); ok {
-				srv.Protocol = protocol.(string)
-			}
-			if domain, ok := d.GetOk(srvPrefix + ".domain"); ok {
-				srv.Domain = domain.(string)
-			}
-			if target, ok := d.GetOk(srvPrefix + ".target"); ok {
-				srv.Target = target.(string)
-			}
-			if port, ok := d.GetOk(srvPrefix + ".port"); ok {
-				p, err := strconv.Atoi(port.(string))
-				if err != nil {
-					return nil, fmt.Errorf("Could not convert port '%s' to int", port)
-				}
-				srv.Port = uint(p)
+		srv := libvirtxml.NetworkDNSSRV{}
+		srv.Service, _ = entryMap["service"].(string)
+		srv.Protocol, _ = entryMap["protocol"].(string)
+		srv.Domain, _ = entryMap["domain"].(string)
+		srv.Target, _ = entryMap["target"].(string)
+		if port, _ := entryMap["port"].(string); port != "" {
+			p, err := strconv.Atoi(port)
+			if err != nil {
+				return nil, fmt.Errorf("Could not convert port '%s' to int", port)
 			}
-			if weight, ok := d.GetOk(srvPrefix + ".weight"); ok {
-				w, err := strconv.Atoi(weight.(string))
-				if err != nil {
-					return nil, fmt.Errorf("Could not convert weight '%s' to int", weight)
-				}
-				srv.Weight = uint(w)
+			srv.Port = uint(p)
+		}
+		if weight, _ := entryMap["weight"].(string); weight != "" {
+			w, err := strconv.Atoi(weight)
+			if err != nil {
+				return nil, fmt.Errorf("Could not convert weight '%s' to int", weight)
 			}
-			if priority, ok := d.GetOk(srvPrefix + ".priority"); ok {
-				w, err := strconv.Atoi(priority.(string))
-				if err != nil {
-					return nil, fmt.Errorf("Could not convert priority '%s' to int", priority)
-				}
-				srv.Priority = uint(w)
+			srv.Weight = uint(w)
+		}
+		if priority, _ := entryMap["priority"].(string); priority != "" {
+			p, err := strconv.Atoi(priority)
+			if err != nil {
+				return nil, fmt.Errorf("Could not convert priority '%s' to int", priority)
 			}
-			dnsSRVs = append(dnsSRVs, srv)
+			srv.Priority = uint(p)
 		}
+		dnsSRVs = append(dnsSRVs, srv)
 	}
 
 	return dnsSRVs, nil
@@ -0,0 +1,518 @@
+package libvirt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/libvirt/libvirt-go-xml"
+)
+
+type fakeResourceChanges map[string]bool
+
+func (c fakeResourceChanges) HasChange(key string) bool {
+	return c[key]
+}
+
+func TestNetworkUpdateRequiresRestart(t *testing.T) {
+	for _, tc := range []struct {
+		changes  fakeResourceChanges
+		expected bool
+	}{
+		{fakeResourceChanges{}, false},
+		{fakeResourceChanges{"dhcp": true, dnsPrefix + ".srvs": true, dnsPrefix + ".hosts": true}, false},
+		{fakeResourceChanges{"domain": true, "autostart": true}, false},
+		{fakeResourceChanges{"routes": true}, true},
+		{fakeResourceChanges{"addresses": true, "dhcp": true}, true},
+		{fakeResourceChanges{dnsPrefix + ".forwarders": true}, true},
+	} {
+		if r := networkUpdateRequiresRestart(tc.changes); r != tc.expected {
+			t.Errorf("%v: expected %t, got %t", tc.changes, tc.expected, r)
+		}
+	}
+}
+
+func TestAssignNetworkDHCPHosts(t *testing.T) {
+	host := networkDHCPHost{
+		MAC:   "52:54:00:00:00:01",
+		Name:  "worker",
+		IP:    "10.17.3.10",
+		Lease: &networkDHCPLease{Expiry: 0},
+	}
+	idHost := networkDHCPHost{
+		ID:   "0:4:7e:7d:f0:7d:a8:bc:c5:d2:13:32:11:ed:16:ea:84:63",
+		Name: "worker6",
+	}
+	from := libvirtxml.Network{
+		IPs: []libvirtxml.NetworkIP{
+			{
+				Address: "10.17.3.1",
+				Prefix:  24,
+				DHCP:    &libvirtxml.NetworkDHCP{},
+			},
+			{
+				Family:  "ipv6",
+				Address: "2001:db8:ca2:2::1",
+				Prefix:  64,
+				DHCP:    &libvirtxml.NetworkDHCP{},
+			},
+		},
+	}
+	fromHosts := [][]networkDHCPHost{
+		{host, {MAC: "52:54:00:00:00:02", IP: "10.17.4.10"}},
+		{idHost},
+	}
+	to := libvirtxml.Network{
+		IPs: []libvirtxml.NetworkIP{
+			{
+				Family:  "ipv6",
+				Address: "2001:db8:ca2:2::1",
+				Prefix:  64,
+				DHCP:    &libvirtxml.NetworkDHCP{},
+			},
+			{
+				Address: "10.17.3.1",
+				Prefix:  24,
+				DHCP: &libvirtxml.NetworkDHCP{
+					Ranges: []libvirtxml.NetworkDHCPRange{
+						{Start: "10.17.3.2", End: "10.17.3.254"},
+					},
+				},
+			},
+		},
+	}
+
+	hosts, err := assignNetworkDHCPHosts(from, fromHosts, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hosts[0], []networkDHCPHost{idHost}) {
+		t.Errorf("Expected only the host given by id in the IPv6 address, got %v", hosts[0])
+	}
+	if !reflect.DeepEqual(hosts[1], []networkDHCPHost{host}) {
+		t.Errorf("Expected only the host in 10.17.3.0/24, with its lease, got %v", hosts[1])
+	}
+}
+
+func TestParseNetworkDNSSRVsChange(t *testing.T) {
+	srvs, err := parseNetworkDNSSRVsChange([]interface{}{
+		map[string]interface{}{
+			"service":  "etcd-server",
+			"protocol": "tcp",
+			"domain":   "k8s.local",
+			"target":   "etcd.k8s.local",
+			"port":     "2380",
+			"weight":   "",
+			"priority": "10",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []libvirtxml.NetworkDNSSRV{
+		{
+			Service:  "etcd-server",
+			Protocol: "tcp",
+			Domain:   "k8s.local",
+			Target:   "etcd.k8s.local",
+			Port:     2380,
+			Priority: 10,
+		},
+	}
+	if !reflect.DeepEqual(srvs, expected) {
+		t.Errorf("Expected %v, got %v", expected, srvs)
+	}
+
+	if _, err := parseNetworkDNSSRVsChange([]interface{}{
+		map[string]interface{}{"port": "http"},
+	}); err == nil {
+		t.Errorf("Expected an error for a non numeric port")
+	}
+}
+
+func TestGetIPsFromResourceFamilySettings(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibvirtNetwork().Schema, map[string]interface{}{
+		"name":      "dualstack",
+		"addresses": []interface{}{"10.17.3.0/24", "2001:db8:ca2:2::/64"},
+		"ipv4": []interface{}{
+			map[string]interface{}{
+				"dhcp_start": "10.17.3.100",
+				"dhcp_end":   "10.17.3.200",
+			},
+		},
+		"ipv6": []interface{}{
+			map[string]interface{}{
+				"ra_mode": "slaac",
+			},
+		},
+	})
+
+	ips, err := getIPsFromResource(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 2 {
+		t.Fatalf("Expected 2 addresses, got %v", ips)
+	}
+	if ips[0].DHCP == nil || !reflect.DeepEqual(ips[0].DHCP.Ranges, []libvirtxml.NetworkDHCPRange{{Start: "10.17.3.100", End: "10.17.3.200"}}) {
+		t.Errorf("Unexpected IPv4 DHCP configuration: %v", ips[0].DHCP)
+	}
+	if ips[1].DHCP != nil {
+		t.Errorf("Expected no DHCPv6 with SLAAC, got %v", ips[1].DHCP)
+	}
+
+	d = schema.TestResourceDataRaw(t, resourceLibvirtNetwork().Schema, map[string]interface{}{
+		"name":      "dualstack",
+		"addresses": []interface{}{"10.17.3.0/24", "2001:db8:ca2:2::/64"},
+		"ipv4": []interface{}{
+			map[string]interface{}{
+				"dhcp_enabled": false,
+			},
+		},
+	})
+
+	ips, err = getIPsFromResource(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ips[0].DHCP != nil {
+		t.Errorf("Expected no DHCP for IPv4, got %v", ips[0].DHCP)
+	}
+	if ips[1].DHCP == nil || len(ips[1].DHCP.Ranges) != 1 {
+		t.Errorf("Expected the default DHCPv6 range, got %v", ips[1].DHCP)
+	}
+}
+
+func TestFlattenNetworkIPFamily(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibvirtNetwork().Schema, map[string]interface{}{
+		"name":      "dualstack",
+		"addresses": []interface{}{"10.17.3.0/24", "2001:db8:ca2:2::/64"},
+		"ipv4": []interface{}{
+			map[string]interface{}{
+				"dhcp_start": "10.17.3.100",
+				"dhcp_end":   "10.17.3.200",
+			},
+		},
+		"ipv6": []interface{}{
+			map[string]interface{}{
+				"ra_mode": "stateful",
+			},
+		},
+	})
+
+	// the network was changed outside of terraform
+	ipv4 := libvirtxml.NetworkIP{
+		Address: "10.17.3.1",
+		DHCP: &libvirtxml.NetworkDHCP{
+			Ranges: []libvirtxml.NetworkDHCPRange{{Start: "10.17.3.50", End: "10.17.3.60"}},
+		},
+	}
+	ipv6 := libvirtxml.NetworkIP{
+		Family:  "ipv6",
+		Address: "2001:db8:ca2:2::1",
+	}
+	if err := d.Set("ipv4", flattenNetworkIPFamily(d, "ipv4", ipv4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set("ipv6", flattenNetworkIPFamily(d, "ipv6", ipv6)); err != nil {
+		t.Fatal(err)
+	}
+
+	if start := d.Get("ipv4.0.dhcp_start").(string); start != "10.17.3.50" {
+		t.Errorf("Expected the DHCP range to start at 10.17.3.50, got '%s'", start)
+	}
+	if end := d.Get("ipv4.0.dhcp_end").(string); end != "10.17.3.60" {
+		t.Errorf("Expected the DHCP range to end at 10.17.3.60, got '%s'", end)
+	}
+	if !d.Get("ipv4.0.dhcp_enabled").(bool) {
+		t.Errorf("Expected DHCP to be enabled for IPv4")
+	}
+	if raMode := d.Get("ipv6.0.ra_mode").(string); raMode != raModeSLAAC {
+		t.Errorf("Expected the SLAAC RA mode without DHCPv6 range, got '%s'", raMode)
+	}
+}
+
+func TestCheckDHCPRange(t *testing.T) {
+	if err := checkDHCPRange("10.17.3.0/24", "10.17.3.100", "10.17.3.200"); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if err := checkDHCPRange("2001:db8:ca2:2::/64", "2001:db8:ca2:2::100", "2001:db8:ca2:2::1ff"); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	for _, r := range [][2]string{
+		{"10.17.3.100", ""},
+		{"10.17.3.100", "10.17.4.200"},
+		{"10.17.3.200", "10.17.3.100"},
+		{"10.17.3.100", "not-an-ip"},
+	} {
+		if err := checkDHCPRange("10.17.3.0/24", r[0], r[1]); err == nil {
+			t.Errorf("Expected an error for the range %s-%s", r[0], r[1])
+		}
+	}
+}
+
+func TestNewNetworkDefFromResourceForwardModes(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibvirtNetwork().Schema, map[string]interface{}{
+		"name": "macvtap",
+		"mode": "passthrough",
+		"forward": []interface{}{
+			map[string]interface{}{
+				"interfaces": []interface{}{"eth10", "eth11"},
+			},
+		},
+	})
+	networkDef, err := newNetworkDefFromResource(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &libvirtxml.NetworkForward{
+		Mode:       "passthrough",
+		Interfaces: []libvirtxml.NetworkForwardInterface{{Dev: "eth10"}, {Dev: "eth11"}},
+	}
+	if !reflect.DeepEqual(networkDef.Forward, expected) {
+		t.Errorf("Expected forward %v, got %v", expected, networkDef.Forward)
+	}
+	if networkDef.Bridge != nil {
+		t.Errorf("Expected no bridge in a macvtap network, got %v", networkDef.Bridge)
+	}
+
+	d = schema.TestResourceDataRaw(t, resourceLibvirtNetwork().Schema, map[string]interface{}{
+		"name": "sriov",
+		"mode": "hostdev",
+		"forward": []interface{}{
+			map[string]interface{}{
+				"pf":      "enp2s0f0",
+				"managed": false,
+			},
+		},
+	})
+	networkDef, err = newNetworkDefFromResource(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = &libvirtxml.NetworkForward{
+		Mode:    "hostdev",
+		Managed: "no",
+		PFs:     []libvirtxml.NetworkForwardPF{{Dev: "enp2s0f0"}},
+	}
+	if !reflect.DeepEqual(networkDef.Forward, expected) {
+		t.Errorf("Expected forward %v, got %v", expected, networkDef.Forward)
+	}
+
+	d = schema.TestResourceDataRaw(t, resourceLibvirtNetwork().Schema, map[string]interface{}{
+		"name":      "open",
+		"mode":      "open",
+		"addresses": []interface{}{"10.17.3.0/24"},
+	})
+	networkDef, err = newNetworkDefFromResource(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if networkDef.Forward == nil || networkDef.Forward.Mode != "open" || networkDef.Forward.NAT != nil {
+		t.Errorf("Unexpected forward in an open network: %v", networkDef.Forward)
+	}
+	if len(networkDef.IPs) != 1 || networkDef.IPs[0].DHCP == nil {
+		t.Errorf("Expected DHCP to be enabled by default in an open network, got %v", networkDef.IPs)
+	}
+
+	for mode, forward := range map[string]map[string]interface{}{
+		"private": {},
+		"hostdev": {},
+		"route":   {"interfaces": []interface{}{"eth10"}},
+		"none":    {"dev": "eth0"},
+		"open":    {"nat": []interface{}{map[string]interface{}{"port_start": 2000}}},
+	} {
+		d = schema.TestResourceDataRaw(t, resourceLibvirtNetwork().Schema, map[string]interface{}{
+			"name":    "invalid",
+			"mode":    mode,
+			"forward": []interface{}{forward},
+		})
+		if _, err := newNetworkDefFromResource(d); err == nil {
+			t.Errorf("Expected an error with mode %s and forward %v", mode, forward)
+		}
+	}
+}
+
+func TestGetNATFromResource(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibvirtNetwork().Schema, map[string]interface{}{
+		"name": "nat",
+		"forward": []interface{}{
+			map[string]interface{}{
+				"nat": []interface{}{
+					map[string]interface{}{
+						"address_start": "192.168.122.10",
+						"address_end":   "192.168.122.20",
+						"port_start":    2000,
+					},
+				},
+			},
+		},
+	})
+	nat, err := getNATFromResource(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &libvirtxml.NetworkForwardNAT{
+		Addresses: []libvirtxml.NetworkForwardNATAddress{{Start: "192.168.122.10", End: "192.168.122.20"}},
+		Ports:     []libvirtxml.NetworkForwardNATPort{{Start: 2000, End: 65535}},
+	}
+	if !reflect.DeepEqual(nat, expected) {
+		t.Errorf("Expected NAT %v, got %v", expected, nat)
+	}
+
+	for _, invalid := range []map[string]interface{}{
+		{"address_start": "192.168.122.10"},
+		{"address_start": "192.168.122.20", "address_end": "192.168.122.10"},
+		{"address_start": "2001:db8::1", "address_end": "2001:db8::2"},
+		{"port_start": 0},
+		{"port_start": 3000, "port_end": 2000},
+		{"port_end": 70000},
+	} {
+		d = schema.TestResourceDataRaw(t, resourceLibvirtNetwork().Schema, map[string]interface{}{
+			"name": "nat",
+			"forward": []interface{}{
+				map[string]interface{}{
+					"nat": []interface{}{invalid},
+				},
+			},
+		})
+		if _, err := getNATFromResource(d); err == nil {
+			t.Errorf("Expected an error with NAT settings %v", invalid)
+		}
+	}
+}
+
+func TestFlattenNetworkForward(t *testing.T) {
+	// an imported network has no forward settings in its state
+	d := schema.TestResourceDataRaw(t, resourceLibvirtNetwork().Schema, map[string]interface{}{
+		"name": "imported",
+	})
+
+	if !networkForwardIsDefault(&libvirtxml.NetworkForward{
+		Mode: "nat",
+		NAT:  &libvirtxml.NetworkForwardNAT{Ports: []libvirtxml.NetworkForwardNATPort{{Start: 1024, End: 65535}}},
+	}) {
+		t.Errorf("Expected the libvirt NAT port range to be the default one")
+	}
+
+	forward := &libvirtxml.NetworkForward{
+		Mode:       "nat",
+		Dev:        "eth0",
+		Interfaces: []libvirtxml.NetworkForwardInterface{{Dev: "eth0"}},
+		NAT: &libvirtxml.NetworkForwardNAT{
+			Addresses: []libvirtxml.NetworkForwardNATAddress{{Start: "192.168.122.10", End: "192.168.122.20"}},
+			Ports:     []libvirtxml.NetworkForwardNATPort{{Start: 2000, End: 65535}},
+		},
+	}
+	if networkForwardIsDefault(forward) {
+		t.Errorf("Expected the forward settings not to be the default ones")
+	}
+	if err := d.Set("forward", flattenNetworkForward(d, forward)); err != nil {
+		t.Fatal(err)
+	}
+
+	if dev := d.Get("forward.0.dev").(string); dev != "eth0" {
+		t.Errorf("Expected the eth0 device, got '%s'", dev)
+	}
+	if interfaces := d.Get("forward.0.interfaces").([]interface{}); len(interfaces) != 0 {
+		t.Errorf("Expected no interfaces besides the device, got %v", interfaces)
+	}
+	if !d.Get("forward.0.managed").(bool) {
+		t.Errorf("Expected the default managed setting")
+	}
+	if start := d.Get("forward.0.nat.0.address_start").(string); start != "192.168.122.10" {
+		t.Errorf("Expected the NAT range to start at 192.168.122.10, got '%s'", start)
+	}
+	if port := d.Get("forward.0.nat.0.port_start").(int); port != 2000 {
+		t.Errorf("Expected the NAT ports to start at 2000, got %d", port)
+	}
+	if port := d.Get("forward.0.nat.0.port_end").(int); port != 65535 {
+		t.Errorf("Expected the NAT ports to end at 65535, got %d", port)
+	}
+
+	hostdev := &libvirtxml.NetworkForward{
+		Mode:    netModeHostdev,
+		Managed: "no",
+		PFs:     []libvirtxml.NetworkForwardPF{{Dev: "enp2s0f0"}},
+	}
+	if err := d.Set("forward", flattenNetworkForward(d, hostdev)); err != nil {
+		t.Fatal(err)
+	}
+	if pf := d.Get("forward.0.pf").(string); pf != "enp2s0f0" {
+		t.Errorf("Expected the enp2s0f0 physical function, got '%s'", pf)
+	}
+	if d.Get("forward.0.managed").(bool) {
+		t.Errorf("Expected an unmanaged hostdev network")
+	}
+	if nat := d.Get("forward.0.nat").([]interface{}); len(nat) != 0 {
+		t.Errorf("Expected no NAT for a hostdev network, got %v", nat)
+	}
+}
+
+func TestResourceLibvirtNetworkPlanRenderedXML(t *testing.T) {
+	raw, err := config.NewRawConfig(map[string]interface{}{
+		"name":      "planned",
+		"addresses": []interface{}{"10.17.3.0/24"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := resourceLibvirtNetwork().Diff(nil, terraform.NewResourceConfig(raw), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rendered, ok := diff.Attributes["rendered_xml"]
+	if !ok || rendered.NewComputed {
+		t.Fatalf("Expected the XML definition to be rendered in the plan, got %+v", rendered)
+	}
+	if !strings.Contains(rendered.New, "<name>planned</name>") || !strings.Contains(rendered.New, `<ip address="10.17.3.1"`) {
+		t.Errorf("Unexpected XML definition in the plan: %s", rendered.New)
+	}
+}
+
+func TestResourceLibvirtNetworkPlanRestartRequired(t *testing.T) {
+	current := map[string]interface{}{
+		"name":      "planned",
+		"mode":      "nat",
+		"domain":    "k8s.local",
+		"addresses": []interface{}{"10.17.3.0/24"},
+	}
+	d := schema.TestResourceDataRaw(t, resourceLibvirtNetwork().Schema, current)
+	d.SetId("c5a4c3e4-fdb7-4bf4-8c54-0f0c1b22f2d4")
+	d.Set("restart_required", false)
+	state := d.State()
+
+	for _, tc := range []struct {
+		changes  map[string]interface{}
+		expected bool
+	}{
+		{map[string]interface{}{"domain": "k8s.example"}, false},
+		{map[string]interface{}{"addresses": []interface{}{"10.17.4.0/24"}}, true},
+	} {
+		planned := map[string]interface{}{}
+		for k, v := range current {
+			planned[k] = v
+		}
+		for k, v := range tc.changes {
+			planned[k] = v
+		}
+		raw, err := config.NewRawConfig(planned)
+		if err != nil {
+			t.Fatal(err)
+		}
+		diff, err := resourceLibvirtNetwork().Diff(state, terraform.NewResourceConfig(raw), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, restart := diff.Attributes["restart_required"]
+		if restart != tc.expected {
+			t.Errorf("%v: expected restart_required in the plan to be %t, got %+v", tc.changes, tc.expected, diff.Attributes)
+		}
+	}
+}
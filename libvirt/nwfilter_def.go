@@ -0,0 +1,156 @@
+package libvirt
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	libvirt "github.com/libvirt/libvirt-go"
+	"github.com/libvirt/libvirt-go-xml"
+)
+
+// libvirtxml models every attribute of every protocol of a filter rule, but
+// can't marshal them back from a generic list of attributes. These types
+// keep the protocol attributes of a rule as they are.
+type nwFilterDef struct {
+	XMLName  xml.Name                 `xml:"filter"`
+	Name     string                   `xml:"name,attr"`
+	Chain    string                   `xml:"chain,attr,omitempty"`
+	Priority int                      `xml:"priority,attr,omitempty"`
+	UUID     string                   `xml:"uuid,omitempty"`
+	Refs     []libvirtxml.NWFilterRef `xml:"filterref"`
+	Rules    []nwFilterRule           `xml:"rule"`
+}
+
+type nwFilterRule struct {
+	Action     string                 `xml:"action,attr"`
+	Direction  string                 `xml:"direction,attr"`
+	Priority   int                    `xml:"priority,attr"`
+	StateMatch string                 `xml:"statematch,attr,omitempty"`
+	Protocols  []nwFilterRuleProtocol `xml:",any"`
+}
+
+// nwFilterRuleProtocol is the protocol element of a rule (e.g. <tcp/>),
+// with the attributes to match
+type nwFilterRuleProtocol struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+}
+
+// the default priority of the rules of a filter
+const nwFilterRuleDefaultPriority = 500
+
+var nwFilterRuleActions = []string{"drop", "reject", "accept", "return", "continue"}
+
+var nwFilterRuleDirections = []string{"in", "out", "inout"}
+
+var nwFilterRuleProtocols = []string{
+	"mac", "vlan", "stp", "arp", "rarp",
+	"ip", "ipv6",
+	"tcp", "udp", "udplite", "esp", "ah", "sctp", "icmp", "igmp", "all",
+	"tcp-ipv6", "udp-ipv6", "udplite-ipv6", "esp-ipv6", "ah-ipv6", "sctp-ipv6", "icmpv6", "all-ipv6",
+}
+
+// Creates a network filter definition from a XML
+func newNWFilterDefFromXML(s string) (nwFilterDef, error) {
+	var filterDef nwFilterDef
+	err := xml.Unmarshal([]byte(s), &filterDef)
+	if err != nil {
+		return nwFilterDef{}, err
+	}
+	return filterDef, nil
+}
+
+func newNWFilterDefFromLibvirt(filter *libvirt.NWFilter) (nwFilterDef, error) {
+	name, err := filter.GetName()
+	if err != nil {
+		return nwFilterDef{}, fmt.Errorf("could not get name for network filter: %s", err)
+	}
+	filterDefXML, err := filter.GetXMLDesc(0)
+	if err != nil {
+		return nwFilterDef{}, fmt.Errorf("could not get XML description for network filter %s: %s", name, err)
+	}
+	filterDef, err := newNWFilterDefFromXML(filterDefXML)
+	if err != nil {
+		return nwFilterDef{}, fmt.Errorf("could not get a network filter definition from XML for %s: %s", name, err)
+	}
+	return filterDef, nil
+}
+
+// newNWFilterRuleProtocol returns the protocol element of a rule matching
+// the given attributes, sorted by name
+func newNWFilterRuleProtocol(protocol string, match map[string]interface{}) nwFilterRuleProtocol {
+	names := make([]string, 0, len(match))
+	for name := range match {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	p := nwFilterRuleProtocol{XMLName: xml.Name{Local: protocol}}
+	for _, name := range names {
+		p.Attrs = append(p.Attrs, xml.Attr{Name: xml.Name{Local: name}, Value: fmt.Sprintf("%v", match[name])})
+	}
+	return p
+}
+
+// match returns the attributes matched by the protocol element of a rule
+func (p nwFilterRuleProtocol) match() map[string]interface{} {
+	match := map[string]interface{}{}
+	for _, attr := range p.Attrs {
+		match[attr.Name.Local] = attr.Value
+	}
+	return match
+}
+
+// expandFilterParameters returns the parameters of a reference to a filter,
+// sorted by name. Parameters with several values (e.g. the IP addresses of
+// an interface) are given separated by commas.
+func expandFilterParameters(params map[string]interface{}) []libvirtxml.NWFilterParameter {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result []libvirtxml.NWFilterParameter
+	for _, name := range names {
+		for _, value := range strings.Split(params[name].(string), ",") {
+			result = append(result, libvirtxml.NWFilterParameter{Name: name, Value: strings.TrimSpace(value)})
+		}
+	}
+	return result
+}
+
+// flattenFilterParameters returns the parameters of a reference to a filter,
+// joining the values of the parameters given several times
+func flattenFilterParameters(params []libvirtxml.NWFilterParameter) map[string]interface{} {
+	result := map[string]interface{}{}
+	for _, param := range params {
+		if value, ok := result[param.Name]; ok {
+			result[param.Name] = value.(string) + "," + param.Value
+		} else {
+			result[param.Name] = param.Value
+		}
+	}
+	return result
+}
+
+// nwFilterRuleStateMatch returns the statematch attribute of a rule
+func nwFilterRuleStateMatch(stateMatch bool) string {
+	if stateMatch {
+		return ""
+	}
+	return "false"
+}
+
+// parseNWFilterRuleStateMatch returns whether a rule matches the state of
+// the connections from its statematch attribute
+func parseNWFilterRuleStateMatch(stateMatch string) bool {
+	if stateMatch == "" {
+		return true
+	}
+	b, err := strconv.ParseBool(stateMatch)
+	return err != nil || b
+}
@@ -0,0 +1,118 @@
+package libvirt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/libvirt/libvirt-go-xml"
+)
+
+func TestNWFilterDefMarshall(t *testing.T) {
+	filterDef := nwFilterDef{
+		Name:  "ssh-only",
+		Chain: "root",
+		Refs: []libvirtxml.NWFilterRef{
+			{Filter: "clean-traffic", Parameters: []libvirtxml.NWFilterParameter{{Name: "IP", Value: "10.17.3.10"}}},
+		},
+		Rules: []nwFilterRule{
+			{
+				Action:    "accept",
+				Direction: "in",
+				Priority:  500,
+				Protocols: []nwFilterRuleProtocol{
+					newNWFilterRuleProtocol("tcp", map[string]interface{}{"dstportstart": "22", "srcipaddr": "$IP"}),
+				},
+			},
+			{
+				Action:     "drop",
+				Direction:  "inout",
+				Priority:   1000,
+				StateMatch: nwFilterRuleStateMatch(false),
+				Protocols:  []nwFilterRuleProtocol{newNWFilterRuleProtocol("all", nil)},
+			},
+		},
+	}
+
+	data, err := xmlMarshallIndented(filterDef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`<filter name="ssh-only" chain="root">`,
+		`<filterref filter="clean-traffic">`,
+		`<parameter name="IP" value="10.17.3.10"></parameter>`,
+		`<rule action="accept" direction="in" priority="500">`,
+		`<tcp dstportstart="22" srcipaddr="$IP"></tcp>`,
+		`<rule action="drop" direction="inout" priority="1000" statematch="false">`,
+		`<all></all>`,
+	} {
+		if !strings.Contains(data, expected) {
+			t.Errorf("Expected %s in the network filter XML:\n%s", expected, data)
+		}
+	}
+
+	parsed, err := newNWFilterDefFromXML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filterDef.XMLName = parsed.XMLName
+	if !reflect.DeepEqual(parsed, filterDef) {
+		t.Errorf("Expected %#v, got %#v", filterDef, parsed)
+	}
+}
+
+func TestNWFilterDefUnmarshall(t *testing.T) {
+	filterDef, err := newNWFilterDefFromXML(`
+		<filter name='no-ip-spoofing' chain='ipv4' priority='-710'>
+		  <uuid>e9fd2e03-ad72-4cbb-9c5c-b4f8a5fc4cc2</uuid>
+		  <rule action='return' direction='out' priority='100'>
+		    <ip srcipaddr='0.0.0.0' protocol='udp' srcportstart='68' dstportstart='67'/>
+		  </rule>
+		  <rule action='drop' direction='out' priority='1000' statematch='false'>
+		    <all/>
+		  </rule>
+		</filter>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filterDef.Chain != "ipv4" || filterDef.Priority != -710 || filterDef.UUID != "e9fd2e03-ad72-4cbb-9c5c-b4f8a5fc4cc2" {
+		t.Errorf("Unexpected network filter %#v", filterDef)
+	}
+	if len(filterDef.Rules) != 2 || len(filterDef.Rules[0].Protocols) != 1 {
+		t.Fatalf("Unexpected rules %#v", filterDef.Rules)
+	}
+	ip := filterDef.Rules[0].Protocols[0]
+	expected := map[string]interface{}{"srcipaddr": "0.0.0.0", "protocol": "udp", "srcportstart": "68", "dstportstart": "67"}
+	if ip.XMLName.Local != "ip" || !reflect.DeepEqual(ip.match(), expected) {
+		t.Errorf("Expected ip rule matching %v, got %s %v", expected, ip.XMLName.Local, ip.match())
+	}
+	if !parseNWFilterRuleStateMatch(filterDef.Rules[0].StateMatch) || parseNWFilterRuleStateMatch(filterDef.Rules[1].StateMatch) {
+		t.Errorf("Unexpected statematch in rules %#v", filterDef.Rules)
+	}
+}
+
+func TestFilterParameters(t *testing.T) {
+	params := expandFilterParameters(map[string]interface{}{
+		"IP":               "10.17.3.10, 10.17.3.11",
+		"CTRL_IP_LEARNING": "none",
+	})
+	expected := []libvirtxml.NWFilterParameter{
+		{Name: "CTRL_IP_LEARNING", Value: "none"},
+		{Name: "IP", Value: "10.17.3.10"},
+		{Name: "IP", Value: "10.17.3.11"},
+	}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected parameters %v, got %v", expected, params)
+	}
+
+	flattened := flattenFilterParameters(params)
+	expectedMap := map[string]interface{}{
+		"IP":               "10.17.3.10,10.17.3.11",
+		"CTRL_IP_LEARNING": "none",
+	}
+	if !reflect.DeepEqual(flattened, expectedMap) {
+		t.Errorf("Expected parameters %v, got %v", expectedMap, flattened)
+	}
+}
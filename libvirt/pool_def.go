@@ -0,0 +1,89 @@
+package libvirt
+
+import (
+	"encoding/xml"
+	"fmt"
+
+	libvirt "github.com/libvirt/libvirt-go"
+	"github.com/libvirt/libvirt-go-xml"
+)
+
+const (
+	poolTypeDir     = "dir"
+	poolTypeFs      = "fs"
+	poolTypeNetFs   = "netfs"
+	poolTypeLogical = "logical"
+	poolTypeIscsi   = "iscsi"
+)
+
+// Creates a storage pool definition from a XML
+func newDefPoolFromXML(s string) (libvirtxml.StoragePool, error) {
+	var poolDef libvirtxml.StoragePool
+	err := xml.Unmarshal([]byte(s), &poolDef)
+	if err != nil {
+		return libvirtxml.StoragePool{}, err
+	}
+	return poolDef, nil
+}
+
+func newDefPoolFromLibvirt(pool *libvirt.StoragePool) (libvirtxml.StoragePool, error) {
+	name, err := pool.GetName()
+	if err != nil {
+		return libvirtxml.StoragePool{}, fmt.Errorf("could not get name for pool: %s", err)
+	}
+	poolDefXML, err := pool.GetXMLDesc(0)
+	if err != nil {
+		return libvirtxml.StoragePool{}, fmt.Errorf("could not get XML description for pool %s: %s", name, err)
+	}
+	poolDef, err := newDefPoolFromXML(poolDefXML)
+	if err != nil {
+		return libvirtxml.StoragePool{}, fmt.Errorf("could not get a pool definition from XML for %s: %s", name, err)
+	}
+	return poolDef, nil
+}
+
+// poolTypeSupportsBuild returns whether libvirt has a build (and delete)
+// backend for the given pool type
+func poolTypeSupportsBuild(poolType string) bool {
+	switch poolType {
+	case poolTypeDir, poolTypeFs, poolTypeNetFs, poolTypeLogical:
+		return true
+	}
+	return false
+}
+
+// validatePoolDef checks that the pool definition has all the elements
+// required by its type before sending it to libvirt
+func validatePoolDef(poolDef libvirtxml.StoragePool) error {
+	hasPath := poolDef.Target != nil && poolDef.Target.Path != ""
+	source := poolDef.Source
+	if source == nil {
+		source = &libvirtxml.StoragePoolSource{}
+	}
+
+	switch poolDef.Type {
+	case poolTypeDir:
+		if !hasPath {
+			return fmt.Errorf("'path' must be provided for pools of type '%s'", poolDef.Type)
+		}
+	case poolTypeFs:
+		if !hasPath || len(source.Device) == 0 {
+			return fmt.Errorf("'path' and 'source.device' must be provided for pools of type '%s'", poolDef.Type)
+		}
+	case poolTypeNetFs:
+		if !hasPath || len(source.Host) == 0 || source.Dir == nil {
+			return fmt.Errorf("'path', 'source.host' and 'source.dir' must be provided for pools of type '%s'", poolDef.Type)
+		}
+	case poolTypeLogical:
+		if source.Name == "" && len(source.Device) == 0 {
+			return fmt.Errorf("'source.name' or 'source.device' must be provided for pools of type '%s'", poolDef.Type)
+		}
+	case poolTypeIscsi:
+		if len(source.Host) == 0 || len(source.Device) != 1 {
+			return fmt.Errorf("'source.host' and exactly one 'source.device' (the target IQN) must be provided for pools of type '%s'", poolDef.Type)
+		}
+	default:
+		return fmt.Errorf("unsupported pool type '%s'", poolDef.Type)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package libvirt
+
+import (
+	"testing"
+
+	"github.com/libvirt/libvirt-go-xml"
+)
+
+func TestPoolUnmarshal(t *testing.T) {
+	xmlDesc := `
+	<pool type='dir'>
+	  <name>default</name>
+	  <uuid>4d7c2a6a-0d2b-4a8d-8a0b-3c3c0c9bd9c1</uuid>
+	  <capacity unit='bytes'>105087164416</capacity>
+	  <allocation unit='bytes'>38541623296</allocation>
+	  <available unit='bytes'>66545541120</available>
+	  <source>
+	  </source>
+	  <target>
+	    <path>/var/lib/libvirt/images</path>
+	    <permissions>
+	      <mode>0711</mode>
+	      <owner>0</owner>
+	      <group>0</group>
+	    </permissions>
+	  </target>
+	</pool>
+	`
+
+	poolDef, err := newDefPoolFromXML(xmlDesc)
+	if err != nil {
+		t.Fatalf("could not unmarshall pool definition:\n%s", err)
+	}
+	if poolDef.Target == nil || poolDef.Target.Path != "/var/lib/libvirt/images" {
+		t.Errorf("unexpected pool target: %v", poolDef.Target)
+	}
+	if poolDef.Capacity == nil || poolDef.Capacity.Value != 105087164416 {
+		t.Errorf("unexpected pool capacity: %v", poolDef.Capacity)
+	}
+}
+
+func TestValidatePoolDef(t *testing.T) {
+	valid := []libvirtxml.StoragePool{
+		{
+			Type:   poolTypeDir,
+			Target: &libvirtxml.StoragePoolTarget{Path: "/tmp/pool"},
+		},
+		{
+			Type:   poolTypeNetFs,
+			Target: &libvirtxml.StoragePoolTarget{Path: "/mnt/pool"},
+			Source: &libvirtxml.StoragePoolSource{
+				Host: []libvirtxml.StoragePoolSourceHost{{Name: "nfs.example.com"}},
+				Dir:  &libvirtxml.StoragePoolSourceDir{Path: "/exports/pool"},
+			},
+		},
+		{
+			Type:   poolTypeLogical,
+			Source: &libvirtxml.StoragePoolSource{Name: "vg0"},
+		},
+		{
+			Type: poolTypeIscsi,
+			Source: &libvirtxml.StoragePoolSource{
+				Host:   []libvirtxml.StoragePoolSourceHost{{Name: "iscsi.example.com"}},
+				Device: []libvirtxml.StoragePoolSourceDevice{{Path: "iqn.2013-06.com.example:iscsi-pool"}},
+			},
+		},
+	}
+	for _, poolDef := range valid {
+		if err := validatePoolDef(poolDef); err != nil {
+			t.Errorf("unexpected error for pool of type '%s': %s", poolDef.Type, err)
+		}
+	}
+
+	invalid := []libvirtxml.StoragePool{
+		{Type: poolTypeDir},
+		{
+			Type:   poolTypeNetFs,
+			Target: &libvirtxml.StoragePoolTarget{Path: "/mnt/pool"},
+		},
+		{Type: poolTypeLogical},
+		{Type: poolTypeIscsi},
+		{Type: "zfs"},
+	}
+	for _, poolDef := range invalid {
+		if err := validatePoolDef(poolDef); err == nil {
+			t.Errorf("expected an error for pool of type '%s'", poolDef.Type)
+		}
+	}
+}
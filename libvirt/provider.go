@@ -1,7 +1,10 @@
 package libvirt
 
 import (
+	"fmt"
 	"log"
+	"os"
+	"time"
 
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
@@ -13,21 +16,66 @@ func Provider() terraform.ResourceProvider {
 		Schema: map[string]*schema.Schema{
 			"uri": {
 				Type:        schema.TypeString,
-				Required:    true,
-				DefaultFunc: schema.EnvDefaultFunc("LIBVIRT_DEFAULT_URI", nil),
+				Optional:    true,
 				Description: "libvirt connection URI for operations. See https://libvirt.org/uri.html",
 			},
+			"host": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "host to connect to over SSH, when 'uri' is not given",
+			},
+			"user": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "user to log in as on the SSH host",
+			},
+			"port": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "port of the SSH server",
+			},
+			"keyfile": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "private key used to authenticate to the SSH host",
+			},
+			"known_hosts_verify": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "host key verification: 'normal' or 'ignore'",
+			},
+			"socket": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "path of the libvirt socket on the SSH host",
+			},
+			"timeout": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "how long to wait for the connection to libvirt (eg. '30s')",
+			},
 		},
 
 		ResourcesMap: map[string]*schema.Resource{
-			"libvirt_domain":         resourceLibvirtDomain(),
-			"libvirt_volume":         resourceLibvirtVolume(),
-			"libvirt_network":        resourceLibvirtNetwork(),
-			"libvirt_cloudinit_disk": resourceCloudInitDisk(),
-			"libvirt_ignition":       resourceIgnition(),
+			"libvirt_domain":               resourceLibvirtDomain(),
+			"libvirt_domain_snapshot":      resourceLibvirtDomainSnapshot(),
+			"libvirt_volume":               resourceLibvirtVolume(),
+			"libvirt_network":              resourceLibvirtNetwork(),
+			"libvirt_network_dhcp_host":    resourceLibvirtNetworkDHCPHost(),
+			"libvirt_network_port_forward": resourceLibvirtNetworkPortForward(),
+			"libvirt_nwfilter":             resourceLibvirtNWFilter(),
+			"libvirt_pool":                 resourceLibvirtPool(),
+			"libvirt_cloudinit_disk":       resourceCloudInitDisk(),
+			"libvirt_ignition":             resourceIgnition(),
 		},
 
 		DataSourcesMap: map[string]*schema.Resource{
+			"libvirt_domain":                    datasourceLibvirtDomain(),
+			"libvirt_domain_xml":                datasourceLibvirtDomainXML(),
+			"libvirt_network":                   datasourceLibvirtNetwork(),
+			"libvirt_network_dhcp_leases":       datasourceLibvirtNetworkDHCPLeases(),
+			"libvirt_pool":                      datasourceLibvirtPool(),
+			"libvirt_volume":                    datasourceLibvirtVolume(),
 			"libvirt_network_dns_host_template": datasourceLibvirtNetworkDNSHostTemplate(),
 			"libvirt_network_dns_srv_template":  datasourceLibvirtNetworkDNSSRVTemplate(),
 		},
@@ -59,12 +107,37 @@ func CleanupLibvirtConnections() {
 
 func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 	config := Config{
-		URI: d.Get("uri").(string),
+		URI:              d.Get("uri").(string),
+		Host:             d.Get("host").(string),
+		User:             d.Get("user").(string),
+		Port:             d.Get("port").(int),
+		KeyFile:          d.Get("keyfile").(string),
+		KnownHostsVerify: d.Get("known_hosts_verify").(string),
+		Socket:           d.Get("socket").(string),
+	}
+
+	// the environment is only used when the connection is not configured
+	if config.URI == "" && config.Host == "" {
+		config.URI = os.Getenv("LIBVIRT_DEFAULT_URI")
 	}
-	log.Printf("[DEBUG] Configuring provider for '%s': %v", config.URI, d)
 
-	if client, ok := globalClientMap[config.URI]; ok {
-		log.Printf("[DEBUG] Reusing client for uri: '%s'", config.URI)
+	if timeout, ok := d.GetOk("timeout"); ok {
+		duration, err := time.ParseDuration(timeout.(string))
+		if err != nil {
+			return nil, fmt.Errorf("'timeout' must be a duration like '30s' or '2m': %s", err)
+		}
+		config.Timeout = duration
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	uri := config.ConnectionURI()
+	log.Printf("[DEBUG] Configuring provider for '%s': %v", uri, d)
+
+	if client, ok := globalClientMap[uri]; ok {
+		log.Printf("[DEBUG] Reusing client for uri: '%s'", uri)
 		return client, nil
 	}
 
@@ -72,7 +145,7 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
-	globalClientMap[config.URI] = client
+	globalClientMap[uri] = client
 
 	return client, nil
 }
@@ -25,6 +25,12 @@ func resourceCloudInitDisk() *schema.Resource {
 				Default:  "default",
 				ForceNew: true,
 			},
+			"datasource": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  cloudInitDataSourceNoCloud,
+				ForceNew: true,
+			},
 			"user_data": {
 				Type:     schema.TypeString,
 				Optional: true,
@@ -40,6 +46,11 @@ func resourceCloudInitDisk() *schema.Resource {
 				Optional: true,
 				ForceNew: true,
 			},
+			"vendor_data": {
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+			},
 		},
 	}
 }
@@ -53,9 +64,11 @@ func resourceCloudInitDiskCreate(d *schema.ResourceData, meta interface{}) error
 	}
 
 	cloudInit := newCloudInitDef()
+	cloudInit.DataSource = d.Get("datasource").(string)
 	cloudInit.UserData = d.Get("user_data").(string)
 	cloudInit.MetaData = d.Get("meta_data").(string)
 	cloudInit.NetworkConfig = d.Get("network_config").(string)
+	cloudInit.VendorData = d.Get("vendor_data").(string)
 	cloudInit.Name = d.Get("name").(string)
 	cloudInit.PoolName = d.Get("pool").(string)
 
@@ -92,9 +105,11 @@ func resourceCloudInitDiskRead(d *schema.ResourceData, meta interface{}) error {
 	}
 	d.Set("pool", ci.PoolName)
 	d.Set("name", ci.Name)
+	d.Set("datasource", ci.DataSource)
 	d.Set("user_data", ci.UserData)
 	d.Set("meta_data", ci.MetaData)
 	d.Set("network_config", ci.NetworkConfig)
+	d.Set("vendor_data", ci.VendorData)
 	return nil
 }
 
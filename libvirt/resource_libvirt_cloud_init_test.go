@@ -91,6 +91,42 @@ func TestAccLibvirtCloudInit_CreateCloudInitDiskAndUpdate(t *testing.T) {
 	})
 }
 
+func TestAccLibvirtCloudInit_ConfigDrive(t *testing.T) {
+	var volume libvirt.StorageVol
+	randomResourceName := acctest.RandString(10)
+	randomIsoName := acctest.RandString(10) + ".iso"
+	expectedContents := Expected{
+		UserData:   "#cloud-config",
+		MetaData:   `{"uuid": "bamboo"}`,
+		VendorData: "#cloud-config\npackages: [vim]",
+	}
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		CheckDestroy: func(s *terraform.State) error {
+			return nil
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+					resource "libvirt_cloudinit_disk" "%s" {
+						name        = "%s"
+						datasource  = "configdrive"
+						user_data   = "#cloud-config"
+						meta_data   = "{\"uuid\": \"bamboo\"}"
+						vendor_data = "#cloud-config\npackages: [vim]"
+					}`, randomResourceName, randomIsoName),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(
+						"libvirt_cloudinit_disk."+randomResourceName, "datasource", "configdrive"),
+					testAccCheckCloudInitVolumeExists("libvirt_cloudinit_disk."+randomResourceName, &volume),
+					expectedContents.testAccCheckCloudInitDiskFilesContent("libvirt_cloudinit_disk."+randomResourceName, &volume),
+				),
+			},
+		},
+	})
+}
+
 // The destroy function should always handle the case where the resource might already be destroyed
 // (manually, for example). If the resource is already destroyed, this should not return an error.
 // This allows Terraform users to manually delete resources without breaking Terraform.
@@ -169,7 +205,7 @@ func testAccCheckCloudInitVolumeExists(volumeName string, volume *libvirt.Storag
 
 // this is helper method for test expected values
 type Expected struct {
-	UserData, NetworkConfig, MetaData string
+	UserData, NetworkConfig, MetaData, VendorData string
 }
 
 func (expected *Expected) testAccCheckCloudInitDiskFilesContent(volumeName string, volume *libvirt.StorageVol) resource.TestCheckFunc {
@@ -192,6 +228,9 @@ func (expected *Expected) testAccCheckCloudInitDiskFilesContent(volumeName strin
 		if cloudInitDiskDef.NetworkConfig != expected.NetworkConfig {
 			return fmt.Errorf("networkconfig '%s' content differs from expected NetworkConfigData %s", cloudInitDiskDef.NetworkConfig, expected.NetworkConfig)
 		}
+		if cloudInitDiskDef.VendorData != expected.VendorData {
+			return fmt.Errorf("vendordata '%s' content differs from expected VendorData %s", cloudInitDiskDef.VendorData, expected.VendorData)
+		}
 		return nil
 	}
 }
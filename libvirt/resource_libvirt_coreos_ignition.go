@@ -25,9 +25,24 @@ func resourceIgnition() *schema.Resource {
 				ForceNew: true,
 			},
 			"content": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateIgnitionContent,
+			},
+			"spec_version": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validateIgnitionSpecVersion,
+			},
+			"delivery": {
 				Type:     schema.TypeString,
-				Required: true,
+				Optional: true,
+				Computed: true,
 				ForceNew: true,
+				ValidateFunc: validateStringInSlice([]string{
+					ignitionDeliveryFwCfg, ignitionDeliveryConfigDrive, ignitionDeliveryVirtio, ignitionDeliveryAuto}),
 			},
 		},
 	}
@@ -45,6 +60,10 @@ func resourceIgnitionCreate(d *schema.ResourceData, meta interface{}) error {
 	ignition.Name = d.Get("name").(string)
 	ignition.PoolName = d.Get("pool").(string)
 	ignition.Content = d.Get("content").(string)
+	ignition.SpecVersion = d.Get("spec_version").(string)
+
+	// when not given, the domains choose the delivery from their architecture
+	ignition.Delivery = d.Get("delivery").(string)
 
 	log.Printf("[INFO] ignition: %+v", ignition)
 
@@ -73,6 +92,7 @@ func resourceIgnitionRead(d *schema.ResourceData, meta interface{}) error {
 	ign, err := newIgnitionDefFromRemoteVol(virConn, d.Id())
 	d.Set("pool", ign.PoolName)
 	d.Set("name", ign.Name)
+	d.Set("delivery", ign.Delivery)
 
 	if err != nil {
 		return fmt.Errorf("Error while retrieving remote volume: %s", err)
@@ -51,6 +51,34 @@ func TestAccLibvirtIgnition_Basic(t *testing.T) {
 	})
 }
 
+func TestAccLibvirtIgnition_ConfigDrive(t *testing.T) {
+	var volume libvirt.StorageVol
+	randomIgnitionName := acctest.RandString(9)
+	var config = fmt.Sprintf(`
+	resource "libvirt_ignition" "ignition" {
+		name     = "%s"
+		content  = "{\"ignition\": {\"version\": \"2.2.0\"}}"
+		delivery = "configdrive"
+	}
+	`, randomIgnitionName)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtIgnitionDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckIgnitionVolumeExists("libvirt_ignition.ignition", &volume),
+					resource.TestCheckResourceAttr(
+						"libvirt_ignition.ignition", "delivery", "configdrive"),
+				),
+			},
+		},
+	})
+}
+
 func testAccCheckIgnitionVolumeExists(name string, volume *libvirt.StorageVol) resource.TestCheckFunc {
 	return func(state *terraform.State) error {
 		virConn := testAccProvider.Meta().(*Client).libvirt
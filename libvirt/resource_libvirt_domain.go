@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net"
-	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -27,16 +27,19 @@ func init() {
 
 func resourceLibvirtDomain() *schema.Resource {
 	return &schema.Resource{
-		Create: resourceLibvirtDomainCreate,
-		Read:   resourceLibvirtDomainRead,
-		Delete: resourceLibvirtDomainDelete,
-		Update: resourceLibvirtDomainUpdate,
-		Exists: resourceLibvirtDomainExists,
+		Create:        resourceLibvirtDomainCreate,
+		Read:          resourceLibvirtDomainRead,
+		Delete:        resourceLibvirtDomainDelete,
+		Update:        resourceLibvirtDomainUpdate,
+		Exists:        resourceLibvirtDomainExists,
+		CustomizeDiff: resourceLibvirtDomainCustomizeDiff,
 		Importer: &schema.ResourceImporter{
 			State: schema.ImportStatePassthrough,
 		},
 		Timeouts: &schema.ResourceTimeout{
 			Create: schema.DefaultTimeout(5 * time.Minute),
+			Update: schema.DefaultTimeout(5 * time.Minute),
+			Delete: schema.DefaultTimeout(5 * time.Minute),
 		},
 		Schema: map[string]*schema.Schema{
 			"name": {
@@ -53,13 +56,23 @@ func resourceLibvirtDomain() *schema.Resource {
 				Type:     schema.TypeInt,
 				Optional: true,
 				Default:  1,
-				ForceNew: true,
+				ForceNew: false,
+			},
+			"maxvcpu": {
+				Type:     schema.TypeInt,
+				Optional: true,
+				ForceNew: false,
 			},
 			"memory": {
 				Type:     schema.TypeInt,
 				Optional: true,
 				Default:  512,
-				ForceNew: true,
+				ForceNew: false,
+			},
+			"maxmemory": {
+				Type:     schema.TypeInt,
+				Optional: true,
+				ForceNew: false,
 			},
 			"firmware": {
 				Type:     schema.TypeString,
@@ -69,6 +82,7 @@ func resourceLibvirtDomain() *schema.Resource {
 			"nvram": {
 				Type:     schema.TypeList,
 				Optional: true,
+				Computed: true,
 				ForceNew: true,
 				MaxItems: 1,
 				Elem: &schema.Resource{
@@ -81,6 +95,7 @@ func resourceLibvirtDomain() *schema.Resource {
 						"template": {
 							Type:     schema.TypeString,
 							Optional: true,
+							Computed: true,
 							ForceNew: true,
 						},
 					},
@@ -93,6 +108,29 @@ func resourceLibvirtDomain() *schema.Resource {
 				ForceNew: false,
 				Required: false,
 			},
+			"shutdown": {
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"methods": {
+							Type:     schema.TypeList,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: validateStringInSlice([]string{domainShutdownACPI, domainShutdownAgent}),
+							},
+						},
+						"timeout": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      defaultDomainShutdownTimeout.String(),
+							ValidateFunc: validateDomainShutdownTimeout,
+						},
+					},
+				},
+			},
 			"cloudinit": {
 				Type:     schema.TypeString,
 				Optional: true,
@@ -134,7 +172,7 @@ func resourceLibvirtDomain() *schema.Resource {
 			"disk": {
 				Type:     schema.TypeList,
 				Optional: true,
-				ForceNew: true,
+				ForceNew: false,
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"volume_id": {
@@ -157,6 +195,7 @@ func resourceLibvirtDomain() *schema.Resource {
 						"wwn": {
 							Type:     schema.TypeString,
 							Optional: true,
+							Computed: true,
 						},
 					},
 				},
@@ -192,6 +231,12 @@ func resourceLibvirtDomain() *schema.Resource {
 							Type:     schema.TypeString,
 							Optional: true,
 						},
+						"user": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateStringInSlice(domainInterfaceUserBackends),
+						},
+						"port_forward": domainInterfacePortForwardSchema(),
 						"hostname": {
 							Type:     schema.TypeString,
 							Optional: true,
@@ -214,12 +259,47 @@ func resourceLibvirtDomain() *schema.Resource {
 								Type: schema.TypeString,
 							},
 						},
+						"filterref": {
+							Type:     schema.TypeList,
+							Optional: true,
+							MaxItems: 1,
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"filter": {
+										Type:     schema.TypeString,
+										Required: true,
+									},
+									"parameters": {
+										Type:     schema.TypeMap,
+										Optional: true,
+										Elem: &schema.Schema{
+											Type: schema.TypeString,
+										},
+									},
+								},
+							},
+						},
+						"bandwidth": bandwidthSchema(true),
+						"model": {
+							Type:             schema.TypeString,
+							Optional:         true,
+							Default:          defaultDomainInterfaceModel,
+							ValidateFunc:     validateDomainInterfaceModel,
+							DiffSuppressFunc: suppressDomainInterfaceModelDiff,
+						},
+						"driver": domainInterfaceDriverSchema(),
+						"mtu": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							ValidateFunc: validateDomainInterfaceMTU,
+						},
 					},
 				},
 			},
 			"graphics": {
 				Type:     schema.TypeList,
 				Optional: true,
+				Computed: true,
 				MaxItems: 1,
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
@@ -249,6 +329,7 @@ func resourceLibvirtDomain() *schema.Resource {
 			"video": {
 				Type:     schema.TypeList,
 				Optional: true,
+				Computed: true,
 				MaxItems: 1,
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
@@ -283,6 +364,7 @@ func resourceLibvirtDomain() *schema.Resource {
 						"target_type": {
 							Type:     schema.TypeString,
 							Optional: true,
+							Computed: true,
 							ForceNew: true,
 						},
 					},
@@ -372,13 +454,19 @@ func resourceLibvirtDomain() *schema.Resource {
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"xslt": {
-							Type:     schema.TypeString,
-							Optional: true,
-							ForceNew: true,
+							Type:         schema.TypeString,
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateXSLT,
 						},
+						"patch": xmlPatchSchema(),
 					},
 				},
 			},
+			"rendered_xml": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
 		},
 	}
 }
@@ -403,18 +491,19 @@ func resourceLibvirtDomainExists(d *schema.ResourceData, meta interface{}) (bool
 	return true, nil
 }
 
-func resourceLibvirtDomainCreate(d *schema.ResourceData, meta interface{}) error {
-	log.Printf("[DEBUG] Create resource libvirt_domain")
-
-	virConn := meta.(*Client).libvirt
-	if virConn == nil {
-		return fmt.Errorf(LibVirtConIsNil)
-	}
-
+// newDomainDefFromResource builds the definition of the domain described by
+// the resource. The DHCP host tables of the networks the domain is connected
+// to are only updated when partialNetIfaces is not nil, so the definition can
+// be rendered without changing anything.
+func newDomainDefFromResource(d *schema.ResourceData, virConn *libvirt.Connect,
+	partialNetIfaces map[string]*pendingMapping, waitForLeases *[]*libvirtxml.DomainInterface) (libvirtxml.Domain, error) {
 	domainDef, err := newDomainDefForConnection(virConn, d)
 	if err != nil {
-		return err
+		return domainDef, err
 	}
+	// the architecture and machine type of the domain, with the defaults of
+	// the host when they are not given
+	guestArch, guestMachine := domainDef.OS.Type.Arch, domainDef.OS.Type.Machine
 
 	if name, ok := d.GetOk("name"); ok {
 		domainDef.Name = name.(string)
@@ -426,12 +515,12 @@ func resourceLibvirtDomainCreate(d *schema.ResourceData, meta interface{}) error
 		}
 	}
 
-	domainDef.Memory = &libvirtxml.DomainMemory{
-		Value: uint(d.Get("memory").(int)),
-		Unit:  "MiB",
+	if err := setVCPUs(d, &domainDef); err != nil {
+		return domainDef, err
 	}
-	domainDef.VCPU = &libvirtxml.DomainVCPU{
-		Value: d.Get("vcpu").(int),
+
+	if err := setMemory(d, &domainDef); err != nil {
+		return domainDef, err
 	}
 
 	domainDef.OS.Kernel = d.Get("kernel").(string)
@@ -442,11 +531,11 @@ func resourceLibvirtDomainCreate(d *schema.ResourceData, meta interface{}) error
 
 	arch, err := getHostArchitecture(virConn)
 	if err != nil {
-		return fmt.Errorf("Error retrieving host architecture: %s", err)
+		return domainDef, fmt.Errorf("Error retrieving host architecture: %s", err)
 	}
 
 	if err := setGraphics(d, &domainDef, arch); err != nil {
-		return err
+		return domainDef, err
 	}
 
 	setVideo(d, &domainDef)
@@ -455,26 +544,123 @@ func resourceLibvirtDomainCreate(d *schema.ResourceData, meta interface{}) error
 	setFirmware(d, &domainDef)
 	setBootDevices(d, &domainDef)
 
-	if err := setCoreOSIgnition(d, &domainDef); err != nil {
-		return err
+	if err := setCoreOSIgnition(d, &domainDef, virConn, guestArch, guestMachine); err != nil {
+		return domainDef, err
 	}
 
 	if err := setDisks(d, &domainDef, virConn); err != nil {
-		return err
+		return domainDef, err
 	}
 
 	if err := setFilesystems(d, &domainDef); err != nil {
-		return err
+		return domainDef, err
 	}
 
 	if err := setCloudinit(d, &domainDef, virConn); err != nil {
+		return domainDef, err
+	}
+
+	if err := setNetworkInterfaces(d, &domainDef, virConn, partialNetIfaces, waitForLeases); err != nil {
+		return domainDef, err
+	}
+
+	if err := checkDomainInterfacesCapabilities(virConn, &domainDef); err != nil {
+		return domainDef, err
+	}
+
+	return domainDef, nil
+}
+
+// renderDomainXML returns the XML definition of a domain, as transformed by
+// the xml block of the resource
+func renderDomainXML(d *schema.ResourceData, domainDef libvirtxml.Domain) (string, error) {
+	data, err := xmlMarshallIndented(domainDef)
+	if err != nil {
+		return "", fmt.Errorf("Error serializing libvirt domain: %s", err)
+	}
+	log.Printf("[DEBUG] Generated XML for libvirt domain:\n%s", data)
+
+	userPatches, err := getDomainInterfacesUserPatches(d)
+	if err != nil {
+		return "", err
+	}
+	data, err = patchXML(data, userPatches)
+	if err != nil {
+		return "", fmt.Errorf("Error adding the user mode network interfaces: %s", err)
+	}
+
+	data, err = transformResourceXML(data, d)
+	if err != nil {
+		return "", fmt.Errorf("Error transforming the XML definition: %s", err)
+	}
+	return data, nil
+}
+
+// resourceLibvirtDomainCustomizeDiff checks the arguments which depend on each
+// other and renders in the plan the XML definition of the domain, the same way
+// it is rendered when applying the plan
+func resourceLibvirtDomainCustomizeDiff(diff *schema.ResourceDiff, meta interface{}) error {
+	if err := checkDomainUserInterfacesAgent(diff); err != nil {
 		return err
 	}
 
+	r := resourceLibvirtDomain()
+	if diff.Id() != "" && !resourceDiffHasChanges(r, diff, "rendered_xml") {
+		return nil
+	}
+
+	data, ok := planDomainXML(r, diff, meta)
+	if !ok {
+		return diff.SetNewComputed("rendered_xml")
+	}
+	return diff.SetNew("rendered_xml", data)
+}
+
+// planDomainXML returns the XML definition of the domain planned by a diff.
+// It returns false when it can't be known before applying the plan, eg when
+// the domain uses volumes to be created or random MAC addresses.
+func planDomainXML(r *schema.Resource, diff *schema.ResourceDiff, meta interface{}) (string, bool) {
+	client, ok := meta.(*Client)
+	if !ok || client.libvirt == nil {
+		return "", false
+	}
+	for i := 0; i < diff.Get("network_interface.#").(int); i++ {
+		if diff.Get(fmt.Sprintf("network_interface.%d.mac", i)).(string) == "" {
+			return "", false
+		}
+	}
+	d, ok := resourceDataFromDiff(r, diff)
+	if !ok {
+		return "", false
+	}
+
+	var waitForLeases []*libvirtxml.DomainInterface
+	domainDef, err := newDomainDefFromResource(d, client.libvirt, nil, &waitForLeases)
+	if err != nil {
+		log.Printf("[DEBUG] Can't render the XML definition of the domain in the plan: %s", err)
+		return "", false
+	}
+	data, err := renderDomainXML(d, domainDef)
+	if err != nil {
+		log.Printf("[DEBUG] Can't render the XML definition of the domain in the plan: %s", err)
+		return "", false
+	}
+	return data, true
+}
+
+func resourceLibvirtDomainCreate(d *schema.ResourceData, meta interface{}) error {
+	log.Printf("[DEBUG] Create resource libvirt_domain")
+
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
 	var waitForLeases []*libvirtxml.DomainInterface
 	partialNetIfaces := make(map[string]*pendingMapping, d.Get("network_interface.#").(int))
 
-	if err := setNetworkInterfaces(d, &domainDef, virConn, partialNetIfaces, &waitForLeases); err != nil {
+	domainDef, err := newDomainDefFromResource(d, virConn, partialNetIfaces, &waitForLeases)
+	if err != nil {
 		return err
 	}
 
@@ -484,15 +670,9 @@ func resourceLibvirtDomainCreate(d *schema.ResourceData, meta interface{}) error
 	}
 	log.Printf("[INFO] Creating libvirt domain at %s", connectURI)
 
-	data, err := xmlMarshallIndented(domainDef)
-	if err != nil {
-		return fmt.Errorf("Error serializing libvirt domain: %s", err)
-	}
-	log.Printf("[DEBUG] Generated XML for libvirt domain:\n%s", data)
-
-	data, err = transformResourceXML(data, d)
+	data, err := renderDomainXML(d, domainDef)
 	if err != nil {
-		return fmt.Errorf("Error applying XSLT stylesheet: %s", err)
+		return err
 	}
 
 	domain, err := virConn.DomainDefineXML(data)
@@ -525,6 +705,7 @@ func resourceLibvirtDomainCreate(d *schema.ResourceData, meta interface{}) error
 	d.Set("id", id)
 	d.SetPartial("id")
 	d.Partial(false)
+	d.Set("rendered_xml", data)
 
 	log.Printf("[INFO] Domain ID: %s", d.Id())
 
@@ -572,8 +753,7 @@ func resourceLibvirtDomainCreate(d *schema.ResourceData, meta interface{}) error
 		}
 	}
 
-	destroyDomainByUserRequest(d, domain)
-	return nil
+	return destroyDomainByUserRequest(d, domain, d.Timeout(schema.TimeoutCreate))
 }
 
 func resourceLibvirtDomainUpdate(d *schema.ResourceData, meta interface{}) error {
@@ -635,6 +815,76 @@ func resourceLibvirtDomainUpdate(d *schema.ResourceData, meta interface{}) error
 		d.SetPartial("autostart")
 	}
 
+	// changes that can't be applied to the running domain are written to
+	// its persistent configuration, and the domain is restarted at the end
+	restartRequired := false
+
+	if d.HasChange("vcpu") || d.HasChange("maxvcpu") {
+		restart, err := updateDomainVCPUs(d, domain)
+		if err != nil {
+			return err
+		}
+		restartRequired = restartRequired || restart
+		d.SetPartial("vcpu")
+		d.SetPartial("maxvcpu")
+	}
+
+	if d.HasChange("memory") || d.HasChange("maxmemory") {
+		restart, err := updateDomainMemory(d, domain)
+		if err != nil {
+			return err
+		}
+		restartRequired = restartRequired || restart
+		d.SetPartial("memory")
+		d.SetPartial("maxmemory")
+	}
+
+	if d.HasChange("disk") {
+		restart, err := updateDomainDisks(d, domain, virConn)
+		if err != nil {
+			return err
+		}
+		restartRequired = restartRequired || restart
+		d.SetPartial("disk")
+	}
+
+	var waitForLeases []*libvirtxml.DomainInterface
+	partialNetIfaces := make(map[string]*pendingMapping)
+	if d.HasChange("network_interface") {
+		restart, err := updateDomainNetworkInterfaces(d, domain, virConn, partialNetIfaces, &waitForLeases)
+		if err != nil {
+			return err
+		}
+		restartRequired = restartRequired || restart
+	}
+
+	if d.HasChange("graphics") || d.HasChange("video") {
+		restart, err := updateDomainGraphicsAndVideo(d, domain, virConn)
+		if err != nil {
+			return err
+		}
+		restartRequired = restartRequired || restart
+		d.SetPartial("graphics")
+		d.SetPartial("video")
+	}
+
+	if restartRequired {
+		log.Printf("[INFO] Restarting domain %s to apply changes to its persistent configuration", d.Id())
+		if err := domainRestart(d, domain, d.Timeout(schema.TimeoutUpdate)); err != nil {
+			return err
+		}
+	}
+
+	// the hot-plugged network interfaces get their leases as in a new domain
+	if len(waitForLeases) > 0 {
+		if err := domainWaitForLeases(domain, waitForLeases, d.Timeout(schema.TimeoutUpdate), d); err != nil {
+			return fmt.Errorf("Error waiting for the leases of the new network interfaces: %s", err)
+		}
+	}
+	if err := addDomainPendingHosts(d, domain, partialNetIfaces); err != nil {
+		return err
+	}
+
 	netIfacesCount := d.Get("network_interface.#").(int)
 	for i := 0; i < netIfacesCount; i++ {
 		prefix := fmt.Sprintf("network_interface.%d", i)
@@ -670,9 +920,20 @@ func resourceLibvirtDomainUpdate(d *schema.ResourceData, meta interface{}) error
 		}
 	}
 
+	// the definition rendered in the plan
+	domainDef, err := newDomainDefFromResource(d, virConn, nil, &[]*libvirtxml.DomainInterface{})
+	if err != nil {
+		return err
+	}
+	data, err := renderDomainXML(d, domainDef)
+	if err != nil {
+		return err
+	}
+	d.Set("rendered_xml", data)
+
 	d.Partial(false)
 
-	return nil
+	return destroyDomainByUserRequest(d, domain, d.Timeout(schema.TimeoutUpdate))
 }
 
 func resourceLibvirtDomainRead(d *schema.ResourceData, meta interface{}) error {
@@ -696,11 +957,8 @@ func resourceLibvirtDomainRead(d *schema.ResourceData, meta interface{}) error {
 
 	log.Printf("[DEBUG] read: obtained XML desc for domain:\n%s", xmlDesc)
 
-	domainDef, err := newDomainDefForConnection(virConn, d)
-	if err != nil {
-		return err
-	}
-
+	// the defaults of newDomainDef would be mixed with the devices read
+	var domainDef libvirtxml.Domain
 	err = xml.Unmarshal([]byte(xmlDesc), &domainDef)
 	if err != nil {
 		return fmt.Errorf("Error reading libvirt domain XML description: %s", err)
@@ -712,14 +970,55 @@ func resourceLibvirtDomainRead(d *schema.ResourceData, meta interface{}) error {
 	}
 
 	d.Set("name", domainDef.Name)
-	d.Set("vcpu", domainDef.VCPU)
-	d.Set("memory", domainDef.Memory)
-	d.Set("firmware", domainDef.OS.Loader)
-	d.Set("nvram", domainDef.OS.NVRam)
-	d.Set("cpu", domainDef.CPU)
+
+	vcpu := domainDef.VCPU.Value
+	if domainDef.VCPU.Current != "" {
+		if vcpu, err = strconv.Atoi(domainDef.VCPU.Current); err != nil {
+			return fmt.Errorf("Error parsing current vcpus '%s': %s", domainDef.VCPU.Current, err)
+		}
+	}
+	d.Set("vcpu", vcpu)
+	// only track the maximum when the user asked for some headroom
+	if _, ok := d.GetOk("maxvcpu"); ok {
+		d.Set("maxvcpu", domainDef.VCPU.Value)
+	}
+
+	memory := domainMemoryToMiB(domainDef.Memory.Value, domainDef.Memory.Unit)
+	if domainDef.CurrentMemory != nil {
+		memory = domainMemoryToMiB(domainDef.CurrentMemory.Value, domainDef.CurrentMemory.Unit)
+	}
+	d.Set("memory", memory)
+	if _, ok := d.GetOk("maxmemory"); ok {
+		d.Set("maxmemory", domainMemoryToMiB(domainDef.Memory.Value, domainDef.Memory.Unit))
+	}
+
+	firmware := ""
+	if domainDef.OS.Loader != nil {
+		firmware = domainDef.OS.Loader.Path
+	}
+	d.Set("firmware", firmware)
+	d.Set("nvram", flattenDomainNVRam(domainDef.OS.NVRam))
 	d.Set("arch", domainDef.OS.Type.Arch)
 	d.Set("autostart", autostart)
 
+	// libvirt expands the CPU model of the running domain, so the mode is
+	// read from its persistent configuration, and only when it was given
+	if _, ok := d.GetOk("cpu.mode"); ok {
+		inactiveXMLDesc, err := domain.GetXMLDesc(libvirt.DOMAIN_XML_INACTIVE)
+		if err != nil {
+			return fmt.Errorf("Error retrieving libvirt domain XML description: %s", err)
+		}
+		var inactiveDef libvirtxml.Domain
+		if err := xml.Unmarshal([]byte(inactiveXMLDesc), &inactiveDef); err != nil {
+			return fmt.Errorf("Error reading libvirt domain XML description: %s", err)
+		}
+		cpu := map[string]interface{}{}
+		if inactiveDef.CPU != nil && inactiveDef.CPU.Mode != "" {
+			cpu["mode"] = inactiveDef.CPU.Mode
+		}
+		d.Set("cpu", cpu)
+	}
+
 	cmdLines, err := splitKernelCmdLine(domainDef.OS.Cmdline)
 	if err != nil {
 		return err
@@ -727,6 +1026,7 @@ func resourceLibvirtDomainRead(d *schema.ResourceData, meta interface{}) error {
 	d.Set("cmdline", cmdLines)
 	d.Set("kernel", domainDef.OS.Kernel)
 	d.Set("initrd", domainDef.OS.Initrd)
+	d.Set("boot_device", flattenDomainBootDevices(d, domainDef.OS.BootDevices))
 
 	caps, err := getHostCapabilities(virConn)
 	if err != nil {
@@ -742,86 +1042,77 @@ func resourceLibvirtDomainRead(d *schema.ResourceData, meta interface{}) error {
 	// Emulator is the same as the default don't set it in domainDef
 	// or it will show as changed
 	d.Set("emulator", domainDef.Devices.Emulator)
-	var (
-		disks []map[string]interface{}
-		disk  map[string]interface{}
-	)
-	for _, diskDef := range domainDef.Devices.Disks {
-		// network drives do not have a volume associated
-		if diskDef.Source.Network != nil {
-			if len(diskDef.Source.Network.Hosts) < 1 {
-				return fmt.Errorf("Network disk does not contain any hosts")
-			}
-			url, err := url.Parse(fmt.Sprintf("%s://%s:%s%s",
-				diskDef.Source.Network.Protocol,
-				diskDef.Source.Network.Hosts[0].Name,
-				diskDef.Source.Network.Hosts[0].Port,
-				diskDef.Source.Network.Name))
-			if err != nil {
-				return err
-			}
-			disk = map[string]interface{}{
-				"url": url.String(),
-			}
-		} else if diskDef.Device == "cdrom" {
-			disk = map[string]interface{}{
-				"file": diskDef.Source.File,
-			}
-		} else if diskDef.Source.File != nil {
-			// LEGACY way of handling volumes using "file", which we replaced
-			// by the diskdef.Source.Volume once we realized it existed.
-			// This code will be removed in future versions of the provider.
-			virVol, err := virConn.LookupStorageVolByPath(diskDef.Source.File.File)
-			if err != nil {
-				return fmt.Errorf("Error retrieving volume for disk: %s", err)
-			}
-			defer virVol.Free()
 
-			virVolKey, err := virVol.GetKey()
-			if err != nil {
-				return fmt.Errorf("Error retrieving volume for disk: %s", err)
-			}
-
-			disk = map[string]interface{}{
-				"volume_id": virVolKey,
-			}
-		} else {
-			pool, err := virConn.LookupStoragePoolByName(diskDef.Source.Volume.Pool)
-			if err != nil {
-				return fmt.Errorf("Error retrieving pool for disk: %s", err)
-			}
-			defer pool.Free()
-
-			virVol, err := pool.LookupStorageVolByName(diskDef.Source.Volume.Volume)
-			if err != nil {
-				return fmt.Errorf("Error retrieving volume for disk: %s", err)
-			}
-			defer virVol.Free()
-
-			virVolKey, err := virVol.GetKey()
-			if err != nil {
-				return fmt.Errorf("Error retrieving volume key for disk: %s", err)
-			}
+	// the graphics are dropped in the architectures not supporting them
+	if len(domainDef.Devices.Graphics) > 0 || domainArchSupportsGraphics(domainDef.OS.Type.Arch) {
+		d.Set("graphics", flattenDomainGraphics(d, domainDef.Devices.Graphics))
+	}
+	d.Set("video", flattenDomainVideo(domainDef.Devices.Videos))
+	d.Set("console", flattenDomainConsoles(d, domainDef.Devices.Consoles))
+
+	// the disks holding the cloud-init and Ignition volumes are not part
+	// of "disk"
+	cloudinitPath := ""
+	if cloudinit, ok := d.GetOk("cloudinit"); ok {
+		key, err := getCloudInitVolumeKeyFromTerraformID(cloudinit.(string))
+		if err != nil {
+			return err
+		}
+		cloudinitPath = volumePathForKey(virConn, key)
+	}
+	ignitionPath := ""
+	ignitionFound := false
+	if ignition, ok := d.GetOk("coreos_ignition"); ok {
+		key, err := getIgnitionVolumeKeyFromTerraformID(ignition.(string))
+		if err != nil {
+			return err
+		}
+		// without a delivery, the config is given either way
+		delivery := getIgnitionDeliveryFromTerraformID(ignition.(string))
+		if delivery == ignitionDeliveryFwCfg || delivery == ignitionDeliveryAuto {
+			ignitionFound = domainHasIgnitionFwCfg(domainDef, key)
+		}
+		if delivery != ignitionDeliveryFwCfg {
+			ignitionPath = volumePathForKey(virConn, key)
+		}
+	}
 
-			disk = map[string]interface{}{
-				"volume_id": virVolKey,
+	cloudinitFound := false
+	disks := make([]map[string]interface{}, 0, len(domainDef.Devices.Disks))
+	for _, diskDef := range domainDef.Devices.Disks {
+		if diskDef.Source != nil && diskDef.Source.File != nil {
+			switch diskDef.Source.File.File {
+			case cloudinitPath:
+				cloudinitFound = true
+				continue
+			case ignitionPath:
+				ignitionFound = true
+				continue
 			}
 		}
 
+		var stateDisk map[string]interface{}
+		if i := len(disks); i < d.Get("disk.#").(int) {
+			stateDisk = d.Get(fmt.Sprintf("disk.%d", i)).(map[string]interface{})
+		}
+		disk, err := flattenDomainDisk(meta.(*Client), diskDef, stateDisk)
+		if err != nil {
+			return err
+		}
 		disks = append(disks, disk)
 	}
-	d.Set("disks", disks)
-	var filesystems []map[string]interface{}
-	for _, fsDef := range domainDef.Devices.Filesystems {
-		fs := map[string]interface{}{
-			"accessmode": fsDef.AccessMode,
-			"source":     fsDef.Source.Mount.Dir,
-			"target":     fsDef.Target.Dir,
-			"readonly":   fsDef.ReadOnly,
-		}
-		filesystems = append(filesystems, fs)
+	d.Set("disk", disks)
+
+	if cloudinitPath != "" && !cloudinitFound {
+		log.Printf("[DEBUG] read: the cloud-init disk of the domain may have been removed outside Terraform")
+		d.Set("cloudinit", "")
 	}
-	d.Set("filesystems", filesystems)
+	if _, ok := d.GetOk("coreos_ignition"); ok && !ignitionFound {
+		log.Printf("[DEBUG] read: the Ignition config of the domain may have been removed outside Terraform")
+		d.Set("coreos_ignition", "")
+	}
+
+	d.Set("filesystem", flattenDomainFilesystems(domainDef.Devices.Filesystems))
 
 	// lookup interfaces with addresses
 	ifacesWithAddr, err := domainGetIfacesInfo(*domain, d)
@@ -843,6 +1134,12 @@ func resourceLibvirtDomainRead(d *schema.ResourceData, meta interface{}) error {
 		return addrs
 	}
 
+	// the backends and port forwards of user mode interfaces
+	userDefs, err := getDomainInterfacesUserDefs(xmlDesc)
+	if err != nil {
+		return err
+	}
+
 	var netIfaces []map[string]interface{}
 	for i, networkInterfaceDef := range domainDef.Devices.Interfaces {
 		// we need it to read old values
@@ -856,6 +1153,8 @@ func resourceLibvirtDomainRead(d *schema.ResourceData, meta interface{}) error {
 			"vepa":           "",
 			"macvtap":        "",
 			"passthrough":    "",
+			"user":           "",
+			"port_forward":   []map[string]interface{}{},
 			"mac":            mac,
 			"hostname":       "",
 			"wait_for_lease": false,
@@ -863,6 +1162,11 @@ func resourceLibvirtDomainRead(d *schema.ResourceData, meta interface{}) error {
 
 		netIface["wait_for_lease"] = d.Get(prefix + ".wait_for_lease").(bool)
 		netIface["addresses"] = addressesForMac(mac)
+		netIface["filterref"] = flattenDomainInterfaceFilterRef(networkInterfaceDef.FilterRef)
+		netIface["bandwidth"] = flattenDomainInterfaceBandwidth(networkInterfaceDef.Bandwidth)
+		netIface["model"] = flattenDomainInterfaceModel(networkInterfaceDef.Model)
+		netIface["driver"] = flattenDomainInterfaceDriver(networkInterfaceDef.Driver)
+		netIface["mtu"] = flattenDomainInterfaceMTU(networkInterfaceDef.MTU)
 		log.Printf("[DEBUG] read: addresses for '%s': %+v", mac, netIface["addresses"])
 
 		if networkInterfaceDef.Source.Network != nil {
@@ -884,13 +1188,16 @@ func resourceLibvirtDomainRead(d *schema.ResourceData, meta interface{}) error {
 
 			netIface["network_name"] = networkInterfaceDef.Source.Network.Network
 
-			// try to look for this MAC in the DHCP configuration for this VM
+			// try to look for this MAC in the DHCP configuration for this VM,
+			// ignoring the hosts not added by the domain (eg. the ones of
+			// libvirt_network_dhcp_host resources)
 			if HasDHCP(networkDef) {
+				hostname := domainInterfaceHostname(d, prefix)
 			hostnameSearch:
 				for _, ip := range networkDef.IPs {
 					if ip.DHCP != nil {
 						for _, host := range ip.DHCP.Hosts {
-							if strings.ToUpper(host.MAC) == netIface["mac"] {
+							if strings.ToUpper(host.MAC) == netIface["mac"] && host.Name == hostname {
 								log.Printf("[DEBUG] read: hostname for '%s': '%s'", netIface["mac"], host.Name)
 								netIface["hostname"] = host.Name
 								break hostnameSearch
@@ -910,6 +1217,9 @@ func resourceLibvirtDomainRead(d *schema.ResourceData, meta interface{}) error {
 			case "passthrough":
 				netIface["passthrough"] = networkInterfaceDef.Source.Direct.Dev
 			}
+		} else if networkInterfaceDef.Source.User != nil && i < len(userDefs) {
+			netIface["user"] = flattenDomainInterfaceUser(userDefs[i])
+			netIface["port_forward"] = flattenDomainInterfacePortForwards(userDefs[i].PortForwards)
 		}
 		netIfaces = append(netIfaces, netIface)
 	}
@@ -956,15 +1266,14 @@ func resourceLibvirtDomainDelete(d *schema.ResourceData, meta interface{}) error
 		return fmt.Errorf("Error reading libvirt domain XML description: %s", err)
 	}
 
-	state, _, err := domain.GetState()
+	methods := getShutdownMethodsFromResource(d)
+	timeout, err := getShutdownTimeoutFromResource(d, d.Timeout(schema.TimeoutDelete))
 	if err != nil {
-		return fmt.Errorf("Couldn't get info about domain: %s", err)
+		return err
 	}
 
-	if state == libvirt.DOMAIN_RUNNING || state == libvirt.DOMAIN_PAUSED {
-		if err := domain.Destroy(); err != nil {
-			return fmt.Errorf("Couldn't destroy libvirt domain: %s", err)
-		}
+	if err := domainShutdown(domain, methods, timeout); err != nil {
+		return err
 	}
 
 	if err := domain.UndefineFlags(libvirt.DOMAIN_UNDEFINE_NVRAM); err != nil {
@@ -978,5 +1287,8 @@ func resourceLibvirtDomainDelete(d *schema.ResourceData, meta interface{}) error
 		}
 	}
 
+	// don't leave behind the static DHCP hosts added for the domain
+	removeDomainNetworkHosts(d, virConn)
+
 	return nil
 }
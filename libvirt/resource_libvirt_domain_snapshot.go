@@ -0,0 +1,292 @@
+package libvirt
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	libvirt "github.com/libvirt/libvirt-go"
+	"github.com/libvirt/libvirt-go-xml"
+)
+
+// a libvirt domain snapshot resource
+//
+// Resource example:
+//
+//	resource "libvirt_domain_snapshot" "before_upgrade" {
+//	   domain_id = "${libvirt_domain.my_machine.id}"
+//	   name      = "before-upgrade"
+//	}
+func resourceLibvirtDomainSnapshot() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceLibvirtDomainSnapshotCreate,
+		Read:   resourceLibvirtDomainSnapshotRead,
+		Update: resourceLibvirtDomainSnapshotUpdate,
+		Delete: resourceLibvirtDomainSnapshotDelete,
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
+		Schema: map[string]*schema.Schema{
+			"domain_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"name": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+				ForceNew: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+			},
+			"disk_only": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+				ForceNew: true,
+			},
+			"quiesce": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+				ForceNew: true,
+			},
+			"delete_children": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"revert_trigger": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"creation_time": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"state": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"parent": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"current": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+		},
+	}
+}
+
+// lookupSnapshotByID returns the domain and the snapshot identified by `id`.
+// Both are nil, without error, when any of them does not exist.
+//
+// You have to call Free() on the returned domain and snapshot
+func lookupSnapshotByID(virConn *libvirt.Connect, id string) (*libvirt.Domain, *libvirt.DomainSnapshot, error) {
+	domainID, name, err := parseSnapshotID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	domain, err := virConn.LookupDomainByUUIDString(domainID)
+	if err != nil {
+		if virErr, ok := err.(libvirt.Error); ok && virErr.Code == libvirt.ERR_NO_DOMAIN {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("Error retrieving libvirt domain %s: %s", domainID, err)
+	}
+
+	snapshot, err := domain.SnapshotLookupByName(name, 0)
+	if err != nil {
+		domain.Free()
+		if virErr, ok := err.(libvirt.Error); ok && virErr.Code == libvirt.ERR_NO_DOMAIN_SNAPSHOT {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("Error retrieving snapshot %s of domain %s: %s", name, domainID, err)
+	}
+
+	return domain, snapshot, nil
+}
+
+func resourceLibvirtDomainSnapshotCreate(d *schema.ResourceData, meta interface{}) error {
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	domainID := d.Get("domain_id").(string)
+	domain, err := virConn.LookupDomainByUUIDString(domainID)
+	if err != nil {
+		return fmt.Errorf("Error retrieving libvirt domain %s: %s", domainID, err)
+	}
+	defer domain.Free()
+
+	snapshotDef := libvirtxml.DomainSnapshot{
+		Name:        d.Get("name").(string),
+		Description: d.Get("description").(string),
+	}
+
+	var flags libvirt.DomainSnapshotCreateFlags
+	if d.Get("disk_only").(bool) {
+		// external snapshots of all the disks, taken at the same time
+		flags |= libvirt.DOMAIN_SNAPSHOT_CREATE_DISK_ONLY | libvirt.DOMAIN_SNAPSHOT_CREATE_ATOMIC
+	}
+	if d.Get("quiesce").(bool) {
+		if !d.Get("disk_only").(bool) {
+			return fmt.Errorf("'quiesce' can only be used together with 'disk_only'")
+		}
+		flags |= libvirt.DOMAIN_SNAPSHOT_CREATE_QUIESCE
+	}
+
+	data, err := xmlMarshallIndented(snapshotDef)
+	if err != nil {
+		return fmt.Errorf("Error serializing libvirt domain snapshot: %s", err)
+	}
+	log.Printf("[DEBUG] Generated XML for libvirt domain snapshot:\n%s", data)
+
+	snapshot, err := domain.CreateSnapshotXML(data, flags)
+	if err != nil {
+		return fmt.Errorf("Error creating snapshot of libvirt domain %s: %s", domainID, err)
+	}
+	defer snapshot.Free()
+
+	name, err := snapshot.GetName()
+	if err != nil {
+		return fmt.Errorf("Error retrieving snapshot name: %s", err)
+	}
+	d.SetId(snapshotID(domainID, name))
+
+	log.Printf("[INFO] Snapshot ID: %s", d.Id())
+
+	return resourceLibvirtDomainSnapshotRead(d, meta)
+}
+
+// resourceLibvirtDomainSnapshotUpdate reverts the domain to the snapshot
+// when the revert trigger changes
+func resourceLibvirtDomainSnapshotUpdate(d *schema.ResourceData, meta interface{}) error {
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	if d.HasChange("revert_trigger") {
+		domain, snapshot, err := lookupSnapshotByID(virConn, d.Id())
+		if err != nil {
+			return err
+		}
+		if snapshot == nil {
+			return fmt.Errorf("Can't revert to snapshot %s: it does not exist", d.Id())
+		}
+		defer domain.Free()
+		defer snapshot.Free()
+
+		log.Printf("[INFO] Reverting domain to snapshot %s", d.Id())
+		if err := snapshot.RevertToSnapshot(0); err != nil {
+			return fmt.Errorf("Error reverting to snapshot %s: %s", d.Id(), err)
+		}
+	}
+
+	return resourceLibvirtDomainSnapshotRead(d, meta)
+}
+
+func resourceLibvirtDomainSnapshotRead(d *schema.ResourceData, meta interface{}) error {
+	log.Printf("[DEBUG] Read resource libvirt_domain_snapshot")
+
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	domain, snapshot, err := lookupSnapshotByID(virConn, d.Id())
+	if err != nil {
+		return err
+	}
+	if snapshot == nil {
+		log.Printf("Snapshot '%s' may have been deleted outside Terraform", d.Id())
+		d.SetId("")
+		return nil
+	}
+	defer domain.Free()
+	defer snapshot.Free()
+
+	snapshotDef, err := newDefSnapshotFromLibvirt(snapshot)
+	if err != nil {
+		return err
+	}
+
+	domainID, _, err := parseSnapshotID(d.Id())
+	if err != nil {
+		return err
+	}
+
+	d.Set("domain_id", domainID)
+	d.Set("name", snapshotDef.Name)
+	d.Set("description", snapshotDef.Description)
+	d.Set("state", snapshotDef.State)
+	d.Set("disk_only", snapshotDef.State == "disk-snapshot")
+	d.Set("creation_time", timeFromEpoch(snapshotDef.CreationTime).UTC().Format(time.RFC3339))
+
+	parent := ""
+	if snapshotDef.Parent != nil {
+		parent = snapshotDef.Parent.Name
+	}
+	d.Set("parent", parent)
+
+	current, err := snapshot.IsCurrent(0)
+	if err != nil {
+		return fmt.Errorf("Error retrieving whether snapshot %s is current: %s", d.Id(), err)
+	}
+	d.Set("current", current)
+
+	// imported snapshots don't have these in the state, assume the
+	// defaults so they don't force a new resource
+	if _, ok := d.GetOkExists("quiesce"); !ok {
+		d.Set("quiesce", false)
+	}
+	if _, ok := d.GetOkExists("delete_children"); !ok {
+		d.Set("delete_children", false)
+	}
+
+	return nil
+}
+
+func resourceLibvirtDomainSnapshotDelete(d *schema.ResourceData, meta interface{}) error {
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+	log.Printf("[DEBUG] Deleting snapshot %s", d.Id())
+
+	domain, snapshot, err := lookupSnapshotByID(virConn, d.Id())
+	if err != nil {
+		return err
+	}
+	if snapshot == nil {
+		return nil
+	}
+	defer domain.Free()
+	defer snapshot.Free()
+
+	var flags libvirt.DomainSnapshotDeleteFlags
+	if d.Get("delete_children").(bool) {
+		flags |= libvirt.DOMAIN_SNAPSHOT_DELETE_CHILDREN
+	}
+	if d.Get("disk_only").(bool) {
+		// libvirt can't merge external snapshots back, so only forget
+		// about them: the domain keeps using the overlay files
+		flags |= libvirt.DOMAIN_SNAPSHOT_DELETE_METADATA_ONLY
+	}
+
+	if err := snapshot.Delete(flags); err != nil {
+		return fmt.Errorf("Error deleting snapshot %s: %s", d.Id(), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package libvirt
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/acctest"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+	libvirt "github.com/libvirt/libvirt-go"
+)
+
+func testAccCheckLibvirtDomainSnapshotExists(name string, snapshot *libvirt.DomainSnapshot) resource.TestCheckFunc {
+	return func(state *terraform.State) error {
+		virConn := testAccProvider.Meta().(*Client).libvirt
+
+		rs, err := getResourceFromTerraformState(name, state)
+		if err != nil {
+			return err
+		}
+
+		domain, retrievedSnapshot, err := lookupSnapshotByID(virConn, rs.Primary.ID)
+		if err != nil {
+			return err
+		}
+		if retrievedSnapshot == nil {
+			return fmt.Errorf("Snapshot %s does not exist", rs.Primary.ID)
+		}
+		defer domain.Free()
+
+		*snapshot = *retrievedSnapshot
+
+		return nil
+	}
+}
+
+func testAccCheckLibvirtDomainSnapshotDestroy(state *terraform.State) error {
+	virConn := testAccProvider.Meta().(*Client).libvirt
+	for _, rs := range state.RootModule().Resources {
+		if rs.Type != "libvirt_domain_snapshot" {
+			continue
+		}
+		_, snapshot, err := lookupSnapshotByID(virConn, rs.Primary.ID)
+		if err != nil {
+			return err
+		}
+		if snapshot != nil {
+			return fmt.Errorf(
+				"Error waiting for snapshot (%s) to be destroyed",
+				rs.Primary.ID)
+		}
+	}
+	return nil
+}
+
+func testAccLibvirtDomainSnapshotConfig(randomName string, snapshotConfig string) string {
+	return fmt.Sprintf(`
+	resource "libvirt_volume" "%[1]s" {
+		name   = "%[1]s.qcow2"
+		format = "qcow2"
+		size   = 1073741824
+	}
+
+	resource "libvirt_domain" "%[1]s" {
+		name    = "%[1]s"
+		running = false
+		disk {
+			volume_id = "${libvirt_volume.%[1]s.id}"
+		}
+	}
+
+	resource "libvirt_domain_snapshot" "%[1]s" {
+		domain_id = "${libvirt_domain.%[1]s.id}"
+		name      = "%[1]s"
+		%[2]s
+	}`, randomName, snapshotConfig)
+}
+
+func TestAccLibvirtDomainSnapshot_Basic(t *testing.T) {
+	var snapshot libvirt.DomainSnapshot
+	randomName := acctest.RandString(10)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtDomainSnapshotDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccLibvirtDomainSnapshotConfig(randomName, `description = "initial state"`),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtDomainSnapshotExists("libvirt_domain_snapshot."+randomName, &snapshot),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain_snapshot."+randomName, "name", randomName),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain_snapshot."+randomName, "description", "initial state"),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain_snapshot."+randomName, "state", "shutoff"),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain_snapshot."+randomName, "current", "true"),
+					resource.TestCheckResourceAttrSet(
+						"libvirt_domain_snapshot."+randomName, "creation_time"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccLibvirtDomainSnapshot_Revert(t *testing.T) {
+	var snapshot libvirt.DomainSnapshot
+	randomName := acctest.RandString(10)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtDomainSnapshotDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccLibvirtDomainSnapshotConfig(randomName, `revert_trigger = "1"`),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtDomainSnapshotExists("libvirt_domain_snapshot."+randomName, &snapshot),
+				),
+			},
+			{
+				Config: testAccLibvirtDomainSnapshotConfig(randomName, `revert_trigger = "2"`),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtDomainSnapshotExists("libvirt_domain_snapshot."+randomName, &snapshot),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain_snapshot."+randomName, "revert_trigger", "2"),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain_snapshot."+randomName, "current", "true"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccLibvirtDomainSnapshot_Import(t *testing.T) {
+	randomName := acctest.RandString(10)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtDomainSnapshotDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccLibvirtDomainSnapshotConfig(randomName, ""),
+			},
+			{
+				ResourceName:      "libvirt_domain_snapshot." + randomName,
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
@@ -1,16 +1,21 @@
 package libvirt
 
 import (
+	"encoding/xml"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/terraform/helper/acctest"
 	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
 	libvirt "github.com/libvirt/libvirt-go"
 	libvirtxml "github.com/libvirt/libvirt-go-xml"
@@ -74,6 +79,125 @@ func TestAccLibvirtDomain_Detailed(t *testing.T) {
 	})
 }
 
+func TestAccLibvirtDomain_UpdateVCPUMemory(t *testing.T) {
+	var domain libvirt.Domain
+	var domainID string
+	randomResourceName := acctest.RandString(10)
+	randomDomainName := acctest.RandString(10)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtDomainDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_domain" "%s" {
+					name      = "%s"
+					memory    = 384
+					maxmemory = 1024
+					vcpu      = 1
+					maxvcpu   = 2
+				}`, randomResourceName, randomDomainName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtDomainExists("libvirt_domain."+randomResourceName, &domain),
+					func(*terraform.State) error {
+						var err error
+						domainID, err = domain.GetUUIDString()
+						return err
+					},
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomResourceName, "memory", "384"),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomResourceName, "maxvcpu", "2"),
+				),
+			},
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_domain" "%s" {
+					name      = "%s"
+					memory    = 768
+					maxmemory = 1024
+					vcpu      = 2
+					maxvcpu   = 2
+				}`, randomResourceName, randomDomainName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtDomainExists("libvirt_domain."+randomResourceName, &domain),
+					resource.TestCheckResourceAttrPtr(
+						"libvirt_domain."+randomResourceName, "id", &domainID),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomResourceName, "memory", "768"),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomResourceName, "vcpu", "2"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccLibvirtDomain_HotplugDisk(t *testing.T) {
+	var domain libvirt.Domain
+	var domainID string
+	randomVolumeName := acctest.RandString(10)
+	randomDomainName := acctest.RandString(10)
+	var configNoDisk = fmt.Sprintf(`
+	resource "libvirt_volume" "%s" {
+		name = "%s"
+		size = 1073741824
+	}
+
+	resource "libvirt_domain" "%s" {
+		name = "%s"
+	}`, randomVolumeName, randomVolumeName, randomDomainName, randomDomainName)
+
+	var configDisk = fmt.Sprintf(`
+	resource "libvirt_volume" "%s" {
+		name = "%s"
+		size = 1073741824
+	}
+
+	resource "libvirt_domain" "%s" {
+		name = "%s"
+		disk {
+			volume_id = "${libvirt_volume.%s.id}"
+		}
+	}`, randomVolumeName, randomVolumeName, randomDomainName, randomDomainName, randomVolumeName)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtDomainDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: configNoDisk,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtDomainExists("libvirt_domain."+randomDomainName, &domain),
+					func(*terraform.State) error {
+						var err error
+						domainID, err = domain.GetUUIDString()
+						return err
+					},
+				),
+			},
+			{
+				Config: configDisk,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtDomainExists("libvirt_domain."+randomDomainName, &domain),
+					resource.TestCheckResourceAttrPtr(
+						"libvirt_domain."+randomDomainName, "id", &domainID),
+					testAccCheckLibvirtDomainDescription(&domain, func(domainDef libvirtxml.Domain) error {
+						for _, disk := range domainDef.Devices.Disks {
+							if disk.Target != nil && disk.Target.Dev == "vda" {
+								return nil
+							}
+						}
+						return fmt.Errorf("Disk vda was not attached to the domain")
+					}),
+				),
+			},
+		},
+	})
+}
+
 func TestAccLibvirtDomain_Volume(t *testing.T) {
 	var domain libvirt.Domain
 	var volume libvirt.StorageVol
@@ -420,6 +544,251 @@ func TestAccLibvirtDomain_NetworkInterface(t *testing.T) {
 	})
 }
 
+func TestAccLibvirtDomain_NetworkInterfaceFilterRef(t *testing.T) {
+	var domain libvirt.Domain
+	randomName := acctest.RandString(10)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtDomainDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_nwfilter" "%[1]s" {
+					name = "%[1]s"
+
+					filterref {
+						filter = "clean-traffic"
+					}
+				}
+
+				resource "libvirt_domain" "%[1]s" {
+					name = "%[1]s"
+					network_interface {
+						network_name = "default"
+						mac          = "52:54:00:A9:F5:18"
+						filterref {
+							filter     = "${libvirt_nwfilter.%[1]s.name}"
+							parameters = {
+								IP = "192.168.122.10"
+							}
+						}
+					}
+				}`, randomName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtDomainExists("libvirt_domain."+randomName, &domain),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomName, "network_interface.0.filterref.0.filter", randomName),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomName, "network_interface.0.filterref.0.parameters.IP", "192.168.122.10"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccLibvirtDomain_NetworkInterfaceBandwidth(t *testing.T) {
+	var domain libvirt.Domain
+	randomName := acctest.RandString(10)
+
+	config := func(average int) string {
+		return fmt.Sprintf(`
+		resource "libvirt_domain" "%[1]s" {
+			name = "%[1]s"
+			network_interface {
+				network_name = "default"
+				bandwidth {
+					inbound {
+						average = %[2]d
+						peak    = 5000
+						burst   = 1024
+					}
+					outbound {
+						average = 128
+					}
+				}
+			}
+		}`, randomName, average)
+	}
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtDomainDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: config(1000),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtDomainExists("libvirt_domain."+randomName, &domain),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomName, "network_interface.0.bandwidth.0.inbound.0.average", "1000"),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomName, "network_interface.0.bandwidth.0.outbound.0.average", "128"),
+				),
+			},
+			{
+				// changed in the running domain, without replacing the interface
+				Config: config(2000),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtDomainExists("libvirt_domain."+randomName, &domain),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomName, "network_interface.0.bandwidth.0.inbound.0.average", "2000"),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomName, "network_interface.0.bandwidth.0.inbound.0.peak", "5000"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccLibvirtDomain_NetworkInterfaceModelDriver(t *testing.T) {
+	var domain libvirt.Domain
+	randomName := acctest.RandString(10)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtDomainDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_domain" "%[1]s" {
+					name = "%[1]s"
+					vcpu = 2
+					network_interface {
+						network_name = "default"
+						mtu          = 1400
+						driver {
+							queues        = 2
+							rx_queue_size = 512
+						}
+					}
+					network_interface {
+						network_name = "default"
+						model        = "e1000"
+					}
+				}`, randomName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtDomainExists("libvirt_domain."+randomName, &domain),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomName, "network_interface.0.model", "virtio"),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomName, "network_interface.0.mtu", "1400"),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomName, "network_interface.0.driver.0.queues", "2"),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomName, "network_interface.0.driver.0.rx_queue_size", "512"),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomName, "network_interface.1.model", "e1000"),
+					testAccCheckLibvirtDomainDescription(&domain, func(domainDef libvirtxml.Domain) error {
+						ifaces := domainDef.Devices.Interfaces
+						if len(ifaces) != 2 {
+							return fmt.Errorf("Expected 2 network interfaces, got %d", len(ifaces))
+						}
+						if ifaces[0].Driver == nil || ifaces[0].Driver.Queues != 2 || ifaces[0].MTU == nil || ifaces[0].MTU.Size != 1400 {
+							return fmt.Errorf("Unexpected driver or MTU of the first network interface: %+v %+v", ifaces[0].Driver, ifaces[0].MTU)
+						}
+						if ifaces[1].Model == nil || ifaces[1].Model.Type != "e1000" {
+							return fmt.Errorf("Unexpected model of the second network interface: %+v", ifaces[1].Model)
+						}
+						return nil
+					}),
+				),
+			},
+		},
+	})
+}
+
+func TestAccLibvirtDomain_NetworkInterfaceDriverNotVirtio(t *testing.T) {
+	randomName := acctest.RandString(10)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtDomainDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_domain" "%[1]s" {
+					name = "%[1]s"
+					network_interface {
+						network_name = "default"
+						model        = "rtl8139"
+						driver {
+							queues = 2
+						}
+					}
+				}`, randomName),
+				ExpectError: regexp.MustCompile("only supported with the virtio model"),
+			},
+		},
+	})
+}
+
+func TestAccLibvirtDomain_UserNetworkInterface(t *testing.T) {
+	var domain libvirt.Domain
+	randomName := acctest.RandString(10)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtDomainDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_domain" "%[1]s" {
+					name = "%[1]s"
+					network_interface {
+						user = "slirp"
+						mac  = "52:54:00:B2:2F:87"
+					}
+				}`, randomName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtDomainExists("libvirt_domain."+randomName, &domain),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomName, "network_interface.0.user", "slirp"),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomName, "network_interface.0.mac", "52:54:00:B2:2F:87"),
+					testAccCheckLibvirtDomainDescription(&domain, func(domainDef libvirtxml.Domain) error {
+						ifaces := domainDef.Devices.Interfaces
+						if len(ifaces) != 1 || ifaces[0].Source == nil || ifaces[0].Source.User == nil {
+							return fmt.Errorf("Expected a user mode network interface, got %+v", ifaces)
+						}
+						return nil
+					}),
+				),
+			},
+		},
+	})
+}
+
+func TestAccLibvirtDomain_UserNetworkInterfacePortForwardNeedsPasst(t *testing.T) {
+	randomName := acctest.RandString(10)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtDomainDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_domain" "%[1]s" {
+					name = "%[1]s"
+					network_interface {
+						user = "slirp"
+						port_forward {
+							host_port  = 2222
+							guest_port = 22
+						}
+					}
+				}`, randomName),
+				ExpectError: regexp.MustCompile("only supported by user mode interfaces with the passt backend"),
+			},
+		},
+	})
+}
+
 func TestAccLibvirtDomain_CheckDHCPEntries(t *testing.T) {
 	var domain libvirt.Domain
 	var network libvirt.Network
@@ -794,6 +1163,113 @@ func TestAccLibvirtDomain_Consoles(t *testing.T) {
 	})
 }
 
+func TestAccLibvirtDomain_ReadDevices(t *testing.T) {
+	var domain libvirt.Domain
+	randomDomainName := acctest.RandString(10)
+	randomVolumeName := acctest.RandString(10)
+	var config = fmt.Sprintf(`
+	resource "libvirt_volume" "%[2]s" {
+		name = "%[2]s"
+		size = 1073741824
+	}
+
+	resource "libvirt_domain" "%[1]s" {
+		name = "%[1]s"
+		disk {
+			volume_id = "${libvirt_volume.%[2]s.id}"
+		}
+		filesystem {
+			source = "/tmp"
+			target = "tmp"
+		}
+		graphics {
+			type        = "vnc"
+			listen_type = "address"
+		}
+		video {
+			type = "vga"
+		}
+		console {
+			type        = "pty"
+			target_port = "0"
+		}
+		boot_device {
+			dev = ["hd", "network"]
+		}
+	}`, randomDomainName, randomVolumeName)
+
+	// changes the video card of the domain outside Terraform
+	changeVideo := func() {
+		virConn := testAccProvider.Meta().(*Client).libvirt
+		xmlDesc, err := domain.GetXMLDesc(libvirt.DOMAIN_XML_INACTIVE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var domainDef libvirtxml.Domain
+		if err := xml.Unmarshal([]byte(xmlDesc), &domainDef); err != nil {
+			t.Fatal(err)
+		}
+		domainDef.Devices.Videos[0].Model = libvirtxml.DomainVideoModel{Type: "cirrus"}
+		data, err := xmlMarshallIndented(domainDef)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := domain.Destroy(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := virConn.DomainDefineXML(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := domain.Create(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtDomainDestroy,
+		Steps: []resource.TestStep{
+			{
+				// reading the created domain gives the same state
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtDomainExists("libvirt_domain."+randomDomainName, &domain),
+					resource.TestCheckResourceAttrPair(
+						"libvirt_domain."+randomDomainName, "disk.0.volume_id",
+						"libvirt_volume."+randomVolumeName, "id"),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomDomainName, "filesystem.0.source", "/tmp"),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomDomainName, "graphics.0.listen_address", "127.0.0.1"),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomDomainName, "console.0.target_type", "serial"),
+					resource.TestCheckResourceAttr(
+						"libvirt_domain."+randomDomainName, "boot_device.0.dev.1", "network"),
+				),
+			},
+			{
+				ResourceName:      "libvirt_domain." + randomDomainName,
+				ImportState:       true,
+				ImportStateVerify: true,
+				// settings of the provider, not of the domain
+				ImportStateVerifyIgnore: []string{
+					"running",
+					"qemu_agent",
+					"cloudinit",
+					"coreos_ignition",
+				},
+			},
+			{
+				PreConfig:          changeVideo,
+				Config:             config,
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+		},
+	})
+}
+
 func testAccCheckLibvirtDomainExists(name string, domain *libvirt.Domain) resource.TestCheckFunc {
 	return func(state *terraform.State) error {
 
@@ -1193,6 +1669,104 @@ func TestAccLibvirtDomain_ShutoffDomain(t *testing.T) {
 		},
 	})
 }
+func TestAccLibvirtDomain_ShutdownMethods(t *testing.T) {
+	var domain libvirt.Domain
+	randomDomainName := acctest.RandString(10)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtDomainDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_domain" "%s" {
+					name    = "%s"
+					running = false
+					shutdown {
+						methods = ["agent"]
+					}
+					timeouts {
+						create = "30s"
+					}
+				}`, randomDomainName, randomDomainName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtDomainExists("libvirt_domain."+randomDomainName, &domain),
+					testAccCheckLibvirtDomainStateEqual("libvirt_domain."+randomDomainName, &domain, "shutoff"),
+				),
+			},
+		},
+	})
+}
+
+func TestGetShutdownMethodsFromResource(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibvirtDomain().Schema, map[string]interface{}{})
+	methods := getShutdownMethodsFromResource(d)
+	if !reflect.DeepEqual(methods, []string{"acpi", "agent"}) {
+		t.Errorf("unexpected default shutdown methods: %v", methods)
+	}
+
+	// a shutdown block only setting the timeout keeps the default methods
+	d = schema.TestResourceDataRaw(t, resourceLibvirtDomain().Schema, map[string]interface{}{
+		"shutdown": []interface{}{
+			map[string]interface{}{
+				"timeout": "2m",
+			},
+		},
+	})
+	methods = getShutdownMethodsFromResource(d)
+	if !reflect.DeepEqual(methods, []string{"acpi", "agent"}) {
+		t.Errorf("unexpected default shutdown methods: %v", methods)
+	}
+
+	d = schema.TestResourceDataRaw(t, resourceLibvirtDomain().Schema, map[string]interface{}{
+		"shutdown": []interface{}{
+			map[string]interface{}{
+				"methods": []interface{}{"agent"},
+			},
+		},
+	})
+	methods = getShutdownMethodsFromResource(d)
+	if !reflect.DeepEqual(methods, []string{"agent"}) {
+		t.Errorf("unexpected shutdown methods: %v", methods)
+	}
+
+	methodSchema := resourceLibvirtDomain().Schema["shutdown"].Elem.(*schema.Resource).Schema["methods"].Elem.(*schema.Schema)
+	if _, errs := methodSchema.ValidateFunc("reset", "shutdown.0.methods.0"); len(errs) != 1 {
+		t.Errorf("expected an error for an unsupported shutdown method")
+	}
+}
+
+func TestGetShutdownTimeoutFromResource(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibvirtDomain().Schema, map[string]interface{}{})
+	timeout, err := getShutdownTimeoutFromResource(d, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeout != time.Minute {
+		t.Errorf("unexpected default shutdown timeout: %s", timeout)
+	}
+
+	d = schema.TestResourceDataRaw(t, resourceLibvirtDomain().Schema, map[string]interface{}{
+		"shutdown": []interface{}{
+			map[string]interface{}{
+				"timeout": "10m",
+			},
+		},
+	})
+	// the timeout of the operation wins
+	timeout, err = getShutdownTimeoutFromResource(d, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeout != 5*time.Minute {
+		t.Errorf("unexpected shutdown timeout: %s", timeout)
+	}
+
+	if _, errs := validateDomainShutdownTimeout("2 minutes", "shutdown.0.timeout"); len(errs) != 1 {
+		t.Errorf("expected an error for an invalid shutdown timeout")
+	}
+}
+
 func TestAccLibvirtDomain_ShutoffMultiDomainsRunning(t *testing.T) {
 	var domain libvirt.Domain
 	var domain2 libvirt.Domain
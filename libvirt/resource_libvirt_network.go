@@ -10,7 +10,6 @@ import (
 	"github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/libvirt/libvirt-go"
-	"github.com/libvirt/libvirt-go-xml"
 )
 
 const (
@@ -18,7 +17,14 @@ const (
 	netModeNat      = "nat"
 	netModeRoute    = "route"
 	netModeBridge   = "bridge"
+	netModeOpen     = "open"
 	dnsPrefix       = "dns.0"
+	// macvtap modes, using a pool of host interfaces
+	netModePrivate     = "private"
+	netModeVEPA        = "vepa"
+	netModePassthrough = "passthrough"
+	// SR-IOV virtual functions of a physical function
+	netModeHostdev = "hostdev"
 )
 
 // a libvirt network resource
@@ -33,15 +39,17 @@ const (
 // }
 //
 // "addresses" can contain (0 or 1) ipv4 and (0 or 1) ipv6 subnets
-// "mode" can be one of: "nat" (default), "isolated"
+// "mode" can be one of: "nat" (default), "none", "route", "open", "bridge",
+// "private", "vepa", "passthrough", "hostdev"
 //
 func resourceLibvirtNetwork() *schema.Resource {
 	return &schema.Resource{
-		Create: resourceLibvirtNetworkCreate,
-		Read:   resourceLibvirtNetworkRead,
-		Delete: resourceLibvirtNetworkDelete,
-		Exists: resourceLibvirtNetworkExists,
-		Update: resourceLibvirtNetworkUpdate,
+		Create:        resourceLibvirtNetworkCreate,
+		Read:          resourceLibvirtNetworkRead,
+		Delete:        resourceLibvirtNetworkDelete,
+		Exists:        resourceLibvirtNetworkExists,
+		Update:        resourceLibvirtNetworkUpdate,
+		CustomizeDiff: resourceLibvirtNetworkCustomizeDiff,
 		Importer: &schema.ResourceImporter{
 			State: schema.ImportStatePassthrough,
 		},
@@ -56,7 +64,7 @@ func resourceLibvirtNetwork() *schema.Resource {
 				Optional: true,
 				ForceNew: false,
 			},
-			"mode": { // can be "none", "nat" (default), "route", "bridge"
+			"mode": { // can be "none", "nat" (default), "route", "open", "bridge", "private", "vepa", "passthrough", "hostdev"
 				Type:     schema.TypeString,
 				Optional: true,
 				ForceNew: true,
@@ -73,14 +81,70 @@ func resourceLibvirtNetwork() *schema.Resource {
 				Optional: true,
 				Required: false,
 			},
+			"bandwidth": bandwidthSchema(false),
 			"addresses": {
 				Type:     schema.TypeList,
 				Optional: true,
-				ForceNew: true,
 				Elem: &schema.Schema{
 					Type: schema.TypeString,
 				},
 			},
+			"forward": {
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"dev": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"interfaces": {
+							Type:     schema.TypeList,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+						"pf": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"managed": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  true,
+						},
+						"nat": {
+							Type:     schema.TypeList,
+							Optional: true,
+							MaxItems: 1,
+							Elem: &schema.Resource{
+								Schema: map[string]*schema.Schema{
+									"address_start": {
+										Type:     schema.TypeString,
+										Optional: true,
+									},
+									"address_end": {
+										Type:     schema.TypeString,
+										Optional: true,
+									},
+									"port_start": {
+										Type:     schema.TypeInt,
+										Optional: true,
+										Default:  1024,
+									},
+									"port_end": {
+										Type:     schema.TypeInt,
+										Optional: true,
+										Default:  65535,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
 			"autostart": {
 				Type:     schema.TypeBool,
 				Optional: true,
@@ -107,20 +171,17 @@ func resourceLibvirtNetwork() *schema.Resource {
 						"forwarders": {
 							Type:     schema.TypeList,
 							Optional: true,
-							ForceNew: true,
 							Elem: &schema.Resource{
 								Schema: map[string]*schema.Schema{
 									"address": {
 										Type:     schema.TypeString,
 										Optional: true,
 										Required: false,
-										ForceNew: true,
 									},
 									"domain": {
 										Type:     schema.TypeString,
 										Optional: true,
 										Required: false,
-										ForceNew: true,
 									},
 								},
 							},
@@ -128,7 +189,6 @@ func resourceLibvirtNetwork() *schema.Resource {
 						"srvs": {
 							Type:     schema.TypeList,
 							Optional: true,
-							ForceNew: true,
 							Elem: &schema.Resource{
 								Schema: map[string]*schema.Schema{
 									"service": {
@@ -137,7 +197,6 @@ func resourceLibvirtNetwork() *schema.Resource {
 										// and therefore doesn't recognize that this is set when assigning from
 										// a rendered dns_host template.
 										Optional: true,
-										ForceNew: true,
 									},
 									"protocol": {
 										Type: schema.TypeString,
@@ -145,33 +204,27 @@ func resourceLibvirtNetwork() *schema.Resource {
 										// and therefore doesn't recognize that this is set when assigning from
 										// a rendered dns_host template.
 										Optional: true,
-										ForceNew: true,
 									},
 									"domain": {
 										Type:     schema.TypeString,
 										Optional: true,
 										Required: false,
-										ForceNew: true,
 									},
 									"target": {
 										Type:     schema.TypeString,
 										Optional: true,
-										ForceNew: true,
 									},
 									"port": {
 										Type:     schema.TypeString,
 										Optional: true,
-										ForceNew: true,
 									},
 									"weight": {
 										Type:     schema.TypeString,
 										Optional: true,
-										ForceNew: true,
 									},
 									"priority": {
 										Type:     schema.TypeString,
 										Optional: true,
-										ForceNew: true,
 									},
 								},
 							},
@@ -205,7 +258,6 @@ func resourceLibvirtNetwork() *schema.Resource {
 			"dhcp": {
 				Type:     schema.TypeList,
 				Optional: true,
-				ForceNew: true,
 				MaxItems: 1,
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
@@ -218,10 +270,54 @@ func resourceLibvirtNetwork() *schema.Resource {
 					},
 				},
 			},
+			"ipv4": {
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"dhcp_enabled": {
+							Type:     schema.TypeBool,
+							Default:  true,
+							Optional: true,
+						},
+						"dhcp_start": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"dhcp_end": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+					},
+				},
+			},
+			"ipv6": {
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"ra_mode": {
+							Type:         schema.TypeString,
+							Default:      raModeStateful,
+							Optional:     true,
+							ValidateFunc: validateNetworkRAMode,
+						},
+						"dhcp_start": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"dhcp_end": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+					},
+				},
+			},
 			"routes": {
 				Type:     schema.TypeList,
 				Optional: true,
-				ForceNew: true,
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"cidr": {
@@ -235,6 +331,10 @@ func resourceLibvirtNetwork() *schema.Resource {
 					},
 				},
 			},
+			"restart_required": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
 			"xml": {
 				Type:     schema.TypeList,
 				Optional: true,
@@ -243,13 +343,19 @@ func resourceLibvirtNetwork() *schema.Resource {
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"xslt": {
-							Type:     schema.TypeString,
-							Optional: true,
-							ForceNew: true,
+							Type:         schema.TypeString,
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateXSLT,
 						},
+						"patch": xmlPatchSchema(),
 					},
 				},
 			},
+			"rendered_xml": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
 		},
 	}
 }
@@ -273,6 +379,34 @@ func resourceLibvirtNetworkExists(d *schema.ResourceData, meta interface{}) (boo
 	return err == nil, err
 }
 
+// resourceLibvirtNetworkCustomizeDiff tells in the plan when the changes in
+// the network can't be applied to the running network, so it will be
+// redefined and restarted, and renders the XML definition of the network,
+// the same way it is rendered when applying the plan
+func resourceLibvirtNetworkCustomizeDiff(diff *schema.ResourceDiff, meta interface{}) error {
+	if diff.Id() != "" && networkUpdateRequiresRestart(resourceDiffChanges{diff}) {
+		if err := diff.SetNew("restart_required", true); err != nil {
+			return err
+		}
+	}
+
+	r := resourceLibvirtNetwork()
+	if diff.Id() != "" && !resourceDiffHasChanges(r, diff, "rendered_xml") {
+		return nil
+	}
+
+	d, ok := resourceDataFromDiff(r, diff)
+	if !ok {
+		return diff.SetNewComputed("rendered_xml")
+	}
+	data, err := renderNetworkXML(d)
+	if err != nil {
+		log.Printf("[DEBUG] Can't render the XML definition of the network in the plan: %s", err)
+		return diff.SetNewComputed("rendered_xml")
+	}
+	return diff.SetNew("rendered_xml", data)
+}
+
 // resourceLibvirtNetworkUpdate updates dynamically some attributes in the network
 func resourceLibvirtNetworkUpdate(d *schema.ResourceData, meta interface{}) error {
 	// check the list of things that can be changed dynamically
@@ -294,6 +428,27 @@ func resourceLibvirtNetworkUpdate(d *schema.ResourceData, meta interface{}) erro
 		return err
 	}
 
+	if d.HasChange("autostart") {
+		err = network.SetAutostart(d.Get("autostart").(bool))
+		if err != nil {
+			return fmt.Errorf("Error updating autostart for network %s: %s", networkName, err)
+		}
+		d.SetPartial("autostart")
+	}
+
+	if networkUpdateRequiresRestart(d) {
+		// libvirt can't change some attributes in a running network: the
+		// new definition contains all the other changes too
+		log.Printf("[INFO] Redefining network %s: the changes can't be applied live", networkName)
+		if err := redefineAndRestartNetwork(d, virConn, network); err != nil {
+			return err
+		}
+		d.Set("restart_required", false)
+		d.Partial(false)
+		return nil
+	}
+
+	// the changes below are applied to the running network
 	active, err := network.IsActive()
 	if err != nil {
 		return fmt.Errorf("Error when getting network %s status during update: %s", networkName, err)
@@ -306,12 +461,10 @@ func resourceLibvirtNetworkUpdate(d *schema.ResourceData, meta interface{}) erro
 		}
 	}
 
-	if d.HasChange("autostart") {
-		err = network.SetAutostart(d.Get("autostart").(bool))
-		if err != nil {
-			return fmt.Errorf("Error updating autostart for network %s: %s", networkName, err)
-		}
-		d.SetPartial("autostart")
+	// detect changes in the DHCP ranges
+	err = updateNetworkDHCPRanges(d, network)
+	if err != nil {
+		return fmt.Errorf("Error updating DHCP ranges for network %s: %s", networkName, err)
 	}
 
 	// detect changes in the DNS entries in this network
@@ -320,6 +473,12 @@ func resourceLibvirtNetworkUpdate(d *schema.ResourceData, meta interface{}) erro
 		return fmt.Errorf("Error updating DNS hosts for network %s: %s", networkName, err)
 	}
 
+	// and in the DNS SRV entries
+	err = updateDNSSRVs(d, network)
+	if err != nil {
+		return fmt.Errorf("Error updating DNS SRV entries for network %s: %s", networkName, err)
+	}
+
 	// detect changes in the bridge
 	if d.HasChange("bridge") {
 		networkBridge := getBridgeFromResource(d)
@@ -358,6 +517,13 @@ func resourceLibvirtNetworkUpdate(d *schema.ResourceData, meta interface{}) erro
 		d.SetPartial("domain")
 	}
 
+	// the definition rendered in the plan
+	data, err := renderNetworkXML(d)
+	if err != nil {
+		return err
+	}
+	d.Set("rendered_xml", data)
+
 	d.Partial(false)
 	return nil
 }
@@ -370,80 +536,10 @@ func resourceLibvirtNetworkCreate(d *schema.ResourceData, meta interface{}) erro
 		return fmt.Errorf(LibVirtConIsNil)
 	}
 
-	networkDef := newNetworkDef()
-	networkDef.Name = d.Get("name").(string)
-	networkDef.Domain = getDomainFromResource(d)
-
-	// use a bridge provided by the user, or create one otherwise (libvirt will assign on automatically when empty)
-	networkDef.Bridge = getBridgeFromResource(d)
-
-	networkDef.MTU = getMTUFromResource(d)
-
-	// check the network mode
-	networkDef.Forward = &libvirtxml.NetworkForward{
-		Mode: getNetModeFromResource(d),
-	}
-	if networkDef.Forward.Mode == netModeIsolated || networkDef.Forward.Mode == netModeNat || networkDef.Forward.Mode == netModeRoute {
-
-		if networkDef.Forward.Mode == netModeIsolated {
-			// there is no forwarding when using an isolated network
-			networkDef.Forward = nil
-		} else if networkDef.Forward.Mode == netModeRoute {
-			// there is no NAT when using a routed network
-			networkDef.Forward.NAT = nil
-		}
-
-		// if addresses are given set dhcp for these
-		ips, err := getIPsFromResource(d)
-		if err != nil {
-			return fmt.Errorf("Could not set DHCP from adresses '%s'", err)
-		}
-		networkDef.IPs = ips
-
-		dnsEnabled, err := getDNSEnableFromResource(d)
-		if err != nil {
-			return err
-		}
-
-		dnsForwarders, err := getDNSForwardersFromResource(d)
-		if err != nil {
-			return err
-		}
-
-		dnsSRVs, err := getDNSSRVFromResource(d)
-		if err != nil {
-			return err
-		}
-
-		dnsHosts, err := getDNSHostsFromResource(d)
-		if err != nil {
-			return err
-		}
-
-		dns := libvirtxml.NetworkDNS{
-			Enable:     dnsEnabled,
-			Forwarders: dnsForwarders,
-			Host:       dnsHosts,
-			SRVs:       dnsSRVs,
-		}
-		networkDef.DNS = &dns
-
-	} else if networkDef.Forward.Mode == netModeBridge {
-		if networkDef.Bridge.Name == "" {
-			return fmt.Errorf("'bridge' must be provided when using the bridged network mode")
-		}
-		// Bridges cannot forward
-		networkDef.Forward = nil
-	} else {
-		return fmt.Errorf("unsupported network mode '%s'", networkDef.Forward.Mode)
-	}
-
-	// parse any static routes
-	routes, err := getRoutesFromResource(d)
+	data, err := renderNetworkXML(d)
 	if err != nil {
 		return err
 	}
-	networkDef.Routes = routes
 
 	// once we have the network defined, connect to libvirt and create it from the XML serialization
 	connectURI, err := virConn.GetURI()
@@ -452,17 +548,6 @@ func resourceLibvirtNetworkCreate(d *schema.ResourceData, meta interface{}) erro
 	}
 	log.Printf("[INFO] Creating libvirt network at %s", connectURI)
 
-	data, err := xmlMarshallIndented(networkDef)
-	if err != nil {
-		return fmt.Errorf("Error serializing libvirt network: %s", err)
-	}
-	log.Printf("[DEBUG] Generated XML for libvirt network:\n%s", data)
-
-	data, err = transformResourceXML(data, d)
-	if err != nil {
-		return fmt.Errorf("Error applying XSLT stylesheet: %s", err)
-	}
-
 	log.Printf("[DEBUG] Creating libvirt network at %s: %s", connectURI, data)
 	network, err := virConn.NetworkDefineXML(data)
 	if err != nil {
@@ -485,8 +570,9 @@ func resourceLibvirtNetworkCreate(d *schema.ResourceData, meta interface{}) erro
 	d.Set("id", id)
 	d.SetPartial("id")
 	d.Partial(false)
+	d.Set("rendered_xml", data)
 
-	log.Printf("[INFO] Created network %s [%s]", networkDef.Name, d.Id())
+	log.Printf("[INFO] Created network %s [%s]", d.Get("name").(string), d.Id())
 
 	stateConf := &resource.StateChangeConf{
 		Pending:    []string{"BUILD"},
@@ -533,14 +619,25 @@ func resourceLibvirtNetworkRead(d *schema.ResourceData, meta interface{}) error
 	}
 
 	d.Set("name", networkDef.Name)
-	d.Set("bridge", networkDef.Bridge.Name)
+	// networks using macvtap or SR-IOV devices have no bridge
+	if networkDef.Bridge != nil {
+		d.Set("bridge", networkDef.Bridge.Name)
+	}
 
 	if networkDef.MTU != nil {
 		d.Set("mtu", networkDef.MTU.Size)
 	}
 
+	d.Set("bandwidth", flattenNetworkBandwidth(networkDef.Bandwidth))
+
 	if networkDef.Forward != nil {
 		d.Set("mode", networkDef.Forward.Mode)
+
+		// and the forward settings, when given or set up outside of the
+		// provider (eg, when importing the network)
+		if d.Get("forward.#").(int) > 0 || !networkForwardIsDefault(networkDef.Forward) {
+			d.Set("forward", flattenNetworkForward(d, networkDef.Forward))
+		}
 	}
 
 	// Domain as won't be present for bridged networks
@@ -554,6 +651,7 @@ func resourceLibvirtNetworkRead(d *schema.ResourceData, meta interface{}) error
 		return fmt.Errorf("Error reading network autostart setting: %s", err)
 	}
 	d.Set("autostart", autostart)
+	d.Set("restart_required", false)
 
 	// read add the IP addresses
 	addresses := []string{}
@@ -587,6 +685,15 @@ func resourceLibvirtNetworkRead(d *schema.ResourceData, meta interface{}) error
 	}
 	d.Set("dhcp.0.enabled", dhcpEnabled)
 
+	// and the settings of each address family, when given
+	for _, address := range networkDef.IPs {
+		family := getNetworkIPFamily(address)
+		if d.Get(family+".#").(int) == 0 {
+			continue
+		}
+		d.Set(family, flattenNetworkIPFamily(d, family, address))
+	}
+
 	// read the DNS configuration
 	if networkDef.DNS != nil {
 		for i, forwarder := range networkDef.DNS.Forwarders {
@@ -0,0 +1,281 @@
+package libvirt
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	libvirt "github.com/libvirt/libvirt-go"
+)
+
+// a static DHCP host of a libvirt network
+//
+// Resource example:
+//
+//	resource "libvirt_network_dhcp_host" "worker" {
+//	   network_id = "${libvirt_network.k8snet.id}"
+//	   mac        = "52:54:00:6c:3c:01"
+//	   ip         = "10.17.3.10"
+//	   name       = "worker"
+//	   lease_time = "12h"
+//	}
+func resourceLibvirtNetworkDHCPHost() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceLibvirtNetworkDHCPHostCreate,
+		Read:   resourceLibvirtNetworkDHCPHostRead,
+		Update: resourceLibvirtNetworkDHCPHostUpdate,
+		Delete: resourceLibvirtNetworkDHCPHostDelete,
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
+		Schema: map[string]*schema.Schema{
+			"network_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"ip": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateNetworkDHCPHostIP,
+			},
+			"mac": {
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+				DiffSuppressFunc: func(k, old, new string, d *schema.ResourceData) bool {
+					return strings.EqualFold(old, new)
+				},
+			},
+			"name": {
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+			},
+			"lease_time": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateNetworkDHCPLeaseTime,
+				DiffSuppressFunc: func(k, old, new string, d *schema.ResourceData) bool {
+					oldLease, err := newNetworkDHCPLease(old)
+					if err != nil {
+						return false
+					}
+					newLease, err := newNetworkDHCPLease(new)
+					if err != nil {
+						return false
+					}
+					return oldLease.leaseTime() == newLease.leaseTime()
+				},
+			},
+		},
+	}
+}
+
+func validateNetworkDHCPHostIP(v interface{}, k string) ([]string, []error) {
+	if net.ParseIP(v.(string)) == nil {
+		return nil, []error{fmt.Errorf("%q: could not parse address '%s'", k, v.(string))}
+	}
+	return nil, nil
+}
+
+func validateNetworkDHCPLeaseTime(v interface{}, k string) ([]string, []error) {
+	if _, err := newNetworkDHCPLease(v.(string)); err != nil {
+		return nil, []error{fmt.Errorf("%q: %s", k, err)}
+	}
+	return nil, nil
+}
+
+// newNetworkDHCPHostFromResource returns the static DHCP host of the resource
+func newNetworkDHCPHostFromResource(d *schema.ResourceData) (networkDHCPHost, error) {
+	host := networkDHCPHost{
+		MAC:  d.Get("mac").(string),
+		Name: d.Get("name").(string),
+		IP:   d.Get("ip").(string),
+	}
+	if host.MAC == "" && host.Name == "" {
+		return host, fmt.Errorf("At least one of 'mac' or 'name' must be provided for DHCP host %s", host.IP)
+	}
+
+	lease, err := newNetworkDHCPLease(d.Get("lease_time").(string))
+	if err != nil {
+		return host, err
+	}
+	host.Lease = lease
+
+	return host, nil
+}
+
+// updateNetworkDHCPHost applies a change to a static DHCP host of a
+// network, and to the running network if it is active
+func updateNetworkDHCPHost(network *libvirt.Network, command libvirt.NetworkUpdateCommand, host networkDHCPHost) error {
+	networkDef, err := getXMLNetworkDefFromLibvirt(network)
+	if err != nil {
+		return err
+	}
+	parentIndex, err := getNetworkIPIndexForHost(networkDef, host.IP)
+	if err != nil {
+		return err
+	}
+
+	active, err := network.IsActive()
+	if err != nil {
+		return fmt.Errorf("Couldn't determine if network is active: %s", err)
+	}
+	flags := libvirt.NETWORK_UPDATE_AFFECT_CONFIG
+	if active {
+		flags |= libvirt.NETWORK_UPDATE_AFFECT_LIVE
+	}
+
+	data, err := xmlMarshallIndented(host)
+	if err != nil {
+		return fmt.Errorf("Error serializing DHCP host: %s", err)
+	}
+
+	log.Printf("[DEBUG] Updating DHCP host in network %s with XML: %s", networkDef.Name, data)
+	return network.Update(command, libvirt.NETWORK_SECTION_IP_DHCP_HOST, parentIndex, data, flags)
+}
+
+func resourceLibvirtNetworkDHCPHostCreate(d *schema.ResourceData, meta interface{}) error {
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	networkID := d.Get("network_id").(string)
+	network, err := virConn.LookupNetworkByUUIDString(networkID)
+	if err != nil {
+		return fmt.Errorf("Error retrieving libvirt network %s: %s", networkID, err)
+	}
+	defer network.Free()
+
+	host, err := newNetworkDHCPHostFromResource(d)
+	if err != nil {
+		return err
+	}
+
+	if err := updateNetworkDHCPHost(network, libvirt.NETWORK_UPDATE_COMMAND_ADD_LAST, host); err != nil {
+		return fmt.Errorf("Error adding DHCP host %s to network %s: %s", host.IP, networkID, err)
+	}
+	d.SetId(networkDHCPHostID(networkID, host.IP))
+
+	log.Printf("[INFO] DHCP host ID: %s", d.Id())
+
+	return resourceLibvirtNetworkDHCPHostRead(d, meta)
+}
+
+// resourceLibvirtNetworkDHCPHostUpdate changes the lease time of the host
+func resourceLibvirtNetworkDHCPHostUpdate(d *schema.ResourceData, meta interface{}) error {
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	if d.HasChange("lease_time") {
+		networkID := d.Get("network_id").(string)
+		network, err := virConn.LookupNetworkByUUIDString(networkID)
+		if err != nil {
+			return fmt.Errorf("Error retrieving libvirt network %s: %s", networkID, err)
+		}
+		defer network.Free()
+
+		host, err := newNetworkDHCPHostFromResource(d)
+		if err != nil {
+			return err
+		}
+
+		if err := updateNetworkDHCPHost(network, libvirt.NETWORK_UPDATE_COMMAND_MODIFY, host); err != nil {
+			return fmt.Errorf("Error updating DHCP host %s in network %s: %s", host.IP, networkID, err)
+		}
+	}
+
+	return resourceLibvirtNetworkDHCPHostRead(d, meta)
+}
+
+func resourceLibvirtNetworkDHCPHostRead(d *schema.ResourceData, meta interface{}) error {
+	log.Printf("[DEBUG] Read resource libvirt_network_dhcp_host")
+
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	networkID, address, err := parseNetworkDHCPHostID(d.Id())
+	if err != nil {
+		return err
+	}
+
+	network, err := virConn.LookupNetworkByUUIDString(networkID)
+	if err != nil {
+		if virErr, ok := err.(libvirt.Error); ok && virErr.Code == libvirt.ERR_NO_NETWORK {
+			log.Printf("Network '%s' of DHCP host %s may have been deleted outside Terraform", networkID, address)
+			d.SetId("")
+			return nil
+		}
+		return fmt.Errorf("Error retrieving libvirt network %s: %s", networkID, err)
+	}
+	defer network.Free()
+
+	hosts, err := getNetworkDHCPHosts(network)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(address)
+	var host *networkDHCPHost
+	for i := range hosts {
+		if ip.Equal(net.ParseIP(hosts[i].IP)) {
+			host = &hosts[i]
+			break
+		}
+	}
+	if host == nil {
+		log.Printf("DHCP host '%s' may have been deleted outside Terraform", d.Id())
+		d.SetId("")
+		return nil
+	}
+
+	d.Set("network_id", networkID)
+	d.Set("ip", address)
+	d.Set("mac", host.MAC)
+	d.Set("name", host.Name)
+	d.Set("lease_time", host.Lease.leaseTime())
+
+	return nil
+}
+
+func resourceLibvirtNetworkDHCPHostDelete(d *schema.ResourceData, meta interface{}) error {
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+	log.Printf("[DEBUG] Deleting DHCP host %s", d.Id())
+
+	networkID, address, err := parseNetworkDHCPHostID(d.Id())
+	if err != nil {
+		return err
+	}
+
+	network, err := virConn.LookupNetworkByUUIDString(networkID)
+	if err != nil {
+		if virErr, ok := err.(libvirt.Error); ok && virErr.Code == libvirt.ERR_NO_NETWORK {
+			return nil
+		}
+		return fmt.Errorf("Error retrieving libvirt network %s: %s", networkID, err)
+	}
+	defer network.Free()
+
+	host := networkDHCPHost{
+		MAC:  d.Get("mac").(string),
+		Name: d.Get("name").(string),
+		IP:   address,
+	}
+	if err := updateNetworkDHCPHost(network, libvirt.NETWORK_UPDATE_COMMAND_DELETE, host); err != nil {
+		return fmt.Errorf("Error removing DHCP host %s from network %s: %s", address, networkID, err)
+	}
+
+	return nil
+}
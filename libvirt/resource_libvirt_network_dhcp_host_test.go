@@ -0,0 +1,128 @@
+package libvirt
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/acctest"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// testAccCheckLibvirtNetworkDHCPHost checks the host in the network has
+// the expected lease time
+func testAccCheckLibvirtNetworkDHCPHost(name string, expectedLeaseTime string) resource.TestCheckFunc {
+	return func(state *terraform.State) error {
+		virConn := testAccProvider.Meta().(*Client).libvirt
+
+		rs, err := getResourceFromTerraformState(name, state)
+		if err != nil {
+			return err
+		}
+
+		networkID, address, err := parseNetworkDHCPHostID(rs.Primary.ID)
+		if err != nil {
+			return err
+		}
+		network, err := virConn.LookupNetworkByUUIDString(networkID)
+		if err != nil {
+			return err
+		}
+		defer network.Free()
+
+		hosts, err := getNetworkDHCPHosts(network)
+		if err != nil {
+			return err
+		}
+		for _, host := range hosts {
+			if net.ParseIP(host.IP).Equal(net.ParseIP(address)) {
+				if leaseTime := host.Lease.leaseTime(); leaseTime != expectedLeaseTime {
+					return fmt.Errorf("Expected lease time '%s', got '%s'", expectedLeaseTime, leaseTime)
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("DHCP host %s not found", rs.Primary.ID)
+	}
+}
+
+func testAccCheckLibvirtNetworkDHCPHostDestroy(state *terraform.State) error {
+	virConn := testAccProvider.Meta().(*Client).libvirt
+	for _, rs := range state.RootModule().Resources {
+		if rs.Type != "libvirt_network_dhcp_host" {
+			continue
+		}
+		networkID, address, err := parseNetworkDHCPHostID(rs.Primary.ID)
+		if err != nil {
+			return err
+		}
+		network, err := virConn.LookupNetworkByUUIDString(networkID)
+		if err != nil {
+			// the network is gone too
+			continue
+		}
+		hosts, err := getNetworkDHCPHosts(network)
+		network.Free()
+		if err != nil {
+			return err
+		}
+		for _, host := range hosts {
+			if net.ParseIP(host.IP).Equal(net.ParseIP(address)) {
+				return fmt.Errorf(
+					"Error waiting for DHCP host (%s) to be destroyed",
+					rs.Primary.ID)
+			}
+		}
+	}
+	return nil
+}
+
+func testAccLibvirtNetworkDHCPHostConfig(randomName string, hostConfig string) string {
+	return fmt.Sprintf(`
+	resource "libvirt_network" "%[1]s" {
+		name      = "%[1]s"
+		mode      = "nat"
+		addresses = ["10.17.3.0/24"]
+	}
+
+	resource "libvirt_network_dhcp_host" "%[1]s" {
+		network_id = "${libvirt_network.%[1]s.id}"
+		mac        = "52:54:00:6C:3C:01"
+		ip         = "10.17.3.10"
+		name       = "%[1]s"
+		%[2]s
+	}`, randomName, hostConfig)
+}
+
+func TestAccLibvirtNetworkDHCPHost_Basic(t *testing.T) {
+	randomName := acctest.RandString(10)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtNetworkDHCPHostDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccLibvirtNetworkDHCPHostConfig(randomName, ""),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtNetworkDHCPHost("libvirt_network_dhcp_host."+randomName, ""),
+					resource.TestCheckResourceAttr(
+						"libvirt_network_dhcp_host."+randomName, "ip", "10.17.3.10"),
+					resource.TestCheckResourceAttr(
+						"libvirt_network_dhcp_host."+randomName, "name", randomName),
+				),
+			},
+			{
+				Config: testAccLibvirtNetworkDHCPHostConfig(randomName, `lease_time = "12h"`),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtNetworkDHCPHost("libvirt_network_dhcp_host."+randomName, "12h0m0s"),
+				),
+			},
+			{
+				ResourceName:      "libvirt_network_dhcp_host." + randomName,
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
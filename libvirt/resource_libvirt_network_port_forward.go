@@ -0,0 +1,239 @@
+package libvirt
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	libvirt "github.com/libvirt/libvirt-go"
+)
+
+// a port of the hypervisor forwarded to a guest of a NAT network
+//
+// Resource example:
+//
+//	resource "libvirt_network_port_forward" "ssh" {
+//	   network_id    = "${libvirt_network.k8snet.id}"
+//	   host_port     = 2222
+//	   guest_address = "10.17.3.10"
+//	   guest_port    = 22
+//	}
+func resourceLibvirtNetworkPortForward() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceLibvirtNetworkPortForwardCreate,
+		Read:   resourceLibvirtNetworkPortForwardRead,
+		Delete: resourceLibvirtNetworkPortForwardDelete,
+		Schema: map[string]*schema.Schema{
+			"network_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"protocol": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				Default:      "tcp",
+				ValidateFunc: validateNetworkPortForwardProtocol,
+			},
+			"host_address": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validateNetworkPortForwardAddress,
+			},
+			"host_port": {
+				Type:         schema.TypeInt,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateNetworkPortForwardPort,
+			},
+			"guest_address": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateNetworkPortForwardAddress,
+			},
+			"guest_port": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateNetworkPortForwardPort,
+			},
+			"bridge": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func validateNetworkPortForwardProtocol(v interface{}, k string) ([]string, []error) {
+	switch v.(string) {
+	case "tcp", "udp":
+		return nil, nil
+	}
+	return nil, []error{fmt.Errorf("%q must be 'tcp' or 'udp', got '%s'", k, v.(string))}
+}
+
+func validateNetworkPortForwardAddress(v interface{}, k string) ([]string, []error) {
+	if ip := net.ParseIP(v.(string)); ip == nil || ip.To4() == nil {
+		return nil, []error{fmt.Errorf("%q must be an IPv4 address, got '%s'", k, v.(string))}
+	}
+	return nil, nil
+}
+
+func validateNetworkPortForwardPort(v interface{}, k string) ([]string, []error) {
+	if port := v.(int); port < 1 || port > 65535 {
+		return nil, []error{fmt.Errorf("%q must be between 1 and 65535, got %d", k, port)}
+	}
+	return nil, nil
+}
+
+// networkPortForwardID returns the terraform id of a port forward: a port of
+// the hypervisor can only be forwarded once
+func networkPortForwardID(networkID string, protocol string, hostAddress string, hostPort int) string {
+	return fmt.Sprintf("%s/%s/%s", networkID, protocol, net.JoinHostPort(hostAddress, strconv.Itoa(hostPort)))
+}
+
+// parseNetworkPortForwardID returns the UUID of the network of a port forward
+func parseNetworkPortForwardID(id string) (string, error) {
+	parts := strings.SplitN(id, "/", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return "", fmt.Errorf("Invalid port forward id '%s': expected <network id>/<protocol>/<host address>:<host port>", id)
+	}
+	return parts[0], nil
+}
+
+// newNetworkPortForwardFromResource returns the port forward of the resource
+func newNetworkPortForwardFromResource(d *schema.ResourceData) networkPortForward {
+	return networkPortForward{
+		ID:           d.Id(),
+		Protocol:     d.Get("protocol").(string),
+		HostAddress:  d.Get("host_address").(string),
+		HostPort:     d.Get("host_port").(int),
+		GuestAddress: d.Get("guest_address").(string),
+		GuestPort:    d.Get("guest_port").(int),
+		Bridge:       d.Get("bridge").(string),
+	}
+}
+
+func resourceLibvirtNetworkPortForwardCreate(d *schema.ResourceData, meta interface{}) error {
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	networkID := d.Get("network_id").(string)
+	network, err := virConn.LookupNetworkByUUIDString(networkID)
+	if err != nil {
+		return fmt.Errorf("Error retrieving libvirt network %s: %s", networkID, err)
+	}
+	defer network.Free()
+
+	networkDef, err := getXMLNetworkDefFromLibvirt(network)
+	if err != nil {
+		return err
+	}
+	if networkDef.Forward == nil || networkDef.Forward.Mode != netModeNat || networkDef.Bridge == nil {
+		return fmt.Errorf("Ports can only be forwarded to guests of networks in %s mode", netModeNat)
+	}
+
+	guestAddress := d.Get("guest_address").(string)
+	if _, err := getNetworkIPIndexForHost(networkDef, guestAddress); err != nil {
+		return err
+	}
+
+	if _, ok := d.GetOk("guest_port"); !ok {
+		d.Set("guest_port", d.Get("host_port").(int))
+	}
+	d.Set("bridge", networkDef.Bridge.Name)
+
+	uri, err := virConn.GetURI()
+	if err != nil {
+		return fmt.Errorf("Error retrieving libvirt connection URI: %s", err)
+	}
+
+	id := networkPortForwardID(networkID, d.Get("protocol").(string), d.Get("host_address").(string), d.Get("host_port").(int))
+	d.SetId(id)
+	forward := newNetworkPortForwardFromResource(d)
+	if err := addFirewallRules(uri, forward.firewallRules()); err != nil {
+		d.SetId("")
+		return fmt.Errorf("Error forwarding port %d to %s: %s", forward.HostPort, forward.GuestAddress, err)
+	}
+
+	log.Printf("[INFO] Port forward ID: %s", d.Id())
+
+	return resourceLibvirtNetworkPortForwardRead(d, meta)
+}
+
+// resourceLibvirtNetworkPortForwardRead checks the firewall rules of the port
+// forward are still in place: they are lost, for example, when the
+// hypervisor reboots
+func resourceLibvirtNetworkPortForwardRead(d *schema.ResourceData, meta interface{}) error {
+	log.Printf("[DEBUG] Read resource libvirt_network_port_forward")
+
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	networkID, err := parseNetworkPortForwardID(d.Id())
+	if err != nil {
+		return err
+	}
+
+	network, err := virConn.LookupNetworkByUUIDString(networkID)
+	if err != nil {
+		if virErr, ok := err.(libvirt.Error); ok && virErr.Code == libvirt.ERR_NO_NETWORK {
+			log.Printf("Network '%s' of port forward %s may have been deleted outside Terraform", networkID, d.Id())
+			d.SetId("")
+			return nil
+		}
+		return fmt.Errorf("Error retrieving libvirt network %s: %s", networkID, err)
+	}
+	defer network.Free()
+
+	uri, err := virConn.GetURI()
+	if err != nil {
+		return fmt.Errorf("Error retrieving libvirt connection URI: %s", err)
+	}
+
+	exist, err := firewallRulesExist(uri, newNetworkPortForwardFromResource(d).firewallRules())
+	if err != nil {
+		return err
+	}
+	if !exist {
+		log.Printf("Firewall rules of port forward '%s' may have been deleted outside Terraform, or be behind the rules of libvirt after restarting the network", d.Id())
+		d.SetId("")
+		return nil
+	}
+
+	d.Set("network_id", networkID)
+
+	return nil
+}
+
+func resourceLibvirtNetworkPortForwardDelete(d *schema.ResourceData, meta interface{}) error {
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+	log.Printf("[DEBUG] Deleting port forward %s", d.Id())
+
+	uri, err := virConn.GetURI()
+	if err != nil {
+		return fmt.Errorf("Error retrieving libvirt connection URI: %s", err)
+	}
+
+	forward := newNetworkPortForwardFromResource(d)
+	if err := deleteFirewallRules(uri, forward.firewallRules()); err != nil {
+		return fmt.Errorf("Error removing forward of port %d to %s: %s", forward.HostPort, forward.GuestAddress, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package libvirt
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/acctest"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestParseNetworkPortForwardID(t *testing.T) {
+	id := networkPortForwardID("8d9c4b2e-22d2-4a48-b1a4-2b2bcd4b2b11", "tcp", "", 2222)
+	if id != "8d9c4b2e-22d2-4a48-b1a4-2b2bcd4b2b11/tcp/:2222" {
+		t.Errorf("Unexpected port forward id %s", id)
+	}
+	networkID, err := parseNetworkPortForwardID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if networkID != "8d9c4b2e-22d2-4a48-b1a4-2b2bcd4b2b11" {
+		t.Errorf("Unexpected network id %s", networkID)
+	}
+
+	for _, invalid := range []string{"", "8d9c4b2e-22d2-4a48-b1a4-2b2bcd4b2b11", "/tcp/:2222"} {
+		if _, err := parseNetworkPortForwardID(invalid); err == nil {
+			t.Errorf("Expected an error parsing '%s'", invalid)
+		}
+	}
+}
+
+// testAccNetworkPortForwardRulesExist returns whether the firewall rules of
+// a port forward in the state are in place
+func testAccNetworkPortForwardRulesExist(rs *terraform.ResourceState) (bool, error) {
+	virConn := testAccProvider.Meta().(*Client).libvirt
+	uri, err := virConn.GetURI()
+	if err != nil {
+		return false, err
+	}
+	hostPort, _ := strconv.Atoi(rs.Primary.Attributes["host_port"])
+	guestPort, _ := strconv.Atoi(rs.Primary.Attributes["guest_port"])
+	forward := networkPortForward{
+		ID:           rs.Primary.ID,
+		Protocol:     rs.Primary.Attributes["protocol"],
+		HostAddress:  rs.Primary.Attributes["host_address"],
+		HostPort:     hostPort,
+		GuestAddress: rs.Primary.Attributes["guest_address"],
+		GuestPort:    guestPort,
+		Bridge:       rs.Primary.Attributes["bridge"],
+	}
+	return firewallRulesExist(uri, forward.firewallRules())
+}
+
+func testAccCheckLibvirtNetworkPortForwardExists(name string) resource.TestCheckFunc {
+	return func(state *terraform.State) error {
+		rs, err := getResourceFromTerraformState(name, state)
+		if err != nil {
+			return err
+		}
+		exist, err := testAccNetworkPortForwardRulesExist(rs)
+		if err != nil {
+			return err
+		}
+		if !exist {
+			return fmt.Errorf("Firewall rules of port forward %s not found", rs.Primary.ID)
+		}
+		return nil
+	}
+}
+
+func testAccCheckLibvirtNetworkPortForwardDestroy(state *terraform.State) error {
+	for _, rs := range state.RootModule().Resources {
+		if rs.Type != "libvirt_network_port_forward" {
+			continue
+		}
+		exist, err := testAccNetworkPortForwardRulesExist(rs)
+		if err != nil {
+			return err
+		}
+		if exist {
+			return fmt.Errorf(
+				"Error waiting for port forward (%s) to be destroyed",
+				rs.Primary.ID)
+		}
+	}
+	return nil
+}
+
+func TestAccLibvirtNetworkPortForward_Basic(t *testing.T) {
+	randomName := acctest.RandString(10)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtNetworkPortForwardDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_network" "%[1]s" {
+					name      = "%[1]s"
+					mode      = "nat"
+					addresses = ["10.17.3.0/24"]
+				}
+
+				resource "libvirt_network_port_forward" "%[1]s" {
+					network_id    = "${libvirt_network.%[1]s.id}"
+					host_port     = 52222
+					guest_address = "10.17.3.10"
+					guest_port    = 22
+				}`, randomName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtNetworkPortForwardExists("libvirt_network_port_forward."+randomName),
+					resource.TestCheckResourceAttr("libvirt_network_port_forward."+randomName, "protocol", "tcp"),
+					resource.TestCheckResourceAttrPair(
+						"libvirt_network_port_forward."+randomName, "bridge",
+						"libvirt_network."+randomName, "bridge"),
+				),
+			},
+		},
+	})
+}
@@ -556,3 +556,253 @@ func TestAccLibvirtNetwork_MTU(t *testing.T) {
 		},
 	})
 }
+
+func TestAccLibvirtNetwork_UpdateInPlace(t *testing.T) {
+	var network libvirt.Network
+	var networkID string
+	randomNetworkResource := acctest.RandString(10)
+	randomNetworkName := acctest.RandString(10)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtNetworkDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_network" "%s" {
+					name      = "%s"
+					mode      = "nat"
+					domain    = "k8s.local"
+					addresses = ["10.17.3.0/24"]
+					dhcp {
+						enabled = true
+					}
+				}`, randomNetworkResource, randomNetworkName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckNetworkExists("libvirt_network."+randomNetworkResource, &network),
+					func(*terraform.State) error {
+						var err error
+						networkID, err = network.GetUUIDString()
+						return err
+					},
+					testAccCheckLibvirtNetworkDhcpStatus("libvirt_network."+randomNetworkResource, "enabled"),
+				),
+			},
+			{
+				// DHCP ranges and SRV entries are changed in the running network
+				Config: fmt.Sprintf(`
+				resource "libvirt_network" "%s" {
+					name      = "%s"
+					mode      = "nat"
+					domain    = "k8s.local"
+					addresses = ["10.17.3.0/24"]
+					dhcp {
+						enabled = false
+					}
+					dns {
+						srvs = [
+						  {
+						    service  = "etcd-server"
+						    protocol = "tcp"
+						    domain   = "k8s.local"
+						    target   = "etcd.k8s.local"
+						    port     = "2380"
+						  },
+						]
+					}
+				}`, randomNetworkResource, randomNetworkName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckNetworkExists("libvirt_network."+randomNetworkResource, &network),
+					resource.TestCheckResourceAttrPtr("libvirt_network."+randomNetworkResource, "id", &networkID),
+					resource.TestCheckResourceAttr("libvirt_network."+randomNetworkResource, "restart_required", "false"),
+					testAccCheckLibvirtNetworkDhcpStatus("libvirt_network."+randomNetworkResource, "disabled"),
+				),
+			},
+			{
+				// forwarders and routes need the network to be restarted
+				Config: fmt.Sprintf(`
+				resource "libvirt_network" "%s" {
+					name      = "%s"
+					mode      = "nat"
+					domain    = "k8s.local"
+					addresses = ["10.17.3.0/24"]
+					dhcp {
+						enabled = false
+					}
+					dns {
+						forwarders = [
+						  {
+						    address = "8.8.8.8",
+						  },
+						]
+					}
+					routes {
+						cidr    = "10.17.0.0/16"
+						gateway = "10.17.3.2"
+					}
+				}`, randomNetworkResource, randomNetworkName),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckNetworkExists("libvirt_network."+randomNetworkResource, &network),
+					resource.TestCheckResourceAttrPtr("libvirt_network."+randomNetworkResource, "id", &networkID),
+					testAccCheckLibvirtNetworkDNSForwarders("libvirt_network."+randomNetworkResource, []libvirtxml.NetworkDNSForwarder{
+						{
+							Addr: "8.8.8.8",
+						},
+					}),
+				),
+			},
+		},
+	})
+}
+
+func TestAccLibvirtNetwork_DualStack(t *testing.T) {
+	var network libvirt.Network
+	var networkID string
+	randomNetworkResource := acctest.RandString(10)
+	randomNetworkName := acctest.RandString(10)
+	config := func(dhcpStart string, raMode string) string {
+		return fmt.Sprintf(`
+		resource "libvirt_network" "%s" {
+			name      = "%s"
+			mode      = "nat"
+			addresses = ["10.17.3.0/24", "2001:db8:ca2:2::/64"]
+			ipv4 {
+				dhcp_start = "%s"
+				dhcp_end   = "10.17.3.200"
+			}
+			ipv6 {
+				ra_mode = "%s"
+			}
+		}`, randomNetworkResource, randomNetworkName, dhcpStart, raMode)
+	}
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtNetworkDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: config("10.17.3.100", "slaac"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckNetworkExists("libvirt_network."+randomNetworkResource, &network),
+					func(*terraform.State) error {
+						var err error
+						networkID, err = network.GetUUIDString()
+						return err
+					},
+					testAccCheckLibvirtNetworkDHCPRanges("libvirt_network."+randomNetworkResource, []string{"10.17.3.100-10.17.3.200", ""}),
+				),
+			},
+			{
+				Config: config("10.17.3.150", "stateful"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrPtr("libvirt_network."+randomNetworkResource, "id", &networkID),
+					resource.TestCheckResourceAttr("libvirt_network."+randomNetworkResource, "ipv4.0.dhcp_start", "10.17.3.150"),
+					resource.TestCheckResourceAttr("libvirt_network."+randomNetworkResource, "ipv6.0.ra_mode", "stateful"),
+					testAccCheckLibvirtNetworkDHCPRanges("libvirt_network."+randomNetworkResource, []string{
+						"10.17.3.150-10.17.3.200",
+						"2001:db8:ca2:2::2-2001:db8:ca2:2:ffff:ffff:ffff:fffe",
+					}),
+				),
+			},
+		},
+	})
+}
+
+func TestAccLibvirtNetwork_ForwardModes(t *testing.T) {
+	randomNetworkResource := acctest.RandString(10)
+	randomNetworkName := acctest.RandString(10)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtNetworkDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_network" "%s" {
+					name      = "%s"
+					mode      = "nat"
+					addresses = ["10.17.3.0/24"]
+					forward {
+						nat {
+							address_start = "192.168.122.10"
+							address_end   = "192.168.122.20"
+							port_start    = 2000
+							port_end      = 3000
+						}
+					}
+				}`, randomNetworkResource, randomNetworkName),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("libvirt_network."+randomNetworkResource, "forward.0.nat.0.port_start", "2000"),
+					testAccCheckLibvirtNetworkForward("libvirt_network."+randomNetworkResource, &libvirtxml.NetworkForward{
+						Mode: "nat",
+						NAT: &libvirtxml.NetworkForwardNAT{
+							Addresses: []libvirtxml.NetworkForwardNATAddress{{Start: "192.168.122.10", End: "192.168.122.20"}},
+							Ports:     []libvirtxml.NetworkForwardNATPort{{Start: 2000, End: 3000}},
+						},
+					}),
+				),
+			},
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_network" "%s" {
+					name      = "%s"
+					mode      = "open"
+					addresses = ["10.17.3.0/24"]
+				}`, randomNetworkResource, randomNetworkName),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("libvirt_network."+randomNetworkResource, "mode", "open"),
+					testAccCheckLibvirtNetworkForward("libvirt_network."+randomNetworkResource, &libvirtxml.NetworkForward{
+						Mode: "open",
+					}),
+					testAccCheckLibvirtNetworkDHCPRanges("libvirt_network."+randomNetworkResource, []string{"10.17.3.2-10.17.3.254"}),
+				),
+			},
+		},
+	})
+}
+
+func TestAccLibvirtNetwork_Bandwidth(t *testing.T) {
+	randomNetworkResource := acctest.RandString(10)
+	randomNetworkName := acctest.RandString(10)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtNetworkDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_network" "%s" {
+					name      = "%s"
+					mode      = "nat"
+					addresses = ["10.17.3.0/24"]
+					bandwidth {
+						inbound {
+							average = 1000
+							peak    = 5000
+							burst   = 1024
+						}
+						outbound {
+							average = 2000
+						}
+					}
+				}`, randomNetworkResource, randomNetworkName),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("libvirt_network."+randomNetworkResource, "bandwidth.0.inbound.0.average", "1000"),
+					resource.TestCheckResourceAttr("libvirt_network."+randomNetworkResource, "bandwidth.0.inbound.0.burst", "1024"),
+					resource.TestCheckResourceAttr("libvirt_network."+randomNetworkResource, "bandwidth.0.outbound.0.average", "2000"),
+				),
+			},
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_network" "%s" {
+					name      = "%s"
+					mode      = "nat"
+					addresses = ["10.17.3.0/24"]
+				}`, randomNetworkResource, randomNetworkName),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("libvirt_network."+randomNetworkResource, "bandwidth.#", "0"),
+				),
+			},
+		},
+	})
+}
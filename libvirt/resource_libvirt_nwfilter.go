@@ -0,0 +1,332 @@
+package libvirt
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	libvirt "github.com/libvirt/libvirt-go"
+	"github.com/libvirt/libvirt-go-xml"
+)
+
+// a libvirt network filter
+//
+// Resource example:
+//
+//	resource "libvirt_nwfilter" "ssh_only" {
+//	   name = "ssh-only"
+//
+//	   filterref {
+//	      filter = "clean-traffic"
+//	   }
+//
+//	   rule {
+//	      action    = "accept"
+//	      direction = "in"
+//	      protocol  = "tcp"
+//	      match = {
+//	         dstportstart = 22
+//	      }
+//	   }
+//
+//	   rule {
+//	      action    = "drop"
+//	      direction = "inout"
+//	      priority  = 1000
+//	      protocol  = "all"
+//	   }
+//	}
+func resourceLibvirtNWFilter() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceLibvirtNWFilterCreate,
+		Read:   resourceLibvirtNWFilterRead,
+		Update: resourceLibvirtNWFilterUpdate,
+		Delete: resourceLibvirtNWFilterDelete,
+		Exists: resourceLibvirtNWFilterExists,
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"chain": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"priority": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateNWFilterPriority,
+			},
+			"filterref": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"filter": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						"parameters": {
+							Type:     schema.TypeMap,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+					},
+				},
+			},
+			"rule": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"action": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validateStringInSlice(nwFilterRuleActions),
+						},
+						"direction": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validateStringInSlice(nwFilterRuleDirections),
+						},
+						"priority": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							Default:      nwFilterRuleDefaultPriority,
+							ValidateFunc: validateNWFilterPriority,
+						},
+						"statematch": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  true,
+						},
+						"protocol": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validateStringInSlice(nwFilterRuleProtocols),
+						},
+						"match": {
+							Type:     schema.TypeMap,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func validateNWFilterPriority(v interface{}, k string) ([]string, []error) {
+	if priority := v.(int); priority < -1000 || priority > 1000 {
+		return nil, []error{fmt.Errorf("%q must be between -1000 and 1000, got %d", k, priority)}
+	}
+	return nil, nil
+}
+
+// newNWFilterDefFromResource returns the network filter of the resource
+func newNWFilterDefFromResource(d *schema.ResourceData) nwFilterDef {
+	filterDef := nwFilterDef{
+		Name:     d.Get("name").(string),
+		Chain:    d.Get("chain").(string),
+		Priority: d.Get("priority").(int),
+	}
+
+	for i := 0; i < d.Get("filterref.#").(int); i++ {
+		prefix := fmt.Sprintf("filterref.%d", i)
+		filterDef.Refs = append(filterDef.Refs, libvirtxml.NWFilterRef{
+			Filter:     d.Get(prefix + ".filter").(string),
+			Parameters: expandFilterParameters(d.Get(prefix + ".parameters").(map[string]interface{})),
+		})
+	}
+
+	for i := 0; i < d.Get("rule.#").(int); i++ {
+		prefix := fmt.Sprintf("rule.%d", i)
+		filterDef.Rules = append(filterDef.Rules, nwFilterRule{
+			Action:     d.Get(prefix + ".action").(string),
+			Direction:  d.Get(prefix + ".direction").(string),
+			Priority:   d.Get(prefix + ".priority").(int),
+			StateMatch: nwFilterRuleStateMatch(d.Get(prefix + ".statematch").(bool)),
+			Protocols: []nwFilterRuleProtocol{
+				newNWFilterRuleProtocol(d.Get(prefix+".protocol").(string), d.Get(prefix+".match").(map[string]interface{})),
+			},
+		})
+	}
+
+	return filterDef
+}
+
+// defineNWFilter defines the network filter of the resource, replacing the
+// existing one with the same UUID. libvirt applies the changes to the
+// interfaces using the filter.
+func defineNWFilter(d *schema.ResourceData, virConn *libvirt.Connect) (*libvirt.NWFilter, error) {
+	filterDef := newNWFilterDefFromResource(d)
+	filterDef.UUID = d.Id()
+
+	data, err := xmlMarshallIndented(filterDef)
+	if err != nil {
+		return nil, fmt.Errorf("Error serializing libvirt network filter: %s", err)
+	}
+	log.Printf("[DEBUG] Generated XML for libvirt network filter:\n%s", data)
+
+	filter, err := virConn.NWFilterDefineXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("Error defining libvirt network filter: %s - %s", err, data)
+	}
+	return filter, nil
+}
+
+func resourceLibvirtNWFilterCreate(d *schema.ResourceData, meta interface{}) error {
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	// defining a filter with the name of an existing one replaces it
+	name := d.Get("name").(string)
+	if filter, err := virConn.LookupNWFilterByName(name); err == nil {
+		filter.Free()
+		return fmt.Errorf("network filter '%s' already exists", name)
+	}
+
+	filter, err := defineNWFilter(d, virConn)
+	if err != nil {
+		return err
+	}
+	defer filter.Free()
+
+	id, err := filter.GetUUIDString()
+	if err != nil {
+		return fmt.Errorf("Error retrieving libvirt network filter id: %s", err)
+	}
+	d.SetId(id)
+
+	log.Printf("[INFO] Network filter ID: %s", d.Id())
+
+	return resourceLibvirtNWFilterRead(d, meta)
+}
+
+func resourceLibvirtNWFilterUpdate(d *schema.ResourceData, meta interface{}) error {
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	filter, err := defineNWFilter(d, virConn)
+	if err != nil {
+		return err
+	}
+	filter.Free()
+
+	return resourceLibvirtNWFilterRead(d, meta)
+}
+
+func resourceLibvirtNWFilterRead(d *schema.ResourceData, meta interface{}) error {
+	log.Printf("[DEBUG] Read resource libvirt_nwfilter")
+
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	filter, err := virConn.LookupNWFilterByUUIDString(d.Id())
+	if err != nil {
+		if virErr, ok := err.(libvirt.Error); ok && virErr.Code == libvirt.ERR_NO_NWFILTER {
+			log.Printf("Network filter '%s' may have been deleted outside Terraform", d.Id())
+			d.SetId("")
+			return nil
+		}
+		return fmt.Errorf("Error retrieving libvirt network filter: %s", err)
+	}
+	defer filter.Free()
+
+	filterDef, err := newNWFilterDefFromLibvirt(filter)
+	if err != nil {
+		return err
+	}
+
+	d.Set("name", filterDef.Name)
+	d.Set("chain", filterDef.Chain)
+	// libvirt omits the priority when it is the default one of the chain
+	if filterDef.Priority != 0 {
+		d.Set("priority", filterDef.Priority)
+	}
+
+	refs := make([]map[string]interface{}, 0, len(filterDef.Refs))
+	for _, ref := range filterDef.Refs {
+		refs = append(refs, map[string]interface{}{
+			"filter":     ref.Filter,
+			"parameters": flattenFilterParameters(ref.Parameters),
+		})
+	}
+	d.Set("filterref", refs)
+
+	rules := make([]map[string]interface{}, 0, len(filterDef.Rules))
+	for _, rule := range filterDef.Rules {
+		protocol := ""
+		match := map[string]interface{}{}
+		if len(rule.Protocols) > 0 {
+			protocol = rule.Protocols[0].XMLName.Local
+			match = rule.Protocols[0].match()
+		}
+		rules = append(rules, map[string]interface{}{
+			"action":     rule.Action,
+			"direction":  rule.Direction,
+			"priority":   rule.Priority,
+			"statematch": parseNWFilterRuleStateMatch(rule.StateMatch),
+			"protocol":   protocol,
+			"match":      match,
+		})
+	}
+	d.Set("rule", rules)
+
+	return nil
+}
+
+func resourceLibvirtNWFilterDelete(d *schema.ResourceData, meta interface{}) error {
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+	log.Printf("[DEBUG] Deleting network filter %s", d.Id())
+
+	filter, err := virConn.LookupNWFilterByUUIDString(d.Id())
+	if err != nil {
+		return fmt.Errorf("Error retrieving libvirt network filter: %s", err)
+	}
+	defer filter.Free()
+
+	// libvirt refuses to undefine the filters in use by an interface
+	if err := filter.Undefine(); err != nil {
+		return fmt.Errorf("Error undefining libvirt network filter: %s", err)
+	}
+
+	return nil
+}
+
+func resourceLibvirtNWFilterExists(d *schema.ResourceData, meta interface{}) (bool, error) {
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return false, fmt.Errorf(LibVirtConIsNil)
+	}
+	filter, err := virConn.LookupNWFilterByUUIDString(d.Id())
+	if err != nil {
+		if virErr, ok := err.(libvirt.Error); ok && virErr.Code == libvirt.ERR_NO_NWFILTER {
+			return false, nil
+		}
+		return false, err
+	}
+	defer filter.Free()
+
+	return true, nil
+}
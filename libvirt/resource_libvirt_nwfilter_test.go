@@ -0,0 +1,113 @@
+package libvirt
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/acctest"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func testAccCheckLibvirtNWFilterExists(name string, filterDef *nwFilterDef) resource.TestCheckFunc {
+	return func(state *terraform.State) error {
+		virConn := testAccProvider.Meta().(*Client).libvirt
+
+		rs, err := getResourceFromTerraformState(name, state)
+		if err != nil {
+			return err
+		}
+
+		filter, err := virConn.LookupNWFilterByUUIDString(rs.Primary.ID)
+		if err != nil {
+			return err
+		}
+		defer filter.Free()
+
+		*filterDef, err = newNWFilterDefFromLibvirt(filter)
+		return err
+	}
+}
+
+func testAccCheckLibvirtNWFilterDestroy(state *terraform.State) error {
+	virConn := testAccProvider.Meta().(*Client).libvirt
+	for _, rs := range state.RootModule().Resources {
+		if rs.Type != "libvirt_nwfilter" {
+			continue
+		}
+		_, err := virConn.LookupNWFilterByUUIDString(rs.Primary.ID)
+		if err == nil {
+			return fmt.Errorf(
+				"Error waiting for network filter (%s) to be destroyed",
+				rs.Primary.ID)
+		}
+	}
+	return nil
+}
+
+func TestAccLibvirtNWFilter_Basic(t *testing.T) {
+	var filterDef nwFilterDef
+	randomName := acctest.RandString(10)
+	config := func(port int) string {
+		return fmt.Sprintf(`
+		resource "libvirt_nwfilter" "%[1]s" {
+			name = "%[1]s"
+
+			filterref {
+				filter = "clean-traffic"
+			}
+
+			rule {
+				action    = "accept"
+				direction = "in"
+				protocol  = "tcp"
+				match = {
+					dstportstart = %[2]d
+				}
+			}
+
+			rule {
+				action     = "drop"
+				direction  = "inout"
+				priority   = 1000
+				statematch = false
+				protocol   = "all"
+			}
+		}`, randomName, port)
+	}
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtNWFilterDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: config(22),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtNWFilterExists("libvirt_nwfilter."+randomName, &filterDef),
+					resource.TestCheckResourceAttr("libvirt_nwfilter."+randomName, "chain", "root"),
+					resource.TestCheckResourceAttr("libvirt_nwfilter."+randomName, "filterref.0.filter", "clean-traffic"),
+					resource.TestCheckResourceAttr("libvirt_nwfilter."+randomName, "rule.0.match.dstportstart", "22"),
+					resource.TestCheckResourceAttr("libvirt_nwfilter."+randomName, "rule.1.statematch", "false"),
+				),
+			},
+			{
+				Config: config(443),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtNWFilterExists("libvirt_nwfilter."+randomName, &filterDef),
+					func(*terraform.State) error {
+						if len(filterDef.Rules) != 2 || filterDef.Rules[0].Protocols[0].match()["dstportstart"] != "443" {
+							return fmt.Errorf("Network filter rules not updated: %#v", filterDef.Rules)
+						}
+						return nil
+					},
+				),
+			},
+			{
+				ResourceName:      "libvirt_nwfilter." + randomName,
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
@@ -0,0 +1,453 @@
+package libvirt
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	libvirt "github.com/libvirt/libvirt-go"
+	"github.com/libvirt/libvirt-go-xml"
+)
+
+// a libvirt storage pool resource
+//
+// Resource example:
+//
+//	resource "libvirt_pool" "images" {
+//	   name = "images"
+//	   type = "dir"
+//	   path = "/var/lib/libvirt/terraform-images"
+//	}
+//
+// "type" can be one of: "dir", "fs", "netfs", "logical", "iscsi"
+func resourceLibvirtPool() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceLibvirtPoolCreate,
+		Read:   resourceLibvirtPoolRead,
+		Update: resourceLibvirtPoolUpdate,
+		Delete: resourceLibvirtPoolDelete,
+		Exists: resourceLibvirtPoolExists,
+		Importer: &schema.ResourceImporter{
+			State: resourceLibvirtPoolImport,
+		},
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"type": { // can be "dir", "fs", "netfs", "logical", "iscsi"
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"path": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+				ForceNew: true,
+			},
+			"source": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Computed: true,
+				MaxItems: 1,
+				ForceNew: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"host": {
+							Type:     schema.TypeString,
+							Optional: true,
+							ForceNew: true,
+						},
+						"dir": {
+							Type:     schema.TypeString,
+							Optional: true,
+							ForceNew: true,
+						},
+						"device": {
+							Type:     schema.TypeList,
+							Optional: true,
+							ForceNew: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+						"name": {
+							Type:     schema.TypeString,
+							Optional: true,
+							ForceNew: true,
+						},
+						"format": {
+							Type:     schema.TypeString,
+							Optional: true,
+							Computed: true,
+							ForceNew: true,
+						},
+					},
+				},
+			},
+			"build": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+				// only used when creating the pool: the state records
+				// whether its storage was built by terraform
+				DiffSuppressFunc: func(k, old, new string, d *schema.ResourceData) bool {
+					return d.Id() != ""
+				},
+			},
+			"autostart": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Required: false,
+			},
+			"capacity": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"allocation": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"available": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"xml": {
+				Type:     schema.TypeList,
+				Optional: true,
+				MaxItems: 1,
+				ForceNew: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"xslt": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateXSLT,
+						},
+						"patch": xmlPatchSchema(),
+					},
+				},
+			},
+		},
+	}
+}
+
+// getPoolSourceFromResource returns the libvirt's StoragePoolSource
+// from the ResourceData provided.
+func getPoolSourceFromResource(d *schema.ResourceData) *libvirtxml.StoragePoolSource {
+	if _, ok := d.GetOk("source"); !ok {
+		return nil
+	}
+
+	source := &libvirtxml.StoragePoolSource{
+		Name: d.Get("source.0.name").(string),
+	}
+
+	if host, ok := d.GetOk("source.0.host"); ok {
+		source.Host = []libvirtxml.StoragePoolSourceHost{
+			{Name: host.(string)},
+		}
+	}
+
+	if dir, ok := d.GetOk("source.0.dir"); ok {
+		source.Dir = &libvirtxml.StoragePoolSourceDir{
+			Path: dir.(string),
+		}
+	}
+
+	for _, deviceI := range d.Get("source.0.device").([]interface{}) {
+		source.Device = append(source.Device, libvirtxml.StoragePoolSourceDevice{
+			Path: deviceI.(string),
+		})
+	}
+
+	if format, ok := d.GetOk("source.0.format"); ok {
+		source.Format = &libvirtxml.StoragePoolSourceFormat{
+			Type: format.(string),
+		}
+	}
+
+	return source
+}
+
+func resourceLibvirtPoolCreate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+	virConn := client.libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	poolName := d.Get("name").(string)
+
+	client.poolMutexKV.Lock(poolName)
+	defer client.poolMutexKV.Unlock(poolName)
+
+	// Check whether the storage pool already exists. Its name needs to be
+	// unique.
+	if pool, err := virConn.LookupStoragePoolByName(poolName); err == nil {
+		pool.Free()
+		return fmt.Errorf("storage pool '%s' already exists", poolName)
+	}
+
+	poolDef := libvirtxml.StoragePool{
+		Type:   d.Get("type").(string),
+		Name:   poolName,
+		Source: getPoolSourceFromResource(d),
+	}
+
+	if path, ok := d.GetOk("path"); ok {
+		poolDef.Target = &libvirtxml.StoragePoolTarget{
+			Path: path.(string),
+		}
+	}
+
+	if err := validatePoolDef(poolDef); err != nil {
+		return err
+	}
+
+	data, err := xmlMarshallIndented(poolDef)
+	if err != nil {
+		return fmt.Errorf("Error serializing libvirt storage pool: %s", err)
+	}
+	log.Printf("[DEBUG] Generated XML for libvirt storage pool:\n%s", data)
+
+	data, err = transformResourceXML(data, d)
+	if err != nil {
+		return fmt.Errorf("Error transforming the XML definition: %s", err)
+	}
+
+	pool, err := virConn.StoragePoolDefineXML(data, 0)
+	if err != nil {
+		return fmt.Errorf("Error defining libvirt storage pool: %s - %s", err, data)
+	}
+	defer pool.Free()
+
+	id, err := pool.GetUUIDString()
+	if err != nil {
+		return fmt.Errorf("Error retrieving libvirt storage pool id: %s", err)
+	}
+	d.SetId(id)
+
+	// make sure we record the id even if the rest of this gets interrupted
+	d.Partial(true)
+	d.Set("id", id)
+	d.SetPartial("id")
+	d.Partial(false)
+
+	log.Printf("[INFO] Defined storage pool %s [%s]", poolName, d.Id())
+
+	if d.Get("build").(bool) {
+		if poolTypeSupportsBuild(poolDef.Type) {
+			log.Printf("[DEBUG] Building storage pool %s", poolName)
+			if err := pool.Build(libvirt.STORAGE_POOL_BUILD_NO_OVERWRITE); err != nil {
+				return fmt.Errorf("Error building libvirt storage pool %s: %s", poolName, err)
+			}
+		} else {
+			log.Printf("[DEBUG] Storage pools of type '%s' can't be built: skipping", poolDef.Type)
+		}
+	}
+
+	if err := pool.Create(0); err != nil {
+		return fmt.Errorf("Error starting libvirt storage pool %s: %s", poolName, err)
+	}
+
+	if autostart, ok := d.GetOk("autostart"); ok {
+		err = pool.SetAutostart(autostart.(bool))
+		if err != nil {
+			return fmt.Errorf("Error setting autostart for storage pool: %s", err)
+		}
+	}
+
+	return resourceLibvirtPoolRead(d, meta)
+}
+
+// resourceLibvirtPoolUpdate updates dynamically some attributes in the pool
+func resourceLibvirtPoolUpdate(d *schema.ResourceData, meta interface{}) error {
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	pool, err := virConn.LookupStoragePoolByUUIDString(d.Id())
+	if err != nil {
+		return fmt.Errorf("Can't retrieve storage pool with ID '%s' during update: %s", d.Id(), err)
+	}
+	defer pool.Free()
+
+	d.Partial(true)
+
+	if d.HasChange("autostart") {
+		err = pool.SetAutostart(d.Get("autostart").(bool))
+		if err != nil {
+			return fmt.Errorf("Error updating autostart for storage pool %s: %s", d.Get("name").(string), err)
+		}
+		d.SetPartial("autostart")
+	}
+
+	d.Partial(false)
+
+	return resourceLibvirtPoolRead(d, meta)
+}
+
+// resourceLibvirtPoolRead gets the current resource from libvirt and creates
+// the corresponding `schema.ResourceData`
+func resourceLibvirtPoolRead(d *schema.ResourceData, meta interface{}) error {
+	log.Printf("[DEBUG] Read resource libvirt_pool")
+
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	pool, err := virConn.LookupStoragePoolByUUIDString(d.Id())
+	if err != nil {
+		if virErr, ok := err.(libvirt.Error); ok && virErr.Code == libvirt.ERR_NO_STORAGE_POOL {
+			log.Printf("Storage pool '%s' may have been deleted outside Terraform", d.Id())
+			d.SetId("")
+			return nil
+		}
+		return fmt.Errorf("Error retrieving libvirt storage pool: %s", err)
+	}
+	defer pool.Free()
+
+	poolDef, err := newDefPoolFromLibvirt(pool)
+	if err != nil {
+		return err
+	}
+
+	d.Set("name", poolDef.Name)
+	d.Set("type", poolDef.Type)
+
+	if poolDef.Target != nil {
+		d.Set("path", poolDef.Target.Path)
+	}
+
+	if poolDef.Source != nil {
+		source := map[string]interface{}{
+			"name": poolDef.Source.Name,
+		}
+		if len(poolDef.Source.Host) > 0 {
+			source["host"] = poolDef.Source.Host[0].Name
+		}
+		if poolDef.Source.Dir != nil {
+			source["dir"] = poolDef.Source.Dir.Path
+		}
+		var devices []string
+		for _, device := range poolDef.Source.Device {
+			devices = append(devices, device.Path)
+		}
+		source["device"] = devices
+		if poolDef.Source.Format != nil {
+			source["format"] = poolDef.Source.Format.Type
+		}
+		// libvirt always adds a source element, which is empty for
+		// the pools without one
+		if poolSourceIsEmpty(poolDef.Source) {
+			d.Set("source", []map[string]interface{}{})
+		} else {
+			d.Set("source", []map[string]interface{}{source})
+		}
+	}
+
+	autostart, err := pool.GetAutostart()
+	if err != nil {
+		return fmt.Errorf("Error reading storage pool autostart setting: %s", err)
+	}
+	d.Set("autostart", autostart)
+
+	info, err := pool.GetInfo()
+	if err != nil {
+		return fmt.Errorf("Error retrieving storage pool info: %s", err)
+	}
+	d.Set("capacity", info.Capacity)
+	d.Set("allocation", info.Allocation)
+	d.Set("available", info.Available)
+
+	log.Printf("[DEBUG] Storage pool ID %s successfully read", d.Id())
+	return nil
+}
+
+// resourceLibvirtPoolImport imports an existing pool. Its storage was not
+// built by terraform, so it must not be deleted with the pool.
+func resourceLibvirtPoolImport(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	d.Set("build", false)
+	return []*schema.ResourceData{d}, nil
+}
+
+// poolSourceIsEmpty returns whether the source of a pool doesn't
+// declare anything
+func poolSourceIsEmpty(source *libvirtxml.StoragePoolSource) bool {
+	return source.Name == "" && len(source.Host) == 0 && source.Dir == nil &&
+		len(source.Device) == 0 && source.Format == nil
+}
+
+func resourceLibvirtPoolDelete(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+	virConn := client.libvirt
+	if virConn == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+	log.Printf("[DEBUG] Deleting storage pool ID %s", d.Id())
+
+	pool, err := virConn.LookupStoragePoolByUUIDString(d.Id())
+	if err != nil {
+		return fmt.Errorf("When destroying libvirt storage pool: error retrieving %s", err)
+	}
+	defer pool.Free()
+
+	poolName, err := pool.GetName()
+	if err != nil {
+		return fmt.Errorf("Error retrieving storage pool name: %s", err)
+	}
+
+	client.poolMutexKV.Lock(poolName)
+	defer client.poolMutexKV.Unlock(poolName)
+
+	active, err := pool.IsActive()
+	if err != nil {
+		return fmt.Errorf("Couldn't determine if storage pool is active: %s", err)
+	}
+	if active {
+		if err := pool.Destroy(); err != nil {
+			return fmt.Errorf("When destroying libvirt storage pool: %s", err)
+		}
+	}
+
+	// only remove the underlying storage when we were the ones building it
+	if d.Get("build").(bool) && poolTypeSupportsBuild(d.Get("type").(string)) {
+		if err := pool.Delete(libvirt.STORAGE_POOL_DELETE_NORMAL); err != nil {
+			return fmt.Errorf("Couldn't delete libvirt storage pool %s: %s", poolName, err)
+		}
+	}
+
+	if err := pool.Undefine(); err != nil {
+		return fmt.Errorf("Couldn't undefine libvirt storage pool: %s", err)
+	}
+
+	return nil
+}
+
+func resourceLibvirtPoolExists(d *schema.ResourceData, meta interface{}) (bool, error) {
+	log.Printf("[DEBUG] Check if resource libvirt_pool exists")
+
+	virConn := meta.(*Client).libvirt
+	if virConn == nil {
+		return false, fmt.Errorf(LibVirtConIsNil)
+	}
+
+	pool, err := virConn.LookupStoragePoolByUUIDString(d.Id())
+	if err != nil {
+		// If the pool couldn't be found, don't return an error otherwise
+		// Terraform won't create it again.
+		if virErr, ok := err.(libvirt.Error); ok && virErr.Code == libvirt.ERR_NO_STORAGE_POOL {
+			return false, nil
+		}
+		return false, err
+	}
+	defer pool.Free()
+
+	return true, nil
+}
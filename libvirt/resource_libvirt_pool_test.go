@@ -0,0 +1,203 @@
+package libvirt
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/acctest"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/terraform"
+	libvirt "github.com/libvirt/libvirt-go"
+)
+
+func testAccCheckLibvirtPoolExists(name string, pool *libvirt.StoragePool) resource.TestCheckFunc {
+	return func(state *terraform.State) error {
+		virConn := testAccProvider.Meta().(*Client).libvirt
+
+		rs, err := getResourceFromTerraformState(name, state)
+		if err != nil {
+			return err
+		}
+
+		retrievedPool, err := virConn.LookupStoragePoolByUUIDString(rs.Primary.ID)
+		if err != nil {
+			return err
+		}
+
+		realID, err := retrievedPool.GetUUIDString()
+		if err != nil {
+			return err
+		}
+
+		if realID != rs.Primary.ID {
+			return fmt.Errorf("Resource ID and pool ID does not match")
+		}
+
+		*pool = *retrievedPool
+
+		return nil
+	}
+}
+
+func testAccCheckLibvirtPoolDestroy(state *terraform.State) error {
+	virConn := testAccProvider.Meta().(*Client).libvirt
+	for _, rs := range state.RootModule().Resources {
+		if rs.Type != "libvirt_pool" {
+			continue
+		}
+		_, err := virConn.LookupStoragePoolByUUIDString(rs.Primary.ID)
+		if err == nil {
+			return fmt.Errorf(
+				"Error waiting for pool (%s) to be destroyed: %s",
+				rs.Primary.ID, err)
+		}
+	}
+	return nil
+}
+
+func TestAccLibvirtPool_Basic(t *testing.T) {
+	var pool libvirt.StoragePool
+	randomPoolResource := acctest.RandString(10)
+	randomPoolName := acctest.RandString(10)
+	poolPath := filepath.Join(os.TempDir(), "terraform-provider-libvirt-pool-"+randomPoolName)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtPoolDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_pool" "%s" {
+					name = "%s"
+					type = "dir"
+					path = "%s"
+				}`, randomPoolResource, randomPoolName, poolPath),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtPoolExists("libvirt_pool."+randomPoolResource, &pool),
+					resource.TestCheckResourceAttr(
+						"libvirt_pool."+randomPoolResource, "name", randomPoolName),
+					resource.TestCheckResourceAttr(
+						"libvirt_pool."+randomPoolResource, "path", poolPath),
+					resource.TestCheckResourceAttrSet(
+						"libvirt_pool."+randomPoolResource, "capacity"),
+				),
+			},
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_pool" "%s" {
+					name      = "%s"
+					type      = "dir"
+					path      = "%s"
+					autostart = true
+				}`, randomPoolResource, randomPoolName, poolPath),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtPoolExists("libvirt_pool."+randomPoolResource, &pool),
+					resource.TestCheckResourceAttr(
+						"libvirt_pool."+randomPoolResource, "autostart", "true"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccLibvirtPool_WithVolume(t *testing.T) {
+	var volume libvirt.StorageVol
+	randomPoolResource := acctest.RandString(10)
+	randomPoolName := acctest.RandString(10)
+	randomVolumeResource := acctest.RandString(10)
+	randomVolumeName := acctest.RandString(10)
+	poolPath := filepath.Join(os.TempDir(), "terraform-provider-libvirt-pool-"+randomPoolName)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtPoolDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_pool" "%s" {
+					name = "%s"
+					type = "dir"
+					path = "%s"
+				}
+
+				resource "libvirt_volume" "%s" {
+					name = "%s"
+					pool = "${libvirt_pool.%s.name}"
+					size =  1073741824
+				}`, randomPoolResource, randomPoolName, poolPath,
+					randomVolumeResource, randomVolumeName, randomPoolResource),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtVolumeExists("libvirt_volume."+randomVolumeResource, &volume),
+					resource.TestCheckResourceAttr(
+						"libvirt_volume."+randomVolumeResource, "pool", randomPoolName),
+				),
+			},
+		},
+	})
+}
+
+func TestAccLibvirtPool_UnsupportedType(t *testing.T) {
+	randomPoolResource := acctest.RandString(10)
+	randomPoolName := acctest.RandString(10)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtPoolDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+				resource "libvirt_pool" "%s" {
+					name = "%s"
+					type = "zfs"
+				}`, randomPoolResource, randomPoolName),
+				ExpectError: regexp.MustCompile(`unsupported pool type 'zfs'`),
+			},
+		},
+	})
+}
+
+func TestAccLibvirtPool_Import(t *testing.T) {
+	var pool libvirt.StoragePool
+	randomPoolResource := acctest.RandString(10)
+	randomPoolName := acctest.RandString(10)
+	poolPath := filepath.Join(os.TempDir(), "terraform-provider-libvirt-pool-"+randomPoolName)
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtPoolDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`
+					resource "libvirt_pool" "%s" {
+						name = "%s"
+						type = "dir"
+						path = "%s"
+					}`, randomPoolResource, randomPoolName, poolPath),
+			},
+			{
+				ResourceName: "libvirt_pool." + randomPoolResource,
+				ImportState:  true,
+				ImportStateCheck: func(states []*terraform.InstanceState) error {
+					if len(states) != 1 {
+						return fmt.Errorf("Expected 1 imported pool, got %d", len(states))
+					}
+					// the storage of imported pools is kept on destroy
+					if build := states[0].Attributes["build"]; build != "false" {
+						return fmt.Errorf("Expected build to be false for an imported pool, got '%s'", build)
+					}
+					return nil
+				},
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtPoolExists("libvirt_pool."+randomPoolResource, &pool),
+					resource.TestCheckResourceAttr(
+						"libvirt_pool."+randomPoolResource, "name", randomPoolName),
+					resource.TestCheckResourceAttr(
+						"libvirt_pool."+randomPoolResource, "path", poolPath),
+				),
+			},
+		},
+	})
+}
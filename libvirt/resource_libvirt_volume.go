@@ -10,10 +10,12 @@ import (
 
 func resourceLibvirtVolume() *schema.Resource {
 	return &schema.Resource{
-		Create: resourceLibvirtVolumeCreate,
-		Read:   resourceLibvirtVolumeRead,
-		Delete: resourceLibvirtVolumeDelete,
-		Exists: resourceLibvirtVolumeExists,
+		Create:        resourceLibvirtVolumeCreate,
+		Read:          resourceLibvirtVolumeRead,
+		Update:        resourceLibvirtVolumeUpdate,
+		Delete:        resourceLibvirtVolumeDelete,
+		Exists:        resourceLibvirtVolumeExists,
+		CustomizeDiff: resourceLibvirtVolumeCustomizeDiff,
 		Schema: map[string]*schema.Schema{
 			"name": {
 				Type:     schema.TypeString,
@@ -35,7 +37,11 @@ func resourceLibvirtVolume() *schema.Resource {
 				Type:     schema.TypeInt,
 				Optional: true,
 				Computed: true,
-				ForceNew: true,
+			},
+			"resize_running_domains": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
 			},
 			"format": {
 				Type:     schema.TypeString,
@@ -66,13 +72,19 @@ func resourceLibvirtVolume() *schema.Resource {
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"xslt": {
-							Type:     schema.TypeString,
-							Optional: true,
-							ForceNew: true,
+							Type:         schema.TypeString,
+							Optional:     true,
+							ForceNew:     true,
+							ValidateFunc: validateXSLT,
 						},
+						"patch": xmlPatchSchema(),
 					},
 				},
 			},
+			"rendered_xml": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
 		},
 		Importer: &schema.ResourceImporter{
 			State: schema.ImportStatePassthrough,
@@ -227,7 +239,7 @@ func resourceLibvirtVolumeCreate(d *schema.ResourceData, meta interface{}) error
 
 	data, err = transformResourceXML(data, d)
 	if err != nil {
-		return fmt.Errorf("Error applying XSLT stylesheet: %s", err)
+		return fmt.Errorf("Error transforming the XML definition: %s", err)
 	}
 
 	// create the volume
@@ -249,6 +261,7 @@ func resourceLibvirtVolumeCreate(d *schema.ResourceData, meta interface{}) error
 	d.Set("id", key)
 	d.SetPartial("id")
 	d.Partial(false)
+	d.Set("rendered_xml", data)
 
 	log.Printf("[INFO] Volume ID: %s", d.Id())
 
@@ -322,6 +335,40 @@ func resourceLibvirtVolumeRead(d *schema.ResourceData, meta interface{}) error {
 	return nil
 }
 
+// resourceLibvirtVolumeCustomizeDiff refuses in the plan to shrink a volume,
+// as it would destroy the data at its end
+func resourceLibvirtVolumeCustomizeDiff(d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" || !d.HasChange("size") {
+		return nil
+	}
+
+	oldSize, newSize := d.GetChange("size")
+	if newSize.(int) < oldSize.(int) {
+		return fmt.Errorf("Can't shrink volume '%s' from %d to %d bytes: only growing a volume is supported", d.Get("name").(string), oldSize.(int), newSize.(int))
+	}
+	return nil
+}
+
+func resourceLibvirtVolumeUpdate(d *schema.ResourceData, meta interface{}) error {
+	client := meta.(*Client)
+	if client.libvirt == nil {
+		return fmt.Errorf(LibVirtConIsNil)
+	}
+
+	if d.HasChange("size") {
+		oldSize, newSize := d.GetChange("size")
+		if newSize.(int) < oldSize.(int) {
+			return fmt.Errorf("Can't shrink volume '%s' from %d to %d bytes: only growing a volume is supported", d.Get("name").(string), oldSize.(int), newSize.(int))
+		}
+
+		if err := resizeVolume(client, d.Id(), uint64(newSize.(int)), d.Get("resize_running_domains").(bool)); err != nil {
+			return err
+		}
+	}
+
+	return resourceLibvirtVolumeRead(d, meta)
+}
+
 func resourceLibvirtVolumeDelete(d *schema.ResourceData, meta interface{}) error {
 	client := meta.(*Client)
 	if client.libvirt == nil {
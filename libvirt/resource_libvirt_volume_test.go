@@ -119,6 +119,50 @@ func TestAccLibvirtVolume_Basic(t *testing.T) {
 	})
 }
 
+func TestAccLibvirtVolume_Resize(t *testing.T) {
+	var volume libvirt.StorageVol
+	var volumeID string
+	randomVolumeResource := acctest.RandString(10)
+	randomVolumeName := acctest.RandString(10)
+	config := `
+	resource "libvirt_volume" "%s" {
+		name = "%s"
+		size = %d
+	}`
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckLibvirtVolumeDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(config, randomVolumeResource, randomVolumeName, 1073741824),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtVolumeExists("libvirt_volume."+randomVolumeResource, &volume),
+					func(*terraform.State) error {
+						var err error
+						volumeID, err = volume.GetKey()
+						return err
+					},
+				),
+			},
+			{
+				Config: fmt.Sprintf(config, randomVolumeResource, randomVolumeName, 2147483648),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckLibvirtVolumeExists("libvirt_volume."+randomVolumeResource, &volume),
+					resource.TestCheckResourceAttrPtr(
+						"libvirt_volume."+randomVolumeResource, "id", &volumeID),
+					resource.TestCheckResourceAttr(
+						"libvirt_volume."+randomVolumeResource, "size", "2147483648"),
+				),
+			},
+			{
+				Config:      fmt.Sprintf(config, randomVolumeResource, randomVolumeName, 1073741824),
+				ExpectError: regexp.MustCompile(`Can't shrink volume`),
+			},
+		},
+	})
+}
+
 func TestAccLibvirtVolume_BackingStoreTestByID(t *testing.T) {
 	var volume libvirt.StorageVol
 	var volume2 libvirt.StorageVol
@@ -0,0 +1,51 @@
+package libvirt
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	libvirt "github.com/libvirt/libvirt-go"
+	"github.com/libvirt/libvirt-go-xml"
+)
+
+// Creates a domain snapshot definition from a XML
+func newDefSnapshotFromXML(s string) (libvirtxml.DomainSnapshot, error) {
+	var snapshotDef libvirtxml.DomainSnapshot
+	err := xml.Unmarshal([]byte(s), &snapshotDef)
+	if err != nil {
+		return libvirtxml.DomainSnapshot{}, err
+	}
+	return snapshotDef, nil
+}
+
+func newDefSnapshotFromLibvirt(snapshot *libvirt.DomainSnapshot) (libvirtxml.DomainSnapshot, error) {
+	name, err := snapshot.GetName()
+	if err != nil {
+		return libvirtxml.DomainSnapshot{}, fmt.Errorf("could not get name for snapshot: %s", err)
+	}
+	snapshotDefXML, err := snapshot.GetXMLDesc(0)
+	if err != nil {
+		return libvirtxml.DomainSnapshot{}, fmt.Errorf("could not get XML description for snapshot %s: %s", name, err)
+	}
+	snapshotDef, err := newDefSnapshotFromXML(snapshotDefXML)
+	if err != nil {
+		return libvirtxml.DomainSnapshot{}, fmt.Errorf("could not get a snapshot definition from XML for %s: %s", name, err)
+	}
+	return snapshotDef, nil
+}
+
+// snapshotID returns the terraform id of a snapshot: snapshots are only
+// unique by name inside of their domain
+func snapshotID(domainID string, name string) string {
+	return domainID + "/" + name
+}
+
+// parseSnapshotID splits a snapshot id in the UUID of its domain and its name
+func parseSnapshotID(id string) (string, string, error) {
+	parts := strings.SplitN(id, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid snapshot id '%s': it should be 'domainUUID/snapshotName'", id)
+	}
+	return parts[0], parts[1], nil
+}
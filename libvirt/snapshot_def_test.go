@@ -0,0 +1,54 @@
+package libvirt
+
+import (
+	"testing"
+)
+
+func TestSnapshotUnmarshal(t *testing.T) {
+	xmlDesc := `
+	<domainsnapshot>
+	  <name>before-upgrade</name>
+	  <description>Snapshot of the OS install</description>
+	  <state>shutoff</state>
+	  <parent>
+	    <name>installed</name>
+	  </parent>
+	  <creationTime>1525889631</creationTime>
+	  <memory snapshot='no'/>
+	  <disks>
+	    <disk name='vda' snapshot='internal'/>
+	  </disks>
+	  <active>0</active>
+	</domainsnapshot>
+	`
+
+	snapshotDef, err := newDefSnapshotFromXML(xmlDesc)
+	if err != nil {
+		t.Fatalf("could not unmarshall snapshot definition:\n%s", err)
+	}
+	if snapshotDef.Name != "before-upgrade" || snapshotDef.State != "shutoff" {
+		t.Errorf("unexpected snapshot name or state: %s %s", snapshotDef.Name, snapshotDef.State)
+	}
+	if snapshotDef.Parent == nil || snapshotDef.Parent.Name != "installed" {
+		t.Errorf("unexpected snapshot parent: %v", snapshotDef.Parent)
+	}
+	if snapshotDef.CreationTime != "1525889631" {
+		t.Errorf("unexpected snapshot creation time: %s", snapshotDef.CreationTime)
+	}
+}
+
+func TestParseSnapshotID(t *testing.T) {
+	domainID, name, err := parseSnapshotID(snapshotID("4d7c2a6a-0d2b-4a8d-8a0b-3c3c0c9bd9c1", "before-upgrade"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if domainID != "4d7c2a6a-0d2b-4a8d-8a0b-3c3c0c9bd9c1" || name != "before-upgrade" {
+		t.Errorf("unexpected domain id and snapshot name: %s %s", domainID, name)
+	}
+
+	for _, id := range []string{"", "4d7c2a6a-0d2b-4a8d-8a0b-3c3c0c9bd9c1", "4d7c2a6a-0d2b-4a8d-8a0b-3c3c0c9bd9c1/", "/before-upgrade"} {
+		if _, _, err := parseSnapshotID(id); err == nil {
+			t.Errorf("expected an error parsing snapshot id '%s'", id)
+		}
+	}
+}
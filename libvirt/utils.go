@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/hashicorp/terraform/helper/schema"
 )
 
 var diskLetters = []rune("abcdefghijklmnopqrstuvwxyz")
@@ -70,3 +71,80 @@ func formatBoolYesNo(b bool) string {
 	}
 	return "no"
 }
+
+// validateStringInSlice returns a function checking the value is one of
+// the given ones
+func validateStringInSlice(values []string) schema.SchemaValidateFunc {
+	return func(v interface{}, k string) ([]string, []error) {
+		for _, value := range values {
+			if v.(string) == value {
+				return nil, nil
+			}
+		}
+		return nil, []error{fmt.Errorf("%q must be one of %v, got '%s'", k, values, v.(string))}
+	}
+}
+
+// resourceDataFromDiff returns the resource data planned by a diff, so the
+// definitions built from the resource data can be rendered in the plan.
+// The computed attributes not known yet are left empty, as they are when
+// creating the resource. It returns false when some of the other arguments
+// are not known yet (eg, the id of a resource to be created).
+func resourceDataFromDiff(r *schema.Resource, diff *schema.ResourceDiff) (*schema.ResourceData, bool) {
+	if resourceDiffHasUnknownArguments(diff, r.Schema, "") {
+		return nil, false
+	}
+
+	d := r.Data(nil)
+	d.SetId(diff.Id())
+	for key, s := range r.Schema {
+		if !s.Optional && !s.Required {
+			continue
+		}
+		if err := d.Set(key, diff.Get(key)); err != nil {
+			log.Printf("[DEBUG] Can't plan '%s': %s", key, err)
+			return nil, false
+		}
+	}
+	return d, true
+}
+
+// resourceDiffHasUnknownArguments returns whether some of the arguments that
+// aren't computed are not known yet in the diff
+func resourceDiffHasUnknownArguments(diff *schema.ResourceDiff, schemas map[string]*schema.Schema, prefix string) bool {
+	for key, s := range schemas {
+		path := prefix + key
+		if s.Computed && !diff.NewValueKnown(path) {
+			continue
+		}
+		if !diff.NewValueKnown(path) {
+			return true
+		}
+
+		elem, ok := s.Elem.(*schema.Resource)
+		if !ok || s.Type != schema.TypeList {
+			continue
+		}
+		for i := 0; i < diff.Get(path+".#").(int); i++ {
+			if resourceDiffHasUnknownArguments(diff, elem.Schema, fmt.Sprintf("%s.%d.", path, i)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resourceDiffHasChanges returns whether the diff changes any argument of
+// the resource but the `ignored` ones
+func resourceDiffHasChanges(r *schema.Resource, diff *schema.ResourceDiff, ignored ...string) bool {
+	for key := range r.Schema {
+		skip := false
+		for _, i := range ignored {
+			skip = skip || key == i
+		}
+		if !skip && diff.HasChange(key) {
+			return true
+		}
+	}
+	return false
+}
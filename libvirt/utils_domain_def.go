@@ -127,3 +127,72 @@ func getHostCapabilities(virConn *libvirt.Connect) (libvirtxml.Caps, error) {
 	log.Printf("[TRACE] Capabilities of host \n %+v", caps)
 	return caps, nil
 }
+
+// getDomainCapabilities returns the capabilities of the emulator, machine
+// and architecture of the domain
+func getDomainCapabilities(virConn *libvirt.Connect, domainDef *libvirtxml.Domain) (libvirtxml.DomainCaps, error) {
+	caps := libvirtxml.DomainCaps{}
+	var arch, machine string
+	if domainDef.OS != nil && domainDef.OS.Type != nil {
+		arch = domainDef.OS.Type.Arch
+		machine = domainDef.OS.Type.Machine
+	}
+	capsXML, err := virConn.GetDomainCapabilities(domainDef.Devices.Emulator, arch, machine, domainDef.Type, 0)
+	if err != nil {
+		return caps, fmt.Errorf("Error retrieving the capabilities of the domain: %s", err)
+	}
+	if err := xml.Unmarshal([]byte(capsXML), &caps); err != nil {
+		return caps, fmt.Errorf("Error reading the capabilities of the domain: %s", err)
+	}
+	log.Printf("[TRACE] Capabilities of domain \n %+v", caps)
+	return caps, nil
+}
+
+// domainMemoryToMiB converts a domain memory value in the given unit
+// to MiB, which is the unit used in the resource
+func domainMemoryToMiB(value uint, unit string) uint {
+	switch unit {
+	case "b", "bytes":
+		return value / 1024 / 1024
+	case "M", "MiB":
+		return value
+	case "MB":
+		return value * 1000 * 1000 / 1024 / 1024
+	case "G", "GiB":
+		return value * 1024
+	case "GB":
+		return value * 1000 * 1000 * 1000 / 1024 / 1024
+	case "KB":
+		return value * 1000 / 1024 / 1024
+	default:
+		// libvirt defaults to KiB
+		return value / 1024
+	}
+}
+
+// domainDiskSourcePath returns a human readable location of the source of a
+// disk: a file or device path, a "pool/volume" pair or a network URL
+func domainDiskSourcePath(disk libvirtxml.DomainDisk) string {
+	if disk.Source == nil {
+		return ""
+	}
+
+	switch {
+	case disk.Source.File != nil:
+		return disk.Source.File.File
+	case disk.Source.Block != nil:
+		return disk.Source.Block.Dev
+	case disk.Source.Volume != nil:
+		return disk.Source.Volume.Pool + "/" + disk.Source.Volume.Volume
+	case disk.Source.Network != nil:
+		if len(disk.Source.Network.Hosts) > 0 {
+			return fmt.Sprintf("%s://%s:%s%s",
+				disk.Source.Network.Protocol,
+				disk.Source.Network.Hosts[0].Name,
+				disk.Source.Network.Hosts[0].Port,
+				disk.Source.Network.Name)
+		}
+		return fmt.Sprintf("%s://%s", disk.Source.Network.Protocol, disk.Source.Network.Name)
+	}
+	return ""
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/davecgh/go-spew/spew"
 	libvirt "github.com/libvirt/libvirt-go"
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
 )
 
 func init() {
@@ -42,6 +43,55 @@ func TestSplitKernelEmptyCmdLine(t *testing.T) {
 	}
 }
 
+func TestDomainMemoryToMiB(t *testing.T) {
+	testCases := []struct {
+		value    uint
+		unit     string
+		expected uint
+	}{
+		{524288, "KiB", 512},
+		{524288, "", 512},
+		{512, "MiB", 512},
+		{2, "GiB", 2048},
+		{536870912, "bytes", 512},
+	}
+	for _, tc := range testCases {
+		if r := domainMemoryToMiB(tc.value, tc.unit); r != tc.expected {
+			t.Errorf("%d %s: got=%d expected=%d", tc.value, tc.unit, r, tc.expected)
+		}
+	}
+}
+
+func TestDomainDiskSourcePath(t *testing.T) {
+	testCases := []struct {
+		disk     libvirtxml.DomainDisk
+		expected string
+	}{
+		{libvirtxml.DomainDisk{}, ""},
+		{libvirtxml.DomainDisk{Source: &libvirtxml.DomainDiskSource{
+			File: &libvirtxml.DomainDiskSourceFile{File: "/var/lib/libvirt/images/a.qcow2"},
+		}}, "/var/lib/libvirt/images/a.qcow2"},
+		{libvirtxml.DomainDisk{Source: &libvirtxml.DomainDiskSource{
+			Block: &libvirtxml.DomainDiskSourceBlock{Dev: "/dev/vg/b"},
+		}}, "/dev/vg/b"},
+		{libvirtxml.DomainDisk{Source: &libvirtxml.DomainDiskSource{
+			Volume: &libvirtxml.DomainDiskSourceVolume{Pool: "default", Volume: "c.qcow2"},
+		}}, "default/c.qcow2"},
+		{libvirtxml.DomainDisk{Source: &libvirtxml.DomainDiskSource{
+			Network: &libvirtxml.DomainDiskSourceNetwork{
+				Protocol: "http",
+				Name:     "/d.iso",
+				Hosts:    []libvirtxml.DomainDiskSourceHost{{Name: "example.com", Port: "80"}},
+			},
+		}}, "http://example.com:80/d.iso"},
+	}
+	for _, tc := range testCases {
+		if r := domainDiskSourcePath(tc.disk); r != tc.expected {
+			t.Errorf("got=%s expected=%s", r, tc.expected)
+		}
+	}
+}
+
 func connect(t *testing.T) *libvirt.Connect {
 	conn, err := libvirt.NewConnect(os.Getenv("LIBVIRT_DEFAULT_URI"))
 	if err != nil {
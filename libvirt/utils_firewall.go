@@ -0,0 +1,261 @@
+package libvirt
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// comment attached to the firewall rules managed by the provider
+const firewallRuleCommentPrefix = "terraform-libvirt:"
+
+// firewallRule is an iptables rule in a chain of a table
+type firewallRule struct {
+	table string
+	chain string
+	args  []string
+}
+
+// hostCommandArgs returns the command line running a program in the
+// hypervisor of a libvirt connection: directly for local connections, or
+// with ssh for the connections libvirt tunnels through ssh
+func hostCommandArgs(uri string, program string, args ...string) ([]string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("Can't parse libvirt URI '%s': %s", uri, err)
+	}
+
+	transport := ""
+	if i := strings.Index(u.Scheme, "+"); i >= 0 {
+		transport = u.Scheme[i+1:]
+	}
+	switch {
+	case u.Host == "" && (transport == "" || transport == "unix"):
+		return append([]string{program}, args...), nil
+	case transport == "ssh" || transport == "libssh" || transport == "libssh2":
+	default:
+		return nil, fmt.Errorf("Can't run commands in the hypervisor of '%s': only local and ssh connections are supported", uri)
+	}
+
+	cmd := []string{"ssh"}
+	if port := u.Port(); port != "" {
+		cmd = append(cmd, "-p", port)
+	}
+	query := u.Query()
+	if keyfile := query.Get("keyfile"); keyfile != "" {
+		cmd = append(cmd, "-i", keyfile)
+	}
+	if knownHosts := query.Get("known_hosts"); knownHosts != "" {
+		cmd = append(cmd, "-o", "UserKnownHostsFile="+knownHosts)
+	}
+	if query.Get("no_verify") == "1" {
+		cmd = append(cmd, "-o", "StrictHostKeyChecking=no")
+	}
+	host := u.Hostname()
+	if u.User != nil && u.User.Username() != "" {
+		host = u.User.Username() + "@" + host
+	}
+	cmd = append(cmd, host, "--")
+
+	// ssh runs the command with the shell of the remote user
+	cmd = append(cmd, shellQuote(program))
+	for _, arg := range args {
+		cmd = append(cmd, shellQuote(arg))
+	}
+	return cmd, nil
+}
+
+// shellQuote quotes a word for a POSIX shell
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@,") == "" {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// runIptables runs iptables in the hypervisor of a libvirt connection
+func runIptables(uri string, args ...string) error {
+	_, err := runHostCommand(uri, "iptables", append([]string{"-w"}, args...)...)
+	return err
+}
+
+// runHostCommand runs a program in the hypervisor of a libvirt connection,
+// and returns its output
+func runHostCommand(uri string, program string, args ...string) (string, error) {
+	cmdArgs, err := hostCommandArgs(uri, program, args...)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("[DEBUG] Running %v", cmdArgs)
+	out, err := exec.Command(cmdArgs[0], cmdArgs[1:]...).CombinedOutput()
+	if err != nil {
+		return "", &hostCommandError{err: err, output: strings.TrimSpace(string(out))}
+	}
+	return string(out), nil
+}
+
+// libvirtUsesNftables returns whether libvirt sets up the firewall of its
+// networks with its nftables backend: the rules added with iptables can't
+// accept the connections libvirt rejects in its own nftables table
+func libvirtUsesNftables(uri string) bool {
+	_, err := runHostCommand(uri, "nft", "list", "table", "ip", "libvirt_network")
+	return err == nil
+}
+
+// hostCommandError is the failure of a command run in the hypervisor, with its output
+type hostCommandError struct {
+	err    error
+	output string
+}
+
+func (e *hostCommandError) Error() string {
+	return fmt.Sprintf("%s: %s", e.err, e.output)
+}
+
+// isFirewallRuleNotFound returns whether iptables failed because the rule
+// to check or to delete doesn't exist
+func isFirewallRuleNotFound(err error) bool {
+	cmdErr, ok := err.(*hostCommandError)
+	if !ok {
+		return false
+	}
+	exitErr, ok := cmdErr.err.(*exec.ExitError)
+	if !ok {
+		return false
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	return ok && status.ExitStatus() == 1
+}
+
+// addFirewallRules inserts the rules at the beginning of their chains, so
+// they are evaluated before the rules libvirt adds for its networks. The
+// rules already there, maybe behind the ones of libvirt, are moved. When a
+// rule can't be added, the ones already added are removed.
+func addFirewallRules(uri string, rules []firewallRule) error {
+	if libvirtUsesNftables(uri) {
+		return fmt.Errorf("libvirt uses its nftables firewall backend, only its iptables backend is supported")
+	}
+	if err := deleteFirewallRules(uri, rules); err != nil {
+		return err
+	}
+
+	for i, rule := range rules {
+		args := append([]string{"-t", rule.table, "-I", rule.chain, "1"}, rule.args...)
+		if err := runIptables(uri, args...); err != nil {
+			if delErr := deleteFirewallRules(uri, rules[:i]); delErr != nil {
+				log.Printf("[WARN] Couldn't remove the firewall rules already added: %s", delErr)
+			}
+			return fmt.Errorf("Error adding firewall rule to %s/%s: %s", rule.table, rule.chain, err)
+		}
+	}
+	return nil
+}
+
+// firewallRulesExist returns whether all the rules are in their chains,
+// before the rules rejecting the connections libvirt adds when a network
+// starts: restarting a network puts libvirt's rules first again
+func firewallRulesExist(uri string, rules []firewallRule) (bool, error) {
+	for _, rule := range rules {
+		args := append([]string{"-t", rule.table, "-C", rule.chain}, rule.args...)
+		if err := runIptables(uri, args...); err != nil {
+			if isFirewallRuleNotFound(err) {
+				return false, nil
+			}
+			return false, fmt.Errorf("Error checking firewall rule in %s/%s: %s", rule.table, rule.chain, err)
+		}
+
+		listing, err := runHostCommand(uri, "iptables", "-w", "-t", rule.table, "-S", rule.chain)
+		if err != nil {
+			return false, fmt.Errorf("Error listing firewall rules of %s/%s: %s", rule.table, rule.chain, err)
+		}
+		if !firewallRuleBeforeRejects(listing, rule) {
+			log.Printf("[DEBUG] Firewall rule %v is behind the rules rejecting connections in %s/%s", rule.args, rule.table, rule.chain)
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// firewallRuleBeforeRejects returns whether the rule comes before the rules
+// rejecting connections, or jumping to the chains of libvirt, in the listing
+// of its chain given by `iptables -S`
+func firewallRuleBeforeRejects(listing string, rule firewallRule) bool {
+	comment := ""
+	for i, arg := range rule.args {
+		if arg == "--comment" && i+1 < len(rule.args) {
+			comment = rule.args[i+1]
+		}
+	}
+
+	for _, line := range strings.Split(listing, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "-A" || fields[1] != rule.chain {
+			continue
+		}
+		if comment != "" && strings.Contains(line, comment) {
+			return true
+		}
+		for i, field := range fields {
+			if field == "-j" && i+1 < len(fields) &&
+				(fields[i+1] == "REJECT" || fields[i+1] == "DROP" || strings.HasPrefix(fields[i+1], "LIBVIRT_")) {
+				return false
+			}
+		}
+	}
+	return false
+}
+
+// deleteFirewallRules removes the rules, ignoring the ones already removed
+func deleteFirewallRules(uri string, rules []firewallRule) error {
+	for _, rule := range rules {
+		args := append([]string{"-t", rule.table, "-D", rule.chain}, rule.args...)
+		if err := runIptables(uri, args...); err != nil && !isFirewallRuleNotFound(err) {
+			return fmt.Errorf("Error deleting firewall rule from %s/%s: %s", rule.table, rule.chain, err)
+		}
+	}
+	return nil
+}
+
+// networkPortForward forwards a port of the hypervisor to a port of a guest
+// in a NAT network
+type networkPortForward struct {
+	ID           string
+	Protocol     string
+	HostAddress  string
+	HostPort     int
+	GuestAddress string
+	GuestPort    int
+	Bridge       string
+}
+
+// firewallRules returns the rules implementing the port forward, as
+// described in https://wiki.libvirt.org/page/Networking#Forwarding_Incoming_Connections:
+// the destination of the incoming connections is translated to the guest,
+// and the connections are accepted before libvirt rejects them. Without a
+// host address only the connections to the addresses of the hypervisor are
+// translated, not the ones it routes to other hosts.
+func (f networkPortForward) firewallRules() []firewallRule {
+	comment := []string{"-m", "comment", "--comment", firewallRuleCommentPrefix + f.ID}
+
+	dnat := []string{"-p", f.Protocol}
+	if f.HostAddress != "" {
+		dnat = append(dnat, "-d", f.HostAddress)
+	} else {
+		dnat = append(dnat, "-m", "addrtype", "--dst-type", "LOCAL")
+	}
+	dnat = append(dnat, "--dport", strconv.Itoa(f.HostPort),
+		"-j", "DNAT", "--to-destination", net.JoinHostPort(f.GuestAddress, strconv.Itoa(f.GuestPort)))
+
+	accept := []string{"-o", f.Bridge, "-p", f.Protocol, "-d", f.GuestAddress,
+		"--dport", strconv.Itoa(f.GuestPort), "-j", "ACCEPT"}
+
+	return []firewallRule{
+		{table: "nat", chain: "PREROUTING", args: append(dnat, comment...)},
+		{table: "filter", chain: "FORWARD", args: append(accept, comment...)},
+	}
+}
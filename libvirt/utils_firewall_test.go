@@ -0,0 +1,121 @@
+package libvirt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHostCommandArgs(t *testing.T) {
+	for _, tc := range []struct {
+		uri      string
+		expected []string
+	}{
+		{"qemu:///system", []string{"iptables", "-L"}},
+		{"qemu+unix:///system?socket=/run/libvirt/libvirt-sock", []string{"iptables", "-L"}},
+		{"qemu+ssh://root@hv1/system", []string{"ssh", "root@hv1", "--", "iptables", "-L"}},
+		{
+			"qemu+ssh://admin@hv1:2222/system?keyfile=/home/me/.ssh/id_rsa&no_verify=1",
+			[]string{"ssh", "-p", "2222", "-i", "/home/me/.ssh/id_rsa", "-o", "StrictHostKeyChecking=no", "admin@hv1", "--", "iptables", "-L"},
+		},
+	} {
+		args, err := hostCommandArgs(tc.uri, "iptables", "-L")
+		if err != nil {
+			t.Errorf("Unexpected error with %s: %s", tc.uri, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, tc.expected) {
+			t.Errorf("Expected %v for %s, got %v", tc.expected, tc.uri, args)
+		}
+	}
+
+	for _, uri := range []string{"qemu+tcp://hv1/system", "qemu://hv1/system"} {
+		if _, err := hostCommandArgs(uri, "iptables", "-L"); err == nil {
+			t.Errorf("Expected an error with %s", uri)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for s, expected := range map[string]string{
+		"iptables":              "iptables",
+		"10.17.3.10:22":         "10.17.3.10:22",
+		"":                      "''",
+		"two words":             "'two words'",
+		"it's":                  `'it'\''s'`,
+		"$(reboot)":             "'$(reboot)'",
+		"terraform-libvirt:a/b": "terraform-libvirt:a/b",
+	} {
+		if quoted := shellQuote(s); quoted != expected {
+			t.Errorf("Expected %s quoting '%s', got %s", expected, s, quoted)
+		}
+	}
+}
+
+func TestNetworkPortForwardFirewallRules(t *testing.T) {
+	forward := networkPortForward{
+		ID:           "uuid/tcp/:2222",
+		Protocol:     "tcp",
+		HostPort:     2222,
+		GuestAddress: "10.17.3.10",
+		GuestPort:    22,
+		Bridge:       "virbr1",
+	}
+	expected := []firewallRule{
+		{
+			table: "nat",
+			chain: "PREROUTING",
+			args: []string{"-p", "tcp", "-m", "addrtype", "--dst-type", "LOCAL", "--dport", "2222",
+				"-j", "DNAT", "--to-destination", "10.17.3.10:22",
+				"-m", "comment", "--comment", "terraform-libvirt:uuid/tcp/:2222"},
+		},
+		{
+			table: "filter",
+			chain: "FORWARD",
+			args: []string{"-o", "virbr1", "-p", "tcp", "-d", "10.17.3.10", "--dport", "22", "-j", "ACCEPT",
+				"-m", "comment", "--comment", "terraform-libvirt:uuid/tcp/:2222"},
+		},
+	}
+	if rules := forward.firewallRules(); !reflect.DeepEqual(rules, expected) {
+		t.Errorf("Expected rules %v, got %v", expected, rules)
+	}
+
+	forward.HostAddress = "192.168.1.5"
+	expectedDNAT := []string{"-p", "tcp", "-d", "192.168.1.5", "--dport", "2222",
+		"-j", "DNAT", "--to-destination", "10.17.3.10:22",
+		"-m", "comment", "--comment", "terraform-libvirt:uuid/tcp/:2222"}
+	if rules := forward.firewallRules(); !reflect.DeepEqual(rules[0].args, expectedDNAT) {
+		t.Errorf("Expected the DNAT rule %v, got %v", expectedDNAT, rules[0].args)
+	}
+}
+
+func TestFirewallRuleBeforeRejects(t *testing.T) {
+	rule := networkPortForward{
+		ID:           "uuid/tcp/:2222",
+		Protocol:     "tcp",
+		HostPort:     2222,
+		GuestAddress: "10.17.3.10",
+		GuestPort:    22,
+		Bridge:       "virbr1",
+	}.firewallRules()[1]
+
+	first := `-P FORWARD ACCEPT
+-A FORWARD -d 10.17.3.10/32 -o virbr1 -p tcp -m tcp --dport 22 -m comment --comment terraform-libvirt:uuid/tcp/:2222 -j ACCEPT
+-A FORWARD -j LIBVIRT_FWX
+-A FORWARD -j LIBVIRT_FWI
+`
+	if !firewallRuleBeforeRejects(first, rule) {
+		t.Errorf("Expected the rule to be before the chains of libvirt")
+	}
+
+	restarted := `-P FORWARD ACCEPT
+-A FORWARD -o virbr1 -j REJECT --reject-with icmp-port-unreachable
+-A FORWARD -d 10.17.3.10/32 -o virbr1 -p tcp -m tcp --dport 22 -m comment --comment terraform-libvirt:uuid/tcp/:2222 -j ACCEPT
+`
+	if firewallRuleBeforeRejects(restarted, rule) {
+		t.Errorf("Expected the rule to be behind the rules rejecting connections")
+	}
+
+	if firewallRuleBeforeRejects("-P FORWARD ACCEPT\n", rule) {
+		t.Errorf("Expected a missing rule not to be before the rules rejecting connections")
+	}
+}
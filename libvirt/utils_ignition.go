@@ -0,0 +1,209 @@
+package libvirt
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/coreos/ignition/config/v2_1/types"
+	"github.com/coreos/ignition/config/validate/report"
+)
+
+// Ignition configs are checked against the newest spec the provider knows
+// about: configs with a newer version are passed through as they are, older
+// 2.x ones can be translated to it.
+
+// validateIgnitionContent is the ValidateFunc of the 'content' of
+// libvirt_ignition: it checks the config before any volume or domain is created
+func validateIgnitionContent(v interface{}, k string) ([]string, []error) {
+	ign := newIgnitionDef()
+	ign.Content = v.(string)
+	content, err := ign.readContent()
+	if err != nil {
+		return nil, []error{fmt.Errorf("%q: %s", k, err)}
+	}
+
+	warnings, errs := validateIgnitionConfig(content)
+	for i, err := range errs {
+		errs[i] = fmt.Errorf("%q: %s", k, err)
+	}
+	for i, warning := range warnings {
+		warnings[i] = fmt.Sprintf("%q: %s", k, warning)
+	}
+	return warnings, errs
+}
+
+// validateIgnitionSpecVersion is the ValidateFunc of the 'spec_version' of
+// libvirt_ignition
+func validateIgnitionSpecVersion(v interface{}, k string) ([]string, []error) {
+	version, err := semver.NewVersion(v.(string))
+	if err != nil {
+		return nil, []error{fmt.Errorf("%q: '%s' is not a valid Ignition spec version: %s", k, v, err)}
+	}
+	if version.Major != types.MaxVersion.Major || types.MaxVersion.LessThan(*version) {
+		return nil, []error{fmt.Errorf("%q: configs can only be translated to Ignition spec versions from 2.0.0 to %s, got %s",
+			k, types.MaxVersion, version)}
+	}
+	return nil, nil
+}
+
+// validateIgnitionConfig checks an Ignition config, returning the warnings
+// and errors found with the path of the offending key (eg. "storage.files.0.mode")
+func validateIgnitionConfig(content []byte) ([]string, []error) {
+	version, err := ignitionConfigVersion(content)
+	if err != nil {
+		return nil, []error{err}
+	}
+	if types.MaxVersion.LessThan(*version) {
+		return []string{fmt.Sprintf("Ignition spec version %s is newer than %s, the config is not validated", version, types.MaxVersion)}, nil
+	}
+
+	var config types.Config
+	if err := json.Unmarshal(content, &config); err != nil {
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok && typeErr.Field != "" {
+			return nil, []error{fmt.Errorf("%s: expected a %s, got a %s", typeErr.Field, typeErr.Type, typeErr.Value)}
+		}
+		return nil, []error{fmt.Errorf("Error parsing Ignition config: %s", err)}
+	}
+
+	var warnings []string
+	var errs []error
+	for _, entry := range validateIgnitionValue(reflect.ValueOf(config), "").Entries {
+		switch entry.Kind {
+		case report.EntryError:
+			errs = append(errs, fmt.Errorf("%s", entry.Message))
+		default:
+			warnings = append(warnings, fmt.Sprintf("%s: %s", entry.Kind, entry.Message))
+		}
+	}
+	return warnings, errs
+}
+
+// ignitionConfigVersion returns the spec version of an Ignition config
+func ignitionConfigVersion(content []byte) (*semver.Version, error) {
+	var config struct {
+		Ignition struct {
+			Version string `json:"version"`
+		} `json:"ignition"`
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("Error parsing Ignition config: %s", err)
+	}
+	if config.Ignition.Version == "" {
+		return nil, fmt.Errorf("ignition.version: the Ignition config has no spec version")
+	}
+	version, err := semver.NewVersion(config.Ignition.Version)
+	if err != nil {
+		return nil, fmt.Errorf("ignition.version: '%s' is not a valid spec version: %s", config.Ignition.Version, err)
+	}
+	return version, nil
+}
+
+// validateIgnitionValue runs the Validate* methods of the Ignition types the
+// same way Ignition does, walking the config and prefixing the entries of
+// the report with the path of the value that produced them
+func validateIgnitionValue(v reflect.Value, path string) report.Report {
+	return validateIgnitionValueMethods(v, path, true)
+}
+
+// validateIgnitionValueMethods walks the config, running the methods of the
+// values only when `methods` is set: the methods of embedded structs are
+// promoted to the struct embedding them and already run with its ones
+func validateIgnitionValueMethods(v reflect.Value, path string, methods bool) report.Report {
+	r := report.Report{}
+
+	// the methods of pointers are run on the values they point to
+	if v.Kind() == reflect.Ptr {
+		if !v.IsNil() {
+			r.Merge(validateIgnitionValueMethods(v.Elem(), path, methods))
+		}
+		return r
+	}
+
+	reportType := reflect.TypeOf(report.Report{})
+	for i := 0; methods && i < v.NumMethod(); i++ {
+		method := v.Type().Method(i)
+		if !strings.HasPrefix(method.Name, "Validate") || method.Type.NumIn() != 1 ||
+			method.Type.NumOut() != 1 || method.Type.Out(0) != reportType {
+			continue
+		}
+		methodReport := v.Method(i).Call(nil)[0].Interface().(report.Report)
+		for _, entry := range methodReport.Entries {
+			if path != "" {
+				entry.Message = path + ": " + entry.Message
+			}
+			r.Add(entry)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			r.Merge(validateIgnitionValue(v.Index(i), ignitionPath(path, strconv.Itoa(i))))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			// the fields of embedded structs are at the same level in the JSON
+			fieldPath := path
+			if !field.Anonymous {
+				name := strings.Split(field.Tag.Get("json"), ",")[0]
+				if name == "" {
+					name = field.Name
+				}
+				fieldPath = ignitionPath(path, name)
+			}
+			r.Merge(validateIgnitionValueMethods(v.Field(i), fieldPath, !field.Anonymous))
+		}
+	}
+
+	return r
+}
+
+func ignitionPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// translateIgnitionConfig translates a 2.x Ignition config to an equal or
+// newer spec version. The 2.x specs only add keys, so the translation
+// parses the config with the types of the newest one and sets the version.
+func translateIgnitionConfig(content []byte, to string) ([]byte, error) {
+	version, err := ignitionConfigVersion(content)
+	if err != nil {
+		return nil, err
+	}
+	target, err := semver.NewVersion(to)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not a valid Ignition spec version: %s", to, err)
+	}
+	if *version == *target {
+		return content, nil
+	}
+	if version.Major != target.Major || target.LessThan(*version) {
+		return nil, fmt.Errorf("Ignition config with spec version %s can't be translated to %s", version, target)
+	}
+	if types.MaxVersion.LessThan(*target) {
+		return nil, fmt.Errorf("Ignition configs can't be translated to spec version %s, the newest supported one is %s", target, types.MaxVersion)
+	}
+
+	var config types.Config
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("Error parsing Ignition config: %s", err)
+	}
+	config.Ignition.Version = target.String()
+
+	translated, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("Error serializing translated Ignition config: %s", err)
+	}
+	return translated, nil
+}
@@ -0,0 +1,155 @@
+package libvirt
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateIgnitionConfig(t *testing.T) {
+	testCases := []struct {
+		content  string
+		errors   []string
+		warnings int
+	}{
+		{
+			content: `{"ignition": {"version": "2.1.0"}, "systemd": {"units": [{"name": "example.service", "enabled": true}]}}`,
+		},
+		{
+			content: `{"ignition": {"version": "2.0.0"}, "storage": {"files": [{"filesystem": "root", "path": "/etc/motd", "contents": {"source": "data:,hello"}}]}}`,
+		},
+		{
+			// newer than the types vendored, not validated
+			content:  `{"ignition": {"version": "3.0.0"}, "storage": {"files": "whatever"}}`,
+			warnings: 1,
+		},
+		{
+			content: `{"ignition": {}}`,
+			errors:  []string{"ignition.version"},
+		},
+		{
+			content: `{"ignition": {"version": "two"}}`,
+			errors:  []string{"ignition.version"},
+		},
+		{
+			content: `{"ignition": {"version": "1.0.0"}}`,
+			errors:  []string{"too old"},
+		},
+		{
+			content: `{"ignition": {"version": "2.1.0"}, "storage": {"files": [{"filesystem": "root", "path": "etc/motd", "mode": 99999}]}}`,
+			errors:  []string{"storage.files.0: ", "storage.files.0: "},
+		},
+		{
+			content: `{"ignition": {"version": "2.1.0"}, "systemd": {"units": [{"name": "example"}]}}`,
+			errors:  []string{"systemd.units.0: "},
+		},
+		{
+			content: `{"ignition": {"version": "2.1.0"}, "storage": {"files": [{"filesystem": "data", "path": "/etc/motd"}]}}`,
+			// the filesystem could be defined in another config
+			warnings: 1,
+		},
+		{
+			content: `{"ignition": {"version": "2.1.0"}, "storage": {"files": {}}}`,
+			errors:  []string{"storage.files: "},
+		},
+	}
+
+	for _, tc := range testCases {
+		warnings, errs := validateIgnitionConfig([]byte(tc.content))
+		if len(errs) != len(tc.errors) {
+			t.Errorf("%s: expected %d errors, got %v", tc.content, len(tc.errors), errs)
+			continue
+		}
+		for i, err := range errs {
+			if !strings.Contains(err.Error(), tc.errors[i]) {
+				t.Errorf("%s: expected an error containing '%s', got '%s'", tc.content, tc.errors[i], err)
+			}
+		}
+		if len(warnings) != tc.warnings {
+			t.Errorf("%s: expected %d warnings, got %v", tc.content, tc.warnings, warnings)
+		}
+	}
+}
+
+func TestValidateIgnitionContentFromFile(t *testing.T) {
+	if _, errs := validateIgnitionContent("/nonexistent/config.ign", "content"); len(errs) == 0 {
+		t.Errorf("Expected an error for content neither a file nor JSON")
+	}
+}
+
+func TestValidateIgnitionSpecVersion(t *testing.T) {
+	for _, version := range []string{"2.0.0", "2.1.0"} {
+		if _, errs := validateIgnitionSpecVersion(version, "spec_version"); len(errs) > 0 {
+			t.Errorf("%s: unexpected errors %v", version, errs)
+		}
+	}
+	for _, version := range []string{"2", "1.0.0", "2.2.0", "3.0.0"} {
+		if _, errs := validateIgnitionSpecVersion(version, "spec_version"); len(errs) == 0 {
+			t.Errorf("%s: expected an error", version)
+		}
+	}
+}
+
+func TestValidateIgnitionDelivery(t *testing.T) {
+	validate := resourceIgnition().Schema["delivery"].ValidateFunc
+	for _, delivery := range []string{"fw_cfg", "configdrive", "virtio", ""} {
+		if _, errs := validate(delivery, "delivery"); len(errs) > 0 {
+			t.Errorf("%s: unexpected errors %v", delivery, errs)
+		}
+	}
+	if _, errs := validate("cdrom", "delivery"); len(errs) == 0 {
+		t.Errorf("cdrom: expected an error")
+	}
+}
+
+func TestTranslateIgnitionConfig(t *testing.T) {
+	content := `{"ignition": {"version": "2.0.0"}, "storage": {"files": [{"filesystem": "root", "path": "/etc/motd", "contents": {"source": "data:,hello"}, "mode": 420}]}}`
+
+	translated, err := translateIgnitionConfig([]byte(content), "2.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var config struct {
+		Ignition struct {
+			Version string `json:"version"`
+		} `json:"ignition"`
+		Storage struct {
+			Files []struct {
+				Path     string `json:"path"`
+				Mode     int    `json:"mode"`
+				Contents struct {
+					Source string `json:"source"`
+				} `json:"contents"`
+			} `json:"files"`
+		} `json:"storage"`
+	}
+	if err := json.Unmarshal(translated, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Ignition.Version != "2.1.0" {
+		t.Errorf("Expected version 2.1.0, got %s", config.Ignition.Version)
+	}
+	if len(config.Storage.Files) != 1 || config.Storage.Files[0].Path != "/etc/motd" ||
+		config.Storage.Files[0].Mode != 420 || config.Storage.Files[0].Contents.Source != "data:,hello" {
+		t.Errorf("Unexpected translated config %s", translated)
+	}
+	if _, errs := validateIgnitionConfig(translated); len(errs) > 0 {
+		t.Errorf("Translated config is not valid: %v", errs)
+	}
+
+	same, err := translateIgnitionConfig([]byte(content), "2.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(same) != content {
+		t.Errorf("A config with the target version should not change, got %s", same)
+	}
+
+	newer := `{"ignition": {"version": "2.1.0"}}`
+	for _, to := range []string{"2.0.0", "2.2.0", "3.0.0"} {
+		if _, err := translateIgnitionConfig([]byte(newer), to); err == nil {
+			t.Errorf("Expected an error translating to %s", to)
+		}
+	}
+}
@@ -0,0 +1,479 @@
+package libvirt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// A minimal ISO9660 writer, enough to create the small images holding
+// configuration data for the guests (eg. cloud-init's NoCloud "cidata" or
+// OpenStack's "config-2" config drive).
+//
+// Every name is recorded three times: mangled to 8.3 uppercase in the primary
+// directories, as is in the Rock Ridge NM entries of the primary directories
+// and as is in the Joliet directories, so every reader finds the original
+// names. Each directory must fit in a single sector.
+
+const (
+	isoSectorSize = 2048
+	// sectors 0x00-0x0F are the system area
+	isoSystemAreaSectors = 16
+	// ISO9660 allows up to 8 levels of directories, the root included
+	isoMaxDepth = 8
+)
+
+// isoFile is a file to be written in an ISO image. The name can include
+// directories separated by "/" (eg. "openstack/latest/meta_data.json")
+type isoFile struct {
+	Name string
+	Data []byte
+}
+
+// isoEntry is a file or a directory with its location in the image
+type isoEntry struct {
+	name        string
+	primaryName string
+	dir         bool
+	data        []byte
+	parent      *isoEntry
+	children    []*isoEntry
+	// location of the data for files, of the primary directory for directories
+	sector uint32
+	// location of the Joliet directory
+	jolietSector uint32
+}
+
+// writeISO9660 writes an ISO9660 image with Joliet and Rock Ridge extensions
+// holding `files`
+func writeISO9660(w io.Writer, volumeID string, files []isoFile) error {
+	if len(volumeID) > 16 {
+		return fmt.Errorf("ISO volume id '%s' is too long: it can have up to 16 characters", volumeID)
+	}
+
+	root := &isoEntry{dir: true}
+	root.parent = root
+	var layoutFiles []*isoEntry
+	for _, file := range files {
+		entry, err := root.add(file)
+		if err != nil {
+			return err
+		}
+		layoutFiles = append(layoutFiles, entry)
+	}
+
+	primaryDirs := isoDirectories(root, false)
+	jolietDirs := isoDirectories(root, true)
+
+	// sector layout: volume descriptors, path tables, directories and data
+	const (
+		pvdSector        = isoSystemAreaSectors
+		svdSector        = pvdSector + 1
+		terminatorSector = svdSector + 1
+		pathTableLSector = terminatorSector + 1
+	)
+	pathTableSize := uint32(len(isoPathTable(primaryDirs, false, binary.LittleEndian)))
+	jPathTableSize := uint32(len(isoPathTable(jolietDirs, true, binary.LittleEndian)))
+	pathTableMSector := pathTableLSector + isoSectors(int(pathTableSize))
+	jPathTableLSector := pathTableMSector + isoSectors(int(pathTableSize))
+	jPathTableMSector := jPathTableLSector + isoSectors(int(jPathTableSize))
+	sector := jPathTableMSector + isoSectors(int(jPathTableSize))
+	for _, dir := range primaryDirs {
+		dir.sector = sector
+		sector++
+	}
+	for _, dir := range jolietDirs {
+		dir.jolietSector = sector
+		sector++
+	}
+	for _, file := range layoutFiles {
+		file.sector = sector
+		sector += isoSectors(len(file.data))
+	}
+	totalSectors := sector
+
+	now := time.Now()
+
+	image := make([]byte, int(totalSectors)*isoSectorSize)
+	at := func(sector uint32) []byte {
+		return image[int(sector)*isoSectorSize:]
+	}
+
+	for _, dir := range primaryDirs {
+		records, err := isoDirectory(dir, false, now)
+		if err != nil {
+			return err
+		}
+		copy(at(dir.sector), records)
+	}
+	for _, dir := range jolietDirs {
+		records, err := isoDirectory(dir, true, now)
+		if err != nil {
+			return err
+		}
+		copy(at(dir.jolietSector), records)
+	}
+
+	copy(at(pvdSector), isoVolumeDescriptor(false, volumeID, totalSectors, pathTableSize,
+		pathTableLSector, pathTableMSector,
+		isoDirectoryRecord([]byte{0}, root.sector, isoSectorSize, true, now, nil), now))
+	copy(at(svdSector), isoVolumeDescriptor(true, volumeID, totalSectors, jPathTableSize,
+		jPathTableLSector, jPathTableMSector,
+		isoDirectoryRecord([]byte{0}, root.jolietSector, isoSectorSize, true, now, nil), now))
+	copy(at(terminatorSector), append([]byte{255}, []byte("CD001\x01")...))
+	copy(at(pathTableLSector), isoPathTable(primaryDirs, false, binary.LittleEndian))
+	copy(at(pathTableMSector), isoPathTable(primaryDirs, false, binary.BigEndian))
+	copy(at(jPathTableLSector), isoPathTable(jolietDirs, true, binary.LittleEndian))
+	copy(at(jPathTableMSector), isoPathTable(jolietDirs, true, binary.BigEndian))
+	for _, file := range layoutFiles {
+		copy(at(file.sector), file.data)
+	}
+
+	_, err := w.Write(image)
+	return err
+}
+
+// add adds a file to the directory tree starting at `root`, creating its
+// parent directories when needed
+func (root *isoEntry) add(file isoFile) (*isoEntry, error) {
+	components := strings.Split(file.Name, "/")
+	if len(components) >= isoMaxDepth {
+		return nil, fmt.Errorf("ISO file '%s' is nested too deep: up to %d levels of directories are supported", file.Name, isoMaxDepth-1)
+	}
+
+	dir := root
+	for i, name := range components {
+		// Joliet allows up to 64 characters
+		if name == "" || name == "." || name == ".." || len(name) > 64 || strings.Contains(name, ";") {
+			return nil, fmt.Errorf("Invalid name for an ISO file: '%s'", file.Name)
+		}
+		last := i == len(components)-1
+
+		var existing *isoEntry
+		for _, child := range dir.children {
+			if child.name == name {
+				existing = child
+			}
+		}
+		if existing != nil {
+			if last || !existing.dir {
+				return nil, fmt.Errorf("ISO file '%s' conflicts with another file", file.Name)
+			}
+			dir = existing
+			continue
+		}
+
+		entry := &isoEntry{name: name, dir: !last, parent: dir}
+		if last {
+			entry.primaryName = isoPrimaryName(name)
+			entry.data = file.Data
+		} else {
+			entry.primaryName = isoPrimaryDirName(name)
+		}
+		for _, child := range dir.children {
+			if child.primaryName == entry.primaryName {
+				return nil, fmt.Errorf("ISO files '%s' and '%s' have the same ISO9660 name '%s'", child.name, name, entry.primaryName)
+			}
+		}
+		dir.children = append(dir.children, entry)
+		dir = entry
+	}
+	return dir, nil
+}
+
+// isoSortedChildren returns the entries of a directory in the order they are
+// recorded: by their primary names, or by their Joliet names when `joliet` is set
+func isoSortedChildren(dir *isoEntry, joliet bool) []*isoEntry {
+	children := append([]*isoEntry(nil), dir.children...)
+	sort.Slice(children, func(i, j int) bool {
+		return bytes.Compare(isoIdentifier(children[i], joliet), isoIdentifier(children[j], joliet)) < 0
+	})
+	return children
+}
+
+// isoDirectories returns all the directories in the path table order: level
+// by level, sorted by parent and name
+func isoDirectories(root *isoEntry, joliet bool) []*isoEntry {
+	dirs := []*isoEntry{root}
+	for i := 0; i < len(dirs); i++ {
+		for _, child := range isoSortedChildren(dirs[i], joliet) {
+			if child.dir {
+				dirs = append(dirs, child)
+			}
+		}
+	}
+	return dirs
+}
+
+// isoIdentifier returns the name of an entry as recorded in the primary or
+// Joliet directories
+func isoIdentifier(entry *isoEntry, joliet bool) []byte {
+	if entry.parent == entry {
+		return []byte{0}
+	}
+	if joliet {
+		return isoUCS2(entry.name)
+	}
+	return []byte(entry.primaryName)
+}
+
+// isoSectors returns the number of sectors needed to hold `size` bytes
+func isoSectors(size int) uint32 {
+	return uint32((size + isoSectorSize - 1) / isoSectorSize)
+}
+
+// isoPrimaryName mangles a file name to the 8.3 uppercase d-characters
+// allowed by ISO9660 level 1, the same way mkisofs does (eg. "user-data"
+// becomes "USER_DAT.;1")
+func isoPrimaryName(name string) string {
+	base, ext := name, ""
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		base, ext = name[:i], name[i+1:]
+	}
+	return isoMangle(base, 8) + "." + isoMangle(ext, 3) + ";1"
+}
+
+// isoPrimaryDirName mangles a directory name to the 8 uppercase d-characters
+// allowed by ISO9660 level 1 (eg. "openstack" becomes "OPENSTAC")
+func isoPrimaryDirName(name string) string {
+	return isoMangle(name, 8)
+}
+
+// isoMangle uppercases `s`, replaces the characters that aren't d-characters
+// with "_" and truncates it to `limit` characters
+func isoMangle(s string, limit int) string {
+	var mangled []byte
+	for _, c := range strings.ToUpper(s) {
+		if len(mangled) == limit {
+			break
+		}
+		if (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' {
+			mangled = append(mangled, byte(c))
+		} else {
+			mangled = append(mangled, '_')
+		}
+	}
+	return string(mangled)
+}
+
+// isoUCS2 encodes a string as the big endian UCS-2 used by Joliet
+func isoUCS2(s string) []byte {
+	encoded := utf16.Encode([]rune(s))
+	buf := make([]byte, 2*len(encoded))
+	for i, c := range encoded {
+		binary.BigEndian.PutUint16(buf[2*i:], c)
+	}
+	return buf
+}
+
+// isoBothEndian32 encodes a value in the both-byte orders format of ISO9660
+func isoBothEndian32(v uint32) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint32(buf, v)
+	binary.BigEndian.PutUint32(buf[4:], v)
+	return buf
+}
+
+func isoBothEndian16(v uint16) []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint16(buf, v)
+	binary.BigEndian.PutUint16(buf[2:], v)
+	return buf
+}
+
+// isoDirectoryRecord encodes a directory record (ECMA-119 9.1)
+func isoDirectoryRecord(id []byte, sector uint32, size uint32, dir bool, t time.Time, systemUse []byte) []byte {
+	length := 33 + len(id)
+	if len(id)%2 == 0 {
+		length++
+	}
+	// the system use area is padded so records have an even length
+	if len(systemUse)%2 == 1 {
+		systemUse = append(systemUse, 0)
+	}
+	length += len(systemUse)
+
+	var flags byte
+	if dir {
+		flags = 2
+	}
+
+	t = t.UTC()
+	record := []byte{byte(length), 0}
+	record = append(record, isoBothEndian32(sector)...)
+	record = append(record, isoBothEndian32(size)...)
+	record = append(record,
+		byte(t.Year()-1900), byte(t.Month()), byte(t.Day()),
+		byte(t.Hour()), byte(t.Minute()), byte(t.Second()), 0)
+	record = append(record, flags, 0, 0)
+	record = append(record, isoBothEndian16(1)...)
+	record = append(record, byte(len(id)))
+	record = append(record, id...)
+	if len(id)%2 == 0 {
+		record = append(record, 0)
+	}
+	return append(record, systemUse...)
+}
+
+// isoDirectory encodes the records of a directory in a single sector
+func isoDirectory(dir *isoEntry, joliet bool, t time.Time) ([]byte, error) {
+	sector := func(entry *isoEntry) uint32 {
+		if joliet && entry.dir {
+			return entry.jolietSector
+		}
+		return entry.sector
+	}
+	systemUse := func(entries ...[]byte) []byte {
+		if joliet {
+			return nil
+		}
+		var all []byte
+		for _, entry := range entries {
+			all = append(all, entry...)
+		}
+		return all
+	}
+
+	self := isoRockRidgePX(true)
+	if dir.parent == dir {
+		self = isoRockRidgeRootEntries()
+	}
+	records := isoDirectoryRecord([]byte{0}, sector(dir), isoSectorSize, true, t, systemUse(self))
+	records = append(records, isoDirectoryRecord([]byte{1}, sector(dir.parent), isoSectorSize, true, t,
+		systemUse(isoRockRidgePX(true)))...)
+	for _, child := range isoSortedChildren(dir, joliet) {
+		size := uint32(len(child.data))
+		if child.dir {
+			size = isoSectorSize
+		}
+		records = append(records, isoDirectoryRecord(isoIdentifier(child, joliet), sector(child), size, child.dir, t,
+			systemUse(isoRockRidgePX(child.dir), isoRockRidgeNM(child.name)))...)
+	}
+
+	if len(records) > isoSectorSize {
+		return nil, fmt.Errorf("Too many files for an ISO image: the directory takes %d bytes, only %d are supported", len(records), isoSectorSize)
+	}
+	return records, nil
+}
+
+// isoPathTable encodes a path table holding `dirs`, which must be in the
+// order returned by isoDirectories
+func isoPathTable(dirs []*isoEntry, joliet bool, order binary.ByteOrder) []byte {
+	numbers := make(map[*isoEntry]int)
+	var table []byte
+	for i, dir := range dirs {
+		numbers[dir] = i + 1
+
+		sector := dir.sector
+		if joliet {
+			sector = dir.jolietSector
+		}
+		id := isoIdentifier(dir, joliet)
+		entry := make([]byte, 8+len(id)+len(id)%2)
+		entry[0] = byte(len(id))
+		order.PutUint32(entry[2:], sector)
+		order.PutUint16(entry[6:], uint16(numbers[dir.parent]))
+		copy(entry[8:], id)
+		table = append(table, entry...)
+	}
+	return table
+}
+
+// isoDateTime encodes a date in the volume descriptor format (ECMA-119 8.4.26.1)
+func isoDateTime(t time.Time) []byte {
+	return append([]byte(t.UTC().Format("20060102150405")+"00"), 0)
+}
+
+// isoVolumeDescriptor encodes the primary volume descriptor or, when `joliet`
+// is set, the supplementary one with the Joliet UCS-2 escape sequence
+func isoVolumeDescriptor(joliet bool, volumeID string, totalSectors uint32, pathTableSize uint32,
+	pathTableL uint32, pathTableM uint32, rootRecord []byte, t time.Time) []byte {
+	vd := make([]byte, isoSectorSize)
+
+	text := func(offset int, length int, s string) {
+		if joliet {
+			encoded := isoUCS2(s)
+			for i := 0; i < length; i += 2 {
+				vd[offset+i], vd[offset+i+1] = 0, ' '
+			}
+			copy(vd[offset:offset+length], encoded)
+			return
+		}
+		copy(vd[offset:offset+length], fmt.Sprintf("%-*s", length, s))
+	}
+
+	vd[0] = 1
+	if joliet {
+		vd[0] = 2
+	}
+	copy(vd[1:], "CD001")
+	vd[6] = 1
+	text(8, 32, "")
+	text(40, 32, volumeID)
+	copy(vd[80:], isoBothEndian32(totalSectors))
+	if joliet {
+		// UCS-2 level 3
+		copy(vd[88:], "%/E")
+	}
+	copy(vd[120:], isoBothEndian16(1))
+	copy(vd[124:], isoBothEndian16(1))
+	copy(vd[128:], isoBothEndian16(isoSectorSize))
+	copy(vd[132:], isoBothEndian32(pathTableSize))
+	binary.LittleEndian.PutUint32(vd[140:], pathTableL)
+	binary.BigEndian.PutUint32(vd[148:], pathTableM)
+	copy(vd[156:], rootRecord)
+	text(190, 128, "")
+	text(318, 128, "")
+	text(446, 128, "")
+	text(574, 128, "")
+	text(702, 36, "")
+	text(739, 36, "")
+	text(776, 36, "")
+	copy(vd[813:], isoDateTime(t))
+	copy(vd[830:], isoDateTime(t))
+	copy(vd[847:], "0000000000000000")
+	copy(vd[864:], "0000000000000000")
+	vd[881] = 1
+	return vd
+}
+
+// isoRockRidgeRootEntries returns the System Use Sharing Protocol entries
+// marking the image as using the Rock Ridge extensions, recorded in the "."
+// entry of the root directory
+func isoRockRidgeRootEntries() []byte {
+	const (
+		id          = "RRIP_1991A"
+		description = "THE ROCK RIDGE INTERCHANGE PROTOCOL PROVIDES SUPPORT FOR POSIX FILE SYSTEM SEMANTICS"
+		source      = "PLEASE CONTACT DISC PUBLISHER FOR SPECIFICATION SOURCE."
+	)
+	entries := []byte{'S', 'P', 7, 1, 0xBE, 0xEF, 0}
+	entries = append(entries, isoRockRidgePX(true)...)
+	entries = append(entries, 'E', 'R', byte(8+len(id)+len(description)+len(source)), 1,
+		byte(len(id)), byte(len(description)), byte(len(source)), 1)
+	entries = append(entries, id...)
+	entries = append(entries, description...)
+	return append(entries, source...)
+}
+
+// isoRockRidgePX returns the POSIX attributes of a file or directory
+func isoRockRidgePX(dir bool) []byte {
+	mode, links := uint32(0100444), uint32(1)
+	if dir {
+		mode, links = 040555, 2
+	}
+	entry := []byte{'P', 'X', 36, 1}
+	entry = append(entry, isoBothEndian32(mode)...)
+	entry = append(entry, isoBothEndian32(links)...)
+	entry = append(entry, isoBothEndian32(0)...) // uid
+	return append(entry, isoBothEndian32(0)...)  // gid
+}
+
+// isoRockRidgeNM returns the alternate (POSIX) name of a file
+func isoRockRidgeNM(name string) []byte {
+	return append([]byte{'N', 'M', byte(5 + len(name)), 1, 0}, name...)
+}
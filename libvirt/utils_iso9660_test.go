@@ -0,0 +1,156 @@
+package libvirt
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/hooklift/iso9660"
+)
+
+func TestISOPrimaryName(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{"user-data", "USER_DAT.;1"},
+		{"network-config", "NETWORK_.;1"},
+		{"config.ign", "CONFIG.IGN;1"},
+		{"archive.tar.gz", "ARCHIVE_.GZ;1"},
+	}
+	for _, tc := range testCases {
+		if r := isoPrimaryName(tc.name); r != tc.expected {
+			t.Errorf("%s: got=%s expected=%s", tc.name, r, tc.expected)
+		}
+	}
+}
+
+func TestWriteISO9660(t *testing.T) {
+	files := map[string][]byte{
+		"/user_dat.": []byte("#cloud-config\n"),
+		"/meta_dat.": bytes.Repeat([]byte("x"), 3*isoSectorSize+1),
+		"/network_.": {},
+	}
+
+	var buf bytes.Buffer
+	err := writeISO9660(&buf, "cidata", []isoFile{
+		{Name: "user-data", Data: files["/user_dat."]},
+		{Name: "meta-data", Data: files["/meta_dat."]},
+		{Name: "network-config", Data: files["/network_."]},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len()%isoSectorSize != 0 {
+		t.Errorf("ISO image size %d is not a multiple of the sector size", buf.Len())
+	}
+
+	reader, err := iso9660.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := 0
+	for {
+		file, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(file.Sys().(io.Reader))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, ok := files[file.Name()]
+		if !ok {
+			t.Errorf("Unexpected file %s", file.Name())
+			continue
+		}
+		if !bytes.Equal(data, expected) {
+			t.Errorf("Unexpected contents for %s", file.Name())
+		}
+		found++
+	}
+	if found != len(files) {
+		t.Errorf("Expected %d files, found %d", len(files), found)
+	}
+}
+
+func TestWriteISO9660Directories(t *testing.T) {
+	files := map[string][]byte{
+		"/openstac/latest/meta_dat.jso": []byte("{}"),
+		"/openstac/latest/user_dat.":    []byte("#cloud-config\n"),
+		"/openstac/content/0000.":       []byte("data"),
+		"/readme.txt":                   []byte("hello"),
+	}
+
+	var buf bytes.Buffer
+	err := writeISO9660(&buf, "config-2", []isoFile{
+		{Name: "openstack/latest/meta_data.json", Data: files["/openstac/latest/meta_dat.jso"]},
+		{Name: "openstack/latest/user_data", Data: files["/openstac/latest/user_dat."]},
+		{Name: "openstack/content/0000", Data: files["/openstac/content/0000."]},
+		{Name: "readme.txt", Data: files["/readme.txt"]},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := iso9660.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := 0
+	for {
+		file, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.IsDir() {
+			continue
+		}
+		data, err := ioutil.ReadAll(file.Sys().(io.Reader))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, ok := files[file.Name()]
+		if !ok {
+			t.Errorf("Unexpected file %s", file.Name())
+			continue
+		}
+		if !bytes.Equal(data, expected) {
+			t.Errorf("Unexpected contents for %s", file.Name())
+		}
+		found++
+	}
+	if found != len(files) {
+		t.Errorf("Expected %d files, found %d", len(files), found)
+	}
+}
+
+func TestWriteISO9660InvalidFiles(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeISO9660(&buf, "cidata", []isoFile{
+		{Name: "user-data-1"},
+		{Name: "user-data-2"},
+	})
+	if err == nil {
+		t.Errorf("Expected an error for files with the same ISO9660 name")
+	}
+
+	if err := writeISO9660(&buf, "cidata", []isoFile{{Name: "a//b"}}); err == nil {
+		t.Errorf("Expected an error for a file name with an empty directory")
+	}
+
+	if err := writeISO9660(&buf, "cidata", []isoFile{{Name: "a"}, {Name: "a/b"}}); err == nil {
+		t.Errorf("Expected an error for a file used as a directory")
+	}
+
+	if err := writeISO9660(&buf, "a-volume-id-way-too-long", nil); err == nil {
+		t.Errorf("Expected an error for a long volume id")
+	}
+}
@@ -95,3 +95,13 @@ func TestWaitForSuccessBrokenFunction(t *testing.T) {
 		t.Error("expected error")
 	}
 }
+
+func TestValidateStringInSlice(t *testing.T) {
+	validate := validateStringInSlice([]string{"qemu", "vhost"})
+	if _, errs := validate("vhost", "driver"); len(errs) != 0 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+	if _, errs := validate("vhost-user", "driver"); len(errs) != 1 {
+		t.Errorf("expected an error, got %v", errs)
+	}
+}
@@ -380,3 +380,173 @@ func lookupVolumeReallyHard(client *Client, volPoolName string, key string) (*li
 	}
 	return volume, nil
 }
+
+// volumePathForKey returns the path of the volume with the key, or the key
+// itself when the volume can't be found: the keys of the volumes of
+// directory pools are their paths
+func volumePathForKey(virConn *libvirt.Connect, key string) string {
+	volume, err := virConn.LookupStorageVolByKey(key)
+	if err != nil {
+		return key
+	}
+	defer volume.Free()
+
+	path, err := volume.GetPath()
+	if err != nil {
+		return key
+	}
+	return path
+}
+
+// resizeVolume grows the volume identified by `key` to `size` bytes.
+// Shrinking a volume is refused, as it would destroy the data at its end.
+// A volume used by running domains is grown by them when
+// `resizeRunningDomains` is set, and refused otherwise, as resizing it
+// behind the back of the hypervisor could corrupt the image.
+func resizeVolume(client *Client, key string, size uint64, resizeRunningDomains bool) error {
+	volume, err := client.libvirt.LookupStorageVolByKey(key)
+	if err != nil {
+		return fmt.Errorf("Can't retrieve volume %s: %v", key, err)
+	}
+	defer volume.Free()
+
+	volPool, err := volume.LookupPoolByVolume()
+	if err != nil {
+		return fmt.Errorf("Error retrieving pool for volume: %s", err)
+	}
+	defer volPool.Free()
+
+	poolName, err := volPool.GetName()
+	if err != nil {
+		return fmt.Errorf("Error retrieving name of volume: %s", err)
+	}
+
+	client.poolMutexKV.Lock(poolName)
+	defer client.poolMutexKV.Unlock(poolName)
+
+	info, err := volume.GetInfo()
+	if err != nil {
+		return fmt.Errorf("Error retrieving info for volume %s: %s", key, err)
+	}
+
+	if size < info.Capacity {
+		return fmt.Errorf("Can't shrink volume %s from %d to %d bytes: only growing a volume is supported", key, info.Capacity, size)
+	}
+	if size == info.Capacity {
+		return nil
+	}
+
+	resized, err := blockResizeVolumeInDomains(client, volume, size, resizeRunningDomains)
+	if err != nil {
+		return err
+	}
+	if resized {
+		return nil
+	}
+
+	log.Printf("[INFO] Resizing volume %s from %d to %d bytes", key, info.Capacity, size)
+	if err := volume.Resize(size, 0); err != nil {
+		return fmt.Errorf("Error resizing volume %s: %s", key, err)
+	}
+
+	return nil
+}
+
+// domainDiskTargetsForPath returns the target devices of the disks of the
+// domain backed by the file or block device at `path`. The disks given by a
+// pool and a volume name are matched on the path `volumePath` resolves them to.
+func domainDiskTargetsForPath(domainDef libvirtxml.Domain, path string, volumePath func(pool, volume string) (string, error)) []string {
+	var targets []string
+	if domainDef.Devices == nil {
+		return targets
+	}
+
+	for _, disk := range domainDef.Devices.Disks {
+		if disk.Source == nil || disk.Target == nil {
+			continue
+		}
+		diskPath := ""
+		switch {
+		case disk.Source.File != nil:
+			diskPath = disk.Source.File.File
+		case disk.Source.Block != nil:
+			diskPath = disk.Source.Block.Dev
+		case disk.Source.Volume != nil:
+			resolved, err := volumePath(disk.Source.Volume.Pool, disk.Source.Volume.Volume)
+			if err != nil {
+				log.Printf("[WARN] Can't resolve volume %s of pool %s used by disk %s of domain %s: %s",
+					disk.Source.Volume.Volume, disk.Source.Volume.Pool, disk.Target.Dev, domainDef.Name, err)
+				continue
+			}
+			diskPath = resolved
+		}
+		if diskPath != "" && diskPath == path {
+			targets = append(targets, disk.Target.Dev)
+		}
+	}
+	return targets
+}
+
+// lookupVolumePath returns the path of the volume `name` in the pool `poolName`
+func lookupVolumePath(virConn *libvirt.Connect, poolName, name string) (string, error) {
+	pool, err := virConn.LookupStoragePoolByName(poolName)
+	if err != nil {
+		return "", fmt.Errorf("Can't find storage pool '%s': %s", poolName, err)
+	}
+	defer pool.Free()
+
+	volume, err := pool.LookupStorageVolByName(name)
+	if err != nil {
+		return "", fmt.Errorf("Can't find volume '%s' in pool '%s': %s", name, poolName, err)
+	}
+	defer volume.Free()
+
+	return volume.GetPath()
+}
+
+// blockResizeVolumeInDomains resizes to `size` bytes the disks of the running
+// domains using `volume`, and returns whether any disk was resized. Unless
+// `resize` is set, a volume used by a running domain is an error.
+func blockResizeVolumeInDomains(client *Client, volume *libvirt.StorageVol, size uint64, resize bool) (bool, error) {
+	path, err := volume.GetPath()
+	if err != nil {
+		return false, fmt.Errorf("Error retrieving path of volume: %s", err)
+	}
+
+	domains, err := client.libvirt.ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE)
+	if err != nil {
+		return false, fmt.Errorf("Error listing libvirt domains: %s", err)
+	}
+	defer func() {
+		for _, domain := range domains {
+			domain.Free()
+		}
+	}()
+
+	volumePath := func(pool, volume string) (string, error) {
+		return lookupVolumePath(client.libvirt, pool, volume)
+	}
+
+	resized := false
+	for i := range domains {
+		domain := &domains[i]
+		domainDef, err := getXMLDomainDefFromLibvirt(domain)
+		if err != nil {
+			return resized, err
+		}
+
+		for _, target := range domainDiskTargetsForPath(domainDef, path, volumePath) {
+			if !resize {
+				return false, fmt.Errorf("Can't resize volume %s used by disk %s of the running domain %s: "+
+					"set resize_running_domains to grow it through the domain, or stop the domain", path, target, domainDef.Name)
+			}
+			log.Printf("[INFO] Resizing disk %s of domain %s to %d bytes", target, domainDef.Name, size)
+			if err := domain.BlockResize(target, size, libvirt.DOMAIN_BLOCK_RESIZE_BYTES); err != nil {
+				return resized, fmt.Errorf("Error resizing disk %s of domain %s: %s", target, domainDef.Name, err)
+			}
+			resized = true
+		}
+	}
+
+	return resized, nil
+}
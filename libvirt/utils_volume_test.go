@@ -218,3 +218,61 @@ func TestTimeFromEpoch(t *testing.T) {
 		t.Fatalf("expected timestamp '123.456', got %v.%v", ts.Unix(), ts.Nanosecond())
 	}
 }
+
+func TestDomainDiskTargetsForPath(t *testing.T) {
+	domainDef := newDomainDef()
+	domainDef.Devices.Disks = []libvirtxml.DomainDisk{
+		{
+			Source: &libvirtxml.DomainDiskSource{
+				File: &libvirtxml.DomainDiskSourceFile{File: "/var/lib/libvirt/images/a.qcow2"},
+			},
+			Target: &libvirtxml.DomainDiskTarget{Dev: "vda"},
+		},
+		{
+			Source: &libvirtxml.DomainDiskSource{
+				Block: &libvirtxml.DomainDiskSourceBlock{Dev: "/dev/vg/b"},
+			},
+			Target: &libvirtxml.DomainDiskTarget{Dev: "vdb"},
+		},
+		{
+			Source: &libvirtxml.DomainDiskSource{
+				Volume: &libvirtxml.DomainDiskSourceVolume{Pool: "default", Volume: "c.qcow2"},
+			},
+			Target: &libvirtxml.DomainDiskTarget{Dev: "vdc"},
+		},
+		{
+			Source: &libvirtxml.DomainDiskSource{
+				Volume: &libvirtxml.DomainDiskSourceVolume{Pool: "missing", Volume: "d.qcow2"},
+			},
+			Target: &libvirtxml.DomainDiskTarget{Dev: "vdd"},
+		},
+		{
+			Target: &libvirtxml.DomainDiskTarget{Dev: "hda"},
+		},
+	}
+	volumePath := func(pool, volume string) (string, error) {
+		if pool != "default" {
+			return "", fmt.Errorf("no pool %s", pool)
+		}
+		return "/var/lib/libvirt/images/" + volume, nil
+	}
+
+	targets := domainDiskTargetsForPath(domainDef, "/var/lib/libvirt/images/a.qcow2", volumePath)
+	if len(targets) != 1 || targets[0] != "vda" {
+		t.Errorf("Expected [vda], got %v", targets)
+	}
+
+	targets = domainDiskTargetsForPath(domainDef, "/dev/vg/b", volumePath)
+	if len(targets) != 1 || targets[0] != "vdb" {
+		t.Errorf("Expected [vdb], got %v", targets)
+	}
+
+	targets = domainDiskTargetsForPath(domainDef, "/var/lib/libvirt/images/c.qcow2", volumePath)
+	if len(targets) != 1 || targets[0] != "vdc" {
+		t.Errorf("Expected [vdc], got %v", targets)
+	}
+
+	if targets = domainDiskTargetsForPath(domainDef, "/nowhere", volumePath); len(targets) != 0 {
+		t.Errorf("Expected no targets, got %v", targets)
+	}
+}
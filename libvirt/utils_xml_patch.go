@@ -0,0 +1,85 @@
+package libvirt
+
+import (
+	"fmt"
+
+	"github.com/dmacvicar/terraform-provider-libvirt/libvirt/internal/xslt"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// xmlPatchNamespaces are the prefixes paths can use for the namespaces of
+// libvirt, even when the definition doesn't declare them
+var xmlPatchNamespaces = map[string]string{
+	"qemu": "http://libvirt.org/schemas/domain/qemu/1.0",
+}
+
+// xmlPatchSchema returns the schema of the patches of the xml block, a
+// declarative alternative to XSLT for the common changes
+func xmlPatchSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		ForceNew: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"action": {
+					Type:         schema.TypeString,
+					Required:     true,
+					ForceNew:     true,
+					ValidateFunc: validateXMLPatchAction,
+				},
+				"path": {
+					Type:         schema.TypeString,
+					Required:     true,
+					ForceNew:     true,
+					ValidateFunc: validateXMLPatchPath,
+				},
+				"value": {
+					Type:     schema.TypeString,
+					Optional: true,
+					ForceNew: true,
+				},
+			},
+		},
+	}
+}
+
+func validateXMLPatchAction(v interface{}, k string) ([]string, []error) {
+	switch action := v.(string); action {
+	case "set", "append", "remove":
+		return nil, nil
+	default:
+		return nil, []error{fmt.Errorf("%q must be one of set, append or remove, got %q", k, action)}
+	}
+}
+
+func validateXMLPatchPath(v interface{}, k string) ([]string, []error) {
+	if err := xslt.CompileXPath(v.(string)); err != nil {
+		return nil, []error{fmt.Errorf("%q: %s", k, err)}
+	}
+	return nil, nil
+}
+
+// getXMLPatchesFromResource returns the patches of the xml block, in order
+func getXMLPatchesFromResource(d *schema.ResourceData) ([]xslt.Patch, error) {
+	var patches []xslt.Patch
+	count, _ := d.Get("xml.0.patch.#").(int)
+	for i := 0; i < count; i++ {
+		prefix := fmt.Sprintf("xml.0.patch.%d", i)
+		patch := xslt.Patch{
+			Action: d.Get(prefix + ".action").(string),
+			Path:   d.Get(prefix + ".path").(string),
+			Value:  d.Get(prefix + ".value").(string),
+		}
+		if patch.Action == "append" && patch.Value == "" {
+			return nil, fmt.Errorf("the patch appending to %q requires a value", patch.Path)
+		}
+		patches = append(patches, patch)
+	}
+	return patches, nil
+}
+
+// patchXML applies the patches to the xml data, one after the other
+func patchXML(xml string, patches []xslt.Patch) (string, error) {
+	return xslt.ApplyPatches(xml, patches, xmlPatchNamespaces)
+}
@@ -0,0 +1,100 @@
+package libvirt
+
+import (
+	"testing"
+
+	"github.com/dmacvicar/terraform-provider-libvirt/libvirt/internal/xslt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchXML(t *testing.T) {
+	const inXML = `<domain type="kvm">
+  <devices>
+    <disk device="cdrom"><target dev="hda" bus="ide"/></disk>
+    <interface type="network"><model type="virtio"/></interface>
+    <graphics type="spice"/>
+  </devices>
+</domain>`
+	const outXML = `<domain type="kvm">
+  <devices>
+    <disk device="cdrom"><target dev="hda" bus="sata"/><readonly/></disk>
+    <interface type="network"><model type="virtio"/><driver name="vhost" queues="4"/></interface>
+    
+  </devices>
+<description>patched</description><commandline xmlns="http://libvirt.org/schemas/domain/qemu/1.0">` +
+		`<qemu:arg xmlns:qemu="http://libvirt.org/schemas/domain/qemu/1.0" value="-snapshot"/></commandline></domain>`
+
+	result, err := patchXML(inXML, []xslt.Patch{
+		{Action: "set", Path: "/domain/devices/disk[@device='cdrom']/target/@bus", Value: "sata"},
+		{Action: "append", Path: "//disk[@device='cdrom']", Value: "<readonly/>"},
+		{Action: "append", Path: "//interface", Value: `<driver name="vhost"/>`},
+		// missing attributes are added
+		{Action: "set", Path: "//interface/driver/@queues", Value: "4"},
+		{Action: "remove", Path: "/domain/devices/graphics"},
+		// removing missing nodes is not an error
+		{Action: "remove", Path: "/domain/devices/video"},
+		{Action: "append", Path: "domain", Value: "<description/>"},
+		{Action: "set", Path: "domain/description", Value: "patched"},
+		{Action: "append", Path: "/domain", Value: `<commandline xmlns="http://libvirt.org/schemas/domain/qemu/1.0"/>`},
+		// the qemu prefix is known even if the document doesn't declare it
+		{Action: "append", Path: "/domain/qemu:commandline", Value: `<qemu:arg value="-snapshot" xmlns:qemu="http://libvirt.org/schemas/domain/qemu/1.0"/>`},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, outXML, result)
+
+	noop, err := patchXML(inXML, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, inXML, noop)
+}
+
+func TestPatchXMLErrors(t *testing.T) {
+	const inXML = `<domain type="kvm"><devices/></domain>`
+	for _, patch := range []xslt.Patch{
+		{Action: "set", Path: "/domain/vcpu", Value: "2"},
+		{Action: "set", Path: "/domain/vcpu/@placement", Value: "static"},
+		{Action: "append", Path: "/domain/os", Value: "<type>hvm</type>"},
+		{Action: "append", Path: "/domain/@type", Value: "<type>hvm</type>"},
+		{Action: "append", Path: "/domain/devices", Value: "<disk>"},
+		{Action: "remove", Path: "/domain"},
+		{Action: "remove", Path: "/domain/foo:bar"},
+		{Action: "set", Path: "/domain[", Value: "x"},
+	} {
+		result, err := patchXML(inXML, []xslt.Patch{patch})
+		assert.NotNil(t, err, patch.Path)
+		assert.Equal(t, inXML, result)
+	}
+}
+
+func TestGetXMLPatchesFromResource(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceLibvirtDomain().Schema, map[string]interface{}{
+		"name": "patched",
+		"xml": []interface{}{
+			map[string]interface{}{
+				"patch": []interface{}{
+					map[string]interface{}{
+						"action": "set",
+						"path":   "/domain/devices/interface/model/@type",
+						"value":  "e1000",
+					},
+					map[string]interface{}{
+						"action": "remove",
+						"path":   "/domain/devices/graphics",
+					},
+				},
+			},
+		},
+	})
+
+	patches, err := getXMLPatchesFromResource(d)
+	assert.Nil(t, err)
+	assert.Equal(t, []xslt.Patch{
+		{Action: "set", Path: "/domain/devices/interface/model/@type", Value: "e1000"},
+		{Action: "remove", Path: "/domain/devices/graphics"},
+	}, patches)
+
+	_, errs := validateXMLPatchAction("replace", "xml.0.patch.0.action")
+	assert.Len(t, errs, 1)
+	_, errs = validateXMLPatchPath("/domain/[", "xml.0.patch.0.path")
+	assert.Len(t, errs, 1)
+}
@@ -1,12 +1,11 @@
 package libvirt
 
 import (
-	"io/ioutil"
+	"fmt"
 	"log"
-	"os"
-	"os/exec"
 	"strings"
 
+	"github.com/dmacvicar/terraform-provider-libvirt/libvirt/internal/xslt"
 	"github.com/hashicorp/terraform/helper/schema"
 )
 
@@ -44,65 +43,57 @@ func xsltDiffSupressFunc(k, old, new string, d *schema.ResourceData) bool {
 	return oldStrip == newStrip
 }
 
-// this function applies a XSLT transform to the xml data
-func transformXML(xml string, xslt string) (string, error) {
-	// empty xslt is a no-op
-	if strings.TrimSpace(xslt) == "" {
-		return xml, nil
+// validateXSLT checks that a stylesheet is valid and only uses the features
+// the provider supports, so that it doesn't fail when applying the plan
+func validateXSLT(v interface{}, k string) ([]string, []error) {
+	value := v.(string)
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
 	}
-
-	xsltFile, err := ioutil.TempFile("", "terraform-provider-libvirt-xslt")
+	stylesheet, err := xslt.Parse(value)
 	if err != nil {
-		log.Fatal(err)
+		return nil, []error{fmt.Errorf("%q is not a valid XSLT stylesheet: %s", k, err)}
 	}
-	defer os.Remove(xsltFile.Name()) // clean up
-
-	// we trim the xslt as it may contain space before the xml declaration
-	// because of HCL heredoc
-	if _, err := xsltFile.Write([]byte(strings.TrimSpace(xslt))); err != nil {
-		log.Fatal(err)
+	if unsupported := stylesheet.Unsupported(); len(unsupported) > 0 {
+		return nil, []error{fmt.Errorf("%q uses XSLT features which are not supported: %s",
+			k, strings.Join(unsupported, ", "))}
 	}
+	return nil, nil
+}
 
-	if err := xsltFile.Close(); err != nil {
-		log.Fatal(err)
+// this function applies a XSLT transform to the xml data
+func transformXML(xml string, stylesheetXML string) (string, error) {
+	// empty xslt is a no-op
+	if strings.TrimSpace(stylesheetXML) == "" {
+		return xml, nil
 	}
 
-	xmlFile, err := ioutil.TempFile("", "terraform-provider-libvirt-xml")
+	stylesheet, err := xslt.Parse(stylesheetXML)
 	if err != nil {
-		log.Fatal(err)
-	}
-	defer os.Remove(xmlFile.Name()) // clean up
-
-	if _, err := xmlFile.Write([]byte(xml)); err != nil {
-		log.Fatal(err)
-	}
-
-	if err := xmlFile.Close(); err != nil {
-		log.Fatal(err)
+		return xml, err
 	}
-
-	cmd := exec.Command("xsltproc",
-		"--nomkdir",
-		"--nonet",
-		"--nowrite",
-		xsltFile.Name(),
-		xmlFile.Name())
-	transformedXML, err := cmd.Output()
+	transformedXML, err := stylesheet.Transform(xml)
 	if err != nil {
 		return xml, err
 	}
 	log.Printf("[DEBUG] Transformed XML with user specified XSLT:\n%s", transformedXML)
-	return string(transformedXML), nil
+	return transformedXML, nil
 }
 
-// this function applies a XSLT transform to the xml data
-// and is to be reused in all resource types
-// your resource need to have a xml.xslt element in the schema
+// this function applies the XSLT transform and the patches of the xml
+// block to the xml data, and is to be reused in all resource types
+// your resource need to have a xml element in the schema
 func transformResourceXML(xml string, d *schema.ResourceData) (string, error) {
-	xslt, ok := d.GetOk("xml.0.xslt")
-	if !ok {
-		return xml, nil
+	if stylesheet, ok := d.GetOk("xml.0.xslt"); ok {
+		var err error
+		if xml, err = transformXML(xml, stylesheet.(string)); err != nil {
+			return xml, err
+		}
 	}
 
-	return transformXML(xml, xslt.(string))
+	patches, err := getXMLPatchesFromResource(d)
+	if err != nil {
+		return xml, err
+	}
+	return patchXML(xml, patches)
 }
@@ -53,3 +53,28 @@ func TestXSLTDiffSupressFunc(t *testing.T) {
 
 	assert.True(t, xsltDiffSupressFunc("K", inXML, outXML, &schema.ResourceData{}))
 }
+
+func TestTransformXMLErrors(t *testing.T) {
+	const inXML = "<books><book format=\"paper\"/></books>"
+	for _, xslt := range []string{
+		`<books/>`,
+		`<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform"><xsl:import href="other.xsl"/></xsl:stylesheet>`,
+	} {
+		result, err := transformXML(inXML, xslt)
+		assert.NotNil(t, err, xslt)
+		assert.Equal(t, inXML, result)
+	}
+}
+
+func TestValidateXSLT(t *testing.T) {
+	_, errs := validateXSLT("<books/>", "xml.0.xslt")
+	assert.Len(t, errs, 1)
+	warnings, errs := validateXSLT(identitySpaceStripXSLT, "xml.0.xslt")
+	assert.Empty(t, warnings)
+	assert.Empty(t, errs)
+
+	// unsupported features are rejected when planning
+	warnings, errs = validateXSLT(`<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform"><xsl:include href="other.xsl"/></xsl:stylesheet>`, "xml.0.xslt")
+	assert.Empty(t, warnings)
+	assert.Len(t, errs, 1)
+}